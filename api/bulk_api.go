@@ -0,0 +1,304 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"github.com/gofiber/fiber/v2"
+	"simpler-go-home-test/data_layer"
+)
+
+// Bulk insert modes
+const (
+	// BulkAllOrNothing inserts nothing unless every product is valid, and then inserts them in one transaction
+	BulkAllOrNothing = "all_or_nothing"
+
+	// BulkBestEffort inserts the valid products, one transaction per batch, and reports the others
+	BulkBestEffort = "best_effort"
+)
+
+// NDJSONContentType is newline-delimited JSON: one product object per line
+const NDJSONContentType = "application/x-ndjson"
+
+// Outcome of every item of a bulk insert
+const (
+	bulkInserted = "inserted"
+	bulkRejected = "rejected"
+	bulkSkipped  = "skipped"
+)
+
+// BulkItemResult reports what happened to the item at Index of a bulk request
+type BulkItemResult struct {
+	Index     int    `json:"index"`
+	Status    string `json:"status"`
+	ProductID uint   `json:"product_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// BulkInsertProducts answers POST /v1/products/bulk. The body is a JSON array of products, or NDJSON
+// with one product per line; every product is validated like a single insert. ?mode= selects
+// all_or_nothing (the default) or best_effort.
+func (products_api *ProductsAPI) BulkInsertProducts(c *fiber.Ctx) error {
+
+	mode := c.Query("mode", BulkAllOrNothing)
+
+	if mode != BulkAllOrNothing && mode != BulkBestEffort {
+
+		log.Printf("Invalid bulk mode %q", mode)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid mode. Must be all_or_nothing or best_effort"})
+	}
+
+	items, err := bulkItems(c)
+
+	if errors.Is(err, errUnsupportedBulkContentType) {
+
+		log.Printf("Unsupported bulk content type %q", c.Get(fiber.HeaderContentType))
+
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"Error": "Unsupported content type. Send a JSON array as application/json or one product per line as " + NDJSONContentType})
+	}
+
+	if err != nil {
+
+		log.Printf("Cannot parse bulk request: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Cannot parse JSON: " + err.Error()})
+	}
+
+	if len(items) == 0 {
+
+		log.Printf("Empty bulk request")
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "No products to insert"})
+	}
+
+	log.Printf("Attempting to insert %d products in bulk (%s)", len(items), mode)
+
+	results := make([]BulkItemResult, len(items))
+
+	var valid []int
+
+	var products []data_layer.Product
+
+	for i, item := range items {
+
+		results[i] = BulkItemResult{Index: i, Status: bulkSkipped}
+
+		product, err := bulkProduct(item)
+
+		if err != nil {
+
+			results[i].Status = bulkRejected
+
+			results[i].Error = err.Error()
+
+			continue
+		}
+
+		valid = append(valid, i)
+
+		products = append(products, product)
+	}
+
+	if mode == BulkAllOrNothing {
+
+		if len(valid) < len(items) {
+
+			log.Printf("Bulk insert refused: %d of %d products are invalid", len(items)-len(valid), len(items))
+
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(bulkResponse(mode, results))
+		}
+
+		ids, err := products_api.products.InsertProducts(products)
+
+		if errors.Is(err, data_layer.ErrDuplicateProduct) {
+
+			log.Printf("Bulk insert refused: %v", err)
+
+			// The others stay skipped; a conflict raced in by another writer names no product
+			var duplicate *data_layer.DuplicateProductError
+
+			if errors.As(err, &duplicate) {
+
+				results[valid[duplicate.Index]].Status = bulkRejected
+
+				results[valid[duplicate.Index]].Error = "Product conflict: " + err.Error()
+			}
+
+			return c.Status(fiber.StatusConflict).JSON(bulkResponse(mode, results))
+		}
+
+		if err != nil {
+
+			log.Printf("Failed to insert products in bulk: %v", err)
+
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to insert products at the products database"})
+		}
+
+		for i, productID := range ids {
+
+			results[i].Status = bulkInserted
+
+			results[i].ProductID = productID
+		}
+
+	} else {
+
+		products_api.insertBestEffort(products, valid, results)
+	}
+
+	response := bulkResponse(mode, results)
+
+	log.Printf("Bulk insert done: %d inserted, %d rejected", response["inserted"], response["rejected"])
+
+	return c.JSON(response)
+}
+
+// insertBestEffort inserts the products batch by batch. A batch the database refuses is retried one product
+// at a time, so that only the offending products are rejected.
+func (products_api *ProductsAPI) insertBestEffort(products []data_layer.Product, indexes []int, results []BulkItemResult) {
+
+	for start := 0; start < len(products); start += data_layer.InsertBatchSize {
+
+		end := min(start+data_layer.InsertBatchSize, len(products))
+
+		ids, err := products_api.products.InsertProducts(products[start:end])
+
+		if err == nil {
+
+			for i, productID := range ids {
+
+				results[indexes[start+i]].Status = bulkInserted
+
+				results[indexes[start+i]].ProductID = productID
+			}
+
+			continue
+		}
+
+		log.Printf("Failed to insert a batch of %d products, retrying them one by one: %v", end-start, err)
+
+		for i := start; i < end; i++ {
+
+			ids, err := products_api.products.InsertProducts(products[i : i+1])
+
+			if err != nil {
+
+				log.Printf("Failed to insert product %q: %v", products[i].Name, err)
+
+				results[indexes[i]].Status = bulkRejected
+
+				results[indexes[i]].Error = "Failed to insert product at the products database"
+
+				if errors.Is(err, data_layer.ErrDuplicateProduct) {
+
+					results[indexes[i]].Error = "Product conflict: " + err.Error()
+				}
+
+				continue
+			}
+
+			results[indexes[i]].Status = bulkInserted
+
+			results[indexes[i]].ProductID = ids[0]
+		}
+	}
+}
+
+var errUnsupportedBulkContentType = errors.New("unsupported content type")
+
+// bulkItems splits the body into the raw JSON of every product
+func bulkItems(c *fiber.Ctx) ([]json.RawMessage, error) {
+
+	mediaType, _, err := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+
+	if err != nil {
+
+		return nil, errUnsupportedBulkContentType
+	}
+
+	switch mediaType {
+
+	case fiber.MIMEApplicationJSON:
+
+		var items []json.RawMessage
+
+		err = json.Unmarshal(c.Body(), &items)
+
+		if err != nil {
+
+			return nil, fmt.Errorf("expected a JSON array of products")
+		}
+
+		return items, nil
+
+	case NDJSONContentType, "application/jsonl":
+
+		var items []json.RawMessage
+
+		for _, line := range bytes.Split(c.Body(), []byte("\n")) {
+
+			line = bytes.TrimSpace(line)
+
+			if len(line) > 0 {
+
+				items = append(items, json.RawMessage(line))
+			}
+		}
+
+		return items, nil
+	}
+
+	return nil, errUnsupportedBulkContentType
+}
+
+// bulkProduct decodes and validates one item with the rules of a single insert
+func bulkProduct(item json.RawMessage) (data_layer.Product, error) {
+
+	product := data_layer.Product{}
+
+	err := json.Unmarshal(item, &product)
+
+	if err != nil {
+
+		return product, fmt.Errorf("Cannot parse JSON: %v", err)
+	}
+
+	if product.Currency == "" {
+
+		product.Currency = data_layer.DefaultCurrency
+	}
+
+	err = validateProduct(&product)
+
+	if err != nil {
+
+		return product, fmt.Errorf("Invalid product data for insertion: %v", err)
+	}
+
+	return product, nil
+}
+
+func bulkResponse(mode string, results []BulkItemResult) fiber.Map {
+
+	inserted, rejected := 0, 0
+
+	for _, result := range results {
+
+		switch result.Status {
+
+		case bulkInserted:
+
+			inserted++
+
+		case bulkRejected:
+
+			rejected++
+		}
+	}
+
+	return fiber.Map{"mode": mode, "inserted": inserted, "rejected": rejected, "results": results}
+}
@@ -0,0 +1,379 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"simpler-go-home-test/data_layer"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxCategoryNameLength is the size of the categories.name column
+const MaxCategoryNameLength = 100
+
+type CategoryRequest struct {
+	Name     string `json:"name"`
+	ParentID *uint  `json:"parent_id"`
+}
+
+type CategoryResponse struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	ParentID  *uint     `json:"parent_id"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CategoryNodeResponse is a category of GET /v1/categories/tree
+type CategoryNodeResponse struct {
+	CategoryResponse
+	ProductCount      int                    `json:"product_count"`
+	TotalProductCount int                    `json:"total_product_count"`
+	Children          []CategoryNodeResponse `json:"children"`
+}
+
+func newCategoryResponse(category data_layer.Category) CategoryResponse {
+
+	return CategoryResponse{ID: category.ID, Name: category.Name, ParentID: category.ParentID, Path: category.Path, CreatedAt: category.CreatedAt, UpdatedAt: category.UpdatedAt}
+}
+
+func newCategoryNodeResponses(nodes []*data_layer.CategoryNode) []CategoryNodeResponse {
+
+	responses := make([]CategoryNodeResponse, 0, len(nodes))
+
+	for _, node := range nodes {
+
+		responses = append(responses, CategoryNodeResponse{
+			CategoryResponse:  newCategoryResponse(node.Category),
+			ProductCount:      node.ProductCount,
+			TotalProductCount: node.TotalProductCount,
+			Children:          newCategoryNodeResponses(node.Children),
+		})
+	}
+
+	return responses
+}
+
+// parseCategoryRequest reads and validates the body of the category create and replace calls
+func parseCategoryRequest(c *fiber.Ctx) (CategoryRequest, error) {
+
+	requestBody := CategoryRequest{}
+
+	err := c.BodyParser(&requestBody)
+
+	if err != nil {
+
+		return requestBody, fmt.Errorf("Cannot parse JSON")
+	}
+
+	requestBody.Name = strings.TrimSpace(requestBody.Name)
+
+	if requestBody.Name == "" || len(requestBody.Name) > MaxCategoryNameLength {
+
+		return requestBody, fmt.Errorf("Invalid category: name must be non-empty and at most %d bytes long", MaxCategoryNameLength)
+	}
+
+	if requestBody.ParentID != nil && *requestBody.ParentID == 0 {
+
+		return requestBody, fmt.Errorf("Invalid category: parent_id must be a category ID, or null for a root category")
+	}
+
+	return requestBody, nil
+}
+
+func categoryID(c *fiber.Ctx, param string) (uint, error) {
+
+	id, err := strconv.ParseUint(c.Params(param), 10, 64)
+
+	if err != nil || id == 0 {
+
+		return 0, fmt.Errorf("invalid category ID %q", c.Params(param))
+	}
+
+	return uint(id), nil
+}
+
+// categoryError answers the errors of the category calls that are not server failures
+func categoryError(c *fiber.Ctx, err error, notFound string) error {
+
+	switch {
+
+	case errors.Is(err, gorm.ErrRecordNotFound):
+
+		log.Printf("%s: %v", notFound, err)
+
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": notFound})
+
+	case errors.Is(err, data_layer.ErrDuplicateCategory), errors.Is(err, data_layer.ErrCategoryCycle), errors.Is(err, data_layer.ErrCategoryNotEmpty):
+
+		log.Printf("Category conflict: %v", err)
+
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"Error": strings.ToUpper(err.Error()[:1]) + err.Error()[1:]})
+	}
+
+	log.Printf("Failed to access categories: %v", err)
+
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to access categories in the products database"})
+}
+
+// CreateCategory answers POST /v1/categories with 201 Created, the new category and its Location
+func (products_api *ProductsAPI) CreateCategory(c *fiber.Ctx) error {
+
+	requestBody, err := parseCategoryRequest(c)
+
+	if err != nil {
+
+		log.Printf("%v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": err.Error()})
+	}
+
+	log.Printf("Attempting to create category %q", requestBody.Name)
+
+	category, err := products_api.products.CreateCategory(requestBody.Name, requestBody.ParentID)
+
+	if err != nil {
+
+		return categoryError(c, err, "Parent category not found")
+	}
+
+	c.Location(fmt.Sprintf("/v1/categories/%d", category.ID))
+
+	return c.Status(fiber.StatusCreated).JSON(newCategoryResponse(category))
+}
+
+// RetrieveCategories answers GET /v1/categories with every category, parents before their children
+func (products_api *ProductsAPI) RetrieveCategories(c *fiber.Ctx) error {
+
+	categories, err := products_api.products.RetrieveCategories()
+
+	if err != nil {
+
+		return categoryError(c, err, "Category not found")
+	}
+
+	responses := make([]CategoryResponse, 0, len(categories))
+
+	for _, category := range categories {
+
+		responses = append(responses, newCategoryResponse(category))
+	}
+
+	return c.JSON(fiber.Map{"categories": responses})
+}
+
+// RetrieveCategoryTree answers GET /v1/categories/tree with the nested categories and their product counts.
+// Like the product list, only active products are counted unless ?admin=true.
+func (products_api *ProductsAPI) RetrieveCategoryTree(c *fiber.Ctx) error {
+
+	admin, err := boolQuery(c, "admin")
+
+	if err != nil {
+
+		log.Printf("Invalid admin flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid admin flag. Must be true or false"})
+	}
+
+	tree, err := products_api.products.RetrieveCategoryTree(visibleStatuses(admin))
+
+	if err != nil {
+
+		return categoryError(c, err, "Category not found")
+	}
+
+	return c.JSON(fiber.Map{"categories": newCategoryNodeResponses(tree)})
+}
+
+func (products_api *ProductsAPI) RetrieveCategory(c *fiber.Ctx) error {
+
+	id, err := categoryID(c, "id")
+
+	if err != nil {
+
+		log.Printf("Invalid category ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid category ID. Please provide a valid ID"})
+	}
+
+	category, err := products_api.products.RetrieveCategory(id)
+
+	if err != nil {
+
+		return categoryError(c, err, "Category not found")
+	}
+
+	return c.JSON(newCategoryResponse(category))
+}
+
+// ReplaceCategory answers PUT /v1/categories/:id: the name and the parent are replaced, moving the whole subtree
+func (products_api *ProductsAPI) ReplaceCategory(c *fiber.Ctx) error {
+
+	id, err := categoryID(c, "id")
+
+	if err != nil {
+
+		log.Printf("Invalid category ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid category ID. Please provide a valid ID"})
+	}
+
+	requestBody, err := parseCategoryRequest(c)
+
+	if err != nil {
+
+		log.Printf("%v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": err.Error()})
+	}
+
+	log.Printf("Attempting to update category with ID %d", id)
+
+	err = products_api.products.UpdateCategory(id, requestBody.Name, requestBody.ParentID)
+
+	if err != nil {
+
+		return categoryError(c, err, "Category or parent category not found")
+	}
+
+	category, err := products_api.products.RetrieveCategory(id)
+
+	if err != nil {
+
+		return categoryError(c, err, "Category not found")
+	}
+
+	return c.JSON(newCategoryResponse(category))
+}
+
+// DeleteCategory answers DELETE /v1/categories/:id. Its products are unassigned; categories with subcategories are refused.
+func (products_api *ProductsAPI) DeleteCategory(c *fiber.Ctx) error {
+
+	id, err := categoryID(c, "id")
+
+	if err != nil {
+
+		log.Printf("Invalid category ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid category ID. Please provide a valid ID"})
+	}
+
+	log.Printf("Attempting to delete category with ID %d", id)
+
+	err = products_api.products.DeleteCategory(id)
+
+	if err != nil {
+
+		return categoryError(c, err, "Category not found")
+	}
+
+	return c.JSON(fiber.Map{"message": "Category deleted successfully", "category_id": id})
+}
+
+// RetrieveProductCategories answers GET /v1/products/:id/categories
+func (products_api *ProductsAPI) RetrieveProductCategories(c *fiber.Ctx) error {
+
+	productID, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+
+		log.Printf("Invalid product ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product ID. Please provide a valid ID"})
+	}
+
+	admin, err := boolQuery(c, "admin")
+
+	if err != nil {
+
+		log.Printf("Invalid admin flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid admin flag. Must be true or false"})
+	}
+
+	_, err = products_api.retrieveVisibleProduct(productID, admin)
+
+	if err != nil {
+
+		return categoryError(c, err, "Product not found")
+	}
+
+	categories, err := products_api.products.RetrieveProductCategories(productID)
+
+	if err != nil {
+
+		return categoryError(c, err, "Product not found")
+	}
+
+	responses := make([]CategoryResponse, 0, len(categories))
+
+	for _, category := range categories {
+
+		responses = append(responses, newCategoryResponse(category))
+	}
+
+	return c.JSON(fiber.Map{"product_id": productID, "categories": responses})
+}
+
+// AssignProductCategory answers PUT /v1/products/:id/categories/:category_id
+func (products_api *ProductsAPI) AssignProductCategory(c *fiber.Ctx) error {
+
+	return products_api.changeProductCategory(c, true)
+}
+
+// UnassignProductCategory answers DELETE /v1/products/:id/categories/:category_id
+func (products_api *ProductsAPI) UnassignProductCategory(c *fiber.Ctx) error {
+
+	return products_api.changeProductCategory(c, false)
+}
+
+func (products_api *ProductsAPI) changeProductCategory(c *fiber.Ctx, assign bool) error {
+
+	productID, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+
+		log.Printf("Invalid product ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product ID. Please provide a valid ID"})
+	}
+
+	id, err := categoryID(c, "category_id")
+
+	if err != nil {
+
+		log.Printf("Invalid category ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid category ID. Please provide a valid ID"})
+	}
+
+	if assign {
+
+		log.Printf("Attempting to assign product with ID %d to category %d", productID, id)
+
+		err = products_api.products.AssignProductCategory(productID, id)
+
+		if err != nil {
+
+			return categoryError(c, err, "Product or category not found")
+		}
+
+		return c.JSON(fiber.Map{"message": "Product assigned to category successfully", "product_id": productID, "category_id": id})
+	}
+
+	log.Printf("Attempting to unassign product with ID %d from category %d", productID, id)
+
+	err = products_api.products.UnassignProductCategory(productID, id)
+
+	if err != nil {
+
+		return categoryError(c, err, "Product is not assigned to this category")
+	}
+
+	return c.JSON(fiber.Map{"message": "Product unassigned from category successfully", "product_id": productID, "category_id": id})
+}
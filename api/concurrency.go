@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"simpler-go-home-test/data_layer"
+	"strconv"
+	"strings"
+)
+
+// productETag is the strong entity tag of a product version, e.g. "3"
+func productETag(version uint) string {
+
+	return strconv.Quote(strconv.FormatUint(uint64(version), 10))
+}
+
+// ifMatchVersion reads the product version expected by the If-Match header.
+// No header or "*" means any version; weak tags never match a write, so they are refused.
+func ifMatchVersion(c *fiber.Ctx) (uint, error) {
+
+	ifMatch := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+
+	if ifMatch == "" || ifMatch == "*" {
+
+		return data_layer.AnyVersion, nil
+	}
+
+	unquoted, err := strconv.Unquote(ifMatch)
+
+	if err != nil || !strings.HasPrefix(ifMatch, `"`) {
+
+		return 0, fmt.Errorf("expected a single strong ETag such as \"3\", got %s", ifMatch)
+	}
+
+	version, err := strconv.ParseUint(unquoted, 10, 32)
+
+	if err != nil || version == 0 {
+
+		return 0, fmt.Errorf("%s is not an ETag of this API", ifMatch)
+	}
+
+	return uint(version), nil
+}
+
+// versionConflict answers a write whose If-Match no longer matches the stored product
+func versionConflict(c *fiber.Ctx, err error) error {
+
+	log.Printf("Precondition failed: %v", err)
+
+	var conflict *data_layer.VersionConflictError
+
+	if errors.As(err, &conflict) {
+
+		c.Set(fiber.HeaderETag, productETag(conflict.CurrentVersion))
+
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{"Error": "Product was modified since it was retrieved. Retrieve it again and retry", "current_version": conflict.CurrentVersion})
+	}
+
+	return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{"Error": "Product was modified since it was retrieved. Retrieve it again and retry"})
+}
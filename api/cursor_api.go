@@ -0,0 +1,113 @@
+package api
+
+import (
+	"log"
+	"github.com/gofiber/fiber/v2"
+	"simpler-go-home-test/data_layer"
+)
+
+// retrieveCursorPage answers the page of products next to the ?cursor= position (keyset pagination).
+// The cursor carries its sort, so later pages stay stable while products are inserted or deleted.
+func (products_api *ProductsAPI) retrieveCursorPage(c *fiber.Ctx, filter data_layer.ProductFilter, productSort data_layer.ProductSort, limit int, currency string) error {
+
+	cursor, err := data_layer.DecodeProductCursor(c.Query("cursor"))
+
+	if err != nil {
+
+		log.Printf("Invalid cursor: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid cursor. Please send back a next_cursor or prev_cursor of a previous page"})
+	}
+
+	if c.Query("sort") != "" && productSort.String() != cursor.Sort.String() {
+
+		log.Printf("Cursor sorted by %q requested with sort %q", cursor.Sort, productSort)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid cursor. The cursor was issued for sort=" + cursor.Sort.String()})
+	}
+
+	log.Printf("Attempting to retrieve products with cursor: sort = %q, backward = %t, limit = %d", cursor.Sort, cursor.Backward, limit)
+
+	// One extra product tells whether another page follows in the reading direction
+	products, err := products_api.products.RetrieveProductsWithCursor(filter, cursor, limit+1)
+
+	if err != nil {
+
+		log.Printf("Failed to retrieve products with cursor: %v", err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to retrieve products with pagination"})
+	}
+
+	more := len(products) > limit
+
+	if more && cursor.Backward {
+
+		products = products[1:]
+
+	} else if more {
+
+		products = products[:limit]
+	}
+
+	total_number_of_products, err := products_api.products.GetTotalNumberOfProducts(filter)
+
+	if err != nil {
+
+		log.Printf("Failed to retrieve total number of products: %v", err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to retrieve total number of products"})
+	}
+
+	var paginatedResponse []ProductResponse
+
+	for _, product := range products {
+
+		paginatedResponse = append(paginatedResponse, newProductResponse(product))
+	}
+
+	err = products_api.priceInCurrency(paginatedResponse, currency)
+
+	if err != nil {
+
+		return currencyConversionError(c, currency, err)
+	}
+
+	metadata := fiber.Map{"limit": limit, "total_number_of_products": total_number_of_products}
+
+	// The cursor product itself lies on the other side, so that side always has a page
+	if cursor.Backward {
+
+		setPageCursors(metadata, cursor.Sort, products, more, true)
+
+	} else {
+
+		setPageCursors(metadata, cursor.Sort, products, true, more)
+	}
+
+	log.Printf("Successfully retrieved %d products with cursor", len(paginatedResponse))
+
+	return c.JSON(fiber.Map{"metadata": metadata, "products": paginatedResponse})
+}
+
+// setPageCursors adds the next_cursor and prev_cursor of a page to its metadata, null when there is no such page
+func setPageCursors(metadata fiber.Map, productSort data_layer.ProductSort, products []data_layer.Product, hasPrev bool, hasNext bool) {
+
+	metadata["prev_cursor"] = nil
+
+	metadata["next_cursor"] = nil
+
+	if len(products) == 0 {
+
+		return
+	}
+
+	if hasPrev {
+
+		metadata["prev_cursor"] = data_layer.NewProductCursor(productSort, products[0], true).Encode()
+	}
+
+	if hasNext {
+
+		metadata["next_cursor"] = data_layer.NewProductCursor(productSort, products[len(products)-1], false).Encode()
+	}
+}
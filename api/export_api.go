@@ -0,0 +1,299 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"simpler-go-home-test/data_layer"
+	"strconv"
+	"time"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Export formats
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+	ExportJSON   = "json"
+)
+
+// exportFlushEvery is how many products are buffered before they are sent to the client
+const exportFlushEvery = 100
+
+// exportColumns is the CSV header: the fields of ProductResponse. Columns added later go last, so that the
+// position of the others does not change.
+var exportColumns = []string{"id", "name", "price", "currency", "created_at", "updated_at", "deleted_at", "version", "sku", "gtin", "status", "publish_at", "unpublish_at"}
+
+var exportContentTypes = map[string]string{
+	ExportCSV:    "text/csv; charset=utf-8",
+	ExportNDJSON: NDJSONContentType,
+	ExportJSON:   fiber.MIMEApplicationJSONCharsetUTF8,
+}
+
+// ExportProducts answers GET /v1/products/export. It streams every product matching the list query parameters,
+// in ProductResponse shape, as ?format=json (the default), ndjson or csv, and compresses the file with ?gzip=true.
+// As with the list, only active products are exported unless ?admin=true.
+// Products are read one at a time from a database cursor and written as they come.
+func (products_api *ProductsAPI) ExportProducts(c *fiber.Ctx) error {
+
+	format := c.Query("format", ExportJSON)
+
+	contentType, found := exportContentTypes[format]
+
+	if !found {
+
+		log.Printf("Invalid export format %q", format)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid format. Must be csv, ndjson or json"})
+	}
+
+	compress, err := boolQuery(c, "gzip")
+
+	if err != nil {
+
+		log.Printf("Invalid gzip flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid gzip flag. Must be true or false"})
+	}
+
+	includeDeleted, err := boolQuery(c, "include_deleted")
+
+	if err != nil {
+
+		log.Printf("Invalid include_deleted flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid include_deleted flag. Must be true or false"})
+	}
+
+	admin, err := boolQuery(c, "admin")
+
+	if err != nil {
+
+		log.Printf("Invalid admin flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid admin flag. Must be true or false"})
+	}
+
+	filter, productSort, err := parseListQuery(c, data_layer.ProductFilter{IncludeDeleted: includeDeleted, Statuses: visibleStatuses(admin)})
+
+	if err != nil {
+
+		log.Printf("Invalid list query: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid list query: " + err.Error()})
+	}
+
+	// Counting first also fails early, before the headers are sent, when the database is unavailable
+	total, err := products_api.products.GetTotalNumberOfProducts(filter)
+
+	if err != nil {
+
+		log.Printf("Failed to retrieve total number of products: %v", err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to retrieve total number of products"})
+	}
+
+	filename := fmt.Sprintf("products-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+
+	if compress {
+
+		contentType = "application/gzip"
+
+		filename += ".gz"
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	c.Set("X-Total-Count", strconv.FormatInt(total, 10))
+
+	log.Printf("Exporting %d products as %s (gzip: %t)", total, format, compress)
+
+	products := products_api.products
+
+	c.Context().SetBodyStreamWriter(func(stream *bufio.Writer) {
+
+		var output io.Writer = stream
+
+		if compress {
+
+			compressed := gzip.NewWriter(stream)
+
+			defer compressed.Close()
+
+			output = compressed
+		}
+
+		exported, err := exportProducts(products, filter, productSort, format, output, stream)
+
+		if err != nil {
+
+			// The status is already sent: the client gets a truncated file
+			log.Printf("Export interrupted after %d products: %v", exported, err)
+
+			return
+		}
+
+		log.Printf("Exported %d products as %s", exported, format)
+	})
+
+	return nil
+}
+
+// exportProducts writes the products to output in format and flushes stream every exportFlushEvery products
+func exportProducts(products data_layer.Repository, filter data_layer.ProductFilter, productSort data_layer.ProductSort, format string, output io.Writer, stream *bufio.Writer) (int, error) {
+
+	exported := 0
+
+	csvWriter := csv.NewWriter(output)
+
+	var err error
+
+	switch format {
+
+	case ExportCSV:
+
+		err = csvWriter.Write(exportColumns)
+
+	case ExportJSON:
+
+		_, err = io.WriteString(output, "[")
+	}
+
+	if err != nil {
+
+		return exported, err
+	}
+
+	err = products.StreamProducts(filter, productSort, func(product data_layer.Product) error {
+
+		response := newProductResponse(product)
+
+		var err error
+
+		switch format {
+
+		case ExportCSV:
+
+			err = csvWriter.Write(exportRecord(response))
+
+		case ExportNDJSON:
+
+			err = writeJSONLine(output, response, "", "\n")
+
+		case ExportJSON:
+
+			separator := ","
+
+			if exported == 0 {
+
+				separator = ""
+			}
+
+			err = writeJSONLine(output, response, separator, "")
+		}
+
+		if err != nil {
+
+			return err
+		}
+
+		exported++
+
+		if exported%exportFlushEvery == 0 {
+
+			csvWriter.Flush()
+
+			return stream.Flush()
+		}
+
+		return nil
+	})
+
+	if err != nil {
+
+		return exported, err
+	}
+
+	if format == ExportJSON {
+
+		_, err = io.WriteString(output, "]\n")
+	}
+
+	csvWriter.Flush()
+
+	if err == nil {
+
+		err = csvWriter.Error()
+	}
+
+	return exported, err
+}
+
+func writeJSONLine(output io.Writer, response ProductResponse, prefix string, suffix string) error {
+
+	data, err := json.Marshal(response)
+
+	if err != nil {
+
+		return err
+	}
+
+	_, err = io.WriteString(output, prefix+string(data)+suffix)
+
+	return err
+}
+
+// exportRecord is the CSV row of a product, with the values written as in JSON
+func exportRecord(response ProductResponse) []string {
+
+	deletedAt := ""
+
+	if response.DeletedAt != nil {
+
+		deletedAt = response.DeletedAt.Format(time.RFC3339Nano)
+	}
+
+	return []string{
+		strconv.FormatUint(uint64(response.ID), 10),
+		response.Name,
+		response.Price.String(),
+		response.Currency,
+		response.CreatedAt.Format(time.RFC3339Nano),
+		response.UpdatedAt.Format(time.RFC3339Nano),
+		deletedAt,
+		strconv.FormatUint(uint64(response.Version), 10),
+		optionalCell(response.SKU),
+		optionalCell(response.GTIN),
+		response.Status,
+		optionalTimeCell(response.PublishAt),
+		optionalTimeCell(response.UnpublishAt),
+	}
+}
+
+// optionalCell writes a missing value as an empty cell
+func optionalCell(value *string) string {
+
+	if value == nil {
+
+		return ""
+	}
+
+	return *value
+}
+
+// optionalTimeCell writes a missing timestamp as an empty cell
+func optionalTimeCell(value *time.Time) string {
+
+	if value == nil {
+
+		return ""
+	}
+
+	return value.Format(time.RFC3339Nano)
+}
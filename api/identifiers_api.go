@@ -0,0 +1,105 @@
+package api
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"simpler-go-home-test/data_layer"
+)
+
+// LookupProduct answers GET /v1/products/lookup?sku= or ?gtin=, finding a live product by exactly one of its identifiers.
+// The value is normalized like on insertion, so sku=abc-1 finds ABC-1 and gtin=4006381-333931 finds 4006381333931.
+// A SKU may also be the one of a variant: the answer is then its product, with the variant embedded as "variant".
+// As with retrieve-product, only active products are found unless ?admin=true.
+func (products_api *ProductsAPI) LookupProduct(c *fiber.Ctx) error {
+
+	sku, gtin := c.Query("sku"), c.Query("gtin")
+
+	if (sku == "") == (gtin == "") {
+
+		log.Printf("Invalid product lookup: sku %q, gtin %q", sku, gtin)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid lookup. Please provide either sku or gtin"})
+	}
+
+	admin, err := boolQuery(c, "admin")
+
+	if err != nil {
+
+		log.Printf("Invalid admin flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid admin flag. Must be true or false"})
+	}
+
+	var product data_layer.Product
+
+	var variant *data_layer.ProductVariant
+
+	if sku != "" {
+
+		log.Printf("Attempting to look up product with SKU %q", sku)
+
+		product, err = products_api.products.RetrieveProductBySKU(sku)
+
+		// Products and variants share the SKU namespace, so at most one of the two lookups finds it
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+
+			var found data_layer.ProductVariant
+
+			found, err = products_api.products.RetrieveProductVariantBySKU(sku)
+
+			if err == nil {
+
+				variant = &found
+
+				product, err = products_api.products.RetrieveProduct(int(found.ProductID), false)
+			}
+		}
+
+	} else {
+
+		log.Printf("Attempting to look up product with GTIN %q", gtin)
+
+		product, err = products_api.products.RetrieveProductByGTIN(gtin)
+	}
+
+	if errors.Is(err, data_layer.ErrInvalidSKU) || errors.Is(err, data_layer.ErrInvalidGTIN) {
+
+		log.Printf("Invalid product lookup: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid lookup: " + err.Error()})
+	}
+
+	if err == nil && !admin && product.Status != data_layer.StatusActive {
+
+		err = gorm.ErrRecordNotFound
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+
+		log.Printf("No product with SKU %q or GTIN %q", sku, gtin)
+
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": "Product not found"})
+	}
+
+	if err != nil {
+
+		log.Printf("Failed to look up product in the products database: %v", err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to retrieve product from the products database"})
+	}
+
+	c.Set(fiber.HeaderETag, productETag(product.Version))
+
+	productResponse := newProductResponse(product)
+
+	if variant != nil {
+
+		variantResponse := newVariantResponse(*variant, product)
+
+		productResponse.Variant = &variantResponse
+	}
+
+	return c.JSON(productResponse)
+}
@@ -0,0 +1,718 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"simpler-go-home-test/data_layer"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Keys a CSV import can upsert by
+const (
+	ImportKeyName = "name"
+	ImportKeyID   = "id"
+	ImportKeySKU  = "sku"
+)
+
+// ImportFields are the product fields a CSV column can be mapped to. publish_at and unpublish_at are read
+// as RFC 3339 timestamps, as exported.
+var ImportFields = []string{"id", "name", "price", "currency", "sku", "gtin", "status", "publish_at", "unpublish_at"}
+
+// Outcome of every row of a CSV import
+const (
+	importAccepted  = "accepted"
+	importUpdated   = "updated"
+	importUnchanged = "unchanged"
+	importRejected  = "rejected"
+)
+
+// CSVImportOptions tells ImportProductsCSV how to read a file. Mapping maps product fields to column headers;
+// the fields left out are read from the column of the same name, when there is one.
+type CSVImportOptions struct {
+	Key       string
+	Mapping   map[string]string
+	Delimiter rune
+}
+
+// ImportRowResult reports what happened to the data row at line Row of the file (the header is line 1)
+type ImportRowResult struct {
+	Row       int    `json:"row"`
+	Status    string `json:"status"`
+	ProductID uint   `json:"product_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ImportReport is the machine-readable outcome of a CSV import
+type ImportReport struct {
+	Key       string            `json:"key"`
+	Accepted  int               `json:"accepted"`
+	Updated   int               `json:"updated"`
+	Unchanged int               `json:"unchanged"`
+	Rejected  int               `json:"rejected"`
+	Rows      []ImportRowResult `json:"rows"`
+}
+
+// ParseColumnMapping reads a mapping written as "name=Product Title,price=Cost"
+func ParseColumnMapping(spec string) (map[string]string, error) {
+
+	mapping := make(map[string]string)
+
+	for _, entry := range strings.Split(spec, ",") {
+
+		if strings.TrimSpace(entry) == "" {
+
+			continue
+		}
+
+		field, column, found := strings.Cut(entry, "=")
+
+		field = strings.ToLower(strings.TrimSpace(field))
+
+		column = strings.TrimSpace(column)
+
+		if !found || column == "" {
+
+			return nil, fmt.Errorf("invalid column mapping %q: expected FIELD=COLUMN", entry)
+		}
+
+		if !isImportField(field) {
+
+			return nil, fmt.Errorf("unknown field %q: expected one of %s", field, strings.Join(ImportFields, ", "))
+		}
+
+		mapping[field] = column
+	}
+
+	return mapping, nil
+}
+
+func isImportField(field string) bool {
+
+	for _, known := range ImportFields {
+
+		if field == known {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// ImportProductsCSV validates every row of a CSV file like a single insert and upserts it by options.Key:
+// rows whose key matches a live product update its non-empty fields, the others insert a new product.
+// Rows are imported one by one, so a rejected row does not hold back the others. An error means the file
+// could not be imported at all, e.g. because of a bad header or mapping.
+func ImportProductsCSV(products data_layer.Repository, input io.Reader, options CSVImportOptions) (ImportReport, error) {
+
+	report := ImportReport{Key: options.Key, Rows: []ImportRowResult{}}
+
+	if options.Key == "" {
+
+		report.Key = ImportKeyName
+	}
+
+	if report.Key != ImportKeyName && report.Key != ImportKeyID && report.Key != ImportKeySKU {
+
+		return report, fmt.Errorf("invalid key %q: must be name, id or sku", options.Key)
+	}
+
+	reader := csv.NewReader(input)
+
+	reader.FieldsPerRecord = -1
+
+	reader.TrimLeadingSpace = true
+
+	if options.Delimiter != 0 {
+
+		reader.Comma = options.Delimiter
+	}
+
+	header, err := reader.Read()
+
+	if err == io.EOF {
+
+		return report, fmt.Errorf("the file is empty")
+	}
+
+	if err != nil {
+
+		return report, fmt.Errorf("cannot read the header: %v", err)
+	}
+
+	columns, err := importColumns(header, options.Mapping)
+
+	if err != nil {
+
+		return report, err
+	}
+
+	if _, found := columns[report.Key]; !found {
+
+		return report, fmt.Errorf("no column for the key field %q", report.Key)
+	}
+
+	for {
+
+		record, err := reader.Read()
+
+		if err == io.EOF {
+
+			break
+		}
+
+		result := ImportRowResult{}
+
+		var parseError *csv.ParseError
+
+		if errors.As(err, &parseError) {
+
+			result.Row = parseError.StartLine
+
+			result.Status, result.Error = importRejected, err.Error()
+
+		} else if err != nil {
+
+			return report, fmt.Errorf("cannot read the file: %v", err)
+
+		} else {
+
+			result.Row, _ = reader.FieldPos(0)
+
+			result.ProductID, result.Status, err = importRow(products, report.Key, columns, record)
+
+			if err != nil {
+
+				result.Error = err.Error()
+			}
+		}
+
+		switch result.Status {
+
+		case importAccepted:
+
+			report.Accepted++
+
+		case importUpdated:
+
+			report.Updated++
+
+		case importUnchanged:
+
+			report.Unchanged++
+
+		default:
+
+			report.Rejected++
+		}
+
+		report.Rows = append(report.Rows, result)
+	}
+
+	return report, nil
+}
+
+// importColumns finds the index of the column of every mapped field. Headers are compared case-insensitively.
+func importColumns(header []string, mapping map[string]string) (map[string]int, error) {
+
+	positions := make(map[string]int)
+
+	for i, name := range header {
+
+		// Spreadsheets often start their CSV exports with a byte order mark
+		if i == 0 {
+
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+
+		positions[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	columns := make(map[string]int)
+
+	for _, field := range ImportFields {
+
+		column, mapped := mapping[field]
+
+		if !mapped {
+
+			column = field
+		}
+
+		position, found := positions[strings.ToLower(column)]
+
+		if !found && mapped {
+
+			return nil, fmt.Errorf("the column %q mapped to %s is not in the header", column, field)
+		}
+
+		if found {
+
+			columns[field] = position
+		}
+	}
+
+	return columns, nil
+}
+
+// importRow upserts one record and returns the product it touched with the row status
+func importRow(products data_layer.Repository, key string, columns map[string]int, record []string) (uint, string, error) {
+
+	cells := make(map[string]string)
+
+	for field, position := range columns {
+
+		if position < len(record) {
+
+			cells[field] = strings.TrimSpace(record[position])
+		}
+	}
+
+	changes := data_layer.ProductChanges{}
+
+	if name := cells["name"]; name != "" {
+
+		changes.Name = &name
+	}
+
+	if cells["price"] != "" {
+
+		price, err := data_layer.ParseAmount(cells["price"])
+
+		if err != nil {
+
+			return 0, importRejected, err
+		}
+
+		changes.Price = &price
+	}
+
+	if currency := cells["currency"]; currency != "" {
+
+		changes.Currency = &currency
+	}
+
+	if sku := cells["sku"]; sku != "" {
+
+		changes.SKU = &sku
+	}
+
+	if gtin := cells["gtin"]; gtin != "" {
+
+		changes.GTIN = &gtin
+	}
+
+	if status := strings.ToLower(cells["status"]); status != "" {
+
+		changes.Status = &status
+	}
+
+	for _, field := range []string{"publish_at", "unpublish_at"} {
+
+		if cells[field] == "" {
+
+			continue
+		}
+
+		instant, err := time.Parse(time.RFC3339, cells[field])
+
+		if err != nil {
+
+			return 0, importRejected, fmt.Errorf("invalid %s %q: must be an RFC 3339 timestamp", field, cells[field])
+		}
+
+		if field == "publish_at" {
+
+			changes.PublishAt = &instant
+
+		} else {
+
+			changes.UnpublishAt = &instant
+		}
+	}
+
+	existing, found, err := findImportedProduct(products, key, cells[key])
+
+	if err != nil {
+
+		return 0, importRejected, err
+	}
+
+	if !found {
+
+		return insertImportedProduct(products, changes)
+	}
+
+	return updateImportedProduct(products, existing, changes)
+}
+
+// findImportedProduct looks up the live product a row is keyed to. Rows without a key value are new products.
+func findImportedProduct(products data_layer.Repository, key string, value string) (data_layer.Product, bool, error) {
+
+	if value == "" {
+
+		if key == ImportKeyName {
+
+			return data_layer.Product{}, false, fmt.Errorf("the name is empty")
+		}
+
+		return data_layer.Product{}, false, nil
+	}
+
+	if key == ImportKeySKU {
+
+		return findImportedProductBySKU(products, value)
+	}
+
+	filter := data_layer.ProductFilter{Names: []string{value}}
+
+	if key == ImportKeyID {
+
+		id, err := strconv.ParseUint(value, 10, 64)
+
+		if err != nil || id == 0 {
+
+			return data_layer.Product{}, false, fmt.Errorf("invalid id %q: must be a positive integer", value)
+		}
+
+		filter = data_layer.ProductFilter{IDs: []uint{uint(id)}}
+	}
+
+	matching, err := products.RetrieveProductsWithPagination(filter, nil, 0, 2)
+
+	if err != nil {
+
+		log.Printf("Failed to look up the product with %s %q: %v", key, value, err)
+
+		return data_layer.Product{}, false, fmt.Errorf("failed to look up the product in the products database")
+	}
+
+	if len(matching) > 1 {
+
+		return data_layer.Product{}, false, fmt.Errorf("several products are named %q", value)
+	}
+
+	if len(matching) == 0 && key == ImportKeyID {
+
+		return data_layer.Product{}, false, fmt.Errorf("no product with id %s: leave the id empty to insert a new product", value)
+	}
+
+	if len(matching) == 0 {
+
+		return data_layer.Product{}, false, nil
+	}
+
+	return matching[0], true, nil
+}
+
+// findImportedProductBySKU looks up the live product with the SKU of a row; an unknown SKU is a new product
+func findImportedProductBySKU(products data_layer.Repository, sku string) (data_layer.Product, bool, error) {
+
+	product, err := products.RetrieveProductBySKU(sku)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+
+		return data_layer.Product{}, false, nil
+	}
+
+	if errors.Is(err, data_layer.ErrInvalidSKU) {
+
+		return data_layer.Product{}, false, fmt.Errorf("invalid sku %q: %v", sku, err)
+	}
+
+	if err != nil {
+
+		log.Printf("Failed to look up the product with sku %q: %v", sku, err)
+
+		return data_layer.Product{}, false, fmt.Errorf("failed to look up the product in the products database")
+	}
+
+	return product, true, nil
+}
+
+func insertImportedProduct(products data_layer.Repository, changes data_layer.ProductChanges) (uint, string, error) {
+
+	product := data_layer.Product{Currency: data_layer.DefaultCurrency}
+
+	applyProductChanges(&product, changes)
+
+	err := validateProduct(&product)
+
+	if err != nil {
+
+		return 0, importRejected, fmt.Errorf("Invalid product data for insertion: %v", err)
+	}
+
+	ids, err := products.InsertProducts([]data_layer.Product{product})
+
+	if errors.Is(err, data_layer.ErrDuplicateProduct) {
+
+		return 0, importRejected, err
+	}
+
+	if err != nil {
+
+		log.Printf("Failed to insert imported product %q: %v", product.Name, err)
+
+		return 0, importRejected, fmt.Errorf("failed to insert product at the products database")
+	}
+
+	return ids[0], importAccepted, nil
+}
+
+// updateImportedProduct writes the fields of a row that differ from the stored product
+func updateImportedProduct(products data_layer.Repository, existing data_layer.Product, changes data_layer.ProductChanges) (uint, string, error) {
+
+	updated := existing
+
+	applyProductChanges(&updated, changes)
+
+	err := validateProduct(&updated)
+
+	if err != nil {
+
+		return existing.ID, importRejected, fmt.Errorf("Invalid product data for update: %v", err)
+	}
+
+	differences := data_layer.ProductChanges{}
+
+	if updated.Name != existing.Name {
+
+		differences.Name = &updated.Name
+	}
+
+	if updated.Price != existing.Price {
+
+		differences.Price = &updated.Price
+	}
+
+	if updated.Currency != existing.Currency {
+
+		differences.Currency = &updated.Currency
+	}
+
+	if !sameIdentifier(updated.SKU, existing.SKU) {
+
+		differences.SKU = identifierChange(updated.SKU)
+	}
+
+	if !sameIdentifier(updated.GTIN, existing.GTIN) {
+
+		differences.GTIN = identifierChange(updated.GTIN)
+	}
+
+	if updated.Status != existing.Status {
+
+		differences.Status = &updated.Status
+	}
+
+	if !sameInstant(updated.PublishAt, existing.PublishAt) {
+
+		differences.PublishAt = updated.PublishAt
+	}
+
+	if !sameInstant(updated.UnpublishAt, existing.UnpublishAt) {
+
+		differences.UnpublishAt = updated.UnpublishAt
+	}
+
+	if differences == (data_layer.ProductChanges{}) {
+
+		return existing.ID, importUnchanged, nil
+	}
+
+	err = products.UpdateProduct(int(existing.ID), differences, existing.Version)
+
+	if errors.Is(err, data_layer.ErrVersionConflict) {
+
+		return existing.ID, importRejected, fmt.Errorf("the product was modified during the import")
+	}
+
+	if errors.Is(err, data_layer.ErrDuplicateProduct) || errors.Is(err, data_layer.ErrStatusTransition) || errors.Is(err, data_layer.ErrInvalidSchedule) {
+
+		return existing.ID, importRejected, err
+	}
+
+	if err != nil {
+
+		log.Printf("Failed to update imported product with ID %d: %v", existing.ID, err)
+
+		return existing.ID, importRejected, fmt.Errorf("failed to update product in the products database")
+	}
+
+	return existing.ID, importUpdated, nil
+}
+
+func applyProductChanges(product *data_layer.Product, changes data_layer.ProductChanges) {
+
+	if changes.Name != nil {
+
+		product.Name = *changes.Name
+	}
+
+	if changes.Price != nil {
+
+		product.Price = *changes.Price
+	}
+
+	if changes.Currency != nil {
+
+		product.Currency = *changes.Currency
+	}
+
+	if changes.SKU != nil {
+
+		sku := *changes.SKU
+
+		product.SKU = &sku
+	}
+
+	if changes.GTIN != nil {
+
+		gtin := *changes.GTIN
+
+		product.GTIN = &gtin
+	}
+
+	if changes.Status != nil {
+
+		product.Status = *changes.Status
+	}
+
+	if changes.PublishAt != nil {
+
+		publishAt := *changes.PublishAt
+
+		product.PublishAt = &publishAt
+	}
+
+	if changes.UnpublishAt != nil {
+
+		unpublishAt := *changes.UnpublishAt
+
+		product.UnpublishAt = &unpublishAt
+	}
+}
+
+// ParseDelimiter reads a single-character CSV delimiter; "\t" and "tab" stand for a tab
+func ParseDelimiter(text string) (rune, error) {
+
+	if text == "" {
+
+		return ',', nil
+	}
+
+	if text == `\t` || text == "tab" {
+
+		return '\t', nil
+	}
+
+	delimiter, size := utf8.DecodeRuneInString(text)
+
+	if size != len(text) || delimiter == '"' || delimiter == '\r' || delimiter == '\n' || delimiter == utf8.RuneError {
+
+		return 0, fmt.Errorf("invalid delimiter %q: must be a single character other than a quote or a line break", text)
+	}
+
+	return delimiter, nil
+}
+
+var errUnsupportedImportContentType = errors.New("unsupported content type")
+
+// ImportProducts answers POST /v1/products/import. The body is a CSV file, sent as text/csv or as the "file"
+// field of a multipart form. ?key= picks the upsert key (name by default, id or sku), ?map= maps fields
+// to columns as in "name=Product Title,price=Cost" and ?delimiter= changes the separator.
+func (products_api *ProductsAPI) ImportProducts(c *fiber.Ctx) error {
+
+	options := CSVImportOptions{Key: c.Query("key", ImportKeyName)}
+
+	var err error
+
+	options.Mapping, err = ParseColumnMapping(c.Query("map"))
+
+	if err == nil {
+
+		options.Delimiter, err = ParseDelimiter(c.Query("delimiter"))
+	}
+
+	if err != nil {
+
+		log.Printf("Invalid CSV import options: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid CSV import: " + err.Error()})
+	}
+
+	input, err := importInput(c)
+
+	if errors.Is(err, errUnsupportedImportContentType) {
+
+		log.Printf("Unsupported import content type %q", c.Get(fiber.HeaderContentType))
+
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"Error": "Unsupported content type. Send the CSV file as text/csv or as the file field of a multipart/form-data form"})
+	}
+
+	if err != nil {
+
+		log.Printf("Cannot read the CSV file: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Cannot read the CSV file"})
+	}
+
+	defer input.Close()
+
+	log.Printf("Attempting to import products from CSV by %s", options.Key)
+
+	report, err := ImportProductsCSV(products_api.products, input, options)
+
+	if err != nil {
+
+		log.Printf("Invalid CSV import: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid CSV import: " + err.Error()})
+	}
+
+	log.Printf("CSV import done: %d accepted, %d updated, %d unchanged, %d rejected", report.Accepted, report.Updated, report.Unchanged, report.Rejected)
+
+	return c.JSON(report)
+}
+
+// importInput opens the CSV file of the request
+func importInput(c *fiber.Ctx) (io.ReadCloser, error) {
+
+	mediaType, _, err := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+
+	if err != nil {
+
+		return nil, errUnsupportedImportContentType
+	}
+
+	switch mediaType {
+
+	case "text/csv":
+
+		return io.NopCloser(bytes.NewReader(c.Body())), nil
+
+	case fiber.MIMEMultipartForm:
+
+		file, err := c.FormFile("file")
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		return file.Open()
+	}
+
+	return nil, errUnsupportedImportContentType
+}
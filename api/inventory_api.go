@@ -0,0 +1,463 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"simpler-go-home-test/data_layer"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultHoldTTL is how long a reservation holds its units when the request does not say
+	DefaultHoldTTL = 15 * time.Minute
+
+	// MaxHoldTTL bounds ttl_seconds, so forgotten reservations do not lock stock for good
+	MaxHoldTTL = 24 * time.Hour
+
+	// DefaultHoldSweepInterval is how often the server releases the expired holds
+	DefaultHoldSweepInterval = time.Minute
+)
+
+// The warehouse_id of the stock requests is optional: 0 or none stands for the default warehouse
+
+type StockAdjustmentRequest struct {
+	WarehouseID uint   `json:"warehouse_id"`
+	Delta       int64  `json:"delta"`
+	Reason      string `json:"reason"`
+}
+
+type StockTransferRequest struct {
+	FromWarehouseID uint  `json:"from_warehouse_id"`
+	ToWarehouseID   uint  `json:"to_warehouse_id"`
+	Quantity        int64 `json:"quantity"`
+}
+
+type StockHoldRequest struct {
+	HoldID      string `json:"hold_id"`
+	WarehouseID uint   `json:"warehouse_id"`
+	Quantity    int64  `json:"quantity"`
+	TTLSeconds  int64  `json:"ttl_seconds"`
+}
+
+// StockResponse is the availability of a product or variant: the totals over its warehouses, and the stock of every one
+type StockResponse struct {
+	ProductID  uint                     `json:"product_id"`
+	VariantID  uint                     `json:"variant_id,omitempty"`
+	OnHand     int64                    `json:"on_hand"`
+	Reserved   int64                    `json:"reserved"`
+	Available  int64                    `json:"available"`
+	UpdatedAt  *time.Time               `json:"updated_at"`
+	Warehouses []WarehouseStockResponse `json:"warehouses"`
+}
+
+type WarehouseStockResponse struct {
+	WarehouseID uint      `json:"warehouse_id"`
+	OnHand      int64     `json:"on_hand"`
+	Reserved    int64     `json:"reserved"`
+	Available   int64     `json:"available"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type StockHoldResponse struct {
+	HoldID      string    `json:"hold_id"`
+	ProductID   uint      `json:"product_id"`
+	VariantID   uint      `json:"variant_id,omitempty"`
+	WarehouseID uint      `json:"warehouse_id"`
+	Quantity    int64     `json:"quantity"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type StockMovementResponse struct {
+	ID          uint      `json:"id"`
+	WarehouseID uint      `json:"warehouse_id"`
+	Delta       int64     `json:"delta"`
+	Reason      string    `json:"reason"`
+	HoldID      string    `json:"hold_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newStockResponse(availability data_layer.ProductAvailability) StockResponse {
+
+	response := StockResponse{ProductID: availability.ProductID, VariantID: availability.VariantID, OnHand: availability.OnHand, Reserved: availability.Reserved, Available: availability.Available(), Warehouses: make([]WarehouseStockResponse, 0, len(availability.Warehouses))}
+
+	// A product that never had stock has no update time
+	if !availability.UpdatedAt.IsZero() {
+
+		response.UpdatedAt = &availability.UpdatedAt
+	}
+
+	for _, level := range availability.Warehouses {
+
+		response.Warehouses = append(response.Warehouses, WarehouseStockResponse{WarehouseID: level.WarehouseID, OnHand: level.OnHand, Reserved: level.Reserved, Available: level.Available(), UpdatedAt: level.UpdatedAt})
+	}
+
+	return response
+}
+
+func newStockHoldResponse(hold data_layer.StockHold) StockHoldResponse {
+
+	return StockHoldResponse{HoldID: hold.ID, ProductID: hold.ProductID, VariantID: hold.VariantID, WarehouseID: hold.WarehouseID, Quantity: hold.Quantity, ExpiresAt: hold.ExpiresAt, CreatedAt: hold.CreatedAt}
+}
+
+// stockItemIDs reads the product ID of the stock routes, and the variant ID of their /variants/:variant_id forms.
+// The variant ID is 0 for the stock of the product itself.
+func stockItemIDs(c *fiber.Ctx) (int, uint, error) {
+
+	if c.Params("variant_id") == "" {
+
+		productID, err := strconv.Atoi(c.Params("id"))
+
+		return productID, 0, err
+	}
+
+	return variantIDs(c)
+}
+
+// invalidStockItem answers the IDs that stockItemIDs rejected
+func invalidStockItem(c *fiber.Ctx, err error) error {
+
+	if c.Params("variant_id") != "" {
+
+		log.Printf("Invalid product or variant ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product or variant ID. Please provide valid IDs"})
+	}
+
+	log.Printf("Invalid product ID: %v", err)
+
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product ID. Please provide a valid ID"})
+}
+
+// stockItem names what the stock routes act on, in their logs and not found errors
+func stockItem(variantID uint) string {
+
+	if variantID != 0 {
+
+		return "Variant"
+	}
+
+	return "Product"
+}
+
+// stockError answers the errors of the inventory and warehouse calls that are not server failures
+func stockError(c *fiber.Ctx, err error, notFound string) error {
+
+	switch {
+
+	case errors.Is(err, gorm.ErrRecordNotFound):
+
+		log.Printf("%s: %v", notFound, err)
+
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": notFound})
+
+	case errors.Is(err, data_layer.ErrInvalidStockChange):
+
+		log.Printf("Invalid stock change: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": fmt.Sprintf("Invalid stock change: delta must be non-zero, quantity positive, hold_id 1 to %d bytes long and reason one of %s", data_layer.MaxHoldIDLength, strings.Join(data_layer.StockReasons, ", "))})
+
+	case errors.Is(err, data_layer.ErrInsufficientStock), errors.Is(err, data_layer.ErrHoldExists), errors.Is(err, data_layer.ErrHoldCommitted), errors.Is(err, data_layer.ErrDuplicateWarehouse), errors.Is(err, data_layer.ErrWarehouseNotEmpty):
+
+		log.Printf("Stock conflict: %v", err)
+
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"Error": strings.ToUpper(err.Error()[:1]) + err.Error()[1:]})
+
+	case errors.Is(err, data_layer.ErrHoldExpired):
+
+		log.Printf("Expired hold: %v", err)
+
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{"Error": "The hold has expired and its units were given back"})
+	}
+
+	log.Printf("Failed to access stock: %v", err)
+
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to access stock in the products database"})
+}
+
+// RetrieveStock answers GET /v1/products/:id/stock, and /v1/products/:id/variants/:variant_id/stock, with the availability
+// of the product or variant over its warehouses
+func (products_api *ProductsAPI) RetrieveStock(c *fiber.Ctx) error {
+
+	productID, variantID, err := stockItemIDs(c)
+
+	if err != nil {
+
+		return invalidStockItem(c, err)
+	}
+
+	admin, err := boolQuery(c, "admin")
+
+	if err != nil {
+
+		log.Printf("Invalid admin flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid admin flag. Must be true or false"})
+	}
+
+	_, err = products_api.retrieveVisibleProduct(productID, admin)
+
+	if err != nil {
+
+		return stockError(c, err, "Product not found")
+	}
+
+	availability, err := products_api.products.RetrieveStock(productID, variantID)
+
+	if err != nil {
+
+		return stockError(c, err, stockItem(variantID)+" not found")
+	}
+
+	return c.JSON(newStockResponse(availability))
+}
+
+// AdjustStock answers POST /v1/products/:id/stock/adjustments, and its variant form: {"delta": -2, "reason": "damaged"}
+func (products_api *ProductsAPI) AdjustStock(c *fiber.Ctx) error {
+
+	productID, variantID, err := stockItemIDs(c)
+
+	if err != nil {
+
+		return invalidStockItem(c, err)
+	}
+
+	requestBody := StockAdjustmentRequest{}
+
+	err = c.BodyParser(&requestBody)
+
+	if err != nil {
+
+		log.Printf("Cannot parse JSON: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Cannot parse JSON"})
+	}
+
+	log.Printf("Attempting to adjust stock of product with ID %d, variant %d, in warehouse %d by %d (%s)", productID, variantID, requestBody.WarehouseID, requestBody.Delta, requestBody.Reason)
+
+	availability, err := products_api.products.AdjustStock(productID, variantID, requestBody.WarehouseID, requestBody.Delta, requestBody.Reason)
+
+	if err != nil {
+
+		return stockError(c, err, stockItem(variantID)+" or warehouse not found")
+	}
+
+	return c.JSON(newStockResponse(availability))
+}
+
+// TransferStock answers POST /v1/products/:id/stock/transfers, and its variant form: {"from_warehouse_id": 1, "to_warehouse_id": 2, "quantity": 5}
+func (products_api *ProductsAPI) TransferStock(c *fiber.Ctx) error {
+
+	productID, variantID, err := stockItemIDs(c)
+
+	if err != nil {
+
+		return invalidStockItem(c, err)
+	}
+
+	requestBody := StockTransferRequest{}
+
+	err = c.BodyParser(&requestBody)
+
+	if err != nil {
+
+		log.Printf("Cannot parse JSON: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Cannot parse JSON"})
+	}
+
+	if requestBody.FromWarehouseID == 0 || requestBody.ToWarehouseID == 0 || requestBody.FromWarehouseID == requestBody.ToWarehouseID || requestBody.Quantity <= 0 {
+
+		log.Printf("Invalid stock transfer: %+v", requestBody)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid stock transfer: from_warehouse_id and to_warehouse_id must be two different warehouses and quantity positive"})
+	}
+
+	log.Printf("Attempting to transfer %d units of product with ID %d, variant %d, from warehouse %d to warehouse %d", requestBody.Quantity, productID, variantID, requestBody.FromWarehouseID, requestBody.ToWarehouseID)
+
+	availability, err := products_api.products.TransferStock(productID, variantID, requestBody.FromWarehouseID, requestBody.ToWarehouseID, requestBody.Quantity)
+
+	if err != nil {
+
+		return stockError(c, err, stockItem(variantID)+" or warehouse not found")
+	}
+
+	return c.JSON(newStockResponse(availability))
+}
+
+// RetrieveStockMovements answers GET /v1/products/:id/stock/movements, and its variant form, with the latest movements, newest first
+func (products_api *ProductsAPI) RetrieveStockMovements(c *fiber.Ctx) error {
+
+	productID, variantID, err := stockItemIDs(c)
+
+	if err != nil {
+
+		return invalidStockItem(c, err)
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "50"))
+
+	if err != nil || limit <= 0 {
+
+		log.Printf("Invalid limit number: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid limit number. Must be a positive integer"})
+	}
+
+	movements, err := products_api.products.RetrieveStockMovements(productID, variantID, limit)
+
+	if err != nil {
+
+		return stockError(c, err, stockItem(variantID)+" not found")
+	}
+
+	responses := make([]StockMovementResponse, 0, len(movements))
+
+	for _, movement := range movements {
+
+		responses = append(responses, StockMovementResponse{ID: movement.ID, WarehouseID: movement.WarehouseID, Delta: movement.Delta, Reason: movement.Reason, HoldID: movement.HoldID, CreatedAt: movement.CreatedAt})
+	}
+
+	if variantID != 0 {
+
+		return c.JSON(fiber.Map{"product_id": productID, "variant_id": variantID, "movements": responses})
+	}
+
+	return c.JSON(fiber.Map{"product_id": productID, "movements": responses})
+}
+
+// ReserveStock answers POST /v1/products/:id/stock/holds, and its variant form, with 201 Created and the hold.
+// Reserving again with the same hold_id and quantity returns the existing hold.
+func (products_api *ProductsAPI) ReserveStock(c *fiber.Ctx) error {
+
+	productID, variantID, err := stockItemIDs(c)
+
+	if err != nil {
+
+		return invalidStockItem(c, err)
+	}
+
+	requestBody := StockHoldRequest{}
+
+	err = c.BodyParser(&requestBody)
+
+	if err != nil {
+
+		log.Printf("Cannot parse JSON: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Cannot parse JSON"})
+	}
+
+	ttl := DefaultHoldTTL
+
+	// Compared in seconds, as huge values would overflow a Duration
+	if requestBody.TTLSeconds != 0 {
+
+		ttl = time.Duration(min(requestBody.TTLSeconds, int64(MaxHoldTTL/time.Second)+1)) * time.Second
+	}
+
+	if ttl <= 0 || ttl > MaxHoldTTL {
+
+		log.Printf("Invalid hold TTL: %d seconds", requestBody.TTLSeconds)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": fmt.Sprintf("Invalid ttl_seconds: must be between 1 and %d", int64(MaxHoldTTL/time.Second))})
+	}
+
+	log.Printf("Attempting to hold %d units of product with ID %d, variant %d, in warehouse %d as %q", requestBody.Quantity, productID, variantID, requestBody.WarehouseID, requestBody.HoldID)
+
+	hold, err := products_api.products.ReserveStock(requestBody.HoldID, productID, variantID, requestBody.WarehouseID, requestBody.Quantity, time.Now().Add(ttl))
+
+	if err != nil {
+
+		return stockError(c, err, stockItem(variantID)+" or warehouse not found")
+	}
+
+	c.Location("/v1/stock-holds/" + hold.ID)
+
+	return c.Status(fiber.StatusCreated).JSON(newStockHoldResponse(hold))
+}
+
+// RetrieveStockHold answers GET /v1/stock-holds/:hold_id
+func (products_api *ProductsAPI) RetrieveStockHold(c *fiber.Ctx) error {
+
+	hold, err := products_api.products.RetrieveStockHold(c.Params("hold_id"))
+
+	if err != nil {
+
+		return stockError(c, err, "Hold not found")
+	}
+
+	return c.JSON(newStockHoldResponse(hold))
+}
+
+// CommitStockHold answers POST /v1/stock-holds/:hold_id/commit: the held units are sold
+func (products_api *ProductsAPI) CommitStockHold(c *fiber.Ctx) error {
+
+	// The ledger keeps the ID, which must not share the request buffer
+	holdID := strings.Clone(c.Params("hold_id"))
+
+	log.Printf("Attempting to commit hold %q", holdID)
+
+	availability, err := products_api.products.CommitStockHold(holdID)
+
+	if err != nil {
+
+		return stockError(c, err, "Hold not found")
+	}
+
+	return c.JSON(newStockResponse(availability))
+}
+
+// ReleaseStockHold answers DELETE /v1/stock-holds/:hold_id: the held units are available again
+func (products_api *ProductsAPI) ReleaseStockHold(c *fiber.Ctx) error {
+
+	holdID := c.Params("hold_id")
+
+	log.Printf("Attempting to release hold %q", holdID)
+
+	availability, err := products_api.products.ReleaseStockHold(holdID)
+
+	if err != nil {
+
+		return stockError(c, err, "Hold not found")
+	}
+
+	return c.JSON(newStockResponse(availability))
+}
+
+// ReleaseExpiredStockHoldsEvery releases the expired holds every interval until stop is closed.
+// Stock operations already ignore expired holds; this keeps the reserved counts of idle products accurate.
+func (products_api *ProductsAPI) ReleaseExpiredStockHoldsEvery(interval time.Duration, stop <-chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+
+		select {
+
+		case <-stop:
+
+			return
+
+		case now := <-ticker.C:
+
+			released, err := products_api.products.ReleaseExpiredStockHolds(now)
+
+			if err != nil {
+
+				log.Printf("Failed to release expired stock holds: %v", err)
+
+			} else if released > 0 {
+
+				log.Printf("Released %d expired stock holds", released)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"simpler-go-home-test/data_layer"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultScheduleInterval is how often the server publishes and unpublishes the products that are due
+const DefaultScheduleInterval = time.Minute
+
+// visibleStatuses are the statuses the public calls show: active only, unless ?admin=true
+func visibleStatuses(admin bool) []string {
+
+	if admin {
+
+		return nil
+	}
+
+	return []string{data_layer.StatusActive}
+}
+
+// retrieveVisibleProduct returns a live product as retrieve-product shows it: drafts and archived products are
+// not found unless admin
+func (products_api *ProductsAPI) retrieveVisibleProduct(productID int, admin bool) (data_layer.Product, error) {
+
+	product, err := products_api.products.RetrieveProduct(productID, false)
+
+	if err == nil && !admin && product.Status != data_layer.StatusActive {
+
+		return data_layer.Product{}, gorm.ErrRecordNotFound
+	}
+
+	return product, err
+}
+
+// parseStatusQuery reads the comma-separated ?status= list, which may only narrow the statuses allowed down
+func parseStatusQuery(value string, allowed []string) ([]string, error) {
+
+	var statuses []string
+
+	for _, status := range strings.Split(value, ",") {
+
+		status = strings.ToLower(strings.TrimSpace(status))
+
+		err := data_layer.ValidateProductStatus(status)
+
+		if err != nil {
+
+			return nil, fmt.Errorf("invalid status %q: must be draft, active or archived", status)
+		}
+
+		if len(allowed) > 0 && !slices.Contains(allowed, status) {
+
+			return nil, fmt.Errorf("invalid status %q: only active products are listed without admin=true", status)
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// scheduleChange is the publish_at or unpublish_at change writing a replaced timestamp, where a missing one removes it
+func scheduleChange(instant *time.Time) *time.Time {
+
+	if instant == nil {
+
+		return &time.Time{}
+	}
+
+	return instant
+}
+
+// statusConflict answers a write moving a product to a status it cannot reach from its current one
+func statusConflict(c *fiber.Ctx, err error) error {
+
+	log.Printf("Status conflict: %v", err)
+
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{"Error": "Status conflict: " + err.Error()})
+}
+
+// ApplyProductSchedulesEvery publishes and unpublishes the products that are due every interval until stop is closed
+func (products_api *ProductsAPI) ApplyProductSchedulesEvery(interval time.Duration, stop <-chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+
+		select {
+
+		case <-stop:
+
+			return
+
+		case now := <-ticker.C:
+
+			changed, err := products_api.products.ApplyProductSchedules(now)
+
+			if err != nil {
+
+				log.Printf("Failed to apply product schedules: %v", err)
+
+			} else if changed > 0 {
+
+				log.Printf("Applied %d scheduled product status changes", changed)
+			}
+		}
+	}
+}
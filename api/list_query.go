@@ -0,0 +1,144 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"simpler-go-home-test/data_layer"
+	"strconv"
+	"time"
+)
+
+// parseListQuery adds the filters of the list query parameters to filter and reads the requested sort:
+//
+//	name_contains, name_prefix, min_price, max_price, created_after, created_before, updated_after,
+//	category, include_subcategories, tags, tags_match, in_stock, warehouse, status, sort
+//
+// status can only narrow the Statuses of filter down, when it has some.
+func parseListQuery(c *fiber.Ctx, filter data_layer.ProductFilter) (data_layer.ProductFilter, data_layer.ProductSort, error) {
+
+	filter.NameContains = c.Query("name_contains")
+
+	filter.NamePrefix = c.Query("name_prefix")
+
+	for name, bound := range map[string]**data_layer.Amount{"min_price": &filter.MinPrice, "max_price": &filter.MaxPrice} {
+
+		value := c.Query(name)
+
+		if value == "" {
+
+			continue
+		}
+
+		price, err := data_layer.ParseAmount(value)
+
+		if err != nil {
+
+			return filter, nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+
+		*bound = &price
+	}
+
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+
+		return filter, nil, fmt.Errorf("min_price cannot be greater than max_price")
+	}
+
+	for name, bound := range map[string]*time.Time{"created_after": &filter.CreatedAfter, "created_before": &filter.CreatedBefore, "updated_after": &filter.UpdatedAfter} {
+
+		value := c.Query(name)
+
+		if value == "" {
+
+			continue
+		}
+
+		instant, err := parseInstant(value)
+
+		if err != nil {
+
+			return filter, nil, fmt.Errorf("invalid %s: expected an RFC 3339 timestamp or a YYYY-MM-DD date", name)
+		}
+
+		*bound = instant
+	}
+
+	if value := c.Query("category"); value != "" {
+
+		categoryID, err := strconv.ParseUint(value, 10, 64)
+
+		if err != nil || categoryID == 0 {
+
+			return filter, nil, fmt.Errorf("invalid category: must be a category ID")
+		}
+
+		filter.CategoryID = uint(categoryID)
+	}
+
+	includeSubcategories, err := boolQuery(c, "include_subcategories")
+
+	if err != nil {
+
+		return filter, nil, fmt.Errorf("invalid include_subcategories: must be true or false")
+	}
+
+	filter.IncludeSubcategories = includeSubcategories
+
+	filter.Tags, filter.AllTags, err = parseTagsQuery(c)
+
+	if err != nil {
+
+		return filter, nil, err
+	}
+
+	filter.InStock, err = boolQuery(c, "in_stock")
+
+	if err != nil {
+
+		return filter, nil, fmt.Errorf("invalid in_stock: must be true or false")
+	}
+
+	if value := c.Query("warehouse"); value != "" {
+
+		warehouseID, err := strconv.ParseUint(value, 10, 64)
+
+		if err != nil || warehouseID == 0 {
+
+			return filter, nil, fmt.Errorf("invalid warehouse: must be a warehouse ID")
+		}
+
+		filter.WarehouseID = uint(warehouseID)
+	}
+
+	if value := c.Query("status"); value != "" {
+
+		filter.Statuses, err = parseStatusQuery(value, filter.Statuses)
+
+		if err != nil {
+
+			return filter, nil, err
+		}
+	}
+
+	productSort, err := data_layer.ParseProductSort(c.Query("sort"))
+
+	if err != nil {
+
+		return filter, nil, err
+	}
+
+	return filter, productSort, nil
+}
+
+// parseInstant reads an RFC 3339 timestamp, or a date meaning its midnight in UTC
+func parseInstant(value string) (time.Time, error) {
+
+	instant, err := time.Parse(time.RFC3339Nano, value)
+
+	if err == nil {
+
+		return instant, nil
+	}
+
+	return time.Parse(time.DateOnly, value)
+}
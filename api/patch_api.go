@@ -0,0 +1,376 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/evanphx/json-patch/v5"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"mime"
+	"reflect"
+	"simpler-go-home-test/data_layer"
+	"strconv"
+	"time"
+)
+
+// Media types of the two patch formats accepted by PATCH /products/:id
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// Fields of the product document a patch may change; every other field is read-only
+var patchableFields = map[string]bool{"name": true, "price": true, "currency": true, "sku": true, "gtin": true, "status": true, "publish_at": true, "unpublish_at": true}
+
+// How many times a patch sent without If-Match is recomputed when another write slips in between
+const patchAttempts = 3
+
+// errPatchNotApplicable marks a well-formed patch that does not apply to the product, e.g. a failed "test" operation
+var errPatchNotApplicable = errors.New("patch cannot be applied to the product")
+
+// PatchProduct applies a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902) to the product document
+// returned by retrieve-product. Plain application/json bodies are read as a merge patch when they hold
+// an object and as a JSON Patch when they hold an array.
+func (products_api *ProductsAPI) PatchProduct(c *fiber.Ctx) error {
+
+	productID, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+
+		log.Printf("Invalid product ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product ID. Please provide a valid ID"})
+	}
+
+	mediaType, _, err := mime.ParseMediaType(c.Get(fiber.HeaderContentType, fiber.MIMEApplicationJSON))
+
+	if err != nil || (mediaType != MergePatchContentType && mediaType != JSONPatchContentType && mediaType != fiber.MIMEApplicationJSON) {
+
+		log.Printf("Unsupported patch content type: %s", c.Get(fiber.HeaderContentType))
+
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"Error": "Unsupported patch format. Use " + MergePatchContentType + " or " + JSONPatchContentType})
+	}
+
+	body := bytes.TrimSpace(c.Body())
+
+	if mediaType == fiber.MIMEApplicationJSON {
+
+		mediaType = MergePatchContentType
+
+		if len(body) > 0 && body[0] == '[' {
+
+			mediaType = JSONPatchContentType
+		}
+	}
+
+	apply, err := patchFunction(mediaType, body)
+
+	if err != nil {
+
+		log.Printf("Invalid patch document: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid patch document: " + err.Error()})
+	}
+
+	ifMatch, err := ifMatchVersion(c)
+
+	if err != nil {
+
+		log.Printf("Invalid If-Match header: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid If-Match header. Please send back the ETag of retrieve-product"})
+	}
+
+	log.Printf("Attempting to patch product with ID: %d (%s)", productID, mediaType)
+
+	for attempt := 1; ; attempt++ {
+
+		product, err := products_api.products.RetrieveProduct(productID, false)
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+
+			log.Printf("Product with ID %d not found", productID)
+
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": "Product not found"})
+		}
+
+		if err != nil {
+
+			log.Printf("Failed to retrieve product from the products database: %v", err)
+
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to retrieve product from the products database"})
+		}
+
+		// The patch is computed on the version just read, so it is written only if that is still the current one
+		expectedVersion := product.Version
+
+		if ifMatch != data_layer.AnyVersion {
+
+			expectedVersion = ifMatch
+		}
+
+		changes, err := patchedChanges(product, apply)
+
+		if errors.Is(err, errPatchNotApplicable) {
+
+			log.Printf("Cannot patch product with ID %d: %v", productID, err)
+
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"Error": err.Error()})
+		}
+
+		if err != nil {
+
+			log.Printf("Invalid product data for update: %v", err)
+
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product data for update: " + err.Error()})
+		}
+
+		err = products_api.products.UpdateProduct(productID, changes, expectedVersion)
+
+		if errors.Is(err, data_layer.ErrVersionConflict) && ifMatch == data_layer.AnyVersion && attempt < patchAttempts {
+
+			log.Printf("Product with ID %d changed while it was patched, patching again: %v", productID, err)
+
+			continue
+		}
+
+		// Without If-Match there is no precondition to fail: the concurrent writes won every attempt
+		if errors.Is(err, data_layer.ErrVersionConflict) && ifMatch == data_layer.AnyVersion {
+
+			log.Printf("Product with ID %d kept changing while it was patched: %v", productID, err)
+
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"Error": "Product kept changing while it was patched. Please retry"})
+		}
+
+		if errors.Is(err, data_layer.ErrVersionConflict) {
+
+			return versionConflict(c, err)
+		}
+
+		if errors.Is(err, data_layer.ErrDuplicateProduct) {
+
+			return productConflict(c, err)
+		}
+
+		if errors.Is(err, data_layer.ErrStatusTransition) {
+
+			return statusConflict(c, err)
+		}
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+
+			log.Printf("Product with ID %d not found", productID)
+
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": "Product not found"})
+		}
+
+		if err != nil {
+
+			log.Printf("Failed to patch product with ID %d: %v", productID, err)
+
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to update product in the products database"})
+		}
+
+		break
+	}
+
+	product, err := products_api.products.RetrieveProduct(productID, false)
+
+	if err != nil {
+
+		log.Printf("Failed to retrieve patched product with ID %d: %v", productID, err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to retrieve product from the products database"})
+	}
+
+	log.Printf("Product with ID %d patched successfully: Name: %s, Price: %s %s", productID, product.Name, product.Price, product.Currency)
+
+	c.Set(fiber.HeaderETag, productETag(product.Version))
+
+	return c.JSON(newProductResponse(product))
+}
+
+// patchFunction decodes the patch body once and returns the function applying it to a product document
+func patchFunction(mediaType string, body []byte) (func(document []byte) ([]byte, error), error) {
+
+	if mediaType == JSONPatchContentType {
+
+		patch, err := jsonpatch.DecodePatch(body)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		return patch.Apply, nil
+	}
+
+	var mergePatch map[string]interface{}
+
+	err := json.Unmarshal(body, &mergePatch)
+
+	if err != nil || mergePatch == nil {
+
+		return nil, errors.New("a merge patch must be a JSON object")
+	}
+
+	return func(document []byte) ([]byte, error) { return jsonpatch.MergePatch(document, body) }, nil
+}
+
+// patchedChanges applies the patch to the product document, validates the result like an insertion
+// and returns the fields that differ from the stored product
+func patchedChanges(product data_layer.Product, apply func(document []byte) ([]byte, error)) (data_layer.ProductChanges, error) {
+
+	changes := data_layer.ProductChanges{}
+
+	document, err := json.Marshal(newProductResponse(product))
+
+	if err != nil {
+
+		return changes, err
+	}
+
+	patchedDocument, err := apply(document)
+
+	if err != nil {
+
+		return changes, fmt.Errorf("%w: %v", errPatchNotApplicable, err)
+	}
+
+	var original, patched map[string]interface{}
+
+	err = json.Unmarshal(document, &original)
+
+	if err == nil {
+
+		err = json.Unmarshal(patchedDocument, &patched)
+	}
+
+	if err != nil {
+
+		return changes, fmt.Errorf("%w: %v", errPatchNotApplicable, err)
+	}
+
+	for field := range mergedKeys(original, patched) {
+
+		if !patchableFields[field] && !reflect.DeepEqual(original[field], patched[field]) {
+
+			return changes, fmt.Errorf("%s is read-only, only name, price, currency, sku, gtin, status, publish_at and unpublish_at can be patched", field)
+		}
+	}
+
+	var fields struct {
+		Name        string            `json:"name"`
+		Price       data_layer.Amount `json:"price"`
+		Currency    string            `json:"currency"`
+		SKU         *string           `json:"sku"`
+		GTIN        *string           `json:"gtin"`
+		Status      string            `json:"status"`
+		PublishAt   *time.Time        `json:"publish_at"`
+		UnpublishAt *time.Time        `json:"unpublish_at"`
+	}
+
+	err = json.Unmarshal(patchedDocument, &fields)
+
+	if err != nil {
+
+		return changes, err
+	}
+
+	result := data_layer.Product{Name: fields.Name, Price: fields.Price, Currency: fields.Currency, SKU: fields.SKU, GTIN: fields.GTIN, Status: fields.Status, PublishAt: fields.PublishAt, UnpublishAt: fields.UnpublishAt}
+
+	err = validateProduct(&result)
+
+	if err != nil {
+
+		return changes, err
+	}
+
+	if result.Name != product.Name {
+
+		changes.Name = &result.Name
+	}
+
+	if result.Price != product.Price {
+
+		changes.Price = &result.Price
+	}
+
+	if result.Currency != product.Currency {
+
+		changes.Currency = &result.Currency
+	}
+
+	if !sameIdentifier(result.SKU, product.SKU) {
+
+		changes.SKU = identifierChange(result.SKU)
+	}
+
+	if !sameIdentifier(result.GTIN, product.GTIN) {
+
+		changes.GTIN = identifierChange(result.GTIN)
+	}
+
+	if result.Status == "" {
+
+		return changes, data_layer.ErrInvalidStatus
+	}
+
+	if result.Status != product.Status {
+
+		changes.Status = &result.Status
+	}
+
+	if !sameInstant(result.PublishAt, product.PublishAt) {
+
+		changes.PublishAt = scheduleChange(result.PublishAt)
+	}
+
+	if !sameInstant(result.UnpublishAt, product.UnpublishAt) {
+
+		changes.UnpublishAt = scheduleChange(result.UnpublishAt)
+	}
+
+	return changes, nil
+}
+
+// sameInstant tells whether two optional timestamps are the same instant, a missing one being equal only to a missing one
+func sameInstant(a, b *time.Time) bool {
+
+	if a == nil || b == nil {
+
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
+
+// sameIdentifier tells whether two optional SKUs or GTINs are equal, a missing one being equal only to a missing one
+func sameIdentifier(a, b *string) bool {
+
+	if a == nil || b == nil {
+
+		return a == b
+	}
+
+	return *a == *b
+}
+
+// mergedKeys returns the keys present in any of the documents
+func mergedKeys(documents ...map[string]interface{}) map[string]bool {
+
+	keys := make(map[string]bool)
+
+	for _, document := range documents {
+
+		for key := range document {
+
+			keys[key] = true
+		}
+	}
+
+	return keys
+}
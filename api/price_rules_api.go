@@ -0,0 +1,183 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"simpler-go-home-test/data_layer"
+)
+
+// PriceRuleFilter selects the products of a price rule. At least one criterion is required.
+type PriceRuleFilter struct {
+	IDs         []uint             `json:"ids"`
+	MinPrice    *data_layer.Amount `json:"min_price"`
+	MaxPrice    *data_layer.Amount `json:"max_price"`
+	NamePattern string             `json:"name_pattern"`
+}
+
+// PriceOperationRequest is one operation of a price rule: set and add take an amount as value,
+// multiply takes a factor and round_99 takes no value
+type PriceOperationRequest struct {
+	Op    string          `json:"op"`
+	Value json.RawMessage `json:"value"`
+}
+
+type PriceRuleRequest struct {
+	Filter     PriceRuleFilter         `json:"filter"`
+	Operations []PriceOperationRequest `json:"operations"`
+	DryRun     bool                    `json:"dry_run"`
+}
+
+type PriceChangeResponse struct {
+	ID       uint              `json:"id"`
+	Name     string            `json:"name"`
+	Currency string            `json:"currency"`
+	OldPrice data_layer.Amount `json:"old_price"`
+	NewPrice data_layer.Amount `json:"new_price"`
+}
+
+// ApplyPriceRule answers POST /v1/products/bulk-price-update. It changes the base prices of the matching products
+// in one transaction, or only reports the before/after diff when dry_run is set.
+func (products_api *ProductsAPI) ApplyPriceRule(c *fiber.Ctx) error {
+
+	requestBody := PriceRuleRequest{}
+
+	err := json.Unmarshal(c.Body(), &requestBody)
+
+	if err != nil {
+
+		log.Printf("Cannot parse JSON: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Cannot parse JSON"})
+	}
+
+	rule, err := priceRule(requestBody)
+
+	if err != nil {
+
+		log.Printf("Invalid price rule: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid price rule: " + err.Error()})
+	}
+
+	log.Printf("Attempting to apply a price rule of %d operations (dry run: %t)", len(rule.Operations), requestBody.DryRun)
+
+	changes, err := products_api.products.ApplyPriceRule(rule, requestBody.DryRun)
+
+	var invalid *data_layer.PriceRuleError
+
+	if errors.As(err, &invalid) {
+
+		log.Printf("Price rule refused: %v", err)
+
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"Error": "The rule would give product a price that is not greater than zero. No price was changed", "product_id": invalid.ProductID, "price": invalid.Price})
+	}
+
+	if errors.Is(err, data_layer.ErrVersionConflict) {
+
+		log.Printf("Price rule interrupted by a concurrent update: %v", err)
+
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"Error": "A matching product was modified while the rule was applied. No price was changed, please retry"})
+	}
+
+	if err != nil {
+
+		log.Printf("Failed to apply price rule: %v", err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to update product prices in the products database"})
+	}
+
+	response := make([]PriceChangeResponse, 0, len(changes))
+
+	for _, change := range changes {
+
+		response = append(response, PriceChangeResponse{ID: change.ProductID, Name: change.Name, Currency: change.Currency, OldPrice: change.OldPrice, NewPrice: change.NewPrice})
+	}
+
+	log.Printf("Price rule done: %d prices changed (dry run: %t)", len(changes), requestBody.DryRun)
+
+	return c.JSON(fiber.Map{"dry_run": requestBody.DryRun, "changed": len(response), "changes": response})
+}
+
+// priceRule validates the request and converts it into a data layer rule
+func priceRule(requestBody PriceRuleRequest) (data_layer.PriceRule, error) {
+
+	filter := requestBody.Filter
+
+	rule := data_layer.PriceRule{Filter: data_layer.ProductFilter{IDs: filter.IDs, MinPrice: filter.MinPrice, MaxPrice: filter.MaxPrice, NamePattern: filter.NamePattern}}
+
+	if len(filter.IDs) == 0 && filter.MinPrice == nil && filter.MaxPrice == nil && filter.NamePattern == "" {
+
+		return rule, fmt.Errorf("the filter needs at least one of ids, min_price, max_price or name_pattern")
+	}
+
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+
+		return rule, fmt.Errorf("min_price cannot be greater than max_price")
+	}
+
+	if len(requestBody.Operations) == 0 {
+
+		return rule, fmt.Errorf("at least one operation is required")
+	}
+
+	for i, request := range requestBody.Operations {
+
+		operation, err := priceOperation(request)
+
+		if err != nil {
+
+			return rule, fmt.Errorf("operation %d: %v", i, err)
+		}
+
+		rule.Operations = append(rule.Operations, operation)
+	}
+
+	return rule, nil
+}
+
+func priceOperation(request PriceOperationRequest) (data_layer.PriceOperation, error) {
+
+	operation := data_layer.PriceOperation{Kind: data_layer.PriceOperationKind(request.Op)}
+
+	hasValue := len(request.Value) > 0 && string(request.Value) != "null"
+
+	var err error
+
+	switch operation.Kind {
+
+	case data_layer.PriceSet, data_layer.PriceAdd:
+
+		if !hasValue {
+
+			return operation, fmt.Errorf("%s needs an amount as value", request.Op)
+		}
+
+		err = json.Unmarshal(request.Value, &operation.Amount)
+
+	case data_layer.PriceMultiply:
+
+		if !hasValue {
+
+			return operation, fmt.Errorf("multiply needs a factor as value")
+		}
+
+		err = json.Unmarshal(request.Value, &operation.Factor)
+
+	case data_layer.PriceRound99:
+
+		if hasValue {
+
+			return operation, fmt.Errorf("round_99 takes no value")
+		}
+	}
+
+	if err != nil {
+
+		return operation, err
+	}
+
+	return operation, data_layer.ValidatePriceOperation(operation)
+}
@@ -0,0 +1,407 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"simpler-go-home-test/data_layer"
+	"strconv"
+	"time"
+)
+
+type SetProductPriceRequest struct {
+	ID       int               `json:"id"`
+	Currency string            `json:"currency"`
+	Price    data_layer.Amount `json:"price"`
+}
+
+type SetExchangeRateRequest struct {
+	Base  string          `json:"base"`
+	Quote string          `json:"quote"`
+	Rate  data_layer.Rate `json:"rate"`
+}
+
+type ProductPriceResponse struct {
+	Currency  string            `json:"currency"`
+	Price     data_layer.Amount `json:"price"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+func (products_api *ProductsAPI) SetProductPrice(c *fiber.Ctx) error {
+
+	requestBody := SetProductPriceRequest{}
+
+	err := c.BodyParser(&requestBody)
+
+	if err != nil {
+
+		log.Printf("Cannot parse JSON: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Cannot parse JSON"})
+	}
+
+	return products_api.setProductPrice(c, requestBody)
+}
+
+// PutProductPrice is SetProductPrice with the product ID and currency taken from the path, as in PUT /v1/products/:id/prices/:currency
+func (products_api *ProductsAPI) PutProductPrice(c *fiber.Ctx) error {
+
+	requestBody := SetProductPriceRequest{}
+
+	err := c.BodyParser(&requestBody)
+
+	if err != nil {
+
+		log.Printf("Cannot parse JSON: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Cannot parse JSON"})
+	}
+
+	requestBody.ID, err = strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+
+		log.Printf("Invalid product ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product ID. Please provide a valid ID"})
+	}
+
+	requestBody.Currency = c.Params("currency")
+
+	return products_api.setProductPrice(c, requestBody)
+}
+
+func (products_api *ProductsAPI) setProductPrice(c *fiber.Ctx, requestBody SetProductPriceRequest) error {
+
+	currency, err := data_layer.NormalizeCurrency(requestBody.Currency)
+
+	if requestBody.ID <= 0 || requestBody.Price <= 0 || err != nil {
+
+		log.Printf("Invalid product price: ID must be positive, currency must be a three letter ISO 4217 code and price must be greater than zero")
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product price: ID must be positive, currency must be a three letter ISO 4217 code and price must be greater than zero"})
+	}
+
+	log.Printf("Attempting to set the %s price of product with ID: %d to %s", currency, requestBody.ID, requestBody.Price)
+
+	err = products_api.products.SetProductPrice(requestBody.ID, currency, requestBody.Price)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+
+		log.Printf("Product with ID %d not found", requestBody.ID)
+
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": "Product not found"})
+	}
+
+	if err != nil {
+
+		log.Printf("Failed to set the %s price of product with ID %d: %v", currency, requestBody.ID, err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to set product price in the products database"})
+	}
+
+	log.Printf("Product with ID %d now costs %s %s", requestBody.ID, requestBody.Price, currency)
+
+	return c.JSON(fiber.Map{"message": "Product price set successfully", "product_id": requestBody.ID, "currency": currency, "price": requestBody.Price})
+}
+
+func (products_api *ProductsAPI) DeleteProductPrice(c *fiber.Ctx) error {
+
+	productID, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+
+		log.Printf("Invalid product ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product ID. Please provide a valid ID"})
+	}
+
+	currency, err := data_layer.NormalizeCurrency(c.Params("currency"))
+
+	if err != nil {
+
+		log.Printf("Invalid currency: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid currency. Please provide a three letter ISO 4217 code"})
+	}
+
+	log.Printf("Attempting to delete the %s price of product with ID: %d", currency, productID)
+
+	err = products_api.products.DeleteProductPrice(productID, currency)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+
+		log.Printf("Product with ID %d has no explicit %s price", productID, currency)
+
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": "Product price not found"})
+	}
+
+	if err != nil {
+
+		log.Printf("Failed to delete the %s price of product with ID %d: %v", currency, productID, err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to delete product price from the products database"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Product price deleted successfully", "product_id": productID, "currency": currency})
+}
+
+func (products_api *ProductsAPI) RetrieveProductPrices(c *fiber.Ctx) error {
+
+	productID, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+
+		log.Printf("Invalid product ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product ID. Please provide a valid ID"})
+	}
+
+	admin, err := boolQuery(c, "admin")
+
+	if err != nil {
+
+		log.Printf("Invalid admin flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid admin flag. Must be true or false"})
+	}
+
+	product, err := products_api.retrieveVisibleProduct(productID, admin)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+
+		log.Printf("Product with ID %d not found", productID)
+
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": "Product not found"})
+	}
+
+	if err != nil {
+
+		log.Printf("Failed to retrieve product from the products database: %v", err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to retrieve product from the products database"})
+	}
+
+	prices, err := products_api.products.RetrieveProductPrices([]uint{product.ID})
+
+	if err != nil {
+
+		log.Printf("Failed to retrieve the prices of product with ID %d: %v", productID, err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to retrieve product prices from the products database"})
+	}
+
+	pricesResponse := []ProductPriceResponse{{Currency: product.Currency, Price: product.Price, UpdatedAt: product.UpdatedAt}}
+
+	for _, productPrice := range prices {
+
+		pricesResponse = append(pricesResponse, ProductPriceResponse{Currency: productPrice.Currency, Price: productPrice.Price, UpdatedAt: productPrice.UpdatedAt})
+	}
+
+	return c.JSON(fiber.Map{"product_id": product.ID, "base_currency": product.Currency, "prices": pricesResponse})
+}
+
+func (products_api *ProductsAPI) SetExchangeRate(c *fiber.Ctx) error {
+
+	requestBody := SetExchangeRateRequest{}
+
+	err := c.BodyParser(&requestBody)
+
+	if err != nil {
+
+		log.Printf("Cannot parse JSON: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Cannot parse JSON"})
+	}
+
+	return products_api.setExchangeRate(c, requestBody)
+}
+
+// PutExchangeRate is SetExchangeRate with the currency pair taken from the path, as in PUT /v1/exchange-rates/:base/:quote
+func (products_api *ProductsAPI) PutExchangeRate(c *fiber.Ctx) error {
+
+	requestBody := SetExchangeRateRequest{}
+
+	err := c.BodyParser(&requestBody)
+
+	if err != nil {
+
+		log.Printf("Cannot parse JSON: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Cannot parse JSON"})
+	}
+
+	requestBody.Base = c.Params("base")
+
+	requestBody.Quote = c.Params("quote")
+
+	return products_api.setExchangeRate(c, requestBody)
+}
+
+func (products_api *ProductsAPI) setExchangeRate(c *fiber.Ctx, requestBody SetExchangeRateRequest) error {
+
+	base, baseErr := data_layer.NormalizeCurrency(requestBody.Base)
+
+	quote, quoteErr := data_layer.NormalizeCurrency(requestBody.Quote)
+
+	if baseErr != nil || quoteErr != nil || base == quote || requestBody.Rate <= 0 {
+
+		log.Printf("Invalid exchange rate: base and quote must be two different ISO 4217 codes and rate must be greater than zero")
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid exchange rate: base and quote must be two different ISO 4217 codes and rate must be greater than zero"})
+	}
+
+	log.Printf("Setting exchange rate 1 %s = %s %s", base, requestBody.Rate, quote)
+
+	err := products_api.products.SetExchangeRate(base, quote, requestBody.Rate)
+
+	if err != nil {
+
+		log.Printf("Failed to set exchange rate %s/%s: %v", base, quote, err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to set exchange rate in the products database"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Exchange rate set successfully", "base": base, "quote": quote, "rate": requestBody.Rate})
+}
+
+func (products_api *ProductsAPI) DeleteExchangeRate(c *fiber.Ctx) error {
+
+	base, baseErr := data_layer.NormalizeCurrency(c.Params("base"))
+
+	quote, quoteErr := data_layer.NormalizeCurrency(c.Params("quote"))
+
+	if baseErr != nil || quoteErr != nil {
+
+		log.Printf("Invalid currency pair %s/%s", c.Params("base"), c.Params("quote"))
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid currency. Please provide three letter ISO 4217 codes"})
+	}
+
+	err := products_api.products.DeleteExchangeRate(base, quote)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+
+		log.Printf("Exchange rate %s/%s not found", base, quote)
+
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": "Exchange rate not found"})
+	}
+
+	if err != nil {
+
+		log.Printf("Failed to delete exchange rate %s/%s: %v", base, quote, err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to delete exchange rate from the products database"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Exchange rate deleted successfully", "base": base, "quote": quote})
+}
+
+func (products_api *ProductsAPI) RetrieveExchangeRates(c *fiber.Ctx) error {
+
+	rates, err := products_api.products.RetrieveExchangeRates()
+
+	if err != nil {
+
+		log.Printf("Failed to retrieve exchange rates: %v", err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to retrieve exchange rates from the products database"})
+	}
+
+	return c.JSON(fiber.Map{"exchange_rates": rates})
+}
+
+// requestedCurrency reads the optional ?currency= query parameter; an empty result means base prices
+func requestedCurrency(c *fiber.Ctx) (string, error) {
+
+	currency := c.Query("currency")
+
+	if currency == "" {
+
+		return "", nil
+	}
+
+	return data_layer.NormalizeCurrency(currency)
+}
+
+// priceInCurrency rewrites the price of every response in currency, from explicit prices first
+// and through the exchange-rate table otherwise
+func (products_api *ProductsAPI) priceInCurrency(responses []ProductResponse, currency string) error {
+
+	if currency == "" || len(responses) == 0 {
+
+		return nil
+	}
+
+	ids := make([]uint, 0, len(responses))
+
+	for _, response := range responses {
+
+		ids = append(ids, response.ID)
+	}
+
+	prices, err := products_api.products.RetrieveProductPrices(ids)
+
+	if err != nil {
+
+		return err
+	}
+
+	explicit := make(map[uint]map[string]data_layer.Amount)
+
+	for _, productPrice := range prices {
+
+		if explicit[productPrice.ProductID] == nil {
+
+			explicit[productPrice.ProductID] = make(map[string]data_layer.Amount)
+		}
+
+		explicit[productPrice.ProductID][productPrice.Currency] = productPrice.Price
+	}
+
+	rates, err := products_api.products.RetrieveExchangeRates()
+
+	if err != nil {
+
+		return err
+	}
+
+	table := data_layer.NewExchangeRateTable(rates)
+
+	for i, response := range responses {
+
+		product := data_layer.Product{Price: response.Price, Currency: response.Currency}
+
+		price, source, err := data_layer.PriceInCurrency(product, currency, explicit[response.ID], table, products_api.rounding)
+
+		if err != nil {
+
+			return err
+		}
+
+		responses[i].Price = price
+
+		responses[i].Currency = currency
+
+		responses[i].PriceSource = source
+	}
+
+	return nil
+}
+
+// currencyConversionError answers a failed ?currency= conversion
+func currencyConversionError(c *fiber.Ctx, currency string, err error) error {
+
+	if errors.Is(err, data_layer.ErrNoExchangeRate) {
+
+		log.Printf("Cannot price products in %s: %v", currency, err)
+
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"Error": fmt.Sprintf("No exchange rate available to convert prices into %s", currency)})
+	}
+
+	log.Printf("Failed to price products in %s: %v", currency, err)
+
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to retrieve product prices from the products database"})
+}
@@ -17,37 +17,82 @@ type UpdateProductNameRequest struct {
 
 type UpdateProductPriceRequest struct {
 	ID    int     `json:"id"`
-	Price float64 `json:"price"`
+	Price data_layer.Amount `json:"price"`
+}
+
+// ProductsAPI holds the application-scoped dependencies shared by the product handlers.
+// Handlers only talk to storage through the data_layer.Repository interface.
+type ProductsAPI struct {
+	products data_layer.Repository
+	rounding data_layer.RoundingRules
 }
 
 type ProductResponse struct {
 	ID        uint      `json:"id"`
 	Name        string    `json:"name"`
-	Price       float64   `json:"price"`
+	Price       data_layer.Amount `json:"price"`
+	Currency    string    `json:"currency"`
+	SKU         *string   `json:"sku"`
+	GTIN        *string   `json:"gtin"`
+	Status      string    `json:"status"`
+	PublishAt   *time.Time `json:"publish_at"`
+	UnpublishAt *time.Time `json:"unpublish_at"`
+	PriceSource data_layer.PriceSource `json:"price_source,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	Version     uint      `json:"version"`
+	Variants    *[]VariantResponse `json:"variants,omitempty"`
+	Variant     *VariantResponse `json:"variant,omitempty"`
 }
 
+// rounding decides how prices converted through the exchange-rate table are rounded per currency
+func NewProductsAPI(products data_layer.Repository, rounding data_layer.RoundingRules) *ProductsAPI {
+
+	return &ProductsAPI{products: products, rounding: rounding}
+}
 
-func InsertProduct(c *fiber.Ctx) error {
+func newProductResponse(product data_layer.Product) ProductResponse {
+
+	productResponse := ProductResponse{
+		ID:        product.ID,
+		Name:      product.Name,
+		Price:     product.Price,
+		Currency:  product.Currency,
+		SKU:       product.SKU,
+		GTIN:      product.GTIN,
+		Status:    product.Status,
+		PublishAt: product.PublishAt,
+		UnpublishAt: product.UnpublishAt,
+		CreatedAt: product.CreatedAt,
+		UpdatedAt: product.UpdatedAt,
+		Version:   product.Version,
+	}
 
-	products_db, err := data_layer.ProductsDB()
+	if product.DeletedAt.Valid {
 
-	defer func() {
-		sqlDB, _ := products_db.DB()
-		sqlDB.Close()
-	}()
-	
-	if err != nil {
-		
-		log.Printf("Failed to connect to the products database: %v", err)
+		deletedAt := product.DeletedAt.Time
 
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to connect to the products database",})
+		productResponse.DeletedAt = &deletedAt
 	}
 
+	return productResponse
+}
+
+func (products_api *ProductsAPI) InsertProduct(c *fiber.Ctx) error {
+
+	return products_api.insertProduct(c, func(productID uint) error {
+
+		return c.JSON(fiber.Map{"message": "Product inserted successfully to the products database","product_id": productID,})
+	})
+}
+
+// insertProduct validates and stores the product in the request body, then lets inserted answer the request
+func (products_api *ProductsAPI) insertProduct(c *fiber.Ctx, inserted func(productID uint) error) error {
+
 	product := data_layer.Product{} 
 
-	err = c.BodyParser(&product); 
+	err := c.BodyParser(&product); 
 
 	if(err != nil) {
 		
@@ -56,16 +101,28 @@ func InsertProduct(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Cannot parse JSON",})
 	}
 
-	if product.Name == "" || product.Price <= 0 {
+	if product.Currency == "" {
 
-		log.Printf("Invalid product data for insertion: name must be non-empty, and price must be greater than zero")
+		product.Currency = data_layer.DefaultCurrency
+	}
+
+	err = validateProduct(&product)
+
+	if err != nil {
 
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product data for insertion: name must be non-empty, and price must be greater than zero",})
+		log.Printf("Invalid product data for insertion: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product data for insertion: " + err.Error(),})
 	}
 
-	log.Println("Inserting product (name : ", product.Name, ", price : ", product.Price, ") to the products database")
+	log.Println("Inserting product (name : ", product.Name, ", price : ", product.Price, product.Currency, ") to the products database")
+
+	ids, err := products_api.products.InsertProducts([]data_layer.Product{product})
 
-	productID, err := data_layer.InsertProduct(products_db, product.Name, product.Price)
+	if errors.Is(err, data_layer.ErrDuplicateProduct) {
+
+		return productConflict(c, err)
+	}
 	
 	if err != nil {
 		
@@ -74,26 +131,14 @@ func InsertProduct(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to insert product at the products database",})
 	}
 
-	log.Println("Product (name : ", product.Name, ", price : ", product.Price, ") inserted successfully to the products database. Product ID : ", productID,)
+	productID := ids[0]
 
-	return c.JSON(fiber.Map{"message": "Product inserted successfully to the products database","product_id": productID,})
-}
+	log.Println("Product (name : ", product.Name, ", price : ", product.Price, product.Currency, ") inserted successfully to the products database. Product ID : ", productID,)
 
-func DeleteProduct(c *fiber.Ctx) error {
+	return inserted(productID)
+}
 
-	products_db, err := data_layer.ProductsDB()
-
-	defer func() {
-		sqlDB, _ := products_db.DB()
-		sqlDB.Close()
-	}()
-	
-	if err != nil {
-		
-		log.Printf("Failed to connect to the products database: %v", err)
-		
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to connect to the products database",})
-	}
+func (products_api *ProductsAPI) DeleteProduct(c *fiber.Ctx) error {
 
 	idParam := c.Params("id")
 	
@@ -106,9 +151,35 @@ func DeleteProduct(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product ID. Please provide a valid ID",})
 	}
 
-	log.Println("Attempting to delete product with ID:", productID)
+	// ?force=true removes the product for good instead of moving it to the trash
+	force, err := boolQuery(c, "force")
+
+	if err != nil {
+
+		log.Printf("Invalid force flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid force flag. Must be true or false",})
+	}
+
+	expectedVersion, err := ifMatchVersion(c)
+
+	if err != nil {
+
+		log.Printf("Invalid If-Match header: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid If-Match header. Please send back the ETag of retrieve-product",})
+	}
+
+	log.Println("Attempting to delete product with ID:", productID, "force:", force)
+
+	if force {
+
+		err = products_api.products.PurgeProduct(productID, expectedVersion)
 
-	err = data_layer.DeleteProduct(products_db, productID)
+	} else {
+
+		err = products_api.products.DeleteProduct(productID, expectedVersion)
+	}
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 
@@ -116,6 +187,11 @@ func DeleteProduct(c *fiber.Ctx) error {
 		
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": "Product not found",})
 	}
+
+	if errors.Is(err, data_layer.ErrVersionConflict) {
+
+		return versionConflict(c, err)
+	}
 	
 	if err != nil {
 		
@@ -126,27 +202,19 @@ func DeleteProduct(c *fiber.Ctx) error {
 
 	log.Printf("Product with ID %d deleted successfully from the products database", productID)
 
-	return c.JSON(fiber.Map{"message": "Product deleted successfully from the products database","product_id": productID,})
-}
+	if force {
 
-func UpdateProductName(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"message": "Product purged permanently from the products database","product_id": productID,})
+	}
 
-	products_db, err := data_layer.ProductsDB()
+	return c.JSON(fiber.Map{"message": "Product deleted successfully from the products database","product_id": productID,})
+}
 
-	defer func() {
-		sqlDB, _ := products_db.DB()
-		sqlDB.Close()
-	}()
-	
-	if err != nil {
-		log.Printf("Failed to connect to the products database: %v", err)
-		
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to connect to the products database",})
-	}
+func (products_api *ProductsAPI) UpdateProductName(c *fiber.Ctx) error {
 
 	requestBody := UpdateProductNameRequest{}
 	
-	err = c.BodyParser(&requestBody) 
+	err := c.BodyParser(&requestBody) 
 
 	if(err != nil) {
 		
@@ -162,9 +230,18 @@ func UpdateProductName(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product data for update: ID must be positive and name must be non-empty",})
 	}
 
+	expectedVersion, err := ifMatchVersion(c)
+
+	if err != nil {
+
+		log.Printf("Invalid If-Match header: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid If-Match header. Please send back the ETag of retrieve-product",})
+	}
+
 	log.Printf("Attempting to update the name of product with ID: %d to '%s'", requestBody.ID, requestBody.Name)
 
-	err = data_layer.UpdateProductName(products_db, requestBody.ID, requestBody.Name)
+	err = products_api.products.UpdateProductName(requestBody.ID, requestBody.Name, expectedVersion)
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 
@@ -172,6 +249,11 @@ func UpdateProductName(c *fiber.Ctx) error {
 		
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": "Product not found",})
 	}
+
+	if errors.Is(err, data_layer.ErrVersionConflict) {
+
+		return versionConflict(c, err)
+	}
 	
 	if err != nil {
 		
@@ -185,25 +267,11 @@ func UpdateProductName(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Product name updated successfully", "product_id": requestBody.ID, "new_name": requestBody.Name,})
 }
 
-func UpdateProductPrice(c *fiber.Ctx) error {
-	
-	products_db, err := data_layer.ProductsDB()
-
-	defer func() {
-		sqlDB, _ := products_db.DB()
-		sqlDB.Close()
-	}()
-	
-	if err != nil {
-		
-		log.Printf("Failed to connect to the products database: %v", err)
-		
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to connect to the products database",})
-	}
+func (products_api *ProductsAPI) UpdateProductPrice(c *fiber.Ctx) error {
 
 	requestBody := UpdateProductPriceRequest{}
 	
-	err = c.BodyParser(&requestBody); 
+	err := c.BodyParser(&requestBody); 
 
 	if(err != nil) {
 		
@@ -212,16 +280,25 @@ func UpdateProductPrice(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Cannot parse JSON",})
 	}
 
-	if (requestBody.ID <= 0 || requestBody.Price <= 0) {
+	if (requestBody.ID <= 0 || data_layer.ValidatePrice(requestBody.Price) != nil) {
 		
 		log.Printf("Invalid product data for update: ID must be positive and price must be greater than zero")
 		
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product data for update: ID must be positive and price must be greater than zero",})
 	}
 
-	log.Printf("Attempting to update the price of product with ID: %d to %.2f", requestBody.ID, requestBody.Price)
+	expectedVersion, err := ifMatchVersion(c)
 
-	err = data_layer.UpdateProductPrice(products_db, requestBody.ID, requestBody.Price)
+	if err != nil {
+
+		log.Printf("Invalid If-Match header: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid If-Match header. Please send back the ETag of retrieve-product",})
+	}
+
+	log.Printf("Attempting to update the price of product with ID: %d to %s", requestBody.ID, requestBody.Price)
+
+	err = products_api.products.UpdateProductPrice(requestBody.ID, requestBody.Price, expectedVersion)
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 
@@ -229,6 +306,11 @@ func UpdateProductPrice(c *fiber.Ctx) error {
 		
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": "Product not found",})
 	}
+
+	if errors.Is(err, data_layer.ErrVersionConflict) {
+
+		return versionConflict(c, err)
+	}
 	
 	if (err != nil) {
 		
@@ -237,26 +319,12 @@ func UpdateProductPrice(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to update product price in the products database",})
 	}
 
-	log.Printf("Product with ID %d updated successfully. New price: %.2f", requestBody.ID, requestBody.Price)
+	log.Printf("Product with ID %d updated successfully. New price: %s", requestBody.ID, requestBody.Price)
 
 	return c.JSON(fiber.Map{"message": "Product price updated successfully", "product_id": requestBody.ID,"new_price":  requestBody.Price,})
 }
 
-func RetrieveProduct(c *fiber.Ctx) error {
-
-	products_db, err := data_layer.ProductsDB()
-
-	defer func() {
-		sqlDB, _ := products_db.DB()
-		sqlDB.Close()
-	}()
-	
-	if err != nil {
-		
-		log.Printf("Failed to connect to the products database: %v", err)
-		
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to connect to the products database",})
-	}
+func (products_api *ProductsAPI) RetrieveProduct(c *fiber.Ctx) error {
 
 	idParam := c.Params("id")
 	
@@ -269,9 +337,51 @@ func RetrieveProduct(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product ID. Please provide a valid ID",})
 	}
 
+	currency, err := requestedCurrency(c)
+
+	if err != nil {
+
+		log.Printf("Invalid currency: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid currency. Please provide a three letter ISO 4217 code",})
+	}
+
+	includeDeleted, err := boolQuery(c, "include_deleted")
+
+	if err != nil {
+
+		log.Printf("Invalid include_deleted flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid include_deleted flag. Must be true or false",})
+	}
+
+	admin, err := boolQuery(c, "admin")
+
+	if err != nil {
+
+		log.Printf("Invalid admin flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid admin flag. Must be true or false",})
+	}
+
+	withVariants, err := includeVariants(c)
+
+	if err != nil {
+
+		log.Printf("Invalid include: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid include. Only variants can be included",})
+	}
+
 	log.Printf("Attempting to retrieve product with ID: %d", productID)
 
-	product, err := data_layer.RetrieveProduct(products_db, productID)
+	product, err := products_api.products.RetrieveProduct(productID, includeDeleted)
+
+	// Drafts and archived products are only shown to admins
+	if err == nil && !admin && product.Status != data_layer.StatusActive {
+
+		err = gorm.ErrRecordNotFound
+	}
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		// Handle the case where the product is not found
@@ -287,28 +397,73 @@ func RetrieveProduct(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to retrieve product from the products database",})
 	}	
 
-	productResponse := ProductResponse{ID: product.ID, Name: product.Name, Price: product.Price, CreatedAt: product.CreatedAt, UpdatedAt: product.UpdatedAt}
+	productResponse := newProductResponse(product)
+
+	responses := []ProductResponse{productResponse}
+
+	err = products_api.priceInCurrency(responses, currency)
+
+	if err != nil {
+
+		return currencyConversionError(c, currency, err)
+	}
+
+	productResponse = responses[0]
+
+	// Deleted products keep their variants, but only live ones serve them
+	if withVariants && !product.DeletedAt.Valid {
+
+		variants, err := products_api.products.RetrieveProductVariants(productID)
+
+		if err != nil {
+
+			return variantError(c, err, "Product not found")
+		}
 
-	log.Printf("Product with ID %d retrieved successfully: Name: %s, Price: %.2f", productID, productResponse.Name, productResponse.Price)
+		variantResponses := newVariantResponses(variants, product)
+
+		productResponse.Variants = &variantResponses
+	}
+
+	c.Set(fiber.HeaderETag, productETag(product.Version))
+
+	log.Printf("Product with ID %d retrieved successfully: Name: %s, Price: %s %s", productID, productResponse.Name, productResponse.Price, productResponse.Currency)
 
 	return c.JSON(productResponse)
 }
 
-func RetrieveProductsWithPagination(c *fiber.Ctx) error {
+func (products_api *ProductsAPI) RetrieveProductsWithPagination(c *fiber.Ctx) error {
 
-	products_db, err := data_layer.ProductsDB()
+	includeDeleted, err := boolQuery(c, "include_deleted")
 
-	defer func() {
-		sqlDB, _ := products_db.DB()
-		sqlDB.Close()
-	}()
-	
 	if err != nil {
-		log.Printf("Failed to connect to the products database: %v", err)
-		
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to connect to the products database",})
+
+		log.Printf("Invalid include_deleted flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid include_deleted flag. Must be true or false",})
 	}
 
+	admin, err := boolQuery(c, "admin")
+
+	if err != nil {
+
+		log.Printf("Invalid admin flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid admin flag. Must be true or false",})
+	}
+
+	return products_api.retrievePage(c, data_layer.ProductFilter{IncludeDeleted: includeDeleted, Statuses: visibleStatuses(admin)})
+}
+
+// RetrieveDeletedProductsWithPagination lists the trash: soft-deleted products that can still be restored
+func (products_api *ProductsAPI) RetrieveDeletedProductsWithPagination(c *fiber.Ctx) error {
+
+	return products_api.retrievePage(c, data_layer.ProductFilter{OnlyDeleted: true})
+}
+
+// retrievePage answers a paginated listing of the products matching the filter and the list query parameters
+func (products_api *ProductsAPI) retrievePage(c *fiber.Ctx, filter data_layer.ProductFilter) error {
+
 	pageParam := c.Query("page", "1")    // Default page is 1
 	limitParam := c.Query("limit", "10") // Default limit is 10
 
@@ -329,11 +484,34 @@ func RetrieveProductsWithPagination(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid limit number. Must be a positive integer",})
 	}
 
+	currency, err := requestedCurrency(c)
+
+	if err != nil {
+
+		log.Printf("Invalid currency: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid currency. Please provide a three letter ISO 4217 code",})
+	}
+
+	filter, productSort, err := parseListQuery(c, filter)
+
+	if err != nil {
+
+		log.Printf("Invalid list query: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid list query: " + err.Error(),})
+	}
+
+	if c.Query("cursor") != "" {
+
+		return products_api.retrieveCursorPage(c, filter, productSort, limit, currency)
+	}
+
 	offset := (page - 1) * limit
 
 	log.Printf("Attempting to retrieve products with pagination: page = %d, limit = %d, offset = %d", page, limit, offset)
 
-	products, err := data_layer.RetrieveProductsWithPagination(products_db, offset, limit)
+	products, err := products_api.products.RetrieveProductsWithPagination(filter, productSort, offset, limit)
 	
 	if err != nil {
 		
@@ -342,7 +520,7 @@ func RetrieveProductsWithPagination(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to retrieve products with pagination",})
 	}
 
-	total_number_of_products, err := data_layer.GetTotalNumberOfProducts(products_db)
+	total_number_of_products, err := products_api.products.GetTotalNumberOfProducts(filter)
 
 	if(err != nil) {
 
@@ -358,13 +536,14 @@ func RetrieveProductsWithPagination(c *fiber.Ctx) error {
 	
 	for _, product := range products {
 		
-		paginatedResponse = append(paginatedResponse, ProductResponse{
-			ID:        product.ID,
-			Name:      product.Name,
-			Price:     product.Price,
-			CreatedAt: product.CreatedAt,
-			UpdatedAt: product.UpdatedAt,
-		})
+		paginatedResponse = append(paginatedResponse, newProductResponse(product))
+	}
+
+	err = products_api.priceInCurrency(paginatedResponse, currency)
+
+	if err != nil {
+
+		return currencyConversionError(c, currency, err)
 	}
 
 	metadata := fiber.Map{"current_page": page, "total_pages":  totalPages, "total_number_of_products": total_number_of_products, "next_page":    page + 1, "prev_page":    page - 1}
@@ -376,7 +555,130 @@ func RetrieveProductsWithPagination(c *fiber.Ctx) error {
 		metadata["next_page"] = nil
 	}
 
+	setPageCursors(metadata, productSort, products, page > 1, page < totalPages)
+
 	log.Printf("Successfully retrieved %d products on page %d with limit %d", len(paginatedResponse), page, limit)
 
 	return c.JSON(fiber.Map{"metadata": metadata, "products": paginatedResponse,})
-}
\ No newline at end of file
+}
+
+func (products_api *ProductsAPI) RestoreProduct(c *fiber.Ctx) error {
+
+	productID, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+
+		log.Printf("Invalid product ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product ID. Please provide a valid ID"})
+	}
+
+	log.Printf("Attempting to restore product with ID: %d", productID)
+
+	err = products_api.products.RestoreProduct(productID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+
+		log.Printf("Deleted product with ID %d not found", productID)
+
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": "Deleted product not found"})
+	}
+
+	if err != nil {
+
+		log.Printf("Failed to restore product with ID %d: %v", productID, err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to restore product in the products database"})
+	}
+
+	log.Printf("Product with ID %d restored successfully", productID)
+
+	return c.JSON(fiber.Map{"message": "Product restored successfully", "product_id": productID})
+}
+
+// PurgeDeletedProducts removes for good the products that have been in the trash for longer than ?older_than= (default: all of them)
+func (products_api *ProductsAPI) PurgeDeletedProducts(c *fiber.Ctx) error {
+
+	olderThan, err := time.ParseDuration(c.Query("older_than", "0s"))
+
+	if err != nil || olderThan < 0 {
+
+		log.Printf("Invalid older_than duration: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid older_than duration. Use a non-negative Go duration such as 720h"})
+	}
+
+	deletedBefore := time.Now().Add(-olderThan)
+
+	log.Printf("Attempting to purge products deleted before %s", deletedBefore.Format(time.RFC3339))
+
+	purged, err := products_api.products.PurgeDeletedProducts(deletedBefore)
+
+	if err != nil {
+
+		log.Printf("Failed to purge deleted products: %v", err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to purge deleted products from the products database"})
+	}
+
+	log.Printf("Purged %d deleted products", purged)
+
+	return c.JSON(fiber.Map{"message": "Deleted products purged successfully", "purged": purged, "deleted_before": deletedBefore})
+}
+
+// productConflict answers a write giving a product the SKU or GTIN of another one
+func productConflict(c *fiber.Ctx, err error) error {
+
+	log.Printf("Product conflict: %v", err)
+
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{"Error": "Product conflict: " + err.Error()})
+}
+
+// validateProduct checks the rules every stored product follows and normalizes its currency code, SKU and GTIN.
+// Its status may be left empty, for the data layer to default or keep.
+func validateProduct(product *data_layer.Product) error {
+
+	if product.Name == "" || product.Price <= 0 {
+
+		return errors.New("name must be non-empty, and price must be greater than zero")
+	}
+
+	currency, err := data_layer.NormalizeCurrency(product.Currency)
+
+	if err != nil {
+
+		return errors.New("currency must be a three letter ISO 4217 code")
+	}
+
+	product.Currency = currency
+
+	if product.Status != "" {
+
+		err = data_layer.ValidateProductStatus(product.Status)
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	if product.PublishAt != nil && product.UnpublishAt != nil && !product.UnpublishAt.After(*product.PublishAt) {
+
+		return data_layer.ErrInvalidSchedule
+	}
+
+	return data_layer.NormalizeProductIdentifiers(product)
+}
+
+// boolQuery reads an optional boolean query parameter, false when absent
+func boolQuery(c *fiber.Ctx, name string) (bool, error) {
+
+	value := c.Query(name)
+
+	if value == "" {
+
+		return false, nil
+	}
+
+	return strconv.ParseBool(value)
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"simpler-go-home-test/data_layer"
+	"strconv"
+)
+
+// Handlers specific to the /v1 resource routes. The others are shared with the legacy routes.
+
+// CreateProduct answers POST /v1/products with 201 Created, the new product and its Location
+func (products_api *ProductsAPI) CreateProduct(c *fiber.Ctx) error {
+
+	return products_api.insertProduct(c, func(productID uint) error {
+
+		product, err := products_api.products.RetrieveProduct(int(productID), false)
+
+		if err != nil {
+
+			log.Printf("Failed to retrieve inserted product with ID %d: %v", productID, err)
+
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to retrieve product from the products database"})
+		}
+
+		c.Location(fmt.Sprintf("/v1/products/%d", productID))
+
+		c.Set(fiber.HeaderETag, productETag(product.Version))
+
+		return c.Status(fiber.StatusCreated).JSON(newProductResponse(product))
+	})
+}
+
+// ReplaceProduct answers PUT /v1/products/:id: name, price, currency, SKU, GTIN and schedule are all replaced, with the
+// insertion rules, so that a missing SKU, GTIN, publish_at or unpublish_at is removed. A missing status is kept.
+// The currency is required: defaulting it would relabel the price, and the variant price overrides, of the product.
+func (products_api *ProductsAPI) ReplaceProduct(c *fiber.Ctx) error {
+
+	productID, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+
+		log.Printf("Invalid product ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product ID. Please provide a valid ID"})
+	}
+
+	replacement := data_layer.Product{}
+
+	err = c.BodyParser(&replacement)
+
+	if err != nil {
+
+		log.Printf("Cannot parse JSON: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Cannot parse JSON"})
+	}
+
+	if replacement.Currency == "" {
+
+		log.Printf("Invalid product data for update: missing currency")
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product data for update: currency is required when replacing a product"})
+	}
+
+	err = validateProduct(&replacement)
+
+	if err != nil {
+
+		log.Printf("Invalid product data for update: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product data for update: " + err.Error()})
+	}
+
+	expectedVersion, err := ifMatchVersion(c)
+
+	if err != nil {
+
+		log.Printf("Invalid If-Match header: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid If-Match header. Please send back the ETag of retrieve-product"})
+	}
+
+	log.Printf("Attempting to replace product with ID: %d", productID)
+
+	changes := data_layer.ProductChanges{Name: &replacement.Name, Price: &replacement.Price, Currency: &replacement.Currency, SKU: identifierChange(replacement.SKU), GTIN: identifierChange(replacement.GTIN), PublishAt: scheduleChange(replacement.PublishAt), UnpublishAt: scheduleChange(replacement.UnpublishAt)}
+
+	if replacement.Status != "" {
+
+		changes.Status = &replacement.Status
+	}
+
+	err = products_api.products.UpdateProduct(productID, changes, expectedVersion)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+
+		log.Printf("Product with ID %d not found", productID)
+
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": "Product not found"})
+	}
+
+	if errors.Is(err, data_layer.ErrVersionConflict) {
+
+		return versionConflict(c, err)
+	}
+
+	if errors.Is(err, data_layer.ErrDuplicateProduct) {
+
+		return productConflict(c, err)
+	}
+
+	if errors.Is(err, data_layer.ErrStatusTransition) {
+
+		return statusConflict(c, err)
+	}
+
+	if errors.Is(err, data_layer.ErrInvalidSchedule) {
+
+		log.Printf("Invalid product data for update: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product data for update: " + err.Error()})
+	}
+
+	if err != nil {
+
+		log.Printf("Failed to replace product with ID %d: %v", productID, err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to update product in the products database"})
+	}
+
+	product, err := products_api.products.RetrieveProduct(productID, false)
+
+	if err != nil {
+
+		log.Printf("Failed to retrieve replaced product with ID %d: %v", productID, err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to retrieve product from the products database"})
+	}
+
+	c.Set(fiber.HeaderETag, productETag(product.Version))
+
+	return c.JSON(newProductResponse(product))
+}
+
+// identifierChange is the SKU or GTIN change writing a normalized identifier, where an empty one removes it
+func identifierChange(identifier *string) *string {
+
+	if identifier == nil {
+
+		empty := ""
+
+		return &empty
+	}
+
+	return identifier
+}
+
+// noContent turns the confirmation message of a successful delete into 204 No Content
+func noContent(handler fiber.Handler) fiber.Handler {
+
+	return func(c *fiber.Ctx) error {
+
+		err := handler(c)
+
+		if err == nil && c.Response().StatusCode() == fiber.StatusOK {
+
+			c.Response().ResetBody()
+
+			c.Response().Header.Del(fiber.HeaderContentType)
+
+			c.Status(fiber.StatusNoContent)
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LegacyRoutesDeprecatedAt is when the verb-style routes were superseded by the /v1 resource routes
+var LegacyRoutesDeprecatedAt = time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC)
+
+// DefaultLegacyRoutesSunset is when the verb-style routes are planned to be removed
+var DefaultLegacyRoutesSunset = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+
+// RegisterRoutes mounts the /v1 resource routes and, as deprecated aliases announcing legacySunset,
+// the former verb-style routes
+func (products_api *ProductsAPI) RegisterRoutes(app *fiber.App, legacySunset time.Time) {
+
+	v1 := app.Group("/v1")
+
+	v1.Post("/products", products_api.CreateProduct)
+
+	v1.Post("/products/bulk", products_api.BulkInsertProducts)
+
+	v1.Post("/products/bulk-price-update", products_api.ApplyPriceRule)
+
+	v1.Post("/products/import", products_api.ImportProducts)
+
+	v1.Get("/products", products_api.RetrieveProductsWithPagination)
+
+	// Registered before /products/:id, which would otherwise take "search" for an ID
+	v1.Get("/products/search", products_api.SearchProducts)
+
+	v1.Get("/products/autocomplete", products_api.AutocompleteProducts)
+
+	v1.Get("/products/export", products_api.ExportProducts)
+
+	v1.Get("/products/lookup", products_api.LookupProduct)
+
+	v1.Get("/products/:id", products_api.RetrieveProduct)
+
+	v1.Put("/products/:id", products_api.ReplaceProduct)
+
+	v1.Patch("/products/:id", products_api.PatchProduct)
+
+	v1.Delete("/products/:id", noContent(products_api.DeleteProduct))
+
+	v1.Post("/products/:id/restore", products_api.RestoreProduct)
+
+	v1.Get("/deleted-products", products_api.RetrieveDeletedProductsWithPagination)
+
+	v1.Delete("/deleted-products", products_api.PurgeDeletedProducts)
+
+	v1.Get("/products/:id/prices", products_api.RetrieveProductPrices)
+
+	v1.Put("/products/:id/prices/:currency", products_api.PutProductPrice)
+
+	v1.Delete("/products/:id/prices/:currency", noContent(products_api.DeleteProductPrice))
+
+	v1.Get("/products/:id/categories", products_api.RetrieveProductCategories)
+
+	v1.Put("/products/:id/categories/:category_id", products_api.AssignProductCategory)
+
+	v1.Delete("/products/:id/categories/:category_id", noContent(products_api.UnassignProductCategory))
+
+	v1.Get("/products/:id/tags", products_api.RetrieveProductTags)
+
+	v1.Post("/products/:id/tags", products_api.AddProductTags)
+
+	v1.Delete("/products/:id/tags/:tag", noContent(products_api.RemoveProductTag))
+
+	v1.Get("/products/:id/variants", products_api.RetrieveProductVariants)
+
+	v1.Post("/products/:id/variants", products_api.CreateProductVariant)
+
+	v1.Get("/products/:id/variants/:variant_id", products_api.RetrieveProductVariant)
+
+	v1.Put("/products/:id/variants/:variant_id", products_api.ReplaceProductVariant)
+
+	v1.Delete("/products/:id/variants/:variant_id", noContent(products_api.DeleteProductVariant))
+
+	v1.Get("/tags", products_api.RetrieveTagCloud)
+
+	v1.Get("/products/:id/stock", products_api.RetrieveStock)
+
+	v1.Post("/products/:id/stock/adjustments", products_api.AdjustStock)
+
+	v1.Post("/products/:id/stock/transfers", products_api.TransferStock)
+
+	v1.Get("/products/:id/stock/movements", products_api.RetrieveStockMovements)
+
+	v1.Post("/products/:id/stock/holds", products_api.ReserveStock)
+
+	v1.Get("/products/:id/variants/:variant_id/stock", products_api.RetrieveStock)
+
+	v1.Post("/products/:id/variants/:variant_id/stock/adjustments", products_api.AdjustStock)
+
+	v1.Post("/products/:id/variants/:variant_id/stock/transfers", products_api.TransferStock)
+
+	v1.Get("/products/:id/variants/:variant_id/stock/movements", products_api.RetrieveStockMovements)
+
+	v1.Post("/products/:id/variants/:variant_id/stock/holds", products_api.ReserveStock)
+
+	v1.Get("/stock-holds/:hold_id", products_api.RetrieveStockHold)
+
+	v1.Post("/stock-holds/:hold_id/commit", products_api.CommitStockHold)
+
+	v1.Delete("/stock-holds/:hold_id", noContent(products_api.ReleaseStockHold))
+
+	v1.Post("/warehouses", products_api.CreateWarehouse)
+
+	v1.Get("/warehouses", products_api.RetrieveWarehouses)
+
+	v1.Get("/warehouses/:id", products_api.RetrieveWarehouse)
+
+	v1.Put("/warehouses/:id", products_api.ReplaceWarehouse)
+
+	v1.Delete("/warehouses/:id", noContent(products_api.DeleteWarehouse))
+
+	v1.Post("/categories", products_api.CreateCategory)
+
+	v1.Get("/categories", products_api.RetrieveCategories)
+
+	// Registered before /categories/:id, which would otherwise take "tree" for an ID
+	v1.Get("/categories/tree", products_api.RetrieveCategoryTree)
+
+	v1.Get("/categories/:id", products_api.RetrieveCategory)
+
+	v1.Put("/categories/:id", products_api.ReplaceCategory)
+
+	v1.Delete("/categories/:id", noContent(products_api.DeleteCategory))
+
+	v1.Get("/exchange-rates", products_api.RetrieveExchangeRates)
+
+	v1.Put("/exchange-rates/:base/:quote", products_api.PutExchangeRate)
+
+	v1.Delete("/exchange-rates/:base/:quote", noContent(products_api.DeleteExchangeRate))
+
+	// Legacy routes keep their former behaviour and point to their successor
+	legacy := func(successor string) fiber.Handler { return deprecated(successor, legacySunset) }
+
+	app.Post("/insert-product", legacy("/v1/products"), products_api.InsertProduct)
+
+	app.Delete("/delete-product/:id", legacy("/v1/products/:id"), products_api.DeleteProduct)
+
+	app.Put("/update-product-name", legacy("/v1/products/:id"), products_api.UpdateProductName)
+
+	app.Put("/update-product-price", legacy("/v1/products/:id"), products_api.UpdateProductPrice)
+
+	app.Patch("/products/:id", legacy("/v1/products/:id"), products_api.PatchProduct)
+
+	app.Get("/retrieve-product/:id", legacy("/v1/products/:id"), products_api.RetrieveProduct)
+
+	app.Get("/retrieve-products", legacy("/v1/products"), products_api.RetrieveProductsWithPagination)
+
+	app.Post("/restore-product/:id", legacy("/v1/products/:id/restore"), products_api.RestoreProduct)
+
+	app.Get("/retrieve-deleted-products", legacy("/v1/deleted-products"), products_api.RetrieveDeletedProductsWithPagination)
+
+	app.Delete("/purge-deleted-products", legacy("/v1/deleted-products"), products_api.PurgeDeletedProducts)
+
+	app.Put("/set-product-price", legacy("/v1/products/:id/prices/:currency"), products_api.SetProductPrice)
+
+	app.Delete("/delete-product-price/:id/:currency", legacy("/v1/products/:id/prices/:currency"), products_api.DeleteProductPrice)
+
+	app.Get("/retrieve-product-prices/:id", legacy("/v1/products/:id/prices"), products_api.RetrieveProductPrices)
+
+	app.Put("/set-exchange-rate", legacy("/v1/exchange-rates/:base/:quote"), products_api.SetExchangeRate)
+
+	app.Delete("/delete-exchange-rate/:base/:quote", legacy("/v1/exchange-rates/:base/:quote"), products_api.DeleteExchangeRate)
+
+	app.Get("/retrieve-exchange-rates", legacy("/v1/exchange-rates"), products_api.RetrieveExchangeRates)
+}
+
+// deprecated marks a legacy route with the Deprecation (RFC 9745) and Sunset (RFC 8594) headers
+// and links its successor. Its :params are filled in from the path of the request or, for the legacy routes
+// that take their IDs in the body, from the JSON field of the same name; a successor whose :params cannot all be
+// filled in, as with a malformed body, is linked up to the collection of the first missing one.
+func deprecated(successor string, sunset time.Time) fiber.Handler {
+
+	return func(c *fiber.Ctx) error {
+
+		segments := strings.Split(successor, "/")
+
+		var fields map[string]json.RawMessage
+
+		if strings.Contains(successor, ":") && len(c.Body()) > 0 {
+
+			// A body that is not a JSON object leaves fields empty, and the handler reports it
+			_ = json.Unmarshal(c.Body(), &fields)
+		}
+
+		for i, segment := range segments {
+
+			if !strings.HasPrefix(segment, ":") {
+
+				continue
+			}
+
+			value := c.Params(segment[1:])
+
+			if value == "" {
+
+				value = url.PathEscape(bodyField(fields, segment[1:]))
+			}
+
+			if value == "" {
+
+				segments = segments[:i]
+
+				break
+			}
+
+			segments[i] = value
+		}
+
+		c.Set("Deprecation", fmt.Sprintf("@%d", LegacyRoutesDeprecatedAt.Unix()))
+
+		c.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+
+		c.Set(fiber.HeaderLink, fmt.Sprintf("<%s>; rel=\"successor-version\"", strings.Join(segments, "/")))
+
+		return c.Next()
+	}
+}
+
+// bodyField returns a JSON string or number field as text, and "" for any other or a missing one
+func bodyField(fields map[string]json.RawMessage, name string) string {
+
+	var text string
+
+	if json.Unmarshal(fields[name], &text) == nil {
+
+		return text
+	}
+
+	var number json.Number
+
+	if json.Unmarshal(fields[name], &number) == nil {
+
+		return number.String()
+	}
+
+	return ""
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"github.com/gofiber/fiber/v2"
+	"simpler-go-home-test/data_layer"
+)
+
+// SearchResultResponse is a found product together with its relevance and highlighted name
+type SearchResultResponse struct {
+	ProductResponse
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
+// SearchProducts answers GET /v1/products/search?q= with the live products matching every word of q,
+// most relevant first. Words also match the start of longer words ("lap" finds "Laptop").
+// As with the list, only active products are found unless ?admin=true.
+func (products_api *ProductsAPI) SearchProducts(c *fiber.Ctx) error {
+
+	query := c.Query("q")
+
+	page, err := strconv.Atoi(c.Query("page", "1"))
+
+	if err != nil || page <= 0 {
+
+		log.Printf("Invalid page number: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid page number. Must be a positive integer"})
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "10"))
+
+	if err != nil || limit <= 0 {
+
+		log.Printf("Invalid limit number: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid limit number. Must be a positive integer"})
+	}
+
+	currency, err := requestedCurrency(c)
+
+	if err != nil {
+
+		log.Printf("Invalid currency: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid currency. Please provide a three letter ISO 4217 code"})
+	}
+
+	admin, err := boolQuery(c, "admin")
+
+	if err != nil {
+
+		log.Printf("Invalid admin flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid admin flag. Must be true or false"})
+	}
+
+	log.Printf("Attempting to search products: q = %q, page = %d, limit = %d", query, page, limit)
+
+	// One extra result tells whether another page follows
+	results, err := products_api.products.SearchProducts(query, visibleStatuses(admin), (page-1)*limit, limit+1)
+
+	if errors.Is(err, data_layer.ErrEmptySearch) {
+
+		log.Printf("Invalid search query %q: %v", query, err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid search query. Please provide at least one word with ?q="})
+	}
+
+	if err != nil {
+
+		log.Printf("Failed to search products: %v", err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to search products"})
+	}
+
+	more := len(results) > limit
+
+	if more {
+
+		results = results[:limit]
+	}
+
+	responses := make([]ProductResponse, 0, len(results))
+
+	for _, result := range results {
+
+		responses = append(responses, newProductResponse(result.Product))
+	}
+
+	err = products_api.priceInCurrency(responses, currency)
+
+	if err != nil {
+
+		return currencyConversionError(c, currency, err)
+	}
+
+	searchResponse := make([]SearchResultResponse, 0, len(results))
+
+	for i, result := range results {
+
+		searchResponse = append(searchResponse, SearchResultResponse{ProductResponse: responses[i], Score: result.Score, Snippet: result.Snippet})
+	}
+
+	metadata := fiber.Map{"query": query, "current_page": page, "limit": limit, "next_page": page + 1, "prev_page": page - 1}
+
+	if page == 1 {
+		metadata["prev_page"] = nil
+	}
+	if !more {
+		metadata["next_page"] = nil
+	}
+
+	log.Printf("Successfully found %d products for %q on page %d", len(searchResponse), query, page)
+
+	return c.JSON(fiber.Map{"metadata": metadata, "results": searchResponse})
+}
+
+// Largest edit distance accepted by the fuzzy autocomplete
+const maxSuggestionDistance = 3
+
+// SuggestionResponse is one completion of the autocomplete box
+type SuggestionResponse struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	Distance int    `json:"distance"`
+}
+
+// AutocompleteProducts answers GET /v1/products/autocomplete?prefix= with the names of the live products
+// completing what the user typed. With ?fuzzy=true, words within max_distance edits also match
+// (by default 1 for words shorter than 5 letters, 2 otherwise). Only active products are suggested unless ?admin=true.
+func (products_api *ProductsAPI) AutocompleteProducts(c *fiber.Ctx) error {
+
+	prefix := c.Query("prefix")
+
+	limit, err := strconv.Atoi(c.Query("limit", "10"))
+
+	if err != nil || limit <= 0 {
+
+		log.Printf("Invalid limit number: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid limit number. Must be a positive integer"})
+	}
+
+	fuzzy, err := boolQuery(c, "fuzzy")
+
+	if err != nil {
+
+		log.Printf("Invalid fuzzy flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid fuzzy flag. Must be true or false"})
+	}
+
+	admin, err := boolQuery(c, "admin")
+
+	if err != nil {
+
+		log.Printf("Invalid admin flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid admin flag. Must be true or false"})
+	}
+
+	maxDistance := 0
+
+	if fuzzy {
+
+		maxDistance = 1
+
+		if len([]rune(prefix)) >= 5 {
+
+			maxDistance = 2
+		}
+	}
+
+	if value := c.Query("max_distance"); value != "" {
+
+		maxDistance, err = strconv.Atoi(value)
+
+		if err != nil || maxDistance < 0 || maxDistance > maxSuggestionDistance || !fuzzy {
+
+			log.Printf("Invalid max_distance %q (fuzzy: %t)", value, fuzzy)
+
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid max_distance. Must be between 0 and 3, together with fuzzy=true"})
+		}
+	}
+
+	suggestions, err := products_api.products.SuggestProducts(prefix, visibleStatuses(admin), maxDistance, limit)
+
+	if errors.Is(err, data_layer.ErrEmptySearch) {
+
+		log.Printf("Invalid autocomplete prefix %q: %v", prefix, err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid prefix. Please provide at least one letter or digit with ?prefix="})
+	}
+
+	if err != nil {
+
+		log.Printf("Failed to autocomplete products: %v", err)
+
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to autocomplete products"})
+	}
+
+	suggestionsResponse := make([]SuggestionResponse, 0, len(suggestions))
+
+	for _, suggestion := range suggestions {
+
+		suggestionsResponse = append(suggestionsResponse, SuggestionResponse{ID: suggestion.ProductID, Name: suggestion.Name, Distance: suggestion.Distance})
+	}
+
+	return c.JSON(fiber.Map{"prefix": prefix, "max_distance": maxDistance, "suggestions": suggestionsResponse})
+}
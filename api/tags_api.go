@@ -0,0 +1,224 @@
+package api
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"net/url"
+	"simpler-go-home-test/data_layer"
+	"strconv"
+	"strings"
+)
+
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// TagCountResponse is an entry of GET /v1/tags
+type TagCountResponse struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// parseTagsQuery reads the comma-separated ?tags= of the list calls and whether ?tags_match= is any (the default) or all
+func parseTagsQuery(c *fiber.Ctx) ([]string, bool, error) {
+
+	match := c.Query("tags_match", "any")
+
+	if match != "any" && match != "all" {
+
+		return nil, false, errors.New("invalid tags_match: must be any or all")
+	}
+
+	value := c.Query("tags")
+
+	if value == "" {
+
+		return nil, false, nil
+	}
+
+	tags, err := data_layer.NormalizeTags(strings.Split(value, ","))
+
+	if err != nil {
+
+		return nil, false, errors.New("invalid tags: " + err.Error())
+	}
+
+	return tags, match == "all", nil
+}
+
+// tagError answers the errors of the tag calls that are not server failures
+func tagError(c *fiber.Ctx, err error, notFound string) error {
+
+	switch {
+
+	case errors.Is(err, gorm.ErrRecordNotFound):
+
+		log.Printf("%s: %v", notFound, err)
+
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": notFound})
+
+	case errors.Is(err, data_layer.ErrInvalidTag):
+
+		log.Printf("Invalid tag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid tag: " + err.Error()})
+	}
+
+	log.Printf("Failed to access tags: %v", err)
+
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to access tags in the products database"})
+}
+
+// RetrieveProductTags answers GET /v1/products/:id/tags
+func (products_api *ProductsAPI) RetrieveProductTags(c *fiber.Ctx) error {
+
+	productID, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+
+		log.Printf("Invalid product ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product ID. Please provide a valid ID"})
+	}
+
+	admin, err := boolQuery(c, "admin")
+
+	if err != nil {
+
+		log.Printf("Invalid admin flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid admin flag. Must be true or false"})
+	}
+
+	_, err = products_api.retrieveVisibleProduct(productID, admin)
+
+	if err != nil {
+
+		return tagError(c, err, "Product not found")
+	}
+
+	tags, err := products_api.products.RetrieveProductTags(productID)
+
+	if err != nil {
+
+		return tagError(c, err, "Product not found")
+	}
+
+	return c.JSON(fiber.Map{"product_id": productID, "tags": tags})
+}
+
+// AddProductTags answers POST /v1/products/:id/tags with all the tags of the product once the new ones are added
+func (products_api *ProductsAPI) AddProductTags(c *fiber.Ctx) error {
+
+	productID, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+
+		log.Printf("Invalid product ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product ID. Please provide a valid ID"})
+	}
+
+	requestBody := TagsRequest{}
+
+	err = c.BodyParser(&requestBody)
+
+	if err != nil {
+
+		log.Printf("Cannot parse JSON: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Cannot parse JSON"})
+	}
+
+	if len(requestBody.Tags) == 0 {
+
+		log.Printf("No tags to add to product with ID %d", productID)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid tags: provide at least one tag"})
+	}
+
+	log.Printf("Attempting to tag product with ID %d with %q", productID, requestBody.Tags)
+
+	tags, err := products_api.products.AddProductTags(productID, requestBody.Tags)
+
+	if err != nil {
+
+		return tagError(c, err, "Product not found")
+	}
+
+	return c.JSON(fiber.Map{"product_id": productID, "tags": tags})
+}
+
+// RemoveProductTag answers DELETE /v1/products/:id/tags/:tag
+func (products_api *ProductsAPI) RemoveProductTag(c *fiber.Ctx) error {
+
+	productID, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+
+		log.Printf("Invalid product ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product ID. Please provide a valid ID"})
+	}
+
+	tag, err := url.PathUnescape(c.Params("tag"))
+
+	if err != nil {
+
+		log.Printf("Invalid tag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid tag"})
+	}
+
+	log.Printf("Attempting to remove tag %q from product with ID %d", tag, productID)
+
+	err = products_api.products.RemoveProductTag(productID, tag)
+
+	if err != nil {
+
+		return tagError(c, err, "Product does not have this tag")
+	}
+
+	return c.JSON(fiber.Map{"message": "Tag removed successfully", "product_id": productID, "tag": tag})
+}
+
+// RetrieveTagCloud answers GET /v1/tags with the tags of the live products and their usage counts, most used first.
+// ?limit= keeps the most used ones only. Like the product list, only active products are counted unless ?admin=true.
+func (products_api *ProductsAPI) RetrieveTagCloud(c *fiber.Ctx) error {
+
+	limit, err := strconv.Atoi(c.Query("limit", "0"))
+
+	if err != nil || limit < 0 {
+
+		log.Printf("Invalid limit number: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid limit number. Must be a positive integer"})
+	}
+
+	admin, err := boolQuery(c, "admin")
+
+	if err != nil {
+
+		log.Printf("Invalid admin flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid admin flag. Must be true or false"})
+	}
+
+	cloud, err := products_api.products.RetrieveTagCloud(visibleStatuses(admin), limit)
+
+	if err != nil {
+
+		return tagError(c, err, "Tag not found")
+	}
+
+	responses := make([]TagCountResponse, 0, len(cloud))
+
+	for _, entry := range cloud {
+
+		responses = append(responses, TagCountResponse{Tag: entry.Name, Count: entry.Count})
+	}
+
+	return c.JSON(fiber.Map{"tags": responses})
+}
@@ -0,0 +1,357 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"simpler-go-home-test/data_layer"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VariantRequest is the body of the variant create and replace calls. A null or missing price_override
+// sells the variant at the price of its product. Stock is only read to refuse it: the stock of a variant
+// changes through its stock adjustments, like the stock of a product.
+type VariantRequest struct {
+	SKU           string             `json:"sku"`
+	Options       map[string]string  `json:"options"`
+	PriceOverride *data_layer.Amount `json:"price_override"`
+	Stock         *int64             `json:"stock"`
+}
+
+// VariantResponse carries the price of the variant, its override or the price of the product, in the currency of the product,
+// and its available units over the warehouses
+type VariantResponse struct {
+	ID            uint               `json:"id"`
+	ProductID     uint               `json:"product_id"`
+	SKU           string             `json:"sku"`
+	Options       map[string]string  `json:"options"`
+	PriceOverride *data_layer.Amount `json:"price_override"`
+	Price         data_layer.Amount  `json:"price"`
+	Currency      string             `json:"currency"`
+	Available     int64              `json:"available"`
+	CreatedAt     time.Time          `json:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+}
+
+func newVariantResponse(variant data_layer.ProductVariant, product data_layer.Product) VariantResponse {
+
+	return VariantResponse{
+		ID:            variant.ID,
+		ProductID:     variant.ProductID,
+		SKU:           variant.SKU,
+		Options:       variant.OptionValues(),
+		PriceOverride: variant.PriceOverride,
+		Price:         variant.Price(product),
+		Currency:      product.Currency,
+		Available:     variant.Available,
+		CreatedAt:     variant.CreatedAt,
+		UpdatedAt:     variant.UpdatedAt,
+	}
+}
+
+func newVariantResponses(variants []data_layer.ProductVariant, product data_layer.Product) []VariantResponse {
+
+	responses := make([]VariantResponse, 0, len(variants))
+
+	for _, variant := range variants {
+
+		responses = append(responses, newVariantResponse(variant, product))
+	}
+
+	return responses
+}
+
+// includeVariants reads ?include= of retrieve-product, where variants is the only embeddable resource
+func includeVariants(c *fiber.Ctx) (bool, error) {
+
+	value := c.Query("include")
+
+	if value == "" {
+
+		return false, nil
+	}
+
+	for _, name := range strings.Split(value, ",") {
+
+		if strings.TrimSpace(name) != "variants" {
+
+			return false, fmt.Errorf("cannot include %q: expected variants", name)
+		}
+	}
+
+	return true, nil
+}
+
+// variantError answers the errors of the variant calls that are not server failures
+func variantError(c *fiber.Ctx, err error, notFound string) error {
+
+	switch {
+
+	case errors.Is(err, gorm.ErrRecordNotFound):
+
+		log.Printf("%s: %v", notFound, err)
+
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": notFound})
+
+	case errors.Is(err, data_layer.ErrInvalidVariant):
+
+		log.Printf("Invalid variant: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": fmt.Sprintf("Invalid variant: sku must have 1 to %d letters, digits, -, _ or ., options need at least one name and value, and price_override must be greater than zero", data_layer.MaxSKULength)})
+
+	case errors.Is(err, data_layer.ErrDuplicateVariant), errors.Is(err, data_layer.ErrVariantNotEmpty):
+
+		log.Printf("Variant conflict: %v", err)
+
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"Error": "Variant conflict: " + err.Error()})
+	}
+
+	log.Printf("Failed to access variants: %v", err)
+
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": "Failed to access variants in the products database"})
+}
+
+// variantIDs reads the product and variant IDs of the /v1/products/:id/variants/:variant_id routes
+func variantIDs(c *fiber.Ctx) (int, uint, error) {
+
+	productID, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+
+		return 0, 0, err
+	}
+
+	variantID, err := strconv.ParseUint(c.Params("variant_id"), 10, 64)
+
+	if err != nil || variantID == 0 {
+
+		return 0, 0, fmt.Errorf("invalid variant ID %q", c.Params("variant_id"))
+	}
+
+	return productID, uint(variantID), nil
+}
+
+// errVariantStock is returned by parseVariantRequest for a body setting the stock
+var errVariantStock = errors.New("stock is read-only")
+
+func parseVariantRequest(c *fiber.Ctx) (data_layer.VariantSpec, error) {
+
+	requestBody := VariantRequest{}
+
+	err := c.BodyParser(&requestBody)
+
+	if err != nil {
+
+		return data_layer.VariantSpec{}, err
+	}
+
+	if requestBody.Stock != nil {
+
+		return data_layer.VariantSpec{}, errVariantStock
+	}
+
+	return data_layer.VariantSpec{SKU: requestBody.SKU, Options: requestBody.Options, PriceOverride: requestBody.PriceOverride}, nil
+}
+
+// invalidVariantRequest answers the bodies that parseVariantRequest rejected
+func invalidVariantRequest(c *fiber.Ctx, err error) error {
+
+	if errors.Is(err, errVariantStock) {
+
+		log.Printf("Variant stock set in the body: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "The stock of a variant is read-only here. Use POST /v1/products/:id/variants/:variant_id/stock/adjustments"})
+	}
+
+	log.Printf("Cannot parse JSON: %v", err)
+
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Cannot parse JSON"})
+}
+
+// CreateProductVariant answers POST /v1/products/:id/variants with 201 Created, the new variant and its Location
+func (products_api *ProductsAPI) CreateProductVariant(c *fiber.Ctx) error {
+
+	productID, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+
+		log.Printf("Invalid product ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product ID. Please provide a valid ID"})
+	}
+
+	spec, err := parseVariantRequest(c)
+
+	if err != nil {
+
+		return invalidVariantRequest(c, err)
+	}
+
+	log.Printf("Attempting to add variant %q to product with ID %d", spec.SKU, productID)
+
+	variant, err := products_api.products.CreateProductVariant(productID, spec)
+
+	if err != nil {
+
+		return variantError(c, err, "Product not found")
+	}
+
+	product, err := products_api.products.RetrieveProduct(productID, false)
+
+	if err != nil {
+
+		return variantError(c, err, "Product not found")
+	}
+
+	c.Location(fmt.Sprintf("/v1/products/%d/variants/%d", productID, variant.ID))
+
+	return c.Status(fiber.StatusCreated).JSON(newVariantResponse(variant, product))
+}
+
+// RetrieveProductVariants answers GET /v1/products/:id/variants
+func (products_api *ProductsAPI) RetrieveProductVariants(c *fiber.Ctx) error {
+
+	productID, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+
+		log.Printf("Invalid product ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product ID. Please provide a valid ID"})
+	}
+
+	admin, err := boolQuery(c, "admin")
+
+	if err != nil {
+
+		log.Printf("Invalid admin flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid admin flag. Must be true or false"})
+	}
+
+	product, err := products_api.retrieveVisibleProduct(productID, admin)
+
+	if err != nil {
+
+		return variantError(c, err, "Product not found")
+	}
+
+	variants, err := products_api.products.RetrieveProductVariants(productID)
+
+	if err != nil {
+
+		return variantError(c, err, "Product not found")
+	}
+
+	return c.JSON(fiber.Map{"product_id": productID, "variants": newVariantResponses(variants, product)})
+}
+
+func (products_api *ProductsAPI) RetrieveProductVariant(c *fiber.Ctx) error {
+
+	productID, variantID, err := variantIDs(c)
+
+	if err != nil {
+
+		log.Printf("Invalid product or variant ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product or variant ID. Please provide valid IDs"})
+	}
+
+	admin, err := boolQuery(c, "admin")
+
+	if err != nil {
+
+		log.Printf("Invalid admin flag: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid admin flag. Must be true or false"})
+	}
+
+	product, err := products_api.retrieveVisibleProduct(productID, admin)
+
+	if err != nil {
+
+		return variantError(c, err, "Product not found")
+	}
+
+	variant, err := products_api.products.RetrieveProductVariant(productID, variantID)
+
+	if err != nil {
+
+		return variantError(c, err, "Variant not found")
+	}
+
+	return c.JSON(newVariantResponse(variant, product))
+}
+
+// ReplaceProductVariant answers PUT /v1/products/:id/variants/:variant_id: SKU, options and price override are all replaced
+func (products_api *ProductsAPI) ReplaceProductVariant(c *fiber.Ctx) error {
+
+	productID, variantID, err := variantIDs(c)
+
+	if err != nil {
+
+		log.Printf("Invalid product or variant ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product or variant ID. Please provide valid IDs"})
+	}
+
+	spec, err := parseVariantRequest(c)
+
+	if err != nil {
+
+		return invalidVariantRequest(c, err)
+	}
+
+	log.Printf("Attempting to replace variant with ID %d of product with ID %d", variantID, productID)
+
+	err = products_api.products.UpdateProductVariant(productID, variantID, spec)
+
+	if err != nil {
+
+		return variantError(c, err, "Variant not found")
+	}
+
+	product, err := products_api.products.RetrieveProduct(productID, false)
+
+	if err != nil {
+
+		return variantError(c, err, "Product not found")
+	}
+
+	variant, err := products_api.products.RetrieveProductVariant(productID, variantID)
+
+	if err != nil {
+
+		return variantError(c, err, "Variant not found")
+	}
+
+	return c.JSON(newVariantResponse(variant, product))
+}
+
+// DeleteProductVariant answers DELETE /v1/products/:id/variants/:variant_id. Variants still holding stock are refused.
+func (products_api *ProductsAPI) DeleteProductVariant(c *fiber.Ctx) error {
+
+	productID, variantID, err := variantIDs(c)
+
+	if err != nil {
+
+		log.Printf("Invalid product or variant ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid product or variant ID. Please provide valid IDs"})
+	}
+
+	log.Printf("Attempting to delete variant with ID %d of product with ID %d", variantID, productID)
+
+	err = products_api.products.DeleteProductVariant(productID, variantID)
+
+	if err != nil {
+
+		return variantError(c, err, "Variant not found")
+	}
+
+	return c.JSON(fiber.Map{"message": "Variant deleted successfully", "product_id": productID, "variant_id": variantID})
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"simpler-go-home-test/data_layer"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sizes of the warehouses.code and warehouses.name columns
+const (
+	MaxWarehouseCodeLength = 20
+	MaxWarehouseNameLength = 100
+)
+
+type WarehouseRequest struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type WarehouseResponse struct {
+	ID        uint      `json:"id"`
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newWarehouseResponse(warehouse data_layer.Warehouse) WarehouseResponse {
+
+	return WarehouseResponse{ID: warehouse.ID, Code: warehouse.Code, Name: warehouse.Name, CreatedAt: warehouse.CreatedAt, UpdatedAt: warehouse.UpdatedAt}
+}
+
+// parseWarehouseRequest reads and validates the body of the warehouse create and replace calls
+func parseWarehouseRequest(c *fiber.Ctx) (WarehouseRequest, error) {
+
+	requestBody := WarehouseRequest{}
+
+	err := c.BodyParser(&requestBody)
+
+	if err != nil {
+
+		return requestBody, fmt.Errorf("Cannot parse JSON")
+	}
+
+	requestBody.Code = strings.ToLower(strings.TrimSpace(requestBody.Code))
+
+	requestBody.Name = strings.TrimSpace(requestBody.Name)
+
+	if requestBody.Code == "" || len(requestBody.Code) > MaxWarehouseCodeLength || strings.ContainsAny(requestBody.Code, " /") {
+
+		return requestBody, fmt.Errorf("Invalid warehouse: code must be 1 to %d bytes long, without spaces or slashes", MaxWarehouseCodeLength)
+	}
+
+	if requestBody.Name == "" || len(requestBody.Name) > MaxWarehouseNameLength {
+
+		return requestBody, fmt.Errorf("Invalid warehouse: name must be non-empty and at most %d bytes long", MaxWarehouseNameLength)
+	}
+
+	return requestBody, nil
+}
+
+func warehouseID(c *fiber.Ctx) (uint, error) {
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+
+	if err != nil || id == 0 {
+
+		return 0, fmt.Errorf("invalid warehouse ID %q", c.Params("id"))
+	}
+
+	return uint(id), nil
+}
+
+// CreateWarehouse answers POST /v1/warehouses with 201 Created, the new warehouse and its Location
+func (products_api *ProductsAPI) CreateWarehouse(c *fiber.Ctx) error {
+
+	requestBody, err := parseWarehouseRequest(c)
+
+	if err != nil {
+
+		log.Printf("%v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": err.Error()})
+	}
+
+	log.Printf("Attempting to create warehouse %q", requestBody.Code)
+
+	warehouse, err := products_api.products.CreateWarehouse(requestBody.Code, requestBody.Name)
+
+	if err != nil {
+
+		return stockError(c, err, "Warehouse not found")
+	}
+
+	c.Location(fmt.Sprintf("/v1/warehouses/%d", warehouse.ID))
+
+	return c.Status(fiber.StatusCreated).JSON(newWarehouseResponse(warehouse))
+}
+
+// RetrieveWarehouses answers GET /v1/warehouses, the default warehouse first
+func (products_api *ProductsAPI) RetrieveWarehouses(c *fiber.Ctx) error {
+
+	warehouses, err := products_api.products.RetrieveWarehouses()
+
+	if err != nil {
+
+		return stockError(c, err, "Warehouse not found")
+	}
+
+	responses := make([]WarehouseResponse, 0, len(warehouses))
+
+	for _, warehouse := range warehouses {
+
+		responses = append(responses, newWarehouseResponse(warehouse))
+	}
+
+	return c.JSON(fiber.Map{"warehouses": responses})
+}
+
+func (products_api *ProductsAPI) RetrieveWarehouse(c *fiber.Ctx) error {
+
+	id, err := warehouseID(c)
+
+	if err != nil {
+
+		log.Printf("Invalid warehouse ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid warehouse ID. Please provide a valid ID"})
+	}
+
+	warehouse, err := products_api.products.RetrieveWarehouse(id)
+
+	if err != nil {
+
+		return stockError(c, err, "Warehouse not found")
+	}
+
+	return c.JSON(newWarehouseResponse(warehouse))
+}
+
+// ReplaceWarehouse answers PUT /v1/warehouses/:id with the renamed warehouse
+func (products_api *ProductsAPI) ReplaceWarehouse(c *fiber.Ctx) error {
+
+	id, err := warehouseID(c)
+
+	if err != nil {
+
+		log.Printf("Invalid warehouse ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid warehouse ID. Please provide a valid ID"})
+	}
+
+	requestBody, err := parseWarehouseRequest(c)
+
+	if err != nil {
+
+		log.Printf("%v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": err.Error()})
+	}
+
+	log.Printf("Attempting to update warehouse with ID %d", id)
+
+	err = products_api.products.UpdateWarehouse(id, requestBody.Code, requestBody.Name)
+
+	if err != nil {
+
+		return stockError(c, err, "Warehouse not found")
+	}
+
+	warehouse, err := products_api.products.RetrieveWarehouse(id)
+
+	if err != nil {
+
+		return stockError(c, err, "Warehouse not found")
+	}
+
+	return c.JSON(newWarehouseResponse(warehouse))
+}
+
+// DeleteWarehouse answers DELETE /v1/warehouses/:id. Warehouses still holding stock are refused.
+func (products_api *ProductsAPI) DeleteWarehouse(c *fiber.Ctx) error {
+
+	id, err := warehouseID(c)
+
+	if err != nil {
+
+		log.Printf("Invalid warehouse ID: %v", err)
+
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Error": "Invalid warehouse ID. Please provide a valid ID"})
+	}
+
+	log.Printf("Attempting to delete warehouse with ID %d", id)
+
+	err = products_api.products.DeleteWarehouse(id)
+
+	if err != nil {
+
+		return stockError(c, err, "Warehouse not found")
+	}
+
+	return c.JSON(fiber.Map{"message": "Warehouse deleted successfully", "warehouse_id": id})
+}
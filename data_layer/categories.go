@@ -0,0 +1,490 @@
+package data_layer
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Category is a node of the category hierarchy. Path is the materialized path of the category:
+// the IDs of its ancestors and its own, as in "/1/4/9/", so a subtree is every path starting with its root's.
+// SiblingKey is the parent ID, 0 for a root, and the lowercased name, as in "4/novels": unique, so that no two
+// children of a category share a name whatever its case.
+type Category struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	Name       string    `json:"name" gorm:"size:100;not null"`
+	ParentID   *uint     `json:"parent_id" gorm:"index"`
+	Path       string    `json:"path" gorm:"size:255;not null;index"`
+	SiblingKey string    `json:"-" gorm:"size:160;not null;uniqueIndex"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ProductCategory assigns a product to a category; a product may be in many categories
+type ProductCategory struct {
+	ProductID  uint `gorm:"primaryKey;autoIncrement:false"`
+	CategoryID uint `gorm:"primaryKey;autoIncrement:false;index"`
+}
+
+// CategoryNode is a category of the tree with its subcategories. ProductCount counts the live products
+// assigned to the category itself, TotalProductCount the distinct ones in its whole subtree.
+type CategoryNode struct {
+	Category
+	ProductCount      int
+	TotalProductCount int
+	Children          []*CategoryNode
+}
+
+var (
+	// ErrCategoryCycle is returned when a category would become its own ancestor
+	ErrCategoryCycle = errors.New("a category cannot be moved under itself or one of its subcategories")
+
+	// ErrCategoryNotEmpty is returned when deleting a category that still has subcategories
+	ErrCategoryNotEmpty = errors.New("the category has subcategories")
+
+	// ErrDuplicateCategory is returned when a category already has a subcategory of the same name, whatever its case
+	ErrDuplicateCategory = errors.New("a category with the same name already exists under the same parent")
+)
+
+// siblingKey is the SiblingKey of a category named name under parentID
+func siblingKey(parentID *uint, name string) string {
+
+	parent := uint(0)
+
+	if parentID != nil {
+
+		parent = *parentID
+	}
+
+	return strconv.FormatUint(uint64(parent), 10) + "/" + strings.ToLower(name)
+}
+
+// duplicateCategory reports the sibling name violations that got past checkSiblingName, under concurrent writes
+func duplicateCategory(err error) error {
+
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+
+		return ErrDuplicateCategory
+	}
+
+	return err
+}
+
+// categoryPath is the path of the category id under a parent path, "/" for the root
+func categoryPath(parentPath string, id uint) string {
+
+	return parentPath + strconv.FormatUint(uint64(id), 10) + "/"
+}
+
+// subtreePattern matches the paths of a category and all its descendants, without knowing its path
+func subtreePattern(id uint) string {
+
+	return "%/" + strconv.FormatUint(uint64(id), 10) + "/%"
+}
+
+// ancestors returns the IDs of a path, the root first and the category itself last
+func ancestors(path string) []uint {
+
+	var ids []uint
+
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+
+		id, err := strconv.ParseUint(segment, 10, 64)
+
+		if err == nil {
+
+			ids = append(ids, uint(id))
+		}
+	}
+
+	return ids
+}
+
+// parentPath returns the path of the parent category, "/" for the root, or gorm.ErrRecordNotFound
+func parentPath(tx *gorm.DB, parentID *uint) (string, error) {
+
+	if parentID == nil {
+
+		return "/", nil
+	}
+
+	parent, err := RetrieveCategory(tx, *parentID)
+
+	if err != nil {
+
+		return "", err
+	}
+
+	return parent.Path, nil
+}
+
+// checkSiblingName fails with ErrDuplicateCategory when another child of the parent has the name, whatever its case
+func checkSiblingName(tx *gorm.DB, parentID *uint, name string, id uint) error {
+
+	var count int64
+
+	err := tx.Model(&Category{}).Where("sibling_key = ? AND id <> ?", siblingKey(parentID, name), id).Count(&count).Error
+
+	if err != nil {
+
+		return err
+	}
+
+	if count > 0 {
+
+		return ErrDuplicateCategory
+	}
+
+	return nil
+}
+
+func CreateCategory(products_db *gorm.DB, name string, parentID *uint) (Category, error) {
+
+	category := Category{Name: name, ParentID: parentID, SiblingKey: siblingKey(parentID, name)}
+
+	err := products_db.Transaction(func(tx *gorm.DB) error {
+
+		path, err := parentPath(tx, parentID)
+
+		if err != nil {
+
+			return err
+		}
+
+		err = checkSiblingName(tx, parentID, name, 0)
+
+		if err != nil {
+
+			return err
+		}
+
+		// The path ends with the ID, known once the row exists
+		category.Path = path
+
+		err = tx.Create(&category).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		category.Path = categoryPath(path, category.ID)
+
+		return tx.Model(&category).Update("path", category.Path).Error
+	})
+
+	if err != nil {
+
+		return Category{}, duplicateCategory(err)
+	}
+
+	return category, nil
+}
+
+func RetrieveCategory(products_db *gorm.DB, id uint) (Category, error) {
+
+	var category Category
+
+	result := products_db.First(&category, id)
+
+	if result.Error != nil {
+
+		return Category{}, result.Error
+	}
+
+	return category, nil
+}
+
+// RetrieveCategories returns every category, parents before their children
+func RetrieveCategories(products_db *gorm.DB) ([]Category, error) {
+
+	var categories []Category
+
+	result := products_db.Order("path").Find(&categories)
+
+	if result.Error != nil {
+
+		return nil, result.Error
+	}
+
+	return categories, nil
+}
+
+// UpdateCategory renames a category and moves it, with its whole subtree, under parentID (nil for the root)
+func UpdateCategory(products_db *gorm.DB, id uint, name string, parentID *uint) error {
+
+	err := products_db.Transaction(func(tx *gorm.DB) error {
+
+		category, err := RetrieveCategory(tx, id)
+
+		if err != nil {
+
+			return err
+		}
+
+		path, err := parentPath(tx, parentID)
+
+		if err != nil {
+
+			return err
+		}
+
+		newPath := categoryPath(path, id)
+
+		if strings.HasPrefix(path, category.Path) {
+
+			return ErrCategoryCycle
+		}
+
+		err = checkSiblingName(tx, parentID, name, id)
+
+		if err != nil {
+
+			return err
+		}
+
+		if newPath != category.Path {
+
+			var descendants []Category
+
+			err = tx.Where("path LIKE ? AND id <> ?", category.Path+"%", id).Find(&descendants).Error
+
+			if err != nil {
+
+				return err
+			}
+
+			for _, descendant := range descendants {
+
+				err = tx.Model(&descendant).Update("path", newPath+strings.TrimPrefix(descendant.Path, category.Path)).Error
+
+				if err != nil {
+
+					return err
+				}
+			}
+		}
+
+		return tx.Model(&category).Select("name", "parent_id", "path", "sibling_key").Updates(Category{Name: name, ParentID: parentID, Path: newPath, SiblingKey: siblingKey(parentID, name)}).Error
+	})
+
+	return duplicateCategory(err)
+}
+
+// DeleteCategory removes a category without subcategories, and unassigns its products
+func DeleteCategory(products_db *gorm.DB, id uint) error {
+
+	return products_db.Transaction(func(tx *gorm.DB) error {
+
+		_, err := RetrieveCategory(tx, id)
+
+		if err != nil {
+
+			return err
+		}
+
+		var children int64
+
+		err = tx.Model(&Category{}).Where("parent_id = ?", id).Count(&children).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		if children > 0 {
+
+			return ErrCategoryNotEmpty
+		}
+
+		err = tx.Where("category_id = ?", id).Delete(&ProductCategory{}).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		return tx.Delete(&Category{}, id).Error
+	})
+}
+
+// AssignProductCategory puts a live product in a category; assigning it twice changes nothing
+func AssignProductCategory(products_db *gorm.DB, productID int, categoryID uint) error {
+
+	return products_db.Transaction(func(tx *gorm.DB) error {
+
+		_, err := RetrieveProduct(tx, productID, false)
+
+		if err != nil {
+
+			return err
+		}
+
+		_, err = RetrieveCategory(tx, categoryID)
+
+		if err != nil {
+
+			return err
+		}
+
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ProductCategory{ProductID: uint(productID), CategoryID: categoryID}).Error
+	})
+}
+
+func UnassignProductCategory(products_db *gorm.DB, productID int, categoryID uint) error {
+
+	result := products_db.Where("product_id = ? AND category_id = ?", productID, categoryID).Delete(&ProductCategory{})
+
+	if result.Error != nil {
+
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// RetrieveProductCategories returns the categories of a live product
+func RetrieveProductCategories(products_db *gorm.DB, productID int) ([]Category, error) {
+
+	_, err := RetrieveProduct(products_db, productID, false)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	var categories []Category
+
+	result := products_db.Joins("JOIN product_categories ON product_categories.category_id = categories.id").
+		Where("product_categories.product_id = ?", productID).Order("categories.path").Find(&categories)
+
+	if result.Error != nil {
+
+		return nil, result.Error
+	}
+
+	return categories, nil
+}
+
+// RetrieveCategoryTree returns the root categories with their subcategories and the counts of their live products
+// in one of the statuses, or in any when statuses is empty
+func RetrieveCategoryTree(products_db *gorm.DB, statuses []string) ([]*CategoryNode, error) {
+
+	categories, err := RetrieveCategories(products_db)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	var links []ProductCategory
+
+	query := products_db.Model(&ProductCategory{}).Select("product_categories.product_id, product_categories.category_id").
+		Joins("JOIN products ON products.id = product_categories.product_id AND products.deleted_at IS NULL")
+
+	if len(statuses) > 0 {
+
+		query = query.Where("products.status IN ?", statuses)
+	}
+
+	result := query.Scan(&links)
+
+	if result.Error != nil {
+
+		return nil, result.Error
+	}
+
+	return buildCategoryTree(categories, links), nil
+}
+
+// buildCategoryTree nests the categories and counts the products of the links, per category and per subtree
+func buildCategoryTree(categories []Category, links []ProductCategory) []*CategoryNode {
+
+	nodes := make(map[uint]*CategoryNode, len(categories))
+
+	for _, category := range categories {
+
+		nodes[category.ID] = &CategoryNode{Category: category, Children: []*CategoryNode{}}
+	}
+
+	subtrees := make(map[uint]map[uint]struct{})
+
+	for _, link := range links {
+
+		node, found := nodes[link.CategoryID]
+
+		if !found {
+
+			continue
+		}
+
+		node.ProductCount++
+
+		for _, ancestorID := range ancestors(node.Path) {
+
+			if subtrees[ancestorID] == nil {
+
+				subtrees[ancestorID] = make(map[uint]struct{})
+			}
+
+			subtrees[ancestorID][link.ProductID] = struct{}{}
+		}
+	}
+
+	roots := []*CategoryNode{}
+
+	for _, category := range categories {
+
+		node := nodes[category.ID]
+
+		node.TotalProductCount = len(subtrees[category.ID])
+
+		parent, found := (*CategoryNode)(nil), false
+
+		if category.ParentID != nil {
+
+			parent, found = nodes[*category.ParentID]
+		}
+
+		if found {
+
+			parent.Children = append(parent.Children, node)
+
+		} else {
+
+			roots = append(roots, node)
+		}
+	}
+
+	sortCategoryNodes(roots)
+
+	return roots
+}
+
+// sortCategoryNodes orders every level of the tree by name
+func sortCategoryNodes(nodes []*CategoryNode) {
+
+	sort.Slice(nodes, func(i, j int) bool {
+
+		if nodes[i].Name != nodes[j].Name {
+
+			return nodes[i].Name < nodes[j].Name
+		}
+
+		return nodes[i].ID < nodes[j].ID
+	})
+
+	for _, node := range nodes {
+
+		sortCategoryNodes(node.Children)
+	}
+}
@@ -2,44 +2,35 @@ package data_layer
 
 import (
 	"errors"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"os"
 	"log"
+	"time"
 )
 
-// Product model definition
+// Product model definition. Price is kept in integer minor units of Currency.
+// Version starts at 1 and grows with every write, for optimistic concurrency control.
+// SKU and GTIN are optional, and unique among all the products, deleted or not.
+// Status is the lifecycle status; PublishAt and UnpublishAt schedule its next changes, see ApplyProductSchedules.
 type Product struct {
 	gorm.Model
-	Name  string  `json:"name"`
-	Price float64 `json:"price"`
+	Name        string     `json:"name"`
+	Price       Amount     `json:"price" gorm:"column:price_minor"`
+	Currency    string     `json:"currency" gorm:"size:3"`
+	Version     uint       `json:"version" gorm:"not null;default:1"`
+	SKU         *string    `json:"sku" gorm:"column:sku;size:64;uniqueIndex"`
+	GTIN        *string    `json:"gtin" gorm:"column:gtin;size:14;uniqueIndex"`
+	Status      string     `json:"status" gorm:"size:10;not null;default:active;index"`
+	PublishAt   *time.Time `json:"publish_at" gorm:"index"`
+	UnpublishAt *time.Time `json:"unpublish_at" gorm:"index"`
 }
 
 
 
-func ProductsDB() (*gorm.DB, error) {
-	
-	products_db, err := gorm.Open(sqlite.Open("simpler_home_test.db"), &gorm.Config{})
-	
-	if err != nil {
-
-		return nil, err
-	}
-
-	err = products_db.AutoMigrate(&Product{})
-	
-	if err != nil {
-
-		return nil, err
-	}
-
-	return products_db, nil
-}
-
 func DestroyProductsDB() {
 
 	// Remove the database file (for SQLite)
-	err := os.Remove("simpler_home_test.db")
+	err := os.Remove(DefaultProductsDBPath)
 	
 	if err != nil {
 		
@@ -51,9 +42,9 @@ func DestroyProductsDB() {
 	}
 }
 
-func InsertProduct(products_db *gorm.DB, name string, price float64) (uint, error) {
+func InsertProduct(products_db *gorm.DB, name string, price Amount, currency string) (uint, error) {
 	
-	product := Product{Name: name, Price: price}
+	product := Product{Name: name, Price: price, Currency: currency, Version: 1, Status: StatusActive}
 	
 	result := products_db.Create(&product)
 	
@@ -65,33 +56,83 @@ func InsertProduct(products_db *gorm.DB, name string, price float64) (uint, erro
 	return product.ID, nil
 }
 
-func DeleteProduct(products_db *gorm.DB, id int) error {
+// Number of rows written by each INSERT of InsertProducts
+const InsertBatchSize = 100
 
-	var product Product
+// InsertProducts inserts products in one transaction, InsertBatchSize rows per statement, and returns their IDs in order.
+// Either every product is inserted or none is: an invalid SKU or GTIN fails with ErrInvalidSKU or ErrInvalidGTIN,
+// and one already taken, or given twice, with ErrDuplicateProduct. Statuses and schedules follow NormalizeProductLifecycle.
+func InsertProducts(products_db *gorm.DB, products []Product) ([]uint, error) {
 
-	result := products_db.Unscoped().Delete(&product, id)
+	rows, err := newProductRows(products)
 
-	if result.Error != nil {
-		
-		return result.Error
-	
+	if err != nil {
+
+		return nil, err
 	}
 
-	if result.RowsAffected == 0 {
-		
-		return gorm.ErrRecordNotFound
-	
+	err = products_db.Transaction(func(tx *gorm.DB) error {
+
+		err := checkProductIdentifiers(tx, rows, 0)
+
+		if err != nil {
+
+			return err
+		}
+
+		return tx.CreateInBatches(&rows, InsertBatchSize).Error
+	})
+
+	if err != nil {
+
+		return nil, duplicateProduct(err)
 	}
 
-	return nil
-	
+	ids := make([]uint, len(rows))
+
+	for i, row := range rows {
+
+		ids[i] = row.ID
+	}
+
+	return ids, nil
 }
 
-func UpdateProductName(products_db *gorm.DB, id int, name string) error {
+// newProductRows copies the fields of the products a caller can set, with their identifiers and lifecycle normalized
+func newProductRows(products []Product) ([]Product, error) {
 
-	var product Product
+	rows := make([]Product, len(products))
+
+	for i, product := range products {
+
+		rows[i] = Product{Name: product.Name, Price: product.Price, Currency: product.Currency, Version: 1, SKU: product.SKU, GTIN: product.GTIN, Status: product.Status, PublishAt: product.PublishAt, UnpublishAt: product.UnpublishAt}
+
+		err := NormalizeProductIdentifiers(&rows[i])
 
-	result := products_db.Model(&product).Where("id = ?", id).Update("name", name)
+		if err == nil {
+
+			err = NormalizeProductLifecycle(&rows[i])
+		}
+
+		if err != nil {
+
+			return nil, err
+		}
+	}
+
+	return rows, nil
+}
+
+// DeleteProduct soft-deletes a product: it disappears from retrievals but can be restored until purged
+func DeleteProduct(products_db *gorm.DB, id int, expectedVersion uint) error {
+
+	return updateVersioned(products_db, id, expectedVersion, map[string]interface{}{"deleted_at": time.Now()})
+}
+
+// RestoreProduct brings a soft-deleted product back
+func RestoreProduct(products_db *gorm.DB, id int) error {
+
+	result := products_db.Unscoped().Model(&Product{}).Where("id = ? AND deleted_at IS NOT NULL", id).Updates(map[string]interface{}{"deleted_at": nil, "updated_at": time.Now(), "version": nextVersion()})
 
 	if result.Error != nil {
 		return result.Error
@@ -104,27 +145,258 @@ func UpdateProductName(products_db *gorm.DB, id int, name string) error {
 	return nil
 }
 
-func UpdateProductPrice(products_db *gorm.DB, id int, price float64) error {
+// PurgeProduct removes a product for good, whether it was soft-deleted or not
+func PurgeProduct(products_db *gorm.DB, id int, expectedVersion uint) error {
 
-	var product Product
+	return products_db.Transaction(func(tx *gorm.DB) error {
 
-	result := products_db.Model(&product).Where("id = ?", id).Update("price", price)
+		var product Product
+
+		result := whereVersion(tx.Unscoped(), expectedVersion).Delete(&product, id)
+
+		if result.Error != nil {
+			
+			return result.Error
+		
+		}
+
+		if result.RowsAffected == 0 {
+			
+			return missedWrite(tx, id, expectedVersion, true)
+		
+		}
+
+		// Explicit prices in other currencies and category assignments go away with the product
+		return deleteProductAttachments(tx, []int{id})
+	})
+}
+
+// deleteProductAttachments removes the rows attached to the products, given as IDs or as a subquery selecting them
+func deleteProductAttachments(tx *gorm.DB, ids interface{}) error {
+
+	for _, model := range []interface{}{&ProductPrice{}, &ProductCategory{}, &ProductTag{}, &StockLevel{}, &StockMovement{}, &StockHold{}, &ProductVariant{}} {
+
+		err := tx.Where("product_id IN (?)", ids).Delete(model).Error
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PurgeDeletedProducts removes for good every product soft-deleted before the cutoff and returns how many
+func PurgeDeletedProducts(products_db *gorm.DB, deletedBefore time.Time) (int64, error) {
+
+	var purged int64
+
+	err := products_db.Transaction(func(tx *gorm.DB) error {
+
+		expired := tx.Unscoped().Model(&Product{}).Select("id").Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore)
+
+		err := deleteProductAttachments(tx, expired)
+
+		if err != nil {
+
+			return err
+		}
+
+		result := tx.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore).Delete(&Product{})
+
+		purged = result.RowsAffected
 
-	if result.Error != nil {
 		return result.Error
+	})
+
+	if err != nil {
+
+		return 0, err
 	}
-	
-	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
+
+	return purged, nil
+}
+
+func UpdateProductName(products_db *gorm.DB, id int, name string, expectedVersion uint) error {
+
+	return updateVersioned(products_db, id, expectedVersion, map[string]interface{}{"name": name})
+}
+
+func UpdateProductPrice(products_db *gorm.DB, id int, price Amount, expectedVersion uint) error {
+
+	return updateVersioned(products_db, id, expectedVersion, map[string]interface{}{"price_minor": price})
+}
+
+// ProductChanges lists the fields written by UpdateProduct; nil fields are left as they are.
+// An empty SKU or GTIN removes it from the product, and so does a zero PublishAt or UnpublishAt.
+// Status moves the product along its lifecycle, failing with ErrStatusTransition when that is not allowed.
+type ProductChanges struct {
+	Name        *string
+	Price       *Amount
+	Currency    *string
+	SKU         *string
+	GTIN        *string
+	Status      *string
+	PublishAt   *time.Time
+	UnpublishAt *time.Time
+}
+
+// identifierChanges normalizes the SKU and GTIN of the changes, and returns them as the product they would give
+func (changes ProductChanges) identifierChanges() (Product, error) {
+
+	var product Product
+
+	var err error
+
+	if changes.SKU != nil {
+
+		product.SKU, err = normalizeIdentifier(changes.SKU, NormalizeSKU)
+
+		if err != nil {
+
+			return Product{}, err
+		}
 	}
 
-	return nil
+	if changes.GTIN != nil {
+
+		product.GTIN, err = normalizeIdentifier(changes.GTIN, NormalizeGTIN)
+
+		if err != nil {
+
+			return Product{}, err
+		}
+	}
+
+	return product, nil
 }
 
-func RetrieveProduct(products_db *gorm.DB, id int) (Product, error) {
+// UpdateProduct writes all the changed fields of a product at once, in a single transaction.
+// An explicit price in the new base currency is dropped, since the base price takes its place.
+func UpdateProduct(products_db *gorm.DB, id int, changes ProductChanges, expectedVersion uint) error {
+
+	identifiers, err := changes.identifierChanges()
+
+	if err != nil {
+
+		return err
+	}
+
+	err = products_db.Transaction(func(tx *gorm.DB) error {
+
+		columns := make(map[string]interface{})
+
+		if changes.SKU != nil || changes.GTIN != nil || changes.changesLifecycle() {
+
+			// Missing products are reported before taken identifiers and refused transitions
+			product, err := RetrieveProduct(tx, id, false)
+
+			if err != nil {
+
+				return err
+			}
+
+			err = checkProductIdentifiers(tx, []Product{identifiers}, uint(id))
+
+			if err != nil {
+
+				return err
+			}
+
+			if changes.changesLifecycle() {
+
+				err = checkVersion(product, expectedVersion)
+
+				if err != nil {
+
+					return err
+				}
+
+				lifecycle, err := changes.lifecycleChanges(product)
+
+				if err != nil {
+
+					return err
+				}
+
+				columns["status"] = lifecycle.Status
+
+				columns["publish_at"] = lifecycle.PublishAt
+
+				columns["unpublish_at"] = lifecycle.UnpublishAt
+
+				// The transition was checked on this version: another write in between makes it a version conflict
+				expectedVersion = product.Version
+			}
+		}
+
+		if changes.SKU != nil {
+
+			columns["sku"] = identifiers.SKU
+		}
+
+		if changes.GTIN != nil {
+
+			columns["gtin"] = identifiers.GTIN
+		}
+
+		if changes.Name != nil {
+
+			columns["name"] = *changes.Name
+		}
+
+		if changes.Price != nil {
+
+			columns["price_minor"] = *changes.Price
+		}
+
+		if changes.Currency != nil {
+
+			columns["currency"] = *changes.Currency
+		}
+
+		// Nothing to write, but the product must still exist at the expected version
+		if len(columns) == 0 {
+
+			product, err := RetrieveProduct(tx, id, false)
+
+			if err != nil {
+
+				return err
+			}
+
+			return checkVersion(product, expectedVersion)
+		}
+
+		err := updateVersioned(tx, id, expectedVersion, columns)
+
+		if err != nil {
+
+			return err
+		}
+
+		if changes.Currency == nil {
+
+			return nil
+		}
+
+		return tx.Where("product_id = ? AND currency = ?", id, *changes.Currency).Delete(&ProductPrice{}).Error
+	})
+
+	return duplicateProduct(err)
+}
+
+// RetrieveProduct hides soft-deleted products unless includeDeleted is set
+func RetrieveProduct(products_db *gorm.DB, id int, includeDeleted bool) (Product, error) {
 
 	var product Product
 
+	if includeDeleted {
+
+		products_db = products_db.Unscoped()
+	}
+
 	result := products_db.First(&product, id)
 
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
@@ -139,11 +411,12 @@ func RetrieveProduct(products_db *gorm.DB, id int) (Product, error) {
 	return product, nil
 }
 
-func RetrieveProductsWithPagination(products_db *gorm.DB, offset int, limit int) ([]Product, error) {
+// RetrieveProductsWithPagination returns one page of the products matching the filter, in the given order
+func RetrieveProductsWithPagination(products_db *gorm.DB, filter ProductFilter, productSort ProductSort, offset int, limit int) ([]Product, error) {
 
 	var products []Product
 
-	result := products_db.Limit(limit).Offset(offset).Find(&products)
+	result := applyProductSort(applyProductFilter(products_db, filter), productSort).Limit(limit).Offset(offset).Find(&products)
 
 	if result.Error != nil {
 
@@ -153,13 +426,69 @@ func RetrieveProductsWithPagination(products_db *gorm.DB, offset int, limit int)
 	return products, nil
 }
 
-func GetTotalNumberOfProducts(products_db *gorm.DB) (int64, error) {
+// RetrieveProductsWithCursor returns up to limit products matching the filter that come after the cursor,
+// or right before it when the cursor reads backwards, in the order of the cursor sort
+func RetrieveProductsWithCursor(products_db *gorm.DB, filter ProductFilter, cursor ProductCursor, limit int) ([]Product, error) {
+
+	var products []Product
+
+	result := applyProductCursor(applyProductFilter(products_db, filter), cursor).Limit(limit).Find(&products)
+
+	if result.Error != nil {
+
+		return nil, result.Error
+	}
+
+	if cursor.Backward {
+
+		reverseProducts(products)
+	}
+
+	return products, nil
+}
+
+// StreamProducts calls visit on every product matching the filter, in sort order, reading them one at a time
+// from a database cursor. It stops at the first error visit returns.
+func StreamProducts(products_db *gorm.DB, filter ProductFilter, productSort ProductSort, visit func(Product) error) error {
+
+	rows, err := applyProductSort(applyProductFilter(products_db.Model(&Product{}), filter), productSort).Rows()
+
+	if err != nil {
+
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var product Product
+
+		err = products_db.ScanRows(rows, &product)
+
+		if err != nil {
+
+			return err
+		}
+
+		err = visit(product)
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func GetTotalNumberOfProducts(products_db *gorm.DB, filter ProductFilter) (int64, error) {
 
 	var totalRecords int64
 
 	var product Product
 
-	result := products_db.Model(product).Count(&totalRecords)
+	result := applyProductFilter(products_db.Model(product), filter).Count(&totalRecords)
 
 	if result.Error != nil {
 
@@ -0,0 +1,320 @@
+package data_layer
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Number of decimal places kept by an exchange Rate
+const RateScale = 8
+
+// Rate is an exact exchange rate stored as an integer scaled by 10^RateScale.
+// Like Amount it is written as a JSON number and read from a JSON number or string.
+type Rate int64
+
+// ProductPrice is an explicit price of a product in a currency other than its base currency
+type ProductPrice struct {
+	ID        uint      `json:"-" gorm:"primarykey"`
+	ProductID uint      `json:"product_id" gorm:"not null;uniqueIndex:idx_product_prices_product_currency"`
+	Currency  string    `json:"currency" gorm:"size:3;not null;uniqueIndex:idx_product_prices_product_currency"`
+	Price     Amount    `json:"price" gorm:"column:price_minor;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ExchangeRate says that one unit of BaseCurrency is worth Rate units of QuoteCurrency
+type ExchangeRate struct {
+	ID            uint      `json:"-" gorm:"primarykey"`
+	BaseCurrency  string    `json:"base" gorm:"size:3;not null;uniqueIndex:idx_exchange_rates_pair"`
+	QuoteCurrency string    `json:"quote" gorm:"size:3;not null;uniqueIndex:idx_exchange_rates_pair"`
+	Rate          Rate      `json:"rate" gorm:"column:rate_scaled;not null"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Where a resolved price comes from
+type PriceSource string
+
+const (
+	PriceSourceBase         PriceSource = "base"
+	PriceSourceExplicit     PriceSource = "explicit"
+	PriceSourceExchangeRate PriceSource = "exchange_rate"
+)
+
+// ErrNoExchangeRate is returned when a price cannot be converted into the requested currency
+var ErrNoExchangeRate = errors.New("no exchange rate available")
+
+func ParseRate(text string) (Rate, error) {
+
+	value, err := parseDecimal(text, RateScale)
+
+	if err != nil {
+
+		return 0, fmt.Errorf("invalid exchange rate %q: %w", text, err)
+	}
+
+	return Rate(value), nil
+}
+
+func MustParseRate(text string) Rate {
+
+	rate, err := ParseRate(text)
+
+	if err != nil {
+
+		panic(err)
+	}
+
+	return rate
+}
+
+func (rate Rate) String() string {
+
+	return formatDecimal(int64(rate), RateScale, 1)
+}
+
+func (rate Rate) MarshalJSON() ([]byte, error) {
+
+	return []byte(rate.String()), nil
+}
+
+func (rate *Rate) UnmarshalJSON(data []byte) error {
+
+	text, isNull, err := decimalText(data)
+
+	if err != nil || isNull {
+
+		return err
+	}
+
+	parsed, err := ParseRate(text)
+
+	if err != nil {
+
+		return err
+	}
+
+	*rate = parsed
+
+	return nil
+}
+
+// ratio returns the rate as an exact fraction
+func (rate Rate) ratio() *big.Rat {
+
+	return new(big.Rat).SetFrac(big.NewInt(int64(rate)), new(big.Int).Exp(big.NewInt(10), big.NewInt(RateScale), nil))
+}
+
+// How converted amounts are rounded to a multiple of a RoundingRule increment
+type RoundingMode string
+
+const (
+	RoundHalfUp   RoundingMode = "half_up"
+	RoundHalfEven RoundingMode = "half_even"
+	RoundUp       RoundingMode = "up"
+	RoundDown     RoundingMode = "down"
+)
+
+// RoundingRule rounds converted prices of one currency, e.g. to whole yen or to 0.05 francs
+type RoundingRule struct {
+	Increment Amount
+	Mode      RoundingMode
+}
+
+// RoundingRules maps currency codes to their rounding rule; other currencies round half up to the cent
+type RoundingRules map[string]RoundingRule
+
+func DefaultRoundingRules() RoundingRules {
+
+	return RoundingRules{"JPY": {Increment: MustParseAmount("1"), Mode: RoundHalfUp}}
+}
+
+func (rules RoundingRules) For(currency string) RoundingRule {
+
+	if rule, found := rules[currency]; found {
+
+		return rule
+	}
+
+	return RoundingRule{Increment: 1, Mode: RoundHalfUp}
+}
+
+// ParseRoundingRules reads rules written as "JPY=1:half_up,CHF=0.05" (the mode defaults to half_up)
+// on top of the default rules
+func ParseRoundingRules(spec string) (RoundingRules, error) {
+
+	rules := DefaultRoundingRules()
+
+	for _, entry := range strings.Split(spec, ",") {
+
+		entry = strings.TrimSpace(entry)
+
+		if entry == "" {
+
+			continue
+		}
+
+		currency, setting, found := strings.Cut(entry, "=")
+
+		if !found {
+
+			return nil, fmt.Errorf("invalid rounding rule %q: expected CURRENCY=INCREMENT[:MODE]", entry)
+		}
+
+		currency, err := NormalizeCurrency(currency)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		incrementText, modeText, _ := strings.Cut(setting, ":")
+
+		increment, err := ParseAmount(incrementText)
+
+		if err != nil || increment <= 0 {
+
+			return nil, fmt.Errorf("invalid rounding increment in %q: must be a positive amount", entry)
+		}
+
+		mode := RoundingMode(modeText)
+
+		if mode == "" {
+
+			mode = RoundHalfUp
+		}
+
+		if mode != RoundHalfUp && mode != RoundHalfEven && mode != RoundUp && mode != RoundDown {
+
+			return nil, fmt.Errorf("invalid rounding mode %q: expected half_up, half_even, up or down", modeText)
+		}
+
+		rules[currency] = RoundingRule{Increment: increment, Mode: mode}
+	}
+
+	return rules, nil
+}
+
+// Round brings an exact amount of minor units to a multiple of the rule increment
+func (rule RoundingRule) Round(exact *big.Rat) Amount {
+
+	increment := int64(rule.Increment)
+
+	if increment <= 0 {
+
+		increment = 1
+	}
+
+	steps := new(big.Rat).Quo(exact, new(big.Rat).SetInt64(increment))
+
+	quotient, remainder := new(big.Int).QuoRem(steps.Num(), steps.Denom(), new(big.Int))
+
+	// QuoRem truncates towards zero; the mode decides whether to step one increment away from zero
+	if remainder.Sign() != 0 {
+
+		doubled := new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2))
+
+		half := doubled.Cmp(steps.Denom())
+
+		awayFromZero := false
+
+		switch rule.Mode {
+
+		case RoundUp:
+
+			awayFromZero = steps.Sign() > 0
+
+		case RoundDown:
+
+			awayFromZero = steps.Sign() < 0
+
+		case RoundHalfEven:
+
+			awayFromZero = half > 0 || (half == 0 && quotient.Bit(0) == 1)
+
+		default:
+
+			awayFromZero = half >= 0
+		}
+
+		if awayFromZero {
+
+			quotient.Add(quotient, big.NewInt(int64(steps.Sign())))
+		}
+	}
+
+	return Amount(quotient.Int64() * increment)
+}
+
+// ExchangeRateTable answers conversions from a snapshot of the exchange-rate table.
+// A missing pair is derived from its inverse when that one is known.
+type ExchangeRateTable map[[2]string]Rate
+
+func NewExchangeRateTable(rates []ExchangeRate) ExchangeRateTable {
+
+	table := make(ExchangeRateTable)
+
+	for _, rate := range rates {
+
+		table[[2]string{rate.BaseCurrency, rate.QuoteCurrency}] = rate.Rate
+	}
+
+	return table
+}
+
+func (table ExchangeRateTable) factor(from string, to string) (*big.Rat, bool) {
+
+	if rate, found := table[[2]string{from, to}]; found && rate > 0 {
+
+		return rate.ratio(), true
+	}
+
+	if rate, found := table[[2]string{to, from}]; found && rate > 0 {
+
+		return new(big.Rat).Inv(rate.ratio()), true
+	}
+
+	return nil, false
+}
+
+// Convert expresses amount (in currency from) in currency to, rounded with rule
+func (table ExchangeRateTable) Convert(amount Amount, from string, to string, rule RoundingRule) (Amount, error) {
+
+	factor, found := table.factor(from, to)
+
+	if !found {
+
+		return 0, fmt.Errorf("%w from %s to %s", ErrNoExchangeRate, from, to)
+	}
+
+	exact := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(amount)), factor)
+
+	return rule.Round(exact), nil
+}
+
+// PriceInCurrency resolves what a product costs in currency: its base price when the currencies match,
+// then an explicit price, and finally a conversion of the base price through the exchange-rate table
+func PriceInCurrency(product Product, currency string, explicit map[string]Amount, table ExchangeRateTable, rules RoundingRules) (Amount, PriceSource, error) {
+
+	if product.Currency == currency {
+
+		return product.Price, PriceSourceBase, nil
+	}
+
+	if price, found := explicit[currency]; found {
+
+		return price, PriceSourceExplicit, nil
+	}
+
+	converted, err := table.Convert(product.Price, product.Currency, currency, rules.For(currency))
+
+	if err != nil {
+
+		return 0, "", err
+	}
+
+	return converted, PriceSourceExchangeRate, nil
+}
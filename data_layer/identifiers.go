@@ -0,0 +1,346 @@
+package data_layer
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// MaxSKULength is the size of the sku columns of products and variants
+const MaxSKULength = 64
+
+var (
+	// ErrInvalidSKU is returned for SKUs that are longer than MaxSKULength or contain anything but letters, digits, -, _ and .
+	ErrInvalidSKU = errors.New("a SKU must have 1 to 64 letters, digits, -, _ or .")
+
+	// ErrInvalidGTIN is returned for barcodes that are not 8, 12, 13 or 14 digits long, or whose check digit is wrong
+	ErrInvalidGTIN = errors.New("a GTIN must have 8, 12, 13 or 14 digits and a valid check digit")
+
+	// ErrDuplicateProduct is returned when another product, deleted or not, has the same SKU or GTIN, or a variant
+	// has the same SKU: products and variants share a single SKU namespace
+	ErrDuplicateProduct = errors.New("a product with the same SKU or GTIN, or a variant with the same SKU, already exists")
+)
+
+// NormalizeSKU trims and uppercases a SKU, made of 1 to 64 letters, digits, -, _ or .
+func NormalizeSKU(sku string) (string, error) {
+
+	sku = strings.ToUpper(strings.TrimSpace(sku))
+
+	if sku == "" || len(sku) > MaxSKULength {
+
+		return "", ErrInvalidSKU
+	}
+
+	for _, r := range sku {
+
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' && r != '_' && r != '.' {
+
+			return "", ErrInvalidSKU
+		}
+	}
+
+	return sku, nil
+}
+
+// NormalizeGTIN drops the spaces and hyphens of an EAN/UPC barcode, and checks its length and GS1 check digit
+func NormalizeGTIN(gtin string) (string, error) {
+
+	gtin = strings.NewReplacer(" ", "", "-", "").Replace(gtin)
+
+	switch len(gtin) {
+
+	case 8, 12, 13, 14:
+
+	default:
+
+		return "", ErrInvalidGTIN
+	}
+
+	sum := 0
+
+	// Weights alternate 3, 1, 3... from the digit left of the check digit
+	for i := len(gtin) - 1; i >= 0; i-- {
+
+		if gtin[i] < '0' || gtin[i] > '9' {
+
+			return "", ErrInvalidGTIN
+		}
+
+		digit := int(gtin[i] - '0')
+
+		if i == len(gtin)-1 {
+
+			continue
+		}
+
+		if (len(gtin)-1-i)%2 == 1 {
+
+			sum += 3 * digit
+
+		} else {
+
+			sum += digit
+		}
+	}
+
+	if (10-sum%10)%10 != int(gtin[len(gtin)-1]-'0') {
+
+		return "", ErrInvalidGTIN
+	}
+
+	return gtin, nil
+}
+
+// normalizeIdentifier normalizes an optional SKU or GTIN; empty ones are cleared
+func normalizeIdentifier(value *string, normalize func(string) (string, error)) (*string, error) {
+
+	if value == nil || strings.TrimSpace(*value) == "" {
+
+		return nil, nil
+	}
+
+	normalized, err := normalize(*value)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	return &normalized, nil
+}
+
+// NormalizeProductIdentifiers normalizes the SKU and GTIN of a product in place
+func NormalizeProductIdentifiers(product *Product) error {
+
+	sku, err := normalizeIdentifier(product.SKU, NormalizeSKU)
+
+	if err != nil {
+
+		return err
+	}
+
+	gtin, err := normalizeIdentifier(product.GTIN, NormalizeGTIN)
+
+	if err != nil {
+
+		return err
+	}
+
+	product.SKU = sku
+
+	product.GTIN = gtin
+
+	return nil
+}
+
+// DuplicateProductError names the product of an insert or update whose SKU or GTIN is taken. Index is its
+// position among the products written together; it is matched by errors.Is on ErrDuplicateProduct and reads the same.
+type DuplicateProductError struct {
+	Index int
+}
+
+func (err *DuplicateProductError) Error() string {
+
+	return ErrDuplicateProduct.Error()
+}
+
+func (err *DuplicateProductError) Unwrap() error {
+
+	return ErrDuplicateProduct
+}
+
+// identifierKeys returns the keys of the SKU and GTIN of a product, as used to compare identifiers
+func identifierKeys(product Product) []string {
+
+	keys := []string{}
+
+	if product.SKU != nil {
+
+		keys = append(keys, "sku:"+*product.SKU)
+	}
+
+	if product.GTIN != nil {
+
+		keys = append(keys, "gtin:"+*product.GTIN)
+	}
+
+	return keys
+}
+
+// takenIdentifier returns a *DuplicateProductError for the first of the products with an identifier among taken
+func takenIdentifier(products []Product, taken map[string]bool) error {
+
+	for i, product := range products {
+
+		for _, key := range identifierKeys(product) {
+
+			if taken[key] {
+
+				return &DuplicateProductError{Index: i}
+			}
+		}
+	}
+
+	return nil
+}
+
+// identifierSets collects the SKUs and GTINs of products, and fails with a *DuplicateProductError for the first one
+// sharing an identifier with an earlier one
+func identifierSets(products []Product) ([]string, []string, error) {
+
+	skus := []string{}
+
+	gtins := []string{}
+
+	seen := make(map[string]bool)
+
+	for i, product := range products {
+
+		for _, key := range identifierKeys(product) {
+
+			if seen[key] {
+
+				return nil, nil, &DuplicateProductError{Index: i}
+			}
+
+			seen[key] = true
+		}
+
+		if product.SKU != nil {
+
+			skus = append(skus, *product.SKU)
+		}
+
+		if product.GTIN != nil {
+
+			gtins = append(gtins, *product.GTIN)
+		}
+	}
+
+	return skus, gtins, nil
+}
+
+// checkProductIdentifiers fails with a *DuplicateProductError when a stored product other than id, deleted or not,
+// has one of the SKUs or GTINs of the products, or a variant has one of the SKUs
+func checkProductIdentifiers(tx *gorm.DB, products []Product, id uint) error {
+
+	skus, gtins, err := identifierSets(products)
+
+	if err != nil || (len(skus) == 0 && len(gtins) == 0) {
+
+		return err
+	}
+
+	query := tx.Unscoped().Model(&Product{}).Where("id <> ?", id)
+
+	switch {
+
+	case len(skus) == 0:
+
+		query = query.Where("gtin IN ?", gtins)
+
+	case len(gtins) == 0:
+
+		query = query.Where("sku IN ?", skus)
+
+	default:
+
+		query = query.Where("sku IN ? OR gtin IN ?", skus, gtins)
+	}
+
+	var stored []struct {
+		SKU  *string `gorm:"column:sku"`
+		GTIN *string `gorm:"column:gtin"`
+	}
+
+	err = query.Select("sku, gtin").Scan(&stored).Error
+
+	if err != nil {
+
+		return err
+	}
+
+	taken := make(map[string]bool)
+
+	for _, product := range stored {
+
+		for _, key := range identifierKeys(Product{SKU: product.SKU, GTIN: product.GTIN}) {
+
+			taken[key] = true
+		}
+	}
+
+	if len(skus) > 0 {
+
+		var variantSKUs []string
+
+		err = tx.Model(&ProductVariant{}).Where("sku IN ?", skus).Pluck("sku", &variantSKUs).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		for _, sku := range variantSKUs {
+
+			taken["sku:"+sku] = true
+		}
+	}
+
+	return takenIdentifier(products, taken)
+}
+
+// duplicateProduct reports the unique index violations that got past checkProductIdentifiers, under concurrent writes
+func duplicateProduct(err error) error {
+
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+
+		return ErrDuplicateProduct
+	}
+
+	return err
+}
+
+// RetrieveProductBySKU returns the live product with the SKU, compared once normalized
+func RetrieveProductBySKU(products_db *gorm.DB, sku string) (Product, error) {
+
+	normalized, err := NormalizeSKU(sku)
+
+	if err != nil {
+
+		return Product{}, err
+	}
+
+	var product Product
+
+	result := products_db.Where("sku = ?", normalized).First(&product)
+
+	if result.Error != nil {
+
+		return Product{}, result.Error
+	}
+
+	return product, nil
+}
+
+// RetrieveProductByGTIN returns the live product with the barcode, compared once normalized
+func RetrieveProductByGTIN(products_db *gorm.DB, gtin string) (Product, error) {
+
+	normalized, err := NormalizeGTIN(gtin)
+
+	if err != nil {
+
+		return Product{}, err
+	}
+
+	var product Product
+
+	result := products_db.Where("gtin = ?", normalized).First(&product)
+
+	if result.Error != nil {
+
+		return Product{}, result.Error
+	}
+
+	return product, nil
+}
@@ -0,0 +1,560 @@
+package data_layer
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"slices"
+	"time"
+)
+
+// StockLevel is the inventory of a product, or of one of its variants, in a warehouse. VariantID is 0 for the product
+// itself. Reserved counts the units held by open reservations, so Available, what can still be reserved or sold,
+// is OnHand - Reserved. Neither ever goes below zero.
+type StockLevel struct {
+	ProductID   uint  `gorm:"primaryKey;autoIncrement:false"`
+	VariantID   uint  `gorm:"primaryKey;autoIncrement:false"`
+	WarehouseID uint  `gorm:"primaryKey;autoIncrement:false;index"`
+	OnHand      int64 `gorm:"not null;default:0"`
+	Reserved    int64 `gorm:"not null;default:0"`
+	UpdatedAt   time.Time
+}
+
+func (level StockLevel) Available() int64 {
+
+	return level.OnHand - level.Reserved
+}
+
+// StockMovement records every change of the on-hand quantity of a product or variant in a warehouse, with its reason
+type StockMovement struct {
+	ID          uint   `gorm:"primarykey"`
+	ProductID   uint   `gorm:"not null;index"`
+	VariantID   uint   `gorm:"not null;default:0;index"`
+	WarehouseID uint   `gorm:"not null;index"`
+	Delta       int64  `gorm:"not null"`
+	Reason      string `gorm:"size:20;not null"`
+	HoldID      string `gorm:"size:64;index"`
+	CreatedAt   time.Time
+}
+
+// StockHold reserves units of a product or variant in a warehouse until it is committed, released, or expires.
+// Its ID is chosen by the caller, typically an order reference, so that retries are harmless: the ID of a committed
+// hold stays in the ledger on its ReasonSold movement and cannot reserve again.
+type StockHold struct {
+	ID          string    `gorm:"primaryKey;size:64"`
+	ProductID   uint      `gorm:"not null;index"`
+	VariantID   uint      `gorm:"not null;default:0;index"`
+	WarehouseID uint      `gorm:"not null;index"`
+	Quantity    int64     `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+	CreatedAt   time.Time
+}
+
+// Reason codes of the stock movements. ReasonSold is also recorded when a hold is committed.
+const (
+	ReasonReceived   = "received"
+	ReasonReturned   = "returned"
+	ReasonSold       = "sold"
+	ReasonDamaged    = "damaged"
+	ReasonLost       = "lost"
+	ReasonCorrection = "correction"
+)
+
+// StockReasons lists the reason codes accepted by AdjustStock
+var StockReasons = []string{ReasonReceived, ReasonReturned, ReasonSold, ReasonDamaged, ReasonLost, ReasonCorrection}
+
+// MaxHoldIDLength is the size of the stock_holds.id column
+const MaxHoldIDLength = 64
+
+var (
+	// ErrInsufficientStock is returned when a change would take the available quantity below zero
+	ErrInsufficientStock = errors.New("not enough stock available")
+
+	// ErrInvalidStockChange is returned for a zero adjustment, a quantity that is not positive, an unknown reason or an invalid hold ID
+	ErrInvalidStockChange = errors.New("invalid stock change")
+
+	// ErrHoldExists is returned when a hold ID is reused for another product, variant or quantity
+	ErrHoldExists = errors.New("the hold ID is already used by another reservation")
+
+	// ErrHoldExpired is returned when committing a hold after its expiry
+	ErrHoldExpired = errors.New("the hold has expired")
+
+	// ErrHoldCommitted is returned when reserving with the ID of a hold that was already committed
+	ErrHoldCommitted = errors.New("the hold ID belongs to a reservation that was already committed")
+)
+
+// ValidateStockReason accepts the reason codes of StockReasons only
+func ValidateStockReason(reason string) error {
+
+	if !slices.Contains(StockReasons, reason) {
+
+		return ErrInvalidStockChange
+	}
+
+	return nil
+}
+
+func validateHold(holdID string, quantity int64) error {
+
+	if holdID == "" || len(holdID) > MaxHoldIDLength || quantity <= 0 {
+
+		return ErrInvalidStockChange
+	}
+
+	return nil
+}
+
+// retrieveStockItem checks that the product is live and, unless variantID is 0, that the variant is one of its own
+func retrieveStockItem(tx *gorm.DB, productID int, variantID uint) error {
+
+	if variantID != 0 {
+
+		_, err := RetrieveProductVariant(tx, productID, variantID)
+
+		return err
+	}
+
+	_, err := RetrieveProduct(tx, productID, false)
+
+	return err
+}
+
+// productStock reads the stock rows of a product or variant in warehouse order
+func productStock(tx *gorm.DB, productID uint, variantID uint) (ProductAvailability, error) {
+
+	levels := []StockLevel{}
+
+	result := tx.Where("product_id = ? AND variant_id = ?", productID, variantID).Order("warehouse_id").Find(&levels)
+
+	if result.Error != nil {
+
+		return ProductAvailability{}, result.Error
+	}
+
+	return newAvailability(productID, variantID, levels), nil
+}
+
+// ensureStockLevel creates the empty stock row of a product or variant in a warehouse so that the conditional updates below have a row to match
+func ensureStockLevel(tx *gorm.DB, productID uint, variantID uint, warehouseID uint) error {
+
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&StockLevel{ProductID: productID, VariantID: variantID, WarehouseID: warehouseID, UpdatedAt: time.Now()}).Error
+}
+
+// addStock adds delta to the units on hand of a product or variant in a warehouse and records the movement.
+// It is a single conditional update, so that concurrent changes cannot both pass the check: units held
+// by reservations cannot be removed, the change fails with ErrInsufficientStock instead.
+func addStock(tx *gorm.DB, productID uint, variantID uint, warehouseID uint, delta int64, reason string) error {
+
+	err := ensureStockLevel(tx, productID, variantID, warehouseID)
+
+	if err != nil {
+
+		return err
+	}
+
+	result := tx.Model(&StockLevel{}).Where("product_id = ? AND variant_id = ? AND warehouse_id = ? AND on_hand + ? >= reserved", productID, variantID, warehouseID, delta).
+		Updates(map[string]interface{}{"on_hand": gorm.Expr("on_hand + ?", delta), "updated_at": time.Now()})
+
+	if result.Error != nil {
+
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+
+		return ErrInsufficientStock
+	}
+
+	return tx.Create(&StockMovement{ProductID: productID, VariantID: variantID, WarehouseID: warehouseID, Delta: delta, Reason: reason}).Error
+}
+
+// releaseHolds deletes the holds and gives their units back. A hold deleted meanwhile by a concurrent
+// transaction is skipped, so its units are never given back twice.
+func releaseHolds(tx *gorm.DB, holds []StockHold) error {
+
+	for _, hold := range holds {
+
+		result := tx.Where("id = ?", hold.ID).Delete(&StockHold{})
+
+		if result.Error != nil {
+
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+
+			continue
+		}
+
+		err := tx.Model(&StockLevel{}).Where("product_id = ? AND variant_id = ? AND warehouse_id = ?", hold.ProductID, hold.VariantID, hold.WarehouseID).
+			Updates(map[string]interface{}{"reserved": gorm.Expr("reserved - ?", hold.Quantity), "updated_at": time.Now()}).Error
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releaseExpiredHolds gives back the units of the expired holds of a product and its variants, or of every product when productID is 0
+func releaseExpiredHolds(tx *gorm.DB, productID uint, now time.Time) (int, error) {
+
+	var holds []StockHold
+
+	query := tx.Where("expires_at <= ?", now)
+
+	if productID != 0 {
+
+		query = query.Where("product_id = ?", productID)
+	}
+
+	err := query.Find(&holds).Error
+
+	if err != nil {
+
+		return 0, err
+	}
+
+	return len(holds), releaseHolds(tx, holds)
+}
+
+// RetrieveStock returns the stock of a live product, or of one of its variants, in every warehouse, once its expired holds are released
+func RetrieveStock(products_db *gorm.DB, productID int, variantID uint) (ProductAvailability, error) {
+
+	var availability ProductAvailability
+
+	err := products_db.Transaction(func(tx *gorm.DB) error {
+
+		err := retrieveStockItem(tx, productID, variantID)
+
+		if err != nil {
+
+			return err
+		}
+
+		_, err = releaseExpiredHolds(tx, uint(productID), time.Now())
+
+		if err != nil {
+
+			return err
+		}
+
+		availability, err = productStock(tx, uint(productID), variantID)
+
+		return err
+	})
+
+	return availability, err
+}
+
+// AdjustStock adds delta, negative to remove units, to the on-hand quantity of a live product or variant in a warehouse,
+// the default one for 0, and records the movement. It fails with ErrInsufficientStock rather than remove held units.
+func AdjustStock(products_db *gorm.DB, productID int, variantID uint, warehouseID uint, delta int64, reason string) (ProductAvailability, error) {
+
+	if delta == 0 {
+
+		return ProductAvailability{}, ErrInvalidStockChange
+	}
+
+	err := ValidateStockReason(reason)
+
+	if err != nil {
+
+		return ProductAvailability{}, err
+	}
+
+	var availability ProductAvailability
+
+	err = products_db.Transaction(func(tx *gorm.DB) error {
+
+		err := retrieveStockItem(tx, productID, variantID)
+
+		if err != nil {
+
+			return err
+		}
+
+		warehouseID, err := resolveWarehouse(tx, warehouseID)
+
+		if err != nil {
+
+			return err
+		}
+
+		_, err = releaseExpiredHolds(tx, uint(productID), time.Now())
+
+		if err != nil {
+
+			return err
+		}
+
+		err = addStock(tx, uint(productID), variantID, warehouseID, delta, reason)
+
+		if err != nil {
+
+			return err
+		}
+
+		availability, err = productStock(tx, uint(productID), variantID)
+
+		return err
+	})
+
+	return availability, err
+}
+
+// ReserveStock holds quantity units of a live product or variant in a warehouse, the default one for 0, until expiresAt.
+// Reserving again with the same hold ID, product, variant and quantity returns the existing hold, so a retried request
+// does not hold the units twice; once the hold is committed, its ID fails with ErrHoldCommitted.
+func ReserveStock(products_db *gorm.DB, holdID string, productID int, variantID uint, warehouseID uint, quantity int64, expiresAt time.Time) (StockHold, error) {
+
+	err := validateHold(holdID, quantity)
+
+	if err != nil {
+
+		return StockHold{}, err
+	}
+
+	hold := StockHold{ID: holdID, ProductID: uint(productID), VariantID: variantID, Quantity: quantity, ExpiresAt: expiresAt}
+
+	err = products_db.Transaction(func(tx *gorm.DB) error {
+
+		err := retrieveStockItem(tx, productID, variantID)
+
+		if err != nil {
+
+			return err
+		}
+
+		hold.WarehouseID, err = resolveWarehouse(tx, warehouseID)
+
+		if err != nil {
+
+			return err
+		}
+
+		_, err = releaseExpiredHolds(tx, uint(productID), time.Now())
+
+		if err != nil {
+
+			return err
+		}
+
+		existing, err := RetrieveStockHold(tx, holdID)
+
+		if err == nil {
+
+			if existing.ProductID != hold.ProductID || existing.VariantID != hold.VariantID || existing.WarehouseID != hold.WarehouseID || existing.Quantity != quantity {
+
+				return ErrHoldExists
+			}
+
+			hold = existing
+
+			return nil
+		}
+
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+
+			return err
+		}
+
+		var committed int64
+
+		err = tx.Model(&StockMovement{}).Where("hold_id = ?", holdID).Count(&committed).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		if committed > 0 {
+
+			return ErrHoldCommitted
+		}
+
+		err = ensureStockLevel(tx, hold.ProductID, hold.VariantID, hold.WarehouseID)
+
+		if err != nil {
+
+			return err
+		}
+
+		result := tx.Model(&StockLevel{}).Where("product_id = ? AND variant_id = ? AND warehouse_id = ? AND on_hand - reserved >= ?", productID, variantID, hold.WarehouseID, quantity).
+			Updates(map[string]interface{}{"reserved": gorm.Expr("reserved + ?", quantity), "updated_at": time.Now()})
+
+		if result.Error != nil {
+
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+
+			return ErrInsufficientStock
+		}
+
+		return tx.Create(&hold).Error
+	})
+
+	if err != nil {
+
+		return StockHold{}, err
+	}
+
+	return hold, nil
+}
+
+func RetrieveStockHold(products_db *gorm.DB, holdID string) (StockHold, error) {
+
+	var hold StockHold
+
+	result := products_db.Where("id = ?", holdID).First(&hold)
+
+	if result.Error != nil {
+
+		return StockHold{}, result.Error
+	}
+
+	return hold, nil
+}
+
+// CommitStockHold turns a hold into a sale: its units leave the stock and a ReasonSold movement is recorded
+func CommitStockHold(products_db *gorm.DB, holdID string) (ProductAvailability, error) {
+
+	var availability ProductAvailability
+
+	err := products_db.Transaction(func(tx *gorm.DB) error {
+
+		hold, err := RetrieveStockHold(tx, holdID)
+
+		if err != nil {
+
+			return err
+		}
+
+		if !hold.ExpiresAt.After(time.Now()) {
+
+			return ErrHoldExpired
+		}
+
+		result := tx.Where("id = ?", holdID).Delete(&StockHold{})
+
+		if result.Error != nil {
+
+			return result.Error
+		}
+
+		// Committed or released by a concurrent request
+		if result.RowsAffected == 0 {
+
+			return gorm.ErrRecordNotFound
+		}
+
+		err = tx.Model(&StockLevel{}).Where("product_id = ? AND variant_id = ? AND warehouse_id = ?", hold.ProductID, hold.VariantID, hold.WarehouseID).Updates(map[string]interface{}{
+			"on_hand":    gorm.Expr("on_hand - ?", hold.Quantity),
+			"reserved":   gorm.Expr("reserved - ?", hold.Quantity),
+			"updated_at": time.Now(),
+		}).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		err = tx.Create(&StockMovement{ProductID: hold.ProductID, VariantID: hold.VariantID, WarehouseID: hold.WarehouseID, Delta: -hold.Quantity, Reason: ReasonSold, HoldID: holdID}).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		availability, err = productStock(tx, hold.ProductID, hold.VariantID)
+
+		return err
+	})
+
+	return availability, err
+}
+
+// ReleaseStockHold cancels a hold and gives its units back
+func ReleaseStockHold(products_db *gorm.DB, holdID string) (ProductAvailability, error) {
+
+	var availability ProductAvailability
+
+	err := products_db.Transaction(func(tx *gorm.DB) error {
+
+		hold, err := RetrieveStockHold(tx, holdID)
+
+		if err != nil {
+
+			return err
+		}
+
+		result := tx.Where("id = ?", holdID).Delete(&StockHold{})
+
+		if result.Error != nil {
+
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+
+			return gorm.ErrRecordNotFound
+		}
+
+		err = tx.Model(&StockLevel{}).Where("product_id = ? AND variant_id = ? AND warehouse_id = ?", hold.ProductID, hold.VariantID, hold.WarehouseID).
+			Updates(map[string]interface{}{"reserved": gorm.Expr("reserved - ?", hold.Quantity), "updated_at": time.Now()}).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		availability, err = productStock(tx, hold.ProductID, hold.VariantID)
+
+		return err
+	})
+
+	return availability, err
+}
+
+// ReleaseExpiredStockHolds releases every hold expiring at or before now and returns how many
+func ReleaseExpiredStockHolds(products_db *gorm.DB, now time.Time) (int, error) {
+
+	released := 0
+
+	err := products_db.Transaction(func(tx *gorm.DB) error {
+
+		var err error
+
+		released, err = releaseExpiredHolds(tx, 0, now)
+
+		return err
+	})
+
+	return released, err
+}
+
+// RetrieveStockMovements returns the latest movements of a product or variant, newest first
+func RetrieveStockMovements(products_db *gorm.DB, productID int, variantID uint, limit int) ([]StockMovement, error) {
+
+	err := retrieveStockItem(products_db, productID, variantID)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	movements := []StockMovement{}
+
+	result := products_db.Where("product_id = ? AND variant_id = ?", productID, variantID).Order("id DESC").Limit(limit).Find(&movements)
+
+	if result.Error != nil {
+
+		return nil, result.Error
+	}
+
+	return movements, nil
+}
@@ -0,0 +1,238 @@
+package data_layer
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"slices"
+	"time"
+)
+
+// Lifecycle statuses of a product. Only active products are public: drafts are not published yet,
+// archived products are no longer sold.
+const (
+	StatusDraft    = "draft"
+	StatusActive   = "active"
+	StatusArchived = "archived"
+)
+
+// ProductStatuses lists the lifecycle statuses, in lifecycle order
+var ProductStatuses = []string{StatusDraft, StatusActive, StatusArchived}
+
+// statusTransitions lists the statuses a product can move to from each status. Keeping its status is always allowed.
+var statusTransitions = map[string][]string{
+	StatusDraft:    {StatusActive, StatusArchived},
+	StatusActive:   {StatusArchived},
+	StatusArchived: {StatusActive},
+}
+
+var (
+	// ErrInvalidStatus is returned for statuses other than those of ProductStatuses
+	ErrInvalidStatus = errors.New("status must be draft, active or archived")
+
+	// ErrInvalidSchedule is returned when unpublish_at does not come after publish_at
+	ErrInvalidSchedule = errors.New("unpublish_at must come after publish_at")
+
+	// ErrStatusTransition is matched by errors.Is on the errors of the transitions statusTransitions does not allow
+	ErrStatusTransition = errors.New("status transition not allowed")
+)
+
+// ValidateProductStatus accepts the statuses of ProductStatuses only
+func ValidateProductStatus(status string) error {
+
+	if !slices.Contains(ProductStatuses, status) {
+
+		return ErrInvalidStatus
+	}
+
+	return nil
+}
+
+// checkTransition fails with ErrStatusTransition unless a product can move from one status to the other
+func checkTransition(from string, to string) error {
+
+	if from == to || slices.Contains(statusTransitions[from], to) {
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: a product cannot go from %s to %s", ErrStatusTransition, from, to)
+}
+
+// NormalizeProductLifecycle checks the status and schedule of a product as sent by a caller. A product without
+// a status is a draft when it has a publish_at, and active otherwise. publish_at only applies to drafts and
+// unpublish_at to products that are not archived: they are dropped from the others.
+func NormalizeProductLifecycle(product *Product) error {
+
+	if product.Status == "" {
+
+		product.Status = StatusActive
+
+		if product.PublishAt != nil {
+
+			product.Status = StatusDraft
+		}
+	}
+
+	err := ValidateProductStatus(product.Status)
+
+	if err != nil {
+
+		return err
+	}
+
+	return normalizeSchedule(product)
+}
+
+// normalizeSchedule drops the publish_at and unpublish_at that do not apply to the status of the product, and checks
+// their order. They are kept in UTC, so that SQLite, which stores times as text, compares them in order.
+func normalizeSchedule(product *Product) error {
+
+	for _, instant := range []**time.Time{&product.PublishAt, &product.UnpublishAt} {
+
+		if *instant != nil {
+
+			utc := (*instant).UTC()
+
+			*instant = &utc
+		}
+	}
+
+	if product.Status != StatusDraft {
+
+		product.PublishAt = nil
+	}
+
+	if product.Status == StatusArchived {
+
+		product.UnpublishAt = nil
+	}
+
+	if product.PublishAt != nil && product.UnpublishAt != nil && !product.UnpublishAt.After(*product.PublishAt) {
+
+		return ErrInvalidSchedule
+	}
+
+	return nil
+}
+
+// lifecycleChanges applies the status and schedule changes to the stored product, and returns the lifecycle it would get
+func (changes ProductChanges) lifecycleChanges(product Product) (Product, error) {
+
+	lifecycle := Product{Status: product.Status, PublishAt: product.PublishAt, UnpublishAt: product.UnpublishAt}
+
+	if changes.Status != nil {
+
+		err := ValidateProductStatus(*changes.Status)
+
+		if err == nil {
+
+			err = checkTransition(product.Status, *changes.Status)
+		}
+
+		if err != nil {
+
+			return Product{}, err
+		}
+
+		lifecycle.Status = *changes.Status
+	}
+
+	if changes.PublishAt != nil {
+
+		lifecycle.PublishAt = scheduleTime(*changes.PublishAt)
+	}
+
+	if changes.UnpublishAt != nil {
+
+		lifecycle.UnpublishAt = scheduleTime(*changes.UnpublishAt)
+	}
+
+	err := normalizeSchedule(&lifecycle)
+
+	if err != nil {
+
+		return Product{}, err
+	}
+
+	return lifecycle, nil
+}
+
+// changesLifecycle tells whether the changes touch the status or schedule of the product
+func (changes ProductChanges) changesLifecycle() bool {
+
+	return changes.Status != nil || changes.PublishAt != nil || changes.UnpublishAt != nil
+}
+
+// scheduleTime is the publish_at or unpublish_at set by a change, where the zero time removes it
+func scheduleTime(instant time.Time) *time.Time {
+
+	if instant.IsZero() {
+
+		return nil
+	}
+
+	return &instant
+}
+
+// ApplyProductSchedules activates the drafts whose publish_at has come and archives the active products whose
+// unpublish_at has come, clearing the timestamps they followed. It returns how many status changes it made.
+func ApplyProductSchedules(products_db *gorm.DB, now time.Time) (int, error) {
+
+	changedIDs, err := applyProductSchedules(products_db, now)
+
+	return len(changedIDs), err
+}
+
+// applyProductSchedules is ApplyProductSchedules returning the ID of the product of every status change
+func applyProductSchedules(products_db *gorm.DB, now time.Time) ([]uint, error) {
+
+	var changedIDs []uint
+
+	now = now.UTC()
+
+	err := products_db.Transaction(func(tx *gorm.DB) error {
+
+		for _, schedule := range []struct {
+			from   string
+			to     string
+			column string
+		}{
+			{from: StatusDraft, to: StatusActive, column: "publish_at"},
+			{from: StatusActive, to: StatusArchived, column: "unpublish_at"},
+		} {
+
+			var dueIDs []uint
+
+			err := tx.Model(&Product{}).Where("status = ? AND "+schedule.column+" <= ?", schedule.from, now).Pluck("id", &dueIDs).Error
+
+			if err != nil {
+
+				return err
+			}
+
+			if len(dueIDs) == 0 {
+
+				continue
+			}
+
+			err = tx.Model(&Product{}).Where("id IN ? AND status = ?", dueIDs, schedule.from).Updates(map[string]interface{}{"status": schedule.to, schedule.column: nil, "version": nextVersion()}).Error
+
+			if err != nil {
+
+				return err
+			}
+
+			changedIDs = append(changedIDs, dueIDs...)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	return changedIDs, nil
+}
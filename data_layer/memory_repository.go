@@ -0,0 +1,2202 @@
+package data_layer
+
+import (
+	"gorm.io/gorm"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryProductRepository keeps the whole catalog in process memory, without any database file.
+// It is safe for concurrent use and behaves like GormProductRepository.
+type MemoryProductRepository struct {
+	mutex    sync.RWMutex
+	products map[uint]Product
+	nextID   uint
+	prices   map[uint]map[string]ProductPrice
+	rates    map[[2]string]ExchangeRate
+	names    *NameIndex
+
+	categories        map[uint]Category
+	nextCategoryID    uint
+	productCategories map[uint]map[uint]struct{}
+
+	productTags map[uint]map[string]struct{}
+
+	stock           map[[3]uint]StockLevel
+	holds           map[string]StockHold
+	movements       []StockMovement
+	nextMovementID  uint
+	warehouses      map[uint]Warehouse
+	nextWarehouseID uint
+
+	variants      map[uint]ProductVariant
+	nextVariantID uint
+}
+
+func NewMemoryProductRepository() *MemoryProductRepository {
+
+	return &MemoryProductRepository{
+		products: make(map[uint]Product),
+		nextID:   1,
+		prices:   make(map[uint]map[string]ProductPrice),
+		rates:    make(map[[2]string]ExchangeRate),
+		names:    NewNameIndex(),
+
+		categories:        make(map[uint]Category),
+		nextCategoryID:    1,
+		productCategories: make(map[uint]map[uint]struct{}),
+
+		productTags: make(map[uint]map[string]struct{}),
+
+		stock:           make(map[[3]uint]StockLevel),
+		holds:           make(map[string]StockHold),
+		nextMovementID:  1,
+		warehouses:      map[uint]Warehouse{1: {ID: 1, Code: MainWarehouseCode, Name: "Main warehouse", CreatedAt: time.Now(), UpdatedAt: time.Now()}},
+		nextWarehouseID: 2,
+
+		variants:      make(map[uint]ProductVariant),
+		nextVariantID: 1,
+	}
+}
+
+func (repository *MemoryProductRepository) InsertProduct(name string, price Amount, currency string) (uint, error) {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	now := time.Now()
+
+	product := Product{Name: name, Price: price, Currency: currency, Version: 1, Status: StatusActive}
+
+	product.ID = repository.nextID
+
+	product.CreatedAt = now
+
+	product.UpdatedAt = now
+
+	repository.products[product.ID] = product
+
+	repository.reindex(product)
+
+	repository.nextID++
+
+	return product.ID, nil
+}
+
+func (repository *MemoryProductRepository) InsertProducts(products []Product) ([]uint, error) {
+
+	rows, err := newProductRows(products)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	err = repository.checkProductIdentifiers(rows, 0)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	now := time.Now()
+
+	ids := make([]uint, 0, len(rows))
+
+	for _, product := range rows {
+
+		product.ID = repository.nextID
+
+		product.CreatedAt = now
+
+		product.UpdatedAt = now
+
+		repository.products[product.ID] = product
+
+		repository.reindex(product)
+
+		repository.nextID++
+
+		ids = append(ids, product.ID)
+	}
+
+	return ids, nil
+}
+
+func (repository *MemoryProductRepository) DeleteProduct(id int, expectedVersion uint) error {
+
+	return repository.update(id, expectedVersion, func(product *Product) error {
+
+		product.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+
+		return nil
+	})
+}
+
+func (repository *MemoryProductRepository) RestoreProduct(id int) error {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	product, found := repository.products[uint(id)]
+
+	if !found || !product.DeletedAt.Valid {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	product.DeletedAt = gorm.DeletedAt{}
+
+	product.UpdatedAt = time.Now()
+
+	product.Version++
+
+	repository.products[product.ID] = product
+
+	repository.reindex(product)
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) PurgeProduct(id int, expectedVersion uint) error {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	product, found := repository.products[uint(id)]
+
+	if !found {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	err := checkVersion(product, expectedVersion)
+
+	if err != nil {
+
+		return err
+	}
+
+	repository.purge(uint(id))
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) PurgeDeletedProducts(deletedBefore time.Time) (int64, error) {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	var purged int64
+
+	for id, product := range repository.products {
+
+		if product.DeletedAt.Valid && product.DeletedAt.Time.Before(deletedBefore) {
+
+			repository.purge(id)
+
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (repository *MemoryProductRepository) UpdateProductName(id int, name string, expectedVersion uint) error {
+
+	return repository.update(id, expectedVersion, func(product *Product) error {
+
+		product.Name = name
+
+		return nil
+	})
+}
+
+func (repository *MemoryProductRepository) UpdateProductPrice(id int, price Amount, expectedVersion uint) error {
+
+	return repository.update(id, expectedVersion, func(product *Product) error {
+
+		product.Price = price
+
+		return nil
+	})
+}
+
+func (repository *MemoryProductRepository) UpdateProduct(id int, changes ProductChanges, expectedVersion uint) error {
+
+	identifiers, err := changes.identifierChanges()
+
+	if err != nil {
+
+		return err
+	}
+
+	if changes.Name == nil && changes.Price == nil && changes.Currency == nil && changes.SKU == nil && changes.GTIN == nil && !changes.changesLifecycle() {
+
+		repository.mutex.RLock()
+
+		defer repository.mutex.RUnlock()
+
+		product, found := repository.live(id)
+
+		if !found {
+
+			return gorm.ErrRecordNotFound
+		}
+
+		return checkVersion(product, expectedVersion)
+	}
+
+	return repository.update(id, expectedVersion, func(product *Product) error {
+
+		err := repository.checkProductIdentifiers([]Product{identifiers}, product.ID)
+
+		if err != nil {
+
+			return err
+		}
+
+		if changes.changesLifecycle() {
+
+			lifecycle, err := changes.lifecycleChanges(*product)
+
+			if err != nil {
+
+				return err
+			}
+
+			product.Status, product.PublishAt, product.UnpublishAt = lifecycle.Status, lifecycle.PublishAt, lifecycle.UnpublishAt
+		}
+
+		if changes.SKU != nil {
+
+			product.SKU = identifiers.SKU
+		}
+
+		if changes.GTIN != nil {
+
+			product.GTIN = identifiers.GTIN
+		}
+
+		if changes.Name != nil {
+
+			product.Name = *changes.Name
+		}
+
+		if changes.Price != nil {
+
+			product.Price = *changes.Price
+		}
+
+		if changes.Currency != nil {
+
+			product.Currency = *changes.Currency
+
+			delete(repository.prices[product.ID], product.Currency)
+		}
+
+		return nil
+	})
+}
+
+func (repository *MemoryProductRepository) ApplyProductSchedules(now time.Time) (int, error) {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	changed := 0
+
+	for _, product := range repository.products {
+
+		if product.DeletedAt.Valid {
+
+			continue
+		}
+
+		// Like the gorm repository, a draft due for both is published, then archived
+		if product.Status == StatusDraft && product.PublishAt != nil && !product.PublishAt.After(now) {
+
+			product.Status, product.PublishAt = StatusActive, nil
+
+			repository.touch(product)
+
+			product = repository.products[product.ID]
+
+			repository.reindex(product)
+
+			changed++
+		}
+
+		if product.Status == StatusActive && product.UnpublishAt != nil && !product.UnpublishAt.After(now) {
+
+			product.Status, product.UnpublishAt = StatusArchived, nil
+
+			repository.touch(product)
+
+			repository.reindex(product)
+
+			changed++
+		}
+	}
+
+	return changed, nil
+}
+
+// checkProductIdentifiers is the in-memory equivalent of the SKU and GTIN checks of the gorm repository
+func (repository *MemoryProductRepository) checkProductIdentifiers(products []Product, id uint) error {
+
+	_, _, err := identifierSets(products)
+
+	if err != nil {
+
+		return err
+	}
+
+	taken := make(map[string]bool)
+
+	for _, product := range repository.products {
+
+		if product.ID == id {
+
+			continue
+		}
+
+		for _, key := range identifierKeys(product) {
+
+			taken[key] = true
+		}
+	}
+
+	for _, variant := range repository.variants {
+
+		taken["sku:"+variant.SKU] = true
+	}
+
+	return takenIdentifier(products, taken)
+}
+
+// retrieveProductBy returns the live product whose identifier, as read by identifier, is the given one
+func (repository *MemoryProductRepository) retrieveProductBy(value string, identifier func(Product) *string) (Product, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	for _, product := range repository.products {
+
+		if !product.DeletedAt.Valid && identifier(product) != nil && *identifier(product) == value {
+
+			return product, nil
+		}
+	}
+
+	return Product{}, gorm.ErrRecordNotFound
+}
+
+func (repository *MemoryProductRepository) RetrieveProductBySKU(sku string) (Product, error) {
+
+	normalized, err := NormalizeSKU(sku)
+
+	if err != nil {
+
+		return Product{}, err
+	}
+
+	return repository.retrieveProductBy(normalized, func(product Product) *string { return product.SKU })
+}
+
+func (repository *MemoryProductRepository) RetrieveProductByGTIN(gtin string) (Product, error) {
+
+	normalized, err := NormalizeGTIN(gtin)
+
+	if err != nil {
+
+		return Product{}, err
+	}
+
+	return repository.retrieveProductBy(normalized, func(product Product) *string { return product.GTIN })
+}
+
+func (repository *MemoryProductRepository) ApplyPriceRule(rule PriceRule, dryRun bool) ([]PriceChange, error) {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	changes, err := rule.changes(repository.filteredProducts(rule.Filter))
+
+	if err != nil || dryRun {
+
+		return changes, err
+	}
+
+	now := time.Now()
+
+	for _, change := range changes {
+
+		product := repository.products[change.ProductID]
+
+		product.Price = change.NewPrice
+
+		product.UpdatedAt = now
+
+		product.Version++
+
+		repository.products[product.ID] = product
+	}
+
+	return changes, nil
+}
+
+func (repository *MemoryProductRepository) RetrieveProduct(id int, includeDeleted bool) (Product, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	product, found := repository.products[uint(id)]
+
+	if !found || (product.DeletedAt.Valid && !includeDeleted) {
+
+		return Product{}, gorm.ErrRecordNotFound
+	}
+
+	return product, nil
+}
+
+func (repository *MemoryProductRepository) RetrieveProductsWithPagination(filter ProductFilter, productSort ProductSort, offset int, limit int) ([]Product, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	products := repository.filteredProducts(filter)
+
+	sortProducts(products, productSort)
+
+	if offset >= len(products) {
+
+		return []Product{}, nil
+	}
+
+	end := offset + limit
+
+	if end > len(products) {
+
+		end = len(products)
+	}
+
+	return products[offset:end], nil
+}
+
+// StreamProducts visits a snapshot of the matching products, so visit may call the repository
+func (repository *MemoryProductRepository) StreamProducts(filter ProductFilter, productSort ProductSort, visit func(Product) error) error {
+
+	repository.mutex.RLock()
+
+	products := repository.filteredProducts(filter)
+
+	repository.mutex.RUnlock()
+
+	sortProducts(products, productSort)
+
+	for _, product := range products {
+
+		err := visit(product)
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) RetrieveProductsWithCursor(filter ProductFilter, cursor ProductCursor, limit int) ([]Product, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	products := []Product{}
+
+	for _, product := range repository.filteredProducts(filter) {
+
+		if cursor.after(product) {
+
+			products = append(products, product)
+		}
+	}
+
+	sortProducts(products, cursor.direction())
+
+	if len(products) > limit {
+
+		products = products[:limit]
+	}
+
+	if cursor.Backward {
+
+		reverseProducts(products)
+	}
+
+	return products, nil
+}
+
+func (repository *MemoryProductRepository) SearchProducts(query string, statuses []string, offset int, limit int) ([]SearchResult, error) {
+
+	terms := searchTerms(query)
+
+	if len(terms) == 0 {
+
+		return nil, ErrEmptySearch
+	}
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	return rankSearchResults(repository.filteredProducts(ProductFilter{Statuses: statuses}), terms, offset, limit), nil
+}
+
+func (repository *MemoryProductRepository) SuggestProducts(prefix string, statuses []string, maxDistance int, limit int) ([]Suggestion, error) {
+
+	return repository.names.Suggest(prefix, statuses, maxDistance, limit)
+}
+
+func (repository *MemoryProductRepository) GetTotalNumberOfProducts(filter ProductFilter) (int64, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	return int64(len(repository.filteredProducts(filter))), nil
+}
+
+func (repository *MemoryProductRepository) SetProductPrice(id int, currency string, price Amount) error {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	product, found := repository.live(id)
+
+	if !found {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	now := time.Now()
+
+	product.UpdatedAt = now
+
+	product.Version++
+
+	if product.Currency == currency {
+
+		product.Price = price
+
+		repository.products[product.ID] = product
+
+		return nil
+	}
+
+	if repository.prices[product.ID] == nil {
+
+		repository.prices[product.ID] = make(map[string]ProductPrice)
+	}
+
+	productPrice, found := repository.prices[product.ID][currency]
+
+	if !found {
+
+		productPrice = ProductPrice{ProductID: product.ID, Currency: currency, CreatedAt: now}
+	}
+
+	productPrice.Price = price
+
+	productPrice.UpdatedAt = now
+
+	repository.prices[product.ID][currency] = productPrice
+
+	repository.products[product.ID] = product
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) DeleteProductPrice(id int, currency string) error {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	if _, found := repository.prices[uint(id)][currency]; !found {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	delete(repository.prices[uint(id)], currency)
+
+	if product, found := repository.products[uint(id)]; found {
+
+		product.UpdatedAt = time.Now()
+
+		product.Version++
+
+		repository.products[product.ID] = product
+	}
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) RetrieveProductPrices(ids []uint) ([]ProductPrice, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	prices := []ProductPrice{}
+
+	for _, id := range ids {
+
+		for _, productPrice := range repository.prices[id] {
+
+			prices = append(prices, productPrice)
+		}
+	}
+
+	sort.Slice(prices, func(i, j int) bool {
+
+		if prices[i].ProductID != prices[j].ProductID {
+
+			return prices[i].ProductID < prices[j].ProductID
+		}
+
+		return prices[i].Currency < prices[j].Currency
+	})
+
+	return prices, nil
+}
+
+func (repository *MemoryProductRepository) SetExchangeRate(base string, quote string, rate Rate) error {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	now := time.Now()
+
+	exchangeRate, found := repository.rates[[2]string{base, quote}]
+
+	if !found {
+
+		exchangeRate = ExchangeRate{BaseCurrency: base, QuoteCurrency: quote, CreatedAt: now}
+	}
+
+	exchangeRate.Rate = rate
+
+	exchangeRate.UpdatedAt = now
+
+	repository.rates[[2]string{base, quote}] = exchangeRate
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) DeleteExchangeRate(base string, quote string) error {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	if _, found := repository.rates[[2]string{base, quote}]; !found {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	delete(repository.rates, [2]string{base, quote})
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) RetrieveExchangeRates() ([]ExchangeRate, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	rates := make([]ExchangeRate, 0, len(repository.rates))
+
+	for _, rate := range repository.rates {
+
+		rates = append(rates, rate)
+	}
+
+	sort.Slice(rates, func(i, j int) bool {
+
+		if rates[i].BaseCurrency != rates[j].BaseCurrency {
+
+			return rates[i].BaseCurrency < rates[j].BaseCurrency
+		}
+
+		return rates[i].QuoteCurrency < rates[j].QuoteCurrency
+	})
+
+	return rates, nil
+}
+
+// update applies a change to a live product at expectedVersion, refreshes its UpdatedAt timestamp and bumps its version
+func (repository *MemoryProductRepository) update(id int, expectedVersion uint, change func(product *Product) error) error {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	product, found := repository.live(id)
+
+	if !found {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	err := checkVersion(product, expectedVersion)
+
+	if err != nil {
+
+		return err
+	}
+
+	err = change(&product)
+
+	if err != nil {
+
+		return err
+	}
+
+	product.UpdatedAt = time.Now()
+
+	product.Version++
+
+	repository.products[product.ID] = product
+
+	repository.reindex(product)
+
+	return nil
+}
+
+// reindex keeps the name index in line with a stored product
+func (repository *MemoryProductRepository) reindex(product Product) {
+
+	if product.DeletedAt.Valid {
+
+		repository.names.Remove(product.ID)
+
+		return
+	}
+
+	repository.names.Put(product.ID, product.Name, product.Status)
+}
+
+// live returns a product that exists and is not soft-deleted
+func (repository *MemoryProductRepository) live(id int) (Product, bool) {
+
+	product, found := repository.products[uint(id)]
+
+	if !found || product.DeletedAt.Valid {
+
+		return Product{}, false
+	}
+
+	return product, true
+}
+
+// purge removes a product and everything attached to it
+func (repository *MemoryProductRepository) purge(id uint) {
+
+	delete(repository.products, id)
+
+	delete(repository.prices, id)
+
+	delete(repository.productCategories, id)
+
+	delete(repository.productTags, id)
+
+	for key := range repository.stock {
+
+		if key[0] == id {
+
+			delete(repository.stock, key)
+		}
+	}
+
+	for holdID, hold := range repository.holds {
+
+		if hold.ProductID == id {
+
+			delete(repository.holds, holdID)
+		}
+	}
+
+	repository.movements = slices.DeleteFunc(repository.movements, func(movement StockMovement) bool { return movement.ProductID == id })
+
+	for variantID, variant := range repository.variants {
+
+		if variant.ProductID == id {
+
+			delete(repository.variants, variantID)
+		}
+	}
+
+	repository.names.Remove(id)
+}
+
+// filteredProducts returns the products matching the filter in ID order
+func (repository *MemoryProductRepository) filteredProducts(filter ProductFilter) []Product {
+
+	products := make([]Product, 0, len(repository.products))
+
+	for _, product := range repository.products {
+
+		if filter.matches(product) && repository.inCategory(product.ID, filter) && repository.hasTags(product.ID, filter) && repository.hasStock(product.ID, filter) {
+
+			products = append(products, product)
+		}
+	}
+
+	sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+
+	return products
+}
+
+// inCategory is the in-memory equivalent of the CategoryID filter
+func (repository *MemoryProductRepository) inCategory(productID uint, filter ProductFilter) bool {
+
+	if filter.CategoryID == 0 {
+
+		return true
+	}
+
+	for categoryID := range repository.productCategories[productID] {
+
+		if categoryID == filter.CategoryID {
+
+			return true
+		}
+
+		if filter.IncludeSubcategories && strings.Contains(repository.categories[categoryID].Path, "/"+strconv.FormatUint(uint64(filter.CategoryID), 10)+"/") {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasTags is the in-memory equivalent of the Tags filter
+func (repository *MemoryProductRepository) hasTags(productID uint, filter ProductFilter) bool {
+
+	if len(filter.Tags) == 0 {
+
+		return true
+	}
+
+	for _, tag := range filter.Tags {
+
+		_, found := repository.productTags[productID][tag]
+
+		if found && !filter.AllTags {
+
+			return true
+		}
+
+		if !found && filter.AllTags {
+
+			return false
+		}
+	}
+
+	return filter.AllTags
+}
+
+// hasStock is the in-memory equivalent of the InStock and WarehouseID filters
+func (repository *MemoryProductRepository) hasStock(productID uint, filter ProductFilter) bool {
+
+	if !filter.InStock && filter.WarehouseID == 0 {
+
+		return true
+	}
+
+	for key, level := range repository.stock {
+
+		if key[0] != productID || (filter.WarehouseID != 0 && key[2] != filter.WarehouseID) {
+
+			continue
+		}
+
+		if (filter.InStock && level.Available() > 0) || (!filter.InStock && level.OnHand > 0) {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// memoryParentPath is the in-memory equivalent of parentPath
+func (repository *MemoryProductRepository) memoryParentPath(parentID *uint) (string, error) {
+
+	if parentID == nil {
+
+		return "/", nil
+	}
+
+	parent, found := repository.categories[*parentID]
+
+	if !found {
+
+		return "", gorm.ErrRecordNotFound
+	}
+
+	return parent.Path, nil
+}
+
+// checkSiblingName is the in-memory equivalent of the function of the same name
+func (repository *MemoryProductRepository) checkSiblingName(parentID *uint, name string, id uint) error {
+
+	for _, category := range repository.categories {
+
+		if category.SiblingKey == siblingKey(parentID, name) && category.ID != id {
+
+			return ErrDuplicateCategory
+		}
+	}
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) CreateCategory(name string, parentID *uint) (Category, error) {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	path, err := repository.memoryParentPath(parentID)
+
+	if err != nil {
+
+		return Category{}, err
+	}
+
+	err = repository.checkSiblingName(parentID, name, 0)
+
+	if err != nil {
+
+		return Category{}, err
+	}
+
+	now := time.Now()
+
+	category := Category{ID: repository.nextCategoryID, Name: name, ParentID: copyID(parentID), SiblingKey: siblingKey(parentID, name), CreatedAt: now, UpdatedAt: now}
+
+	category.Path = categoryPath(path, category.ID)
+
+	repository.categories[category.ID] = category
+
+	repository.nextCategoryID++
+
+	return category, nil
+}
+
+func (repository *MemoryProductRepository) RetrieveCategory(id uint) (Category, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	category, found := repository.categories[id]
+
+	if !found {
+
+		return Category{}, gorm.ErrRecordNotFound
+	}
+
+	return category, nil
+}
+
+func (repository *MemoryProductRepository) RetrieveCategories() ([]Category, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	return repository.sortedCategories(), nil
+}
+
+func (repository *MemoryProductRepository) sortedCategories() []Category {
+
+	categories := make([]Category, 0, len(repository.categories))
+
+	for _, category := range repository.categories {
+
+		categories = append(categories, category)
+	}
+
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Path < categories[j].Path })
+
+	return categories
+}
+
+func (repository *MemoryProductRepository) UpdateCategory(id uint, name string, parentID *uint) error {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	category, found := repository.categories[id]
+
+	if !found {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	path, err := repository.memoryParentPath(parentID)
+
+	if err != nil {
+
+		return err
+	}
+
+	if strings.HasPrefix(path, category.Path) {
+
+		return ErrCategoryCycle
+	}
+
+	err = repository.checkSiblingName(parentID, name, id)
+
+	if err != nil {
+
+		return err
+	}
+
+	newPath := categoryPath(path, id)
+
+	for _, descendant := range repository.categories {
+
+		if descendant.ID != id && strings.HasPrefix(descendant.Path, category.Path) {
+
+			descendant.Path = newPath + strings.TrimPrefix(descendant.Path, category.Path)
+
+			repository.categories[descendant.ID] = descendant
+		}
+	}
+
+	category.Name = name
+
+	category.ParentID = copyID(parentID)
+
+	category.Path = newPath
+
+	category.SiblingKey = siblingKey(parentID, name)
+
+	category.UpdatedAt = time.Now()
+
+	repository.categories[id] = category
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) DeleteCategory(id uint) error {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	if _, found := repository.categories[id]; !found {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	for _, category := range repository.categories {
+
+		if category.ParentID != nil && *category.ParentID == id {
+
+			return ErrCategoryNotEmpty
+		}
+	}
+
+	for _, categories := range repository.productCategories {
+
+		delete(categories, id)
+	}
+
+	delete(repository.categories, id)
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) AssignProductCategory(productID int, categoryID uint) error {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	product, found := repository.live(productID)
+
+	if !found {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	if _, found := repository.categories[categoryID]; !found {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	if repository.productCategories[product.ID] == nil {
+
+		repository.productCategories[product.ID] = make(map[uint]struct{})
+	}
+
+	repository.productCategories[product.ID][categoryID] = struct{}{}
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) UnassignProductCategory(productID int, categoryID uint) error {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	if _, found := repository.productCategories[uint(productID)][categoryID]; !found {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	delete(repository.productCategories[uint(productID)], categoryID)
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) RetrieveProductCategories(productID int) ([]Category, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	product, found := repository.live(productID)
+
+	if !found {
+
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	categories := []Category{}
+
+	for categoryID := range repository.productCategories[product.ID] {
+
+		categories = append(categories, repository.categories[categoryID])
+	}
+
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Path < categories[j].Path })
+
+	return categories, nil
+}
+
+func (repository *MemoryProductRepository) RetrieveCategoryTree(statuses []string) ([]*CategoryNode, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	var links []ProductCategory
+
+	for productID, categories := range repository.productCategories {
+
+		if product, live := repository.live(int(productID)); !live || (len(statuses) > 0 && !slices.Contains(statuses, product.Status)) {
+
+			continue
+		}
+
+		for categoryID := range categories {
+
+			links = append(links, ProductCategory{ProductID: productID, CategoryID: categoryID})
+		}
+	}
+
+	return buildCategoryTree(repository.sortedCategories(), links), nil
+}
+
+// copyID keeps the stored categories from sharing the parent ID of the caller
+func copyID(id *uint) *uint {
+
+	if id == nil {
+
+		return nil
+	}
+
+	copied := *id
+
+	return &copied
+}
+
+// touch is the in-memory equivalent of touchProduct
+func (repository *MemoryProductRepository) touch(product Product) {
+
+	product.UpdatedAt = time.Now()
+
+	product.Version++
+
+	repository.products[product.ID] = product
+}
+
+func (repository *MemoryProductRepository) AddProductTags(productID int, tags []string) ([]string, error) {
+
+	tags, err := NormalizeTags(tags)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	product, found := repository.live(productID)
+
+	if !found {
+
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if repository.productTags[product.ID] == nil {
+
+		repository.productTags[product.ID] = make(map[string]struct{})
+	}
+
+	added := false
+
+	for _, tag := range tags {
+
+		if _, found := repository.productTags[product.ID][tag]; !found {
+
+			repository.productTags[product.ID][tag] = struct{}{}
+
+			added = true
+		}
+	}
+
+	if added {
+
+		repository.touch(product)
+	}
+
+	return repository.sortedTags(product.ID), nil
+}
+
+func (repository *MemoryProductRepository) RemoveProductTag(productID int, tag string) error {
+
+	tag, err := NormalizeTag(tag)
+
+	if err != nil {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	product, found := repository.live(productID)
+
+	if !found {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	if _, found := repository.productTags[product.ID][tag]; !found {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	delete(repository.productTags[product.ID], tag)
+
+	repository.touch(product)
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) RetrieveProductTags(productID int) ([]string, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	product, found := repository.live(productID)
+
+	if !found {
+
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return repository.sortedTags(product.ID), nil
+}
+
+func (repository *MemoryProductRepository) sortedTags(productID uint) []string {
+
+	tags := make([]string, 0, len(repository.productTags[productID]))
+
+	for tag := range repository.productTags[productID] {
+
+		tags = append(tags, tag)
+	}
+
+	sort.Strings(tags)
+
+	return tags
+}
+
+func (repository *MemoryProductRepository) RetrieveTagCloud(statuses []string, limit int) ([]TagCount, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	counts := make(map[string]int)
+
+	for productID, tags := range repository.productTags {
+
+		if product, live := repository.live(int(productID)); !live || (len(statuses) > 0 && !slices.Contains(statuses, product.Status)) {
+
+			continue
+		}
+
+		for tag := range tags {
+
+			counts[tag]++
+		}
+	}
+
+	cloud := make([]TagCount, 0, len(counts))
+
+	for tag, count := range counts {
+
+		cloud = append(cloud, TagCount{Name: tag, Count: count})
+	}
+
+	return sortTagCloud(cloud, limit), nil
+}
+
+// stockItem is the in-memory equivalent of retrieveStockItem
+func (repository *MemoryProductRepository) stockItem(productID int, variantID uint) (Product, bool) {
+
+	if variantID != 0 {
+
+		product, _, found := repository.liveVariant(productID, variantID)
+
+		return product, found
+	}
+
+	return repository.live(productID)
+}
+
+// productStock is the in-memory equivalent of the function of the same name
+func (repository *MemoryProductRepository) productStock(productID uint, variantID uint) ProductAvailability {
+
+	levels := []StockLevel{}
+
+	for key, level := range repository.stock {
+
+		if key[0] == productID && key[1] == variantID {
+
+			levels = append(levels, level)
+		}
+	}
+
+	sort.Slice(levels, func(i, j int) bool { return levels[i].WarehouseID < levels[j].WarehouseID })
+
+	return newAvailability(productID, variantID, levels)
+}
+
+// stockLevel returns the stock of a product or variant in a warehouse, an empty one when there is none yet
+func (repository *MemoryProductRepository) stockLevel(productID uint, variantID uint, warehouseID uint) StockLevel {
+
+	level, found := repository.stock[[3]uint{productID, variantID, warehouseID}]
+
+	if !found {
+
+		return StockLevel{ProductID: productID, VariantID: variantID, WarehouseID: warehouseID}
+	}
+
+	return level
+}
+
+func (repository *MemoryProductRepository) putStockLevel(level StockLevel) {
+
+	level.UpdatedAt = time.Now()
+
+	repository.stock[[3]uint{level.ProductID, level.VariantID, level.WarehouseID}] = level
+}
+
+// variantAvailable is the in-memory equivalent of variantAvailability for a single variant
+func (repository *MemoryProductRepository) variantAvailable(variant ProductVariant) int64 {
+
+	available := int64(0)
+
+	for key, level := range repository.stock {
+
+		if key[0] == variant.ProductID && key[1] == variant.ID {
+
+			available += level.Available()
+		}
+	}
+
+	return available
+}
+
+// resolveWarehouse is the in-memory equivalent of the function of the same name
+func (repository *MemoryProductRepository) resolveWarehouse(warehouseID uint) (uint, error) {
+
+	if warehouseID != 0 {
+
+		if _, found := repository.warehouses[warehouseID]; !found {
+
+			return 0, gorm.ErrRecordNotFound
+		}
+
+		return warehouseID, nil
+	}
+
+	first := uint(0)
+
+	for id := range repository.warehouses {
+
+		if first == 0 || id < first {
+
+			first = id
+		}
+	}
+
+	if first == 0 {
+
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	return first, nil
+}
+
+// addStock is the in-memory equivalent of the function of the same name
+func (repository *MemoryProductRepository) addStock(productID uint, variantID uint, warehouseID uint, delta int64, reason string) error {
+
+	level := repository.stockLevel(productID, variantID, warehouseID)
+
+	if level.OnHand+delta < level.Reserved {
+
+		return ErrInsufficientStock
+	}
+
+	level.OnHand += delta
+
+	repository.putStockLevel(level)
+
+	repository.recordMovement(productID, variantID, warehouseID, delta, reason, "")
+
+	return nil
+}
+
+// releaseExpiredHolds is the in-memory equivalent of the function of the same name
+func (repository *MemoryProductRepository) releaseExpiredHolds(productID uint, now time.Time) int {
+
+	released := 0
+
+	for _, hold := range repository.holds {
+
+		if (productID == 0 || hold.ProductID == productID) && !hold.ExpiresAt.After(now) {
+
+			repository.releaseHold(hold)
+
+			released++
+		}
+	}
+
+	return released
+}
+
+func (repository *MemoryProductRepository) releaseHold(hold StockHold) {
+
+	delete(repository.holds, hold.ID)
+
+	level := repository.stockLevel(hold.ProductID, hold.VariantID, hold.WarehouseID)
+
+	level.Reserved -= hold.Quantity
+
+	repository.putStockLevel(level)
+}
+
+func (repository *MemoryProductRepository) recordMovement(productID uint, variantID uint, warehouseID uint, delta int64, reason string, holdID string) {
+
+	repository.movements = append(repository.movements, StockMovement{ID: repository.nextMovementID, ProductID: productID, VariantID: variantID, WarehouseID: warehouseID, Delta: delta, Reason: reason, HoldID: holdID, CreatedAt: time.Now()})
+
+	repository.nextMovementID++
+}
+
+func (repository *MemoryProductRepository) RetrieveStock(productID int, variantID uint) (ProductAvailability, error) {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	product, found := repository.stockItem(productID, variantID)
+
+	if !found {
+
+		return ProductAvailability{}, gorm.ErrRecordNotFound
+	}
+
+	repository.releaseExpiredHolds(product.ID, time.Now())
+
+	return repository.productStock(product.ID, variantID), nil
+}
+
+func (repository *MemoryProductRepository) AdjustStock(productID int, variantID uint, warehouseID uint, delta int64, reason string) (ProductAvailability, error) {
+
+	if delta == 0 {
+
+		return ProductAvailability{}, ErrInvalidStockChange
+	}
+
+	err := ValidateStockReason(reason)
+
+	if err != nil {
+
+		return ProductAvailability{}, err
+	}
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	product, found := repository.stockItem(productID, variantID)
+
+	if !found {
+
+		return ProductAvailability{}, gorm.ErrRecordNotFound
+	}
+
+	warehouseID, err = repository.resolveWarehouse(warehouseID)
+
+	if err != nil {
+
+		return ProductAvailability{}, err
+	}
+
+	repository.releaseExpiredHolds(product.ID, time.Now())
+
+	err = repository.addStock(product.ID, variantID, warehouseID, delta, reason)
+
+	if err != nil {
+
+		return ProductAvailability{}, err
+	}
+
+	return repository.productStock(product.ID, variantID), nil
+}
+
+func (repository *MemoryProductRepository) TransferStock(productID int, variantID uint, fromWarehouseID uint, toWarehouseID uint, quantity int64) (ProductAvailability, error) {
+
+	if quantity <= 0 || fromWarehouseID == toWarehouseID {
+
+		return ProductAvailability{}, ErrInvalidStockChange
+	}
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	product, found := repository.stockItem(productID, variantID)
+
+	if !found {
+
+		return ProductAvailability{}, gorm.ErrRecordNotFound
+	}
+
+	for _, warehouseID := range []uint{fromWarehouseID, toWarehouseID} {
+
+		if _, found := repository.warehouses[warehouseID]; !found {
+
+			return ProductAvailability{}, gorm.ErrRecordNotFound
+		}
+	}
+
+	repository.releaseExpiredHolds(product.ID, time.Now())
+
+	// Checked first, as both sides must change or none
+	if repository.stockLevel(product.ID, variantID, fromWarehouseID).Available() < quantity {
+
+		return ProductAvailability{}, ErrInsufficientStock
+	}
+
+	repository.addStock(product.ID, variantID, fromWarehouseID, -quantity, ReasonTransfer)
+
+	repository.addStock(product.ID, variantID, toWarehouseID, quantity, ReasonTransfer)
+
+	return repository.productStock(product.ID, variantID), nil
+}
+
+func (repository *MemoryProductRepository) ReserveStock(holdID string, productID int, variantID uint, warehouseID uint, quantity int64, expiresAt time.Time) (StockHold, error) {
+
+	err := validateHold(holdID, quantity)
+
+	if err != nil {
+
+		return StockHold{}, err
+	}
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	product, found := repository.stockItem(productID, variantID)
+
+	if !found {
+
+		return StockHold{}, gorm.ErrRecordNotFound
+	}
+
+	warehouseID, err = repository.resolveWarehouse(warehouseID)
+
+	if err != nil {
+
+		return StockHold{}, err
+	}
+
+	now := time.Now()
+
+	repository.releaseExpiredHolds(product.ID, now)
+
+	if existing, found := repository.holds[holdID]; found {
+
+		if existing.ProductID != product.ID || existing.VariantID != variantID || existing.WarehouseID != warehouseID || existing.Quantity != quantity {
+
+			return StockHold{}, ErrHoldExists
+		}
+
+		return existing, nil
+	}
+
+	if slices.ContainsFunc(repository.movements, func(movement StockMovement) bool { return movement.HoldID == holdID }) {
+
+		return StockHold{}, ErrHoldCommitted
+	}
+
+	level := repository.stockLevel(product.ID, variantID, warehouseID)
+
+	if level.Available() < quantity {
+
+		return StockHold{}, ErrInsufficientStock
+	}
+
+	level.Reserved += quantity
+
+	repository.putStockLevel(level)
+
+	hold := StockHold{ID: holdID, ProductID: product.ID, VariantID: variantID, WarehouseID: warehouseID, Quantity: quantity, ExpiresAt: expiresAt, CreatedAt: now}
+
+	repository.holds[holdID] = hold
+
+	return hold, nil
+}
+
+func (repository *MemoryProductRepository) RetrieveStockHold(holdID string) (StockHold, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	hold, found := repository.holds[holdID]
+
+	if !found {
+
+		return StockHold{}, gorm.ErrRecordNotFound
+	}
+
+	return hold, nil
+}
+
+func (repository *MemoryProductRepository) CommitStockHold(holdID string) (ProductAvailability, error) {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	hold, found := repository.holds[holdID]
+
+	if !found {
+
+		return ProductAvailability{}, gorm.ErrRecordNotFound
+	}
+
+	if !hold.ExpiresAt.After(time.Now()) {
+
+		return ProductAvailability{}, ErrHoldExpired
+	}
+
+	delete(repository.holds, holdID)
+
+	level := repository.stockLevel(hold.ProductID, hold.VariantID, hold.WarehouseID)
+
+	level.OnHand -= hold.Quantity
+
+	level.Reserved -= hold.Quantity
+
+	repository.putStockLevel(level)
+
+	repository.recordMovement(hold.ProductID, hold.VariantID, hold.WarehouseID, -hold.Quantity, ReasonSold, holdID)
+
+	return repository.productStock(hold.ProductID, hold.VariantID), nil
+}
+
+func (repository *MemoryProductRepository) ReleaseStockHold(holdID string) (ProductAvailability, error) {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	hold, found := repository.holds[holdID]
+
+	if !found {
+
+		return ProductAvailability{}, gorm.ErrRecordNotFound
+	}
+
+	repository.releaseHold(hold)
+
+	return repository.productStock(hold.ProductID, hold.VariantID), nil
+}
+
+func (repository *MemoryProductRepository) ReleaseExpiredStockHolds(now time.Time) (int, error) {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	return repository.releaseExpiredHolds(0, now), nil
+}
+
+func (repository *MemoryProductRepository) RetrieveStockMovements(productID int, variantID uint, limit int) ([]StockMovement, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	if _, found := repository.stockItem(productID, variantID); !found {
+
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	movements := []StockMovement{}
+
+	for i := len(repository.movements) - 1; i >= 0 && len(movements) < limit; i-- {
+
+		if repository.movements[i].ProductID == uint(productID) && repository.movements[i].VariantID == variantID {
+
+			movements = append(movements, repository.movements[i])
+		}
+	}
+
+	return movements, nil
+}
+
+// checkWarehouseCode is the in-memory equivalent of the function of the same name
+func (repository *MemoryProductRepository) checkWarehouseCode(code string, id uint) error {
+
+	for _, warehouse := range repository.warehouses {
+
+		if warehouse.Code == code && warehouse.ID != id {
+
+			return ErrDuplicateWarehouse
+		}
+	}
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) CreateWarehouse(code string, name string) (Warehouse, error) {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	err := repository.checkWarehouseCode(code, 0)
+
+	if err != nil {
+
+		return Warehouse{}, err
+	}
+
+	now := time.Now()
+
+	warehouse := Warehouse{ID: repository.nextWarehouseID, Code: code, Name: name, CreatedAt: now, UpdatedAt: now}
+
+	repository.warehouses[warehouse.ID] = warehouse
+
+	repository.nextWarehouseID++
+
+	return warehouse, nil
+}
+
+func (repository *MemoryProductRepository) RetrieveWarehouse(id uint) (Warehouse, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	warehouse, found := repository.warehouses[id]
+
+	if !found {
+
+		return Warehouse{}, gorm.ErrRecordNotFound
+	}
+
+	return warehouse, nil
+}
+
+func (repository *MemoryProductRepository) RetrieveWarehouses() ([]Warehouse, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	warehouses := make([]Warehouse, 0, len(repository.warehouses))
+
+	for _, warehouse := range repository.warehouses {
+
+		warehouses = append(warehouses, warehouse)
+	}
+
+	sort.Slice(warehouses, func(i, j int) bool { return warehouses[i].ID < warehouses[j].ID })
+
+	return warehouses, nil
+}
+
+func (repository *MemoryProductRepository) UpdateWarehouse(id uint, code string, name string) error {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	warehouse, found := repository.warehouses[id]
+
+	if !found {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	err := repository.checkWarehouseCode(code, id)
+
+	if err != nil {
+
+		return err
+	}
+
+	warehouse.Code = code
+
+	warehouse.Name = name
+
+	warehouse.UpdatedAt = time.Now()
+
+	repository.warehouses[id] = warehouse
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) DeleteWarehouse(id uint) error {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	if _, found := repository.warehouses[id]; !found {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	for key, level := range repository.stock {
+
+		if key[2] == id && (level.OnHand > 0 || level.Reserved > 0) {
+
+			return ErrWarehouseNotEmpty
+		}
+	}
+
+	for key := range repository.stock {
+
+		if key[2] == id {
+
+			delete(repository.stock, key)
+		}
+	}
+
+	delete(repository.warehouses, id)
+
+	return nil
+}
+
+// checkVariantUnique is the in-memory equivalent of the SKU and option values checks of the gorm repository
+func (repository *MemoryProductRepository) checkVariantUnique(variant ProductVariant, id uint) error {
+
+	for _, other := range repository.variants {
+
+		if other.ID != id && (other.SKU == variant.SKU || (other.ProductID == variant.ProductID && other.OptionsKey == variant.OptionsKey)) {
+
+			return ErrDuplicateVariant
+		}
+	}
+
+	for _, product := range repository.products {
+
+		if product.SKU != nil && *product.SKU == variant.SKU {
+
+			return ErrDuplicateVariant
+		}
+	}
+
+	return nil
+}
+
+// liveVariant returns a variant of a live product
+func (repository *MemoryProductRepository) liveVariant(productID int, variantID uint) (Product, ProductVariant, bool) {
+
+	product, found := repository.live(productID)
+
+	if !found {
+
+		return Product{}, ProductVariant{}, false
+	}
+
+	variant, found := repository.variants[variantID]
+
+	if !found || variant.ProductID != product.ID {
+
+		return Product{}, ProductVariant{}, false
+	}
+
+	return product, variant, true
+}
+
+func (repository *MemoryProductRepository) CreateProductVariant(productID int, spec VariantSpec) (ProductVariant, error) {
+
+	variant, err := newVariant(uint(productID), spec)
+
+	if err != nil {
+
+		return ProductVariant{}, err
+	}
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	product, found := repository.live(productID)
+
+	if !found {
+
+		return ProductVariant{}, gorm.ErrRecordNotFound
+	}
+
+	err = repository.checkVariantUnique(variant, 0)
+
+	if err != nil {
+
+		return ProductVariant{}, err
+	}
+
+	now := time.Now()
+
+	variant.ID = repository.nextVariantID
+
+	variant.CreatedAt = now
+
+	variant.UpdatedAt = now
+
+	repository.variants[variant.ID] = variant
+
+	repository.nextVariantID++
+
+	repository.touch(product)
+
+	return variant, nil
+}
+
+func (repository *MemoryProductRepository) RetrieveProductVariant(productID int, variantID uint) (ProductVariant, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	_, variant, found := repository.liveVariant(productID, variantID)
+
+	if !found {
+
+		return ProductVariant{}, gorm.ErrRecordNotFound
+	}
+
+	variant.Available = repository.variantAvailable(variant)
+
+	return variant, nil
+}
+
+func (repository *MemoryProductRepository) RetrieveProductVariantBySKU(sku string) (ProductVariant, error) {
+
+	normalized, err := NormalizeSKU(sku)
+
+	if err != nil {
+
+		return ProductVariant{}, err
+	}
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	for _, variant := range repository.variants {
+
+		if variant.SKU != normalized {
+
+			continue
+		}
+
+		if _, found := repository.live(int(variant.ProductID)); !found {
+
+			break
+		}
+
+		variant.Available = repository.variantAvailable(variant)
+
+		return variant, nil
+	}
+
+	return ProductVariant{}, gorm.ErrRecordNotFound
+}
+
+func (repository *MemoryProductRepository) RetrieveProductVariants(productID int) ([]ProductVariant, error) {
+
+	repository.mutex.RLock()
+
+	defer repository.mutex.RUnlock()
+
+	product, found := repository.live(productID)
+
+	if !found {
+
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	variants := []ProductVariant{}
+
+	for _, variant := range repository.variants {
+
+		if variant.ProductID == product.ID {
+
+			variant.Available = repository.variantAvailable(variant)
+
+			variants = append(variants, variant)
+		}
+	}
+
+	sort.Slice(variants, func(i, j int) bool { return variants[i].ID < variants[j].ID })
+
+	return variants, nil
+}
+
+func (repository *MemoryProductRepository) UpdateProductVariant(productID int, variantID uint, spec VariantSpec) error {
+
+	replacement, err := newVariant(uint(productID), spec)
+
+	if err != nil {
+
+		return err
+	}
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	product, variant, found := repository.liveVariant(productID, variantID)
+
+	if !found {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	err = repository.checkVariantUnique(replacement, variantID)
+
+	if err != nil {
+
+		return err
+	}
+
+	replacement.ID = variant.ID
+
+	replacement.CreatedAt = variant.CreatedAt
+
+	replacement.UpdatedAt = time.Now()
+
+	repository.variants[variantID] = replacement
+
+	repository.touch(product)
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) DeleteProductVariant(productID int, variantID uint) error {
+
+	repository.mutex.Lock()
+
+	defer repository.mutex.Unlock()
+
+	product, _, found := repository.liveVariant(productID, variantID)
+
+	if !found {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	repository.releaseExpiredHolds(product.ID, time.Now())
+
+	for key, level := range repository.stock {
+
+		if key[0] == product.ID && key[1] == variantID && (level.OnHand > 0 || level.Reserved > 0) {
+
+			return ErrVariantNotEmpty
+		}
+	}
+
+	for key := range repository.stock {
+
+		if key[0] == product.ID && key[1] == variantID {
+
+			delete(repository.stock, key)
+		}
+	}
+
+	delete(repository.variants, variantID)
+
+	repository.touch(product)
+
+	return nil
+}
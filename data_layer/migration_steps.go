@@ -0,0 +1,841 @@
+package data_layer
+
+import (
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// Every migration works on its own frozen copy of the tables it touches,
+// so later changes to the models never rewrite the history below.
+
+var migrations = []Migration{
+	{Version: 1, Name: "create_products", Up: createProductsUp, Down: createProductsDown},
+	{Version: 2, Name: "store_prices_as_minor_units", Up: storePricesAsMinorUnitsUp, Down: storePricesAsMinorUnitsDown},
+	{Version: 3, Name: "create_product_prices_and_exchange_rates", Up: createProductPricesAndExchangeRatesUp, Down: createProductPricesAndExchangeRatesDown},
+	{Version: 4, Name: "add_product_version", Up: addProductVersionUp, Down: addProductVersionDown},
+	{Version: 5, Name: "index_product_list_columns", Up: indexProductListColumnsUp, Down: indexProductListColumnsDown},
+	{Version: 6, Name: "create_product_search_index", Up: createProductSearchIndexUp, Down: createProductSearchIndexDown, Applicable: createProductSearchIndexApplicable},
+	{Version: 7, Name: "create_categories", Up: createCategoriesUp, Down: createCategoriesDown},
+	{Version: 8, Name: "create_tags", Up: createTagsUp, Down: createTagsDown},
+	{Version: 9, Name: "create_inventory", Up: createInventoryUp, Down: createInventoryDown},
+	{Version: 10, Name: "create_warehouses", Up: createWarehousesUp, Down: createWarehousesDown},
+	{Version: 11, Name: "create_product_variants", Up: createProductVariantsUp, Down: createProductVariantsDown},
+	{Version: 12, Name: "add_product_identifiers", Up: addProductIdentifiersUp, Down: addProductIdentifiersDown},
+	{Version: 13, Name: "add_product_lifecycle", Up: addProductLifecycleUp, Down: addProductLifecycleDown},
+	{Version: 14, Name: "key_stock_by_variant", Up: keyStockByVariantUp, Down: keyStockByVariantDown},
+}
+
+// 0001: products table, as previously created by AutoMigrate(&Product{})
+
+type productV1 struct {
+	gorm.Model
+	Name  string
+	Price float64
+}
+
+func (productV1) TableName() string { return "products" }
+
+func createProductsUp(tx *gorm.DB) error {
+
+	// Databases created before versioned migrations already have the table
+	if tx.Migrator().HasTable(&productV1{}) {
+
+		return nil
+	}
+
+	return tx.Migrator().CreateTable(&productV1{})
+}
+
+func createProductsDown(tx *gorm.DB) error {
+
+	return tx.Migrator().DropTable(&productV1{})
+}
+
+// 0002: float64 prices become integer minor units with an explicit currency code.
+// Existing rows are rounded to the nearest cent and priced in DefaultCurrency.
+
+type productV2 struct {
+	gorm.Model
+	Name       string
+	Price      float64
+	PriceMinor int64  `gorm:"column:price_minor;not null;default:0"`
+	Currency   string `gorm:"size:3;not null;default:'EUR'"`
+}
+
+func (productV2) TableName() string { return "products" }
+
+func storePricesAsMinorUnitsUp(tx *gorm.DB) error {
+
+	for _, column := range []string{"PriceMinor", "Currency"} {
+
+		err := tx.Migrator().AddColumn(&productV2{}, column)
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	err := tx.Exec("UPDATE products SET price_minor = ROUND(price * 100), currency = ?", DefaultCurrency).Error
+
+	if err != nil {
+
+		return err
+	}
+
+	return tx.Migrator().DropColumn(&productV2{}, "Price")
+}
+
+func storePricesAsMinorUnitsDown(tx *gorm.DB) error {
+
+	err := tx.Migrator().AddColumn(&productV2{}, "Price")
+
+	if err != nil {
+
+		return err
+	}
+
+	err = tx.Exec("UPDATE products SET price = price_minor / 100.0").Error
+
+	if err != nil {
+
+		return err
+	}
+
+	for _, column := range []string{"PriceMinor", "Currency"} {
+
+		err = tx.Migrator().DropColumn(&productV2{}, column)
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 0003: explicit per-currency product prices and the local exchange-rate table
+
+type productPriceV3 struct {
+	ID         uint   `gorm:"primarykey"`
+	ProductID  uint   `gorm:"not null;uniqueIndex:idx_product_prices_product_currency"`
+	Currency   string `gorm:"size:3;not null;uniqueIndex:idx_product_prices_product_currency"`
+	PriceMinor int64  `gorm:"column:price_minor;not null"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (productPriceV3) TableName() string { return "product_prices" }
+
+type exchangeRateV3 struct {
+	ID            uint   `gorm:"primarykey"`
+	BaseCurrency  string `gorm:"size:3;not null;uniqueIndex:idx_exchange_rates_pair"`
+	QuoteCurrency string `gorm:"size:3;not null;uniqueIndex:idx_exchange_rates_pair"`
+	RateScaled    int64  `gorm:"column:rate_scaled;not null"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (exchangeRateV3) TableName() string { return "exchange_rates" }
+
+func createProductPricesAndExchangeRatesUp(tx *gorm.DB) error {
+
+	return tx.Migrator().CreateTable(&productPriceV3{}, &exchangeRateV3{})
+}
+
+func createProductPricesAndExchangeRatesDown(tx *gorm.DB) error {
+
+	return tx.Migrator().DropTable(&productPriceV3{}, &exchangeRateV3{})
+}
+
+// 0004: version counter for optimistic concurrency control; existing rows start at version 1
+
+type productV4 struct {
+	gorm.Model
+	Version uint `gorm:"not null;default:1"`
+}
+
+func (productV4) TableName() string { return "products" }
+
+func addProductVersionUp(tx *gorm.DB) error {
+
+	return tx.Migrator().AddColumn(&productV4{}, "Version")
+}
+
+func addProductVersionDown(tx *gorm.DB) error {
+
+	return tx.Migrator().DropColumn(&productV4{}, "Version")
+}
+
+// 0005: indexes behind the filters and sorts of the product list
+
+type productV5 struct {
+	ID         uint      `gorm:"primarykey"`
+	Name       string    `gorm:"index:idx_products_name"`
+	PriceMinor int64     `gorm:"column:price_minor;index:idx_products_price_minor"`
+	CreatedAt  time.Time `gorm:"index:idx_products_created_at"`
+	UpdatedAt  time.Time `gorm:"index:idx_products_updated_at"`
+}
+
+func (productV5) TableName() string { return "products" }
+
+var productListIndexes = []string{"idx_products_name", "idx_products_price_minor", "idx_products_created_at", "idx_products_updated_at"}
+
+func indexProductListColumnsUp(tx *gorm.DB) error {
+
+	for _, index := range productListIndexes {
+
+		err := tx.Migrator().CreateIndex(&productV5{}, index)
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func indexProductListColumnsDown(tx *gorm.DB) error {
+
+	for _, index := range productListIndexes {
+
+		err := tx.Migrator().DropIndex(&productV5{}, index)
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 0006: FTS5 index of the product names, kept in sync by triggers. On PostgreSQL and MySQL the migration is a no-op
+// and search falls back to LIKE matching. On SQLite it needs a build with the sqlite_fts5 tag: builds without it leave
+// the migration pending, searching with LIKE meanwhile, and the first migrate up of a build with the tag creates it.
+// Note that SQLite drops the triggers whenever a migration rebuilds the products table.
+
+const productSearchIndex = "products_fts"
+
+var productSearchIndexStatements = []string{
+	"CREATE VIRTUAL TABLE products_fts USING fts5(name, content='products', content_rowid='id', tokenize='unicode61 remove_diacritics 2', prefix='2 3')",
+	"CREATE TRIGGER products_fts_insert AFTER INSERT ON products BEGIN INSERT INTO products_fts(rowid, name) VALUES (new.id, new.name); END",
+	"CREATE TRIGGER products_fts_delete AFTER DELETE ON products BEGIN INSERT INTO products_fts(products_fts, rowid, name) VALUES ('delete', old.id, old.name); END",
+	"CREATE TRIGGER products_fts_update AFTER UPDATE OF name ON products BEGIN INSERT INTO products_fts(products_fts, rowid, name) VALUES ('delete', old.id, old.name); INSERT INTO products_fts(rowid, name) VALUES (new.id, new.name); END",
+	"INSERT INTO products_fts(products_fts) VALUES ('rebuild')",
+}
+
+// fts5Available tells whether the SQLite library linked into this binary was compiled with FTS5
+func fts5Available(tx *gorm.DB) bool {
+
+	var enabled bool
+
+	err := tx.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled).Error
+
+	return err == nil && enabled
+}
+
+func createProductSearchIndexApplicable(tx *gorm.DB) bool {
+
+	return tx.Dialector.Name() != DriverSQLite || fts5Available(tx)
+}
+
+func createProductSearchIndexUp(tx *gorm.DB) error {
+
+	if tx.Dialector.Name() != DriverSQLite {
+
+		return nil
+	}
+
+	for _, statement := range productSearchIndexStatements {
+
+		err := tx.Exec(statement).Error
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func createProductSearchIndexDown(tx *gorm.DB) error {
+
+	if tx.Dialector.Name() != DriverSQLite {
+
+		return nil
+	}
+
+	for _, statement := range []string{"DROP TRIGGER IF EXISTS products_fts_insert", "DROP TRIGGER IF EXISTS products_fts_delete", "DROP TRIGGER IF EXISTS products_fts_update", "DROP TABLE IF EXISTS products_fts"} {
+
+		err := tx.Exec(statement).Error
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 0007: category hierarchy stored as materialized paths, and the many-to-many product assignments. The sibling key
+// makes the names unique among the children of a category, roots included, which a NULL parent_id could not.
+
+type categoryV7 struct {
+	ID         uint   `gorm:"primarykey"`
+	Name       string `gorm:"size:100;not null"`
+	ParentID   *uint  `gorm:"index"`
+	Path       string `gorm:"size:255;not null;index"`
+	SiblingKey string `gorm:"size:160;not null;uniqueIndex"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (categoryV7) TableName() string { return "categories" }
+
+type productCategoryV7 struct {
+	ProductID  uint `gorm:"primaryKey;autoIncrement:false"`
+	CategoryID uint `gorm:"primaryKey;autoIncrement:false;index"`
+}
+
+func (productCategoryV7) TableName() string { return "product_categories" }
+
+func createCategoriesUp(tx *gorm.DB) error {
+
+	return tx.Migrator().CreateTable(&categoryV7{}, &productCategoryV7{})
+}
+
+func createCategoriesDown(tx *gorm.DB) error {
+
+	return tx.Migrator().DropTable(&productCategoryV7{}, &categoryV7{})
+}
+
+// 0008: normalized tags, and the many-to-many product tags
+
+type tagV8 struct {
+	ID        uint   `gorm:"primarykey"`
+	Name      string `gorm:"size:50;not null;uniqueIndex"`
+	CreatedAt time.Time
+}
+
+func (tagV8) TableName() string { return "tags" }
+
+type productTagV8 struct {
+	ProductID uint `gorm:"primaryKey;autoIncrement:false"`
+	TagID     uint `gorm:"primaryKey;autoIncrement:false;index"`
+}
+
+func (productTagV8) TableName() string { return "product_tags" }
+
+func createTagsUp(tx *gorm.DB) error {
+
+	return tx.Migrator().CreateTable(&tagV8{}, &productTagV8{})
+}
+
+func createTagsDown(tx *gorm.DB) error {
+
+	return tx.Migrator().DropTable(&productTagV8{}, &tagV8{})
+}
+
+// 0009: stock levels, their movements and the reservations holding units
+
+type stockLevelV9 struct {
+	ProductID uint  `gorm:"primaryKey;autoIncrement:false"`
+	OnHand    int64 `gorm:"not null;default:0"`
+	Reserved  int64 `gorm:"not null;default:0"`
+	UpdatedAt time.Time
+}
+
+func (stockLevelV9) TableName() string { return "stock_levels" }
+
+type stockMovementV9 struct {
+	ID        uint   `gorm:"primarykey"`
+	ProductID uint   `gorm:"not null;index"`
+	Delta     int64  `gorm:"not null"`
+	Reason    string `gorm:"size:20;not null"`
+	HoldID    string `gorm:"size:64;index"`
+	CreatedAt time.Time
+}
+
+func (stockMovementV9) TableName() string { return "stock_movements" }
+
+type stockHoldV9 struct {
+	ID        string    `gorm:"primaryKey;size:64"`
+	ProductID uint      `gorm:"not null;index"`
+	Quantity  int64     `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+func (stockHoldV9) TableName() string { return "stock_holds" }
+
+func createInventoryUp(tx *gorm.DB) error {
+
+	return tx.Migrator().CreateTable(&stockLevelV9{}, &stockMovementV9{}, &stockHoldV9{})
+}
+
+func createInventoryDown(tx *gorm.DB) error {
+
+	return tx.Migrator().DropTable(&stockHoldV9{}, &stockMovementV9{}, &stockLevelV9{})
+}
+
+// 0010: warehouses, with the stock rows keyed by product and warehouse. The existing stock moves to the main warehouse.
+// The stock table is rebuilt under a new name and renamed, as its primary key changes; PostgreSQL keeps the
+// constraint names of a renamed table, so the new one must not be created while the old one holds its name.
+
+type warehouseV10 struct {
+	ID        uint   `gorm:"primarykey"`
+	Code      string `gorm:"size:20;not null;uniqueIndex"`
+	Name      string `gorm:"size:100;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (warehouseV10) TableName() string { return "warehouses" }
+
+type stockLevelV10 struct {
+	ProductID   uint  `gorm:"primaryKey;autoIncrement:false"`
+	WarehouseID uint  `gorm:"primaryKey;autoIncrement:false;index"`
+	OnHand      int64 `gorm:"not null;default:0"`
+	Reserved    int64 `gorm:"not null;default:0"`
+	UpdatedAt   time.Time
+}
+
+func (stockLevelV10) TableName() string { return "stock_levels_v10" }
+
+type stockLevelRollbackV10 struct {
+	ProductID uint  `gorm:"primaryKey;autoIncrement:false"`
+	OnHand    int64 `gorm:"not null;default:0"`
+	Reserved  int64 `gorm:"not null;default:0"`
+	UpdatedAt time.Time
+}
+
+func (stockLevelRollbackV10) TableName() string { return "stock_levels_v9" }
+
+type stockMovementV10 struct {
+	WarehouseID uint `gorm:"not null;default:0;index"`
+}
+
+func (stockMovementV10) TableName() string { return "stock_movements" }
+
+type stockHoldV10 struct {
+	WarehouseID uint `gorm:"not null;default:0;index"`
+}
+
+func (stockHoldV10) TableName() string { return "stock_holds" }
+
+// rebuildStockLevels creates the stock table of model under a temporary name, fills it with query and swaps it in
+func rebuildStockLevels(tx *gorm.DB, model interface{ TableName() string }, query string, values ...interface{}) error {
+
+	err := tx.Migrator().CreateTable(model)
+
+	if err != nil {
+
+		return err
+	}
+
+	err = tx.Exec("INSERT INTO "+model.TableName()+" "+query, values...).Error
+
+	if err != nil {
+
+		return err
+	}
+
+	err = tx.Migrator().DropTable("stock_levels")
+
+	if err != nil {
+
+		return err
+	}
+
+	return tx.Migrator().RenameTable(model.TableName(), "stock_levels")
+}
+
+func createWarehousesUp(tx *gorm.DB) error {
+
+	err := tx.Migrator().CreateTable(&warehouseV10{})
+
+	if err != nil {
+
+		return err
+	}
+
+	mainWarehouse := warehouseV10{Code: "main", Name: "Main warehouse"}
+
+	err = tx.Create(&mainWarehouse).Error
+
+	if err != nil {
+
+		return err
+	}
+
+	err = rebuildStockLevels(tx, &stockLevelV10{}, "(product_id, warehouse_id, on_hand, reserved, updated_at) SELECT product_id, ?, on_hand, reserved, updated_at FROM stock_levels", mainWarehouse.ID)
+
+	if err != nil {
+
+		return err
+	}
+
+	for _, model := range []interface{}{&stockMovementV10{}, &stockHoldV10{}} {
+
+		err = tx.Migrator().AddColumn(model, "WarehouseID")
+
+		if err != nil {
+
+			return err
+		}
+
+		err = tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Model(model).Update("warehouse_id", mainWarehouse.ID).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		err = tx.Migrator().CreateIndex(model, "WarehouseID")
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func createWarehousesDown(tx *gorm.DB) error {
+
+	err := rebuildStockLevels(tx, &stockLevelRollbackV10{}, "(product_id, on_hand, reserved, updated_at) SELECT product_id, SUM(on_hand), SUM(reserved), MAX(updated_at) FROM stock_levels GROUP BY product_id")
+
+	if err != nil {
+
+		return err
+	}
+
+	for _, model := range []interface{ TableName() string }{&stockMovementV10{}, &stockHoldV10{}} {
+
+		// SQLite cannot drop an indexed column
+		err = tx.Migrator().DropIndex(model, "idx_"+model.TableName()+"_warehouse_id")
+
+		if err != nil {
+
+			return err
+		}
+
+		err = tx.Migrator().DropColumn(model, "WarehouseID")
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return tx.Migrator().DropTable(&warehouseV10{})
+}
+
+// 0011: product variants, unique by SKU and by option values within a product
+
+type productVariantV11 struct {
+	ID            uint   `gorm:"primarykey"`
+	ProductID     uint   `gorm:"not null;uniqueIndex:idx_product_variants_options"`
+	SKU           string `gorm:"column:sku;size:64;not null;uniqueIndex"`
+	Options       string `gorm:"size:255;not null"`
+	OptionsKey    string `gorm:"size:255;not null;uniqueIndex:idx_product_variants_options"`
+	PriceOverride *int64 `gorm:"column:price_override_minor"`
+	Stock         int64  `gorm:"not null;default:0"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (productVariantV11) TableName() string { return "product_variants" }
+
+func createProductVariantsUp(tx *gorm.DB) error {
+
+	return tx.Migrator().CreateTable(&productVariantV11{})
+}
+
+func createProductVariantsDown(tx *gorm.DB) error {
+
+	return tx.Migrator().DropTable(&productVariantV11{})
+}
+
+// 0012: optional SKU and GTIN of the products, unique when set
+
+type productV12 struct {
+	ID   uint    `gorm:"primarykey"`
+	SKU  *string `gorm:"column:sku;size:64;uniqueIndex"`
+	GTIN *string `gorm:"column:gtin;size:14;uniqueIndex"`
+}
+
+func (productV12) TableName() string { return "products" }
+
+var productIdentifierColumns = []string{"SKU", "GTIN"}
+
+func addProductIdentifiersUp(tx *gorm.DB) error {
+
+	for _, column := range productIdentifierColumns {
+
+		err := tx.Migrator().AddColumn(&productV12{}, column)
+
+		if err != nil {
+
+			return err
+		}
+
+		err = tx.Migrator().CreateIndex(&productV12{}, column)
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func addProductIdentifiersDown(tx *gorm.DB) error {
+
+	for _, column := range productIdentifierColumns {
+
+		err := tx.Migrator().DropIndex(&productV12{}, column)
+
+		if err != nil {
+
+			return err
+		}
+
+		// A plain ALTER TABLE: the DropColumn of the SQLite migrator rebuilds the products table, losing its search triggers
+		err = tx.Exec("ALTER TABLE products DROP COLUMN " + strings.ToLower(column)).Error
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 0013: lifecycle status of the products, active for the existing ones, and its schedule
+
+type productV13 struct {
+	ID          uint       `gorm:"primarykey"`
+	Status      string     `gorm:"size:10;not null;default:active;index"`
+	PublishAt   *time.Time `gorm:"index"`
+	UnpublishAt *time.Time `gorm:"index"`
+}
+
+func (productV13) TableName() string { return "products" }
+
+// productLifecycleColumns maps the fields added by 0013 to their columns
+var productLifecycleColumns = [][2]string{{"Status", "status"}, {"PublishAt", "publish_at"}, {"UnpublishAt", "unpublish_at"}}
+
+func addProductLifecycleUp(tx *gorm.DB) error {
+
+	for _, column := range productLifecycleColumns {
+
+		err := tx.Migrator().AddColumn(&productV13{}, column[0])
+
+		if err != nil {
+
+			return err
+		}
+
+		err = tx.Migrator().CreateIndex(&productV13{}, column[0])
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func addProductLifecycleDown(tx *gorm.DB) error {
+
+	for _, column := range productLifecycleColumns {
+
+		err := tx.Migrator().DropIndex(&productV13{}, column[0])
+
+		if err != nil {
+
+			return err
+		}
+
+		// A plain ALTER TABLE, as in 0012
+		err = tx.Exec("ALTER TABLE products DROP COLUMN " + column[1]).Error
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 0014: stock rows, movements and holds keyed by variant too, 0 standing for the product itself. The stock column of
+// the variants moves to the first warehouse, recorded as a correction; the stock table is rebuilt as in 0010.
+
+type stockLevelV14 struct {
+	ProductID   uint  `gorm:"primaryKey;autoIncrement:false"`
+	VariantID   uint  `gorm:"primaryKey;autoIncrement:false"`
+	WarehouseID uint  `gorm:"primaryKey;autoIncrement:false;index"`
+	OnHand      int64 `gorm:"not null;default:0"`
+	Reserved    int64 `gorm:"not null;default:0"`
+	UpdatedAt   time.Time
+}
+
+func (stockLevelV14) TableName() string { return "stock_levels_v14" }
+
+type stockLevelRollbackV14 struct {
+	ProductID   uint  `gorm:"primaryKey;autoIncrement:false"`
+	WarehouseID uint  `gorm:"primaryKey;autoIncrement:false;index"`
+	OnHand      int64 `gorm:"not null;default:0"`
+	Reserved    int64 `gorm:"not null;default:0"`
+	UpdatedAt   time.Time
+}
+
+func (stockLevelRollbackV14) TableName() string { return "stock_levels_v13" }
+
+type stockMovementV14 struct {
+	VariantID uint `gorm:"not null;default:0;index"`
+}
+
+func (stockMovementV14) TableName() string { return "stock_movements" }
+
+type stockHoldV14 struct {
+	VariantID uint `gorm:"not null;default:0;index"`
+}
+
+func (stockHoldV14) TableName() string { return "stock_holds" }
+
+func keyStockByVariantUp(tx *gorm.DB) error {
+
+	for _, model := range []interface{}{&stockMovementV14{}, &stockHoldV14{}} {
+
+		err := tx.Migrator().AddColumn(model, "VariantID")
+
+		if err != nil {
+
+			return err
+		}
+
+		err = tx.Migrator().CreateIndex(model, "VariantID")
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	err := rebuildStockLevels(tx, &stockLevelV14{}, "(product_id, variant_id, warehouse_id, on_hand, reserved, updated_at) SELECT product_id, 0, warehouse_id, on_hand, reserved, updated_at FROM stock_levels")
+
+	if err != nil {
+
+		return err
+	}
+
+	var stocked int64
+
+	err = tx.Model(&productVariantV11{}).Where("stock > 0").Count(&stocked).Error
+
+	if err != nil {
+
+		return err
+	}
+
+	if stocked > 0 {
+
+		var warehouse warehouseV10
+
+		// Every warehouse may have been deleted since 0010
+		err = tx.Order("id").Attrs(warehouseV10{Code: "main", Name: "Main warehouse"}).FirstOrCreate(&warehouse).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		now := time.Now()
+
+		err = tx.Exec("INSERT INTO stock_levels (product_id, variant_id, warehouse_id, on_hand, reserved, updated_at) SELECT product_id, id, ?, stock, 0, ? FROM product_variants WHERE stock > 0", warehouse.ID, now).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		err = tx.Exec("INSERT INTO stock_movements (product_id, variant_id, warehouse_id, delta, reason, hold_id, created_at) SELECT product_id, id, ?, stock, 'correction', '', ? FROM product_variants WHERE stock > 0", warehouse.ID, now).Error
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	// A plain ALTER TABLE: the DropColumn of the SQLite migrator rebuilds the table, losing its unique indexes
+	return tx.Exec("ALTER TABLE product_variants DROP COLUMN stock").Error
+}
+
+func keyStockByVariantDown(tx *gorm.DB) error {
+
+	err := tx.Migrator().AddColumn(&productVariantV11{}, "Stock")
+
+	if err != nil {
+
+		return err
+	}
+
+	// Held units are counted too: the holds of the variants are dropped below
+	err = tx.Exec("UPDATE product_variants SET stock = COALESCE((SELECT SUM(on_hand) FROM stock_levels WHERE stock_levels.variant_id = product_variants.id), 0)").Error
+
+	if err != nil {
+
+		return err
+	}
+
+	for _, model := range []interface{ TableName() string }{&stockMovementV14{}, &stockHoldV14{}} {
+
+		err = tx.Exec("DELETE FROM " + model.TableName() + " WHERE variant_id <> 0").Error
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	err = rebuildStockLevels(tx, &stockLevelRollbackV14{}, "(product_id, warehouse_id, on_hand, reserved, updated_at) SELECT product_id, warehouse_id, on_hand, reserved, updated_at FROM stock_levels WHERE variant_id = 0")
+
+	if err != nil {
+
+		return err
+	}
+
+	for _, model := range []interface{ TableName() string }{&stockMovementV14{}, &stockHoldV14{}} {
+
+		// SQLite cannot drop an indexed column
+		err = tx.Migrator().DropIndex(model, "idx_"+model.TableName()+"_variant_id")
+
+		if err != nil {
+
+			return err
+		}
+
+		// A plain ALTER TABLE, which keeps the warehouse_id index, as above
+		err = tx.Exec("ALTER TABLE " + model.TableName() + " DROP COLUMN variant_id").Error
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
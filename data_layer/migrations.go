@@ -0,0 +1,290 @@
+package data_layer
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
+
+// Migration is one ordered, reversible schema change. Versions are applied in ascending order.
+// Applicable, when set, tells whether this build can apply the migration: one it cannot apply stays pending,
+// without holding back the later migrations or the server, until a build that can runs MigrateUp.
+type Migration struct {
+	Version    uint
+	Name       string
+	Up         func(tx *gorm.DB) error
+	Down       func(tx *gorm.DB) error
+	Applicable func(tx *gorm.DB) bool
+}
+
+func (migration Migration) applicable(tx *gorm.DB) bool {
+
+	return migration.Applicable == nil || migration.Applicable(tx)
+}
+
+// SchemaMigration is the row recorded in the schema_migrations table for every applied migration
+type SchemaMigration struct {
+	Version   uint   `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255"`
+	AppliedAt time.Time
+}
+
+// MigrationState reports whether a known migration has been applied. Deferred is set on the pending
+// migrations that this build cannot apply.
+type MigrationState struct {
+	Version   uint
+	Name      string
+	Applied   bool
+	Deferred  bool
+	AppliedAt *time.Time
+}
+
+// ErrSchemaBehind is returned by CheckSchemaUpToDate when migrations are pending
+var ErrSchemaBehind = errors.New("the products database schema is behind, run the pending migrations first")
+
+// Migrations returns every known migration sorted by version
+func Migrations() []Migration {
+
+	sorted := make([]Migration, len(migrations))
+
+	copy(sorted, migrations)
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	return sorted
+}
+
+// MigrateUp applies every pending migration in order, each one in its own transaction. The migrations this
+// build cannot apply are skipped and stay pending. Like CheckSchemaUpToDate, it refuses a database whose search
+// index this build cannot maintain.
+func MigrateUp(products_db *gorm.DB) ([]Migration, error) {
+
+	err := CheckSearchIndexSupported(products_db)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	pending, err := PendingMigrations(products_db)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	var applied []Migration
+
+	for _, migration := range pending {
+
+		if !migration.applicable(products_db) {
+
+			continue
+		}
+
+		err = products_db.Transaction(func(tx *gorm.DB) error {
+
+			err := migration.Up(tx)
+
+			if err != nil {
+
+				return err
+			}
+
+			return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		})
+
+		if err != nil {
+
+			return applied, fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+// MigrateDown reverts the last `steps` applied migrations, newest first. A deferred migration applied after
+// later versions is the newest one, so the order is the one they were applied in, then the version.
+func MigrateDown(products_db *gorm.DB, steps int) ([]Migration, error) {
+
+	states, err := MigrationStatus(products_db)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	known := make(map[uint]Migration)
+
+	for _, migration := range Migrations() {
+
+		known[migration.Version] = migration
+	}
+
+	var applied []MigrationState
+
+	for _, state := range states {
+
+		if state.Applied {
+
+			applied = append(applied, state)
+		}
+	}
+
+	sort.SliceStable(applied, func(i, j int) bool {
+
+		if !applied[i].AppliedAt.Equal(*applied[j].AppliedAt) {
+
+			return applied[i].AppliedAt.After(*applied[j].AppliedAt)
+		}
+
+		return applied[i].Version > applied[j].Version
+	})
+
+	var reverted []Migration
+
+	for _, state := range applied {
+
+		if len(reverted) >= steps {
+
+			break
+		}
+
+		migration := known[state.Version]
+
+		err = products_db.Transaction(func(tx *gorm.DB) error {
+
+			err := migration.Down(tx)
+
+			if err != nil {
+
+				return err
+			}
+
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+
+		if err != nil {
+
+			return reverted, fmt.Errorf("reverting migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+
+		reverted = append(reverted, migration)
+	}
+
+	return reverted, nil
+}
+
+// MigrationStatus lists every known migration together with when it was applied
+func MigrationStatus(products_db *gorm.DB) ([]MigrationState, error) {
+
+	err := products_db.AutoMigrate(&SchemaMigration{})
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	var records []SchemaMigration
+
+	err = products_db.Find(&records).Error
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	appliedAt := make(map[uint]time.Time)
+
+	for _, record := range records {
+
+		appliedAt[record.Version] = record.AppliedAt
+	}
+
+	var states []MigrationState
+
+	for _, migration := range Migrations() {
+
+		state := MigrationState{Version: migration.Version, Name: migration.Name}
+
+		if at, found := appliedAt[migration.Version]; found {
+
+			state.Applied = true
+
+			state.AppliedAt = &at
+
+		} else {
+
+			state.Deferred = !migration.applicable(products_db)
+		}
+
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// PendingMigrations returns the migrations that have not been applied yet, in order
+func PendingMigrations(products_db *gorm.DB) ([]Migration, error) {
+
+	states, err := MigrationStatus(products_db)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	known := Migrations()
+
+	var pending []Migration
+
+	for i, state := range states {
+
+		if !state.Applied {
+
+			pending = append(pending, known[i])
+		}
+	}
+
+	return pending, nil
+}
+
+// CheckSchemaUpToDate fails with ErrSchemaBehind when at least one migration that this build can apply is pending,
+// and with ErrSearchIndexUnsupported when an earlier build created a search index that this one cannot maintain
+func CheckSchemaUpToDate(products_db *gorm.DB) error {
+
+	err := CheckSearchIndexSupported(products_db)
+
+	if err != nil {
+
+		return err
+	}
+
+	all, err := PendingMigrations(products_db)
+
+	if err != nil {
+
+		return err
+	}
+
+	var pending []Migration
+
+	for _, migration := range all {
+
+		if migration.applicable(products_db) {
+
+			pending = append(pending, migration)
+		}
+	}
+
+	if len(pending) > 0 {
+
+		return fmt.Errorf("%w (%d pending, next is %d_%s)", ErrSchemaBehind, len(pending), pending[0].Version, pending[0].Name)
+	}
+
+	return nil
+}
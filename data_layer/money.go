@@ -0,0 +1,200 @@
+package data_layer
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Number of decimal places kept by an Amount, shared by every supported currency
+const AmountScale = 2
+
+// Currency used for products inserted without an explicit currency code
+const DefaultCurrency = "EUR"
+
+// Amount is an exact money value stored as an integer number of minor units (hundredths).
+// In JSON it is written as a decimal number and read from a decimal number or string,
+// so 1999.99 round-trips without ever going through float64.
+type Amount int64
+
+// ParseAmount reads a decimal such as "1999.99", "-5" or "1.5e2".
+// Values with more than AmountScale decimal places are rejected instead of rounded.
+func ParseAmount(text string) (Amount, error) {
+
+	value, err := parseDecimal(text, AmountScale)
+
+	if err != nil {
+
+		return 0, fmt.Errorf("invalid amount %q: %w", text, err)
+	}
+
+	return Amount(value), nil
+}
+
+// MustParseAmount is ParseAmount for constants known to be valid; it panics otherwise
+func MustParseAmount(text string) Amount {
+
+	amount, err := ParseAmount(text)
+
+	if err != nil {
+
+		panic(err)
+	}
+
+	return amount
+}
+
+// String formats the amount as a plain decimal with exactly AmountScale decimal places
+func (amount Amount) String() string {
+
+	return formatDecimal(int64(amount), AmountScale, AmountScale)
+}
+
+func (amount Amount) MarshalJSON() ([]byte, error) {
+
+	return []byte(amount.String()), nil
+}
+
+func (amount *Amount) UnmarshalJSON(data []byte) error {
+
+	text, isNull, err := decimalText(data)
+
+	if err != nil || isNull {
+
+		return err
+	}
+
+	parsed, err := ParseAmount(text)
+
+	if err != nil {
+
+		return err
+	}
+
+	*amount = parsed
+
+	return nil
+}
+
+// parseDecimal converts a decimal string into an integer scaled by 10^scale, refusing to lose precision
+func parseDecimal(text string, scale int) (int64, error) {
+
+	text = strings.TrimSpace(text)
+
+	// big.Rat would also accept fractions such as "1/3"
+	if strings.Contains(text, "/") {
+
+		return 0, fmt.Errorf("not a decimal number")
+	}
+
+	// Huge exponents would make big.Rat allocate enormous numbers before the range check
+	if index := strings.IndexAny(text, "eE"); index >= 0 {
+
+		exponent, err := strconv.Atoi(text[index+1:])
+
+		if err != nil || exponent > 18 || exponent < -18 {
+
+			return 0, fmt.Errorf("not a decimal number")
+		}
+	}
+
+	value, ok := new(big.Rat).SetString(text)
+
+	if !ok {
+
+		return 0, fmt.Errorf("not a decimal number")
+	}
+
+	value.Mul(value, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+
+	if !value.IsInt() {
+
+		return 0, fmt.Errorf("at most %d decimal places are allowed", scale)
+	}
+
+	if !value.Num().IsInt64() {
+
+		return 0, fmt.Errorf("out of range")
+	}
+
+	return value.Num().Int64(), nil
+}
+
+// formatDecimal writes an integer scaled by 10^scale as a decimal, trimming trailing zeros down to minDecimals
+func formatDecimal(value int64, scale int, minDecimals int) string {
+
+	sign := ""
+
+	if value < 0 {
+
+		sign = "-"
+
+		value = -value
+	}
+
+	digits := fmt.Sprintf("%0*d", scale+1, value)
+
+	integerPart, fraction := digits[:len(digits)-scale], digits[len(digits)-scale:]
+
+	for len(fraction) > minDecimals && strings.HasSuffix(fraction, "0") {
+
+		fraction = fraction[:len(fraction)-1]
+	}
+
+	if fraction == "" {
+
+		return sign + integerPart
+	}
+
+	return sign + integerPart + "." + fraction
+}
+
+// decimalText extracts the decimal written as a JSON number or a JSON string
+func decimalText(data []byte) (string, bool, error) {
+
+	data = bytes.TrimSpace(data)
+
+	if bytes.Equal(data, []byte("null")) {
+
+		return "", true, nil
+	}
+
+	text := string(data)
+
+	if strings.HasPrefix(text, `"`) {
+
+		unquoted, err := strconv.Unquote(text)
+
+		if err != nil {
+
+			return "", false, err
+		}
+
+		text = unquoted
+	}
+
+	return text, false, nil
+}
+
+// NormalizeCurrency upper-cases a three letter ISO 4217 code and rejects anything else
+func NormalizeCurrency(code string) (string, error) {
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	if len(code) != 3 {
+
+		return "", fmt.Errorf("invalid currency code %q: expected three letters", code)
+	}
+
+	for _, letter := range code {
+
+		if letter < 'A' || letter > 'Z' {
+
+			return "", fmt.Errorf("invalid currency code %q: expected three letters", code)
+		}
+	}
+
+	return code, nil
+}
@@ -0,0 +1,351 @@
+package data_layer
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ProductSuggester completes what a user is typing into the names of live products
+type ProductSuggester interface {
+	// SuggestProducts returns the products having, for every word of prefix, a word that starts with it.
+	// With maxDistance > 0 the words may also differ by that many edits (insertions, deletions,
+	// substitutions or swaps of two neighbouring letters). Closest and shortest names come first.
+	// When statuses is not empty, only the products in one of them are suggested.
+	SuggestProducts(prefix string, statuses []string, maxDistance int, limit int) ([]Suggestion, error)
+}
+
+// Suggestion is one completed product name. Distance is the number of edits the prefix needed to match it.
+type Suggestion struct {
+	ProductID uint
+	Name      string
+	Distance  int
+}
+
+// NameIndex is an in-memory trie of the words of the live product names, built for SuggestProducts.
+// It also keeps the lifecycle status of every product, so that drafts and archived products are only suggested to admins.
+// The repositories keep it up to date on every write; it is only consistent with the writes of this process.
+type NameIndex struct {
+	mutex    sync.Mutex
+	root     *trieNode
+	names    map[uint]string
+	statuses map[uint]string
+
+	// load fills the index on first use, nil once loaded
+	load func() ([]Product, error)
+}
+
+type trieNode struct {
+	children map[rune]*trieNode
+
+	// products having a word that ends here
+	products map[uint]struct{}
+}
+
+func newTrieNode() *trieNode {
+
+	return &trieNode{children: make(map[rune]*trieNode), products: make(map[uint]struct{})}
+}
+
+// NewNameIndex returns an empty index
+func NewNameIndex() *NameIndex {
+
+	return &NameIndex{root: newTrieNode(), names: make(map[uint]string), statuses: make(map[uint]string)}
+}
+
+// newLazyNameIndex returns an index that reads the live products with load on its first query.
+// Writes made before are already in what load returns, so Put and Remove ignore them.
+func newLazyNameIndex(load func() ([]Product, error)) *NameIndex {
+
+	index := NewNameIndex()
+
+	index.load = load
+
+	return index
+}
+
+// Put indexes the name and status of a product, replacing the previous ones
+func (index *NameIndex) Put(productID uint, name string, status string) {
+
+	index.mutex.Lock()
+
+	defer index.mutex.Unlock()
+
+	if index.load != nil {
+
+		return
+	}
+
+	index.put(productID, name, status)
+}
+
+// Remove drops a product from the index
+func (index *NameIndex) Remove(productID uint) {
+
+	index.mutex.Lock()
+
+	defer index.mutex.Unlock()
+
+	if index.load != nil {
+
+		return
+	}
+
+	index.remove(productID)
+}
+
+func (index *NameIndex) put(productID uint, name string, status string) {
+
+	index.remove(productID)
+
+	index.names[productID] = name
+
+	index.statuses[productID] = status
+
+	for _, word := range searchTerms(name) {
+
+		node := index.root
+
+		for _, r := range word {
+
+			child, found := node.children[r]
+
+			if !found {
+
+				child = newTrieNode()
+
+				node.children[r] = child
+			}
+
+			node = child
+		}
+
+		node.products[productID] = struct{}{}
+	}
+}
+
+func (index *NameIndex) remove(productID uint) {
+
+	name, found := index.names[productID]
+
+	if !found {
+
+		return
+	}
+
+	delete(index.names, productID)
+
+	delete(index.statuses, productID)
+
+	for _, word := range searchTerms(name) {
+
+		removeWord(index.root, []rune(word), productID)
+	}
+}
+
+// removeWord unlinks a product from a word and prunes the branches left empty. It reports whether node is now empty.
+func removeWord(node *trieNode, word []rune, productID uint) bool {
+
+	if len(word) == 0 {
+
+		delete(node.products, productID)
+
+	} else if child, found := node.children[word[0]]; found && removeWord(child, word[1:], productID) {
+
+		delete(node.children, word[0])
+	}
+
+	return len(node.children) == 0 && len(node.products) == 0
+}
+
+// Suggest implements SuggestProducts on the index
+func (index *NameIndex) Suggest(prefix string, statuses []string, maxDistance int, limit int) ([]Suggestion, error) {
+
+	terms := searchTerms(prefix)
+
+	if len(terms) == 0 {
+
+		return nil, ErrEmptySearch
+	}
+
+	index.mutex.Lock()
+
+	defer index.mutex.Unlock()
+
+	if index.load != nil {
+
+		products, err := index.load()
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		for _, product := range products {
+
+			index.put(product.ID, product.Name, product.Status)
+		}
+
+		index.load = nil
+	}
+
+	// Every term must match a word; a product's distance is the sum of its best match per term
+	var distances map[uint]int
+
+	for _, term := range terms {
+
+		matches := index.match([]rune(term), maxDistance)
+
+		if distances == nil {
+
+			distances = matches
+
+			continue
+		}
+
+		for productID, distance := range distances {
+
+			termDistance, found := matches[productID]
+
+			if !found {
+
+				delete(distances, productID)
+
+				continue
+			}
+
+			distances[productID] = distance + termDistance
+		}
+	}
+
+	suggestions := make([]Suggestion, 0, len(distances))
+
+	for productID, distance := range distances {
+
+		if len(statuses) > 0 && !slices.Contains(statuses, index.statuses[productID]) {
+
+			continue
+		}
+
+		suggestions = append(suggestions, Suggestion{ProductID: productID, Name: index.names[productID], Distance: distance})
+	}
+
+	lowered := strings.ToLower(strings.TrimSpace(prefix))
+
+	sort.Slice(suggestions, func(i, j int) bool {
+
+		a, b := suggestions[i], suggestions[j]
+
+		if a.Distance != b.Distance {
+
+			return a.Distance < b.Distance
+		}
+
+		// Names starting with the whole prefix first
+		aStarts, bStarts := strings.HasPrefix(strings.ToLower(a.Name), lowered), strings.HasPrefix(strings.ToLower(b.Name), lowered)
+
+		if aStarts != bStarts {
+
+			return aStarts
+		}
+
+		if len(a.Name) != len(b.Name) {
+
+			return len(a.Name) < len(b.Name)
+		}
+
+		if a.Name != b.Name {
+
+			return a.Name < b.Name
+		}
+
+		return a.ProductID < b.ProductID
+	})
+
+	if len(suggestions) > limit {
+
+		suggestions = suggestions[:limit]
+	}
+
+	return suggestions, nil
+}
+
+// match returns the products having a word that starts within maxDistance edits of term, with the smallest distance.
+// It walks the trie with one row of the optimal string alignment distance matrix per node, and stops descending
+// once neither the row nor an ancestor prefix can match anymore.
+func (index *NameIndex) match(term []rune, maxDistance int) map[uint]int {
+
+	matches := make(map[uint]int)
+
+	row := make([]int, len(term)+1)
+
+	for j := range row {
+
+		row[j] = j
+	}
+
+	for r, child := range index.root.children {
+
+		walkTrie(child, r, 0, nil, row, term, maxDistance, maxDistance+1, matches)
+	}
+
+	return matches
+}
+
+func walkTrie(node *trieNode, r rune, previous rune, previousRow []int, parentRow []int, term []rune, maxDistance int, best int, matches map[uint]int) {
+
+	n := len(term)
+
+	row := make([]int, n+1)
+
+	row[0] = parentRow[0] + 1
+
+	rowMin := row[0]
+
+	for j := 1; j <= n; j++ {
+
+		cost := 1
+
+		if term[j-1] == r {
+
+			cost = 0
+		}
+
+		row[j] = min(row[j-1]+1, parentRow[j]+1, parentRow[j-1]+cost)
+
+		// Two neighbouring letters swapped
+		if j > 1 && previousRow != nil && term[j-1] == previous && term[j-2] == r {
+
+			row[j] = min(row[j], previousRow[j-2]+1)
+		}
+
+		rowMin = min(rowMin, row[j])
+	}
+
+	// best is the distance of the closest prefix of the word so far
+	best = min(best, row[n])
+
+	if best <= maxDistance {
+
+		for productID := range node.products {
+
+			distance, found := matches[productID]
+
+			if !found || best < distance {
+
+				matches[productID] = best
+			}
+		}
+	}
+
+	if best > maxDistance && rowMin > maxDistance {
+
+		return
+	}
+
+	for childRune, child := range node.children {
+
+		walkTrie(child, childRune, r, parentRow, row, term, maxDistance, best, matches)
+	}
+}
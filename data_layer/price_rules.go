@@ -0,0 +1,213 @@
+package data_layer
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"math/big"
+)
+
+// PriceOperationKind is what a price rule does to the base price of every matching product
+type PriceOperationKind string
+
+const (
+	// PriceSet replaces the price with Amount
+	PriceSet PriceOperationKind = "set"
+
+	// PriceAdd adds Amount, which may be negative
+	PriceAdd PriceOperationKind = "add"
+
+	// PriceMultiply multiplies the price by Factor, rounding half up to the cent
+	PriceMultiply PriceOperationKind = "multiply"
+
+	// PriceRound99 moves the price to the nearest price ending in .99, rounding ties up
+	PriceRound99 PriceOperationKind = "round_99"
+)
+
+// PriceOperation is one step of a price rule
+type PriceOperation struct {
+	Kind   PriceOperationKind
+	Amount Amount
+	Factor Rate
+}
+
+// PriceRule changes the base prices of the products matching Filter by applying Operations in order,
+// e.g. multiply by 1.05 then round to .99
+type PriceRule struct {
+	Filter     ProductFilter
+	Operations []PriceOperation
+}
+
+// PriceChange is the before/after diff of one product touched by a price rule
+type PriceChange struct {
+	ProductID uint
+	Name      string
+	Currency  string
+	OldPrice  Amount
+	NewPrice  Amount
+}
+
+// ErrInvalidPrice is returned for prices that are not greater than zero
+var ErrInvalidPrice = errors.New("price must be greater than zero")
+
+// PriceRuleError names the product a price rule would give an invalid price
+type PriceRuleError struct {
+	ProductID uint
+	Price     Amount
+}
+
+func (err *PriceRuleError) Error() string {
+
+	return fmt.Sprintf("the rule would price product %d at %s: %v", err.ProductID, err.Price, ErrInvalidPrice)
+}
+
+func (err *PriceRuleError) Unwrap() error {
+
+	return ErrInvalidPrice
+}
+
+// ValidatePrice holds the rule every stored price follows, as enforced by update-product-price
+func ValidatePrice(price Amount) error {
+
+	if price <= 0 {
+
+		return ErrInvalidPrice
+	}
+
+	return nil
+}
+
+// ValidatePriceOperation checks that an operation is known and complete
+func ValidatePriceOperation(operation PriceOperation) error {
+
+	switch operation.Kind {
+
+	case PriceSet:
+
+		return ValidatePrice(operation.Amount)
+
+	case PriceAdd, PriceRound99:
+
+		return nil
+
+	case PriceMultiply:
+
+		if operation.Factor <= 0 {
+
+			return errors.New("the multiply factor must be greater than zero")
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown operation %q: expected set, add, multiply or round_99", operation.Kind)
+}
+
+// apply runs the operations of the rule on a price
+func (rule PriceRule) apply(price Amount) Amount {
+
+	for _, operation := range rule.Operations {
+
+		switch operation.Kind {
+
+		case PriceSet:
+
+			price = operation.Amount
+
+		case PriceAdd:
+
+			price += operation.Amount
+
+		case PriceMultiply:
+
+			exact := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(price)), operation.Factor.ratio())
+
+			price = RoundingRule{Increment: 1, Mode: RoundHalfUp}.Round(exact)
+
+		case PriceRound99:
+
+			// Prices ending in .99 are k * 1.00 - 0.01; pick the nearest k, at least 1
+			units := RoundingRule{Increment: 100, Mode: RoundHalfUp}.Round(new(big.Rat).SetInt64(int64(price) + 1))
+
+			price = max(units, 100) - 1
+		}
+	}
+
+	return price
+}
+
+// changes computes the diff of the rule on the matching products, and fails on the first invalid new price
+func (rule PriceRule) changes(products []Product) ([]PriceChange, error) {
+
+	changes := []PriceChange{}
+
+	for _, product := range products {
+
+		newPrice := rule.apply(product.Price)
+
+		if ValidatePrice(newPrice) != nil {
+
+			return nil, &PriceRuleError{ProductID: product.ID, Price: newPrice}
+		}
+
+		if newPrice != product.Price {
+
+			changes = append(changes, PriceChange{ProductID: product.ID, Name: product.Name, Currency: product.Currency, OldPrice: product.Price, NewPrice: newPrice})
+		}
+	}
+
+	return changes, nil
+}
+
+// ApplyPriceRule changes the base prices of the live products matching the rule in one transaction, and returns
+// the prices that changed. Nothing is written when dryRun is set or when any new price would be invalid.
+func ApplyPriceRule(products_db *gorm.DB, rule PriceRule, dryRun bool) ([]PriceChange, error) {
+
+	var changes []PriceChange
+
+	err := products_db.Transaction(func(tx *gorm.DB) error {
+
+		var products []Product
+
+		err := applyProductFilter(tx, rule.Filter).Order("products.id").Find(&products).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		changes, err = rule.changes(products)
+
+		if err != nil || dryRun {
+
+			return err
+		}
+
+		versions := make(map[uint]uint)
+
+		for _, product := range products {
+
+			versions[product.ID] = product.Version
+		}
+
+		// The versions read above make sure no concurrent edit is overwritten
+		for _, change := range changes {
+
+			err = UpdateProductPrice(tx, int(change.ProductID), change.NewPrice, versions[change.ProductID])
+
+			if err != nil {
+
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	return changes, nil
+}
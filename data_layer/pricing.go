@@ -0,0 +1,128 @@
+package data_layer
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// SetProductPrice stores the explicit price of a product in a currency.
+// Setting the price in the product's own currency updates its base price instead.
+func SetProductPrice(products_db *gorm.DB, id int, currency string, price Amount) error {
+
+	return products_db.Transaction(func(tx *gorm.DB) error {
+
+		product, err := RetrieveProduct(tx, id, false)
+
+		if err != nil {
+
+			return err
+		}
+
+		if product.Currency == currency {
+
+			return UpdateProductPrice(tx, id, price, AnyVersion)
+		}
+
+		productPrice := ProductPrice{ProductID: product.ID, Currency: currency, Price: price}
+
+		err = tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "product_id"}, {Name: "currency"}},
+			DoUpdates: clause.AssignmentColumns([]string{"price_minor", "updated_at"}),
+		}).Create(&productPrice).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		return touchProduct(tx, product.ID)
+	})
+}
+
+func DeleteProductPrice(products_db *gorm.DB, id int, currency string) error {
+
+	return products_db.Transaction(func(tx *gorm.DB) error {
+
+		result := tx.Where("product_id = ? AND currency = ?", id, currency).Delete(&ProductPrice{})
+
+		if result.Error != nil {
+
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+
+			return gorm.ErrRecordNotFound
+		}
+
+		return touchProduct(tx, uint(id))
+	})
+}
+
+// RetrieveProductPrices returns the explicit prices of the given products
+func RetrieveProductPrices(products_db *gorm.DB, ids []uint) ([]ProductPrice, error) {
+
+	var prices []ProductPrice
+
+	if len(ids) == 0 {
+
+		return prices, nil
+	}
+
+	result := products_db.Where("product_id IN ?", ids).Order("product_id, currency").Find(&prices)
+
+	if result.Error != nil {
+
+		return nil, result.Error
+	}
+
+	return prices, nil
+}
+
+func SetExchangeRate(products_db *gorm.DB, base string, quote string, rate Rate) error {
+
+	exchangeRate := ExchangeRate{BaseCurrency: base, QuoteCurrency: quote, Rate: rate}
+
+	return products_db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base_currency"}, {Name: "quote_currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate_scaled", "updated_at"}),
+	}).Create(&exchangeRate).Error
+}
+
+func DeleteExchangeRate(products_db *gorm.DB, base string, quote string) error {
+
+	result := products_db.Where("base_currency = ? AND quote_currency = ?", base, quote).Delete(&ExchangeRate{})
+
+	if result.Error != nil {
+
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func RetrieveExchangeRates(products_db *gorm.DB) ([]ExchangeRate, error) {
+
+	var rates []ExchangeRate
+
+	result := products_db.Order("base_currency, quote_currency").Find(&rates)
+
+	if result.Error != nil {
+
+		return nil, result.Error
+	}
+
+	return rates, nil
+}
+
+// touchProduct bumps UpdatedAt and the version of a product whose related rows changed
+func touchProduct(tx *gorm.DB, id uint) error {
+
+	return tx.Model(&Product{}).Where("id = ?", id).Updates(map[string]interface{}{"updated_at": time.Now(), "version": nextVersion()}).Error
+}
@@ -0,0 +1,293 @@
+package data_layer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProductCursor marks a position in a sorted product listing: the page starts right after Boundary,
+// or ends right before it when Backward is set. Only the sorted fields and the ID of Boundary matter.
+type ProductCursor struct {
+	Sort     ProductSort
+	Boundary Product
+	Backward bool
+}
+
+// ErrInvalidCursor is returned for cursors that were not produced by ProductCursor.Encode
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// encodedCursor is the JSON behind the opaque cursor token
+type encodedCursor struct {
+	Sort     string            `json:"s"`
+	Values   map[string]string `json:"v"`
+	Backward bool              `json:"b,omitempty"`
+}
+
+// String writes the sort back as "-price,name"
+func (productSort ProductSort) String() string {
+
+	entries := make([]string, 0, len(productSort))
+
+	for _, key := range productSort {
+
+		if key.Descending {
+
+			entries = append(entries, "-"+key.Field)
+
+		} else {
+
+			entries = append(entries, key.Field)
+		}
+	}
+
+	return strings.Join(entries, ",")
+}
+
+// NewProductCursor returns the cursor of the page after product, or before it when backward is set
+func NewProductCursor(productSort ProductSort, product Product, backward bool) ProductCursor {
+
+	return ProductCursor{Sort: productSort, Boundary: product, Backward: backward}
+}
+
+// Encode returns the cursor as an opaque, URL-safe token
+func (cursor ProductCursor) Encode() string {
+
+	values := make(map[string]string)
+
+	for _, key := range cursor.Sort.keys() {
+
+		values[key.Field] = sortValue(cursor.Boundary, key.Field)
+	}
+
+	data, _ := json.Marshal(encodedCursor{Sort: cursor.Sort.String(), Values: values, Backward: cursor.Backward})
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeProductCursor reads a token produced by ProductCursor.Encode
+func DecodeProductCursor(token string) (ProductCursor, error) {
+
+	cursor := ProductCursor{}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+
+	if err != nil {
+
+		return cursor, ErrInvalidCursor
+	}
+
+	encoded := encodedCursor{}
+
+	err = json.Unmarshal(data, &encoded)
+
+	if err != nil {
+
+		return cursor, ErrInvalidCursor
+	}
+
+	cursor.Sort, err = ParseProductSort(encoded.Sort)
+
+	if err != nil {
+
+		return cursor, ErrInvalidCursor
+	}
+
+	cursor.Backward = encoded.Backward
+
+	for _, key := range cursor.Sort.keys() {
+
+		value, found := encoded.Values[key.Field]
+
+		if !found {
+
+			return cursor, ErrInvalidCursor
+		}
+
+		err = setSortValue(&cursor.Boundary, key.Field, value)
+
+		if err != nil {
+
+			return cursor, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+	}
+
+	return cursor, nil
+}
+
+// sortValue writes the value of a sortable field without losing precision.
+// Timestamps keep their UTC offset so that SQLite compares them with the stored text as is.
+func sortValue(product Product, field string) string {
+
+	switch field {
+
+	case "name":
+
+		return product.Name
+
+	case "price":
+
+		return strconv.FormatInt(int64(product.Price), 10)
+
+	case "created_at":
+
+		return product.CreatedAt.Format(time.RFC3339Nano)
+
+	case "updated_at":
+
+		return product.UpdatedAt.Format(time.RFC3339Nano)
+	}
+
+	return strconv.FormatUint(uint64(product.ID), 10)
+}
+
+func setSortValue(product *Product, field string, value string) error {
+
+	var err error
+
+	switch field {
+
+	case "name":
+
+		product.Name = value
+
+	case "price":
+
+		var price int64
+
+		price, err = strconv.ParseInt(value, 10, 64)
+
+		product.Price = Amount(price)
+
+	case "created_at":
+
+		product.CreatedAt, err = time.Parse(time.RFC3339Nano, value)
+
+	case "updated_at":
+
+		product.UpdatedAt, err = time.Parse(time.RFC3339Nano, value)
+
+	default:
+
+		var id uint64
+
+		id, err = strconv.ParseUint(value, 10, 64)
+
+		product.ID = uint(id)
+	}
+
+	return err
+}
+
+// sortArgument is the value of a sortable field as passed to the database
+func sortArgument(product Product, field string) interface{} {
+
+	switch field {
+
+	case "name":
+
+		return product.Name
+
+	case "price":
+
+		return product.Price
+
+	case "created_at":
+
+		return product.CreatedAt
+
+	case "updated_at":
+
+		return product.UpdatedAt
+	}
+
+	return product.ID
+}
+
+// direction returns the sort the query runs with: reversed when reading backwards
+func (cursor ProductCursor) direction() ProductSort {
+
+	keys := cursor.Sort.keys()
+
+	if !cursor.Backward {
+
+		return keys
+	}
+
+	reversed := make(ProductSort, len(keys))
+
+	for i, key := range keys {
+
+		reversed[i] = SortKey{Field: key.Field, Descending: !key.Descending}
+	}
+
+	return reversed
+}
+
+// applyProductCursor keeps the products after the cursor boundary in the query direction:
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ..., with < for descending keys
+func applyProductCursor(query *gorm.DB, cursor ProductCursor) *gorm.DB {
+
+	keys := cursor.direction()
+
+	alternatives := make([]string, 0, len(keys))
+
+	arguments := []interface{}{}
+
+	for i, key := range keys {
+
+		conditions := make([]string, 0, i+1)
+
+		for _, equal := range keys[:i] {
+
+			conditions = append(conditions, "products."+sortableProductFields[equal.Field]+" = ?")
+
+			arguments = append(arguments, sortArgument(cursor.Boundary, equal.Field))
+		}
+
+		operator := ">"
+
+		if key.Descending {
+
+			operator = "<"
+		}
+
+		conditions = append(conditions, "products."+sortableProductFields[key.Field]+" "+operator+" ?")
+
+		arguments = append(arguments, sortArgument(cursor.Boundary, key.Field))
+
+		alternatives = append(alternatives, "("+strings.Join(conditions, " AND ")+")")
+	}
+
+	return applyProductSort(query.Where(strings.Join(alternatives, " OR "), arguments...), keys)
+}
+
+// after is the in-memory equivalent of the applyProductCursor condition
+func (cursor ProductCursor) after(product Product) bool {
+
+	for _, key := range cursor.direction() {
+
+		comparison := compareProducts(product, cursor.Boundary, key.Field)
+
+		if comparison != 0 {
+
+			return (comparison > 0) != key.Descending
+		}
+	}
+
+	return false
+}
+
+// reverseProducts restores the listing order of a page read backwards
+func reverseProducts(products []Product) {
+
+	for i, j := 0, len(products)-1; i < j; i, j = i+1, j-1 {
+
+		products[i], products[j] = products[j], products[i]
+	}
+}
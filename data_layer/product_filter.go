@@ -0,0 +1,284 @@
+package data_layer
+
+import (
+	"gorm.io/gorm"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ProductFilter narrows down the products returned by the list operations.
+// Zero values leave the corresponding criterion out.
+type ProductFilter struct {
+	// IncludeDeleted also returns soft-deleted products
+	IncludeDeleted bool
+
+	// OnlyDeleted returns the soft-deleted products only (the trash)
+	OnlyDeleted bool
+
+	// IDs keeps the listed products only
+	IDs []uint
+
+	// Statuses keeps the products in one of the listed lifecycle statuses
+	Statuses []string
+
+	// CategoryID keeps the products assigned to the category, or to any of its subcategories
+	// as well with IncludeSubcategories
+	CategoryID uint
+
+	IncludeSubcategories bool
+
+	// Tags keeps the products carrying any of the normalized tags, or all of them with AllTags
+	Tags []string
+
+	AllTags bool
+
+	// InStock keeps the products with available units, in the warehouse of WarehouseID when set.
+	// WarehouseID alone keeps the products with units on hand in that warehouse.
+	InStock bool
+
+	WarehouseID uint
+
+	// Names keeps the products named exactly as listed; MySQL compares them with the collation of the column
+	Names []string
+
+	// NameContains, NamePrefix and NamePattern match the name case-insensitively.
+	// NamePattern is a wildcard pattern where * stands for any text and ? for one character.
+	NameContains string
+
+	NamePrefix string
+
+	NamePattern string
+
+	// MinPrice and MaxPrice bound the base price, inclusively, whatever the product currency
+	MinPrice *Amount
+
+	MaxPrice *Amount
+
+	// CreatedAfter, CreatedBefore and UpdatedAfter are exclusive bounds
+	CreatedAfter time.Time
+
+	CreatedBefore time.Time
+
+	UpdatedAfter time.Time
+}
+
+// Escape character of the LIKE patterns; a backslash would need escaping itself in MySQL string literals
+const likeEscape = "!"
+
+var likeEscaper = strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_")
+
+// likePattern turns a NamePattern into a LIKE pattern
+var likePattern = strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_", "*", "%", "?", "_")
+
+func applyProductFilter(query *gorm.DB, filter ProductFilter) *gorm.DB {
+
+	if filter.OnlyDeleted {
+
+		query = query.Unscoped().Where("products.deleted_at IS NOT NULL")
+
+	} else if filter.IncludeDeleted {
+
+		query = query.Unscoped()
+	}
+
+	if len(filter.IDs) > 0 {
+
+		query = query.Where("products.id IN ?", filter.IDs)
+	}
+
+	if len(filter.Names) > 0 {
+
+		query = query.Where("products.name IN ?", filter.Names)
+	}
+
+	if len(filter.Statuses) > 0 {
+
+		query = query.Where("products.status IN ?", filter.Statuses)
+	}
+
+	if filter.CategoryID != 0 && filter.IncludeSubcategories {
+
+		query = query.Where("products.id IN (SELECT product_categories.product_id FROM product_categories JOIN categories ON categories.id = product_categories.category_id WHERE categories.path LIKE ?)", subtreePattern(filter.CategoryID))
+
+	} else if filter.CategoryID != 0 {
+
+		query = query.Where("products.id IN (SELECT product_categories.product_id FROM product_categories WHERE product_categories.category_id = ?)", filter.CategoryID)
+	}
+
+	if len(filter.Tags) > 0 && filter.AllTags {
+
+		query = query.Where("products.id IN (SELECT product_tags.product_id FROM product_tags JOIN tags ON tags.id = product_tags.tag_id WHERE tags.name IN ? GROUP BY product_tags.product_id HAVING COUNT(*) = ?)", filter.Tags, len(filter.Tags))
+
+	} else if len(filter.Tags) > 0 {
+
+		query = query.Where("products.id IN (SELECT product_tags.product_id FROM product_tags JOIN tags ON tags.id = product_tags.tag_id WHERE tags.name IN ?)", filter.Tags)
+	}
+
+	if filter.InStock && filter.WarehouseID != 0 {
+
+		query = query.Where("products.id IN (SELECT stock_levels.product_id FROM stock_levels WHERE stock_levels.warehouse_id = ? AND stock_levels.on_hand > stock_levels.reserved)", filter.WarehouseID)
+
+	} else if filter.InStock {
+
+		query = query.Where("products.id IN (SELECT stock_levels.product_id FROM stock_levels WHERE stock_levels.on_hand > stock_levels.reserved)")
+
+	} else if filter.WarehouseID != 0 {
+
+		query = query.Where("products.id IN (SELECT stock_levels.product_id FROM stock_levels WHERE stock_levels.warehouse_id = ? AND stock_levels.on_hand > 0)", filter.WarehouseID)
+	}
+
+	if filter.NamePattern != "" {
+
+		query = query.Where("LOWER(products.name) LIKE ? ESCAPE '"+likeEscape+"'", likePattern.Replace(strings.ToLower(filter.NamePattern)))
+	}
+
+	if filter.NameContains != "" {
+
+		query = query.Where("LOWER(products.name) LIKE ? ESCAPE '"+likeEscape+"'", "%"+likeEscaper.Replace(strings.ToLower(filter.NameContains))+"%")
+	}
+
+	if filter.NamePrefix != "" {
+
+		query = query.Where("LOWER(products.name) LIKE ? ESCAPE '"+likeEscape+"'", likeEscaper.Replace(strings.ToLower(filter.NamePrefix))+"%")
+	}
+
+	if filter.MinPrice != nil {
+
+		query = query.Where("products.price_minor >= ?", *filter.MinPrice)
+	}
+
+	if filter.MaxPrice != nil {
+
+		query = query.Where("products.price_minor <= ?", *filter.MaxPrice)
+	}
+
+	if !filter.CreatedAfter.IsZero() {
+
+		query = query.Where("products.created_at > ?", filter.CreatedAfter)
+	}
+
+	if !filter.CreatedBefore.IsZero() {
+
+		query = query.Where("products.created_at < ?", filter.CreatedBefore)
+	}
+
+	if !filter.UpdatedAfter.IsZero() {
+
+		query = query.Where("products.updated_at > ?", filter.UpdatedAfter)
+	}
+
+	return query
+}
+
+// matches is the in-memory equivalent of applyProductFilter, except for CategoryID, Tags, InStock and WarehouseID that need the related rows
+func (filter ProductFilter) matches(product Product) bool {
+
+	deleted := product.DeletedAt.Valid
+
+	if filter.OnlyDeleted && !deleted {
+
+		return false
+	}
+
+	if deleted && !filter.OnlyDeleted && !filter.IncludeDeleted {
+
+		return false
+	}
+
+	if len(filter.IDs) > 0 && !slices.Contains(filter.IDs, product.ID) {
+
+		return false
+	}
+
+	if len(filter.Names) > 0 && !slices.Contains(filter.Names, product.Name) {
+
+		return false
+	}
+
+	if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, product.Status) {
+
+		return false
+	}
+
+	name := strings.ToLower(product.Name)
+
+	if filter.NamePattern != "" && !wildcardMatch([]rune(strings.ToLower(filter.NamePattern)), []rune(name)) {
+
+		return false
+	}
+
+	if filter.NameContains != "" && !strings.Contains(name, strings.ToLower(filter.NameContains)) {
+
+		return false
+	}
+
+	if filter.NamePrefix != "" && !strings.HasPrefix(name, strings.ToLower(filter.NamePrefix)) {
+
+		return false
+	}
+
+	if filter.MinPrice != nil && product.Price < *filter.MinPrice {
+
+		return false
+	}
+
+	if filter.MaxPrice != nil && product.Price > *filter.MaxPrice {
+
+		return false
+	}
+
+	if !filter.CreatedAfter.IsZero() && !product.CreatedAt.After(filter.CreatedAfter) {
+
+		return false
+	}
+
+	if !filter.CreatedBefore.IsZero() && !product.CreatedAt.Before(filter.CreatedBefore) {
+
+		return false
+	}
+
+	if !filter.UpdatedAfter.IsZero() && !product.UpdatedAt.After(filter.UpdatedAfter) {
+
+		return false
+	}
+
+	return true
+}
+
+// wildcardMatch is the in-memory equivalent of NamePattern: * matches any text and ? one character
+func wildcardMatch(pattern []rune, name []rune) bool {
+
+	if len(pattern) == 0 {
+
+		return len(name) == 0
+	}
+
+	switch pattern[0] {
+
+	case '*':
+
+		rest := pattern[1:]
+
+		for len(rest) > 0 && rest[0] == '*' {
+
+			rest = rest[1:]
+		}
+
+		for skipped := 0; skipped <= len(name); skipped++ {
+
+			if wildcardMatch(rest, name[skipped:]) {
+
+				return true
+			}
+		}
+
+		return false
+
+	case '?':
+
+		return len(name) > 0 && wildcardMatch(pattern[1:], name[1:])
+	}
+
+	return len(name) > 0 && pattern[0] == name[0] && wildcardMatch(pattern[1:], name[1:])
+}
@@ -0,0 +1,303 @@
+package data_layer
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ProductSearcher finds live products by name, most relevant first. When statuses is not empty,
+// only the products in one of them are found.
+// GormProductRepository delegates to one, so other search engines can be plugged in with WithSearcher.
+type ProductSearcher interface {
+	SearchProducts(query string, statuses []string, offset int, limit int) ([]SearchResult, error)
+}
+
+// SearchResult is one product found by a search. Score only orders the results of the same search;
+// Snippet is the name as HTML, escaped, with the matching words wrapped in <mark> tags.
+type SearchResult struct {
+	Product Product
+	Score   float64
+	Snippet string
+}
+
+// ErrEmptySearch is returned for queries without a single word to look for
+var ErrEmptySearch = errors.New("the search query has no words")
+
+// ErrSearchIndexUnsupported is returned for a SQLite database with the products_fts index when this binary was built
+// without FTS5: the triggers of the index would make every write to products fail
+var ErrSearchIndexUnsupported = errors.New("the products database has the FTS5 search index, which this build cannot maintain: build with -tags sqlite_fts5")
+
+// CheckSearchIndexSupported fails with ErrSearchIndexUnsupported when this binary cannot maintain the products_fts
+// index of the database
+func CheckSearchIndexSupported(products_db *gorm.DB) error {
+
+	if products_db.Dialector.Name() == DriverSQLite && products_db.Migrator().HasTable(productSearchIndex) && !fts5Available(products_db) {
+
+		return ErrSearchIndexUnsupported
+	}
+
+	return nil
+}
+
+// Tags wrapped around the matching words of a snippet
+const (
+	highlightOpen  = "<mark>"
+	highlightClose = "</mark>"
+)
+
+// Markers FTS5 puts around the matching words, replaced by the tags once the snippet is escaped
+const (
+	fts5MarkOpen  = "\x02"
+	fts5MarkClose = "\x03"
+)
+
+// searchTerms splits a query into lowercase words, the same way the FTS5 unicode61 tokenizer does
+func searchTerms(query string) []string {
+
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+}
+
+// NewProductSearcher detects the best search engine of a database: FTS5 when the products_fts index
+// of the create_product_search_index migration exists and this binary was built with the sqlite_fts5 tag,
+// name matching with LIKE otherwise. CheckSchemaUpToDate refuses a database with the index this binary
+// cannot maintain.
+func NewProductSearcher(products_db *gorm.DB) ProductSearcher {
+
+	if products_db.Dialector.Name() != DriverSQLite || !products_db.Migrator().HasTable(productSearchIndex) || !fts5Available(products_db) {
+
+		return &LikeProductSearcher{products_db: products_db}
+	}
+
+	return &FTS5ProductSearcher{products_db: products_db}
+}
+
+// FTS5ProductSearcher ranks products with the BM25 score of the products_fts full-text index.
+// Every word of the query must match the start of a word of the name.
+type FTS5ProductSearcher struct {
+	products_db *gorm.DB
+}
+
+type fts5SearchRow struct {
+	Product
+
+	Rank float64
+
+	Snippet string
+}
+
+func (searcher *FTS5ProductSearcher) SearchProducts(query string, statuses []string, offset int, limit int) ([]SearchResult, error) {
+
+	terms := searchTerms(query)
+
+	if len(terms) == 0 {
+
+		return nil, ErrEmptySearch
+	}
+
+	// "lapt"* "pro"* matches the names with words starting with both terms
+	match := make([]string, 0, len(terms))
+
+	for _, term := range terms {
+
+		match = append(match, `"`+term+`"*`)
+	}
+
+	where, arguments := " WHERE "+productSearchIndex+" MATCH ? AND products.deleted_at IS NULL", []interface{}{fts5MarkOpen, fts5MarkClose, strings.Join(match, " ")}
+
+	if len(statuses) > 0 {
+
+		where += " AND products.status IN ?"
+
+		arguments = append(arguments, statuses)
+	}
+
+	var rows []fts5SearchRow
+
+	result := searcher.products_db.Raw(
+		"SELECT products.*, bm25("+productSearchIndex+") AS rank, snippet("+productSearchIndex+", 0, ?, ?, '…', 16) AS snippet"+
+			" FROM "+productSearchIndex+" JOIN products ON products.id = "+productSearchIndex+".rowid"+
+			where+
+			" ORDER BY rank, products.id LIMIT ? OFFSET ?",
+		append(arguments, limit, offset)...).Scan(&rows)
+
+	if result.Error != nil {
+
+		return nil, result.Error
+	}
+
+	results := make([]SearchResult, 0, len(rows))
+
+	for _, row := range rows {
+
+		// BM25 is lower for better matches
+		snippet := strings.NewReplacer(fts5MarkOpen, highlightOpen, fts5MarkClose, highlightClose).Replace(html.EscapeString(row.Snippet))
+
+		results = append(results, SearchResult{Product: row.Product, Score: -row.Rank, Snippet: snippet})
+	}
+
+	return results, nil
+}
+
+// LikeProductSearcher works on every backend: it loads the products whose name contains every word of the query
+// and ranks them in process, like MemoryProductRepository does
+type LikeProductSearcher struct {
+	products_db *gorm.DB
+}
+
+func (searcher *LikeProductSearcher) SearchProducts(query string, statuses []string, offset int, limit int) ([]SearchResult, error) {
+
+	terms := searchTerms(query)
+
+	if len(terms) == 0 {
+
+		return nil, ErrEmptySearch
+	}
+
+	matching := applyProductFilter(searcher.products_db, ProductFilter{Statuses: statuses})
+
+	for _, term := range terms {
+
+		matching = applyProductFilter(matching, ProductFilter{NameContains: term})
+	}
+
+	var products []Product
+
+	result := matching.Find(&products)
+
+	if result.Error != nil {
+
+		return nil, result.Error
+	}
+
+	return rankSearchResults(products, terms, offset, limit), nil
+}
+
+// rankSearchResults scores the products matching every term and returns one page of them, best first
+func rankSearchResults(products []Product, terms []string, offset int, limit int) []SearchResult {
+
+	results := []SearchResult{}
+
+	for _, product := range products {
+
+		score, matched := searchScore(product.Name, terms)
+
+		if matched {
+
+			results = append(results, SearchResult{Product: product, Score: score, Snippet: highlightTerms(product.Name, terms)})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+
+		if results[i].Score != results[j].Score {
+
+			return results[i].Score > results[j].Score
+		}
+
+		return results[i].Product.ID < results[j].Product.ID
+	})
+
+	if offset >= len(results) {
+
+		return []SearchResult{}
+	}
+
+	end := offset + limit
+
+	if end > len(results) {
+
+		end = len(results)
+	}
+
+	return results[offset:end]
+}
+
+// searchScore rewards every term by its best match in the name: a whole word, the start of a word, or anywhere.
+// Shorter names rank higher on ties. matched is false when a term is not found at all.
+func searchScore(name string, terms []string) (score float64, matched bool) {
+
+	words := searchTerms(name)
+
+	for _, term := range terms {
+
+		best := 0.0
+
+		for _, word := range words {
+
+			switch {
+
+			case word == term:
+
+				best = max(best, 3)
+
+			case strings.HasPrefix(word, term):
+
+				best = max(best, 2)
+
+			case strings.Contains(word, term):
+
+				best = max(best, 1)
+			}
+		}
+
+		if best == 0 {
+
+			return 0, false
+		}
+
+		score += best
+	}
+
+	return score + 1/float64(1+len(words)), true
+}
+
+// highlightTerms escapes name as HTML and wraps its words containing one of the terms in <mark> tags
+func highlightTerms(name string, terms []string) string {
+
+	var snippet strings.Builder
+
+	word := []rune{}
+
+	flush := func() {
+
+		lowered := strings.ToLower(string(word))
+
+		for _, term := range terms {
+
+			if len(word) > 0 && strings.Contains(lowered, term) {
+
+				snippet.WriteString(highlightOpen + html.EscapeString(string(word)) + highlightClose)
+
+				word = word[:0]
+
+				return
+			}
+		}
+
+		snippet.WriteString(html.EscapeString(string(word)))
+
+		word = word[:0]
+	}
+
+	for _, r := range name {
+
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+
+			word = append(word, r)
+
+			continue
+		}
+
+		flush()
+
+		snippet.WriteString(html.EscapeString(string(r)))
+	}
+
+	flush()
+
+	return snippet.String()
+}
@@ -0,0 +1,139 @@
+package data_layer
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strings"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SortKey orders products by one whitelisted field
+type SortKey struct {
+	Field      string
+	Descending bool
+}
+
+// ProductSort is an ordered list of sort keys. The product ID always breaks the remaining ties,
+// so every page of a listing is deterministic.
+type ProductSort []SortKey
+
+// Columns of the fields products can be sorted by
+var sortableProductFields = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"price":      "price_minor",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// ParseProductSort reads a sort written as "-price,name": comma separated fields, descending when prefixed with "-"
+func ParseProductSort(spec string) (ProductSort, error) {
+
+	productSort := ProductSort{}
+
+	seen := make(map[string]bool)
+
+	for _, entry := range strings.Split(spec, ",") {
+
+		entry = strings.TrimSpace(entry)
+
+		if entry == "" {
+
+			continue
+		}
+
+		key := SortKey{Field: strings.TrimPrefix(entry, "-"), Descending: strings.HasPrefix(entry, "-")}
+
+		key.Field = strings.TrimPrefix(key.Field, "+")
+
+		if _, found := sortableProductFields[key.Field]; !found {
+
+			return nil, fmt.Errorf("cannot sort by %q: expected id, name, price, created_at or updated_at", key.Field)
+		}
+
+		if seen[key.Field] {
+
+			return nil, fmt.Errorf("cannot sort by %q twice", key.Field)
+		}
+
+		seen[key.Field] = true
+
+		productSort = append(productSort, key)
+	}
+
+	return productSort, nil
+}
+
+// keys returns the sort keys with the ID tie-breaker appended when it is missing
+func (productSort ProductSort) keys() []SortKey {
+
+	for _, key := range productSort {
+
+		if key.Field == "id" {
+
+			return productSort
+		}
+	}
+
+	return append(append([]SortKey{}, productSort...), SortKey{Field: "id"})
+}
+
+func applyProductSort(query *gorm.DB, productSort ProductSort) *gorm.DB {
+
+	columns := []clause.OrderByColumn{}
+
+	for _, key := range productSort.keys() {
+
+		columns = append(columns, clause.OrderByColumn{Column: clause.Column{Table: "products", Name: sortableProductFields[key.Field]}, Desc: key.Descending})
+	}
+
+	return query.Order(clause.OrderBy{Columns: columns})
+}
+
+// sortProducts is the in-memory equivalent of applyProductSort
+func sortProducts(products []Product, productSort ProductSort) {
+
+	keys := productSort.keys()
+
+	sort.SliceStable(products, func(i, j int) bool {
+
+		for _, key := range keys {
+
+			comparison := compareProducts(products[i], products[j], key.Field)
+
+			if comparison != 0 {
+
+				return (comparison < 0) != key.Descending
+			}
+		}
+
+		return false
+	})
+}
+
+// compareProducts compares one field of two products, returning -1, 0 or 1
+func compareProducts(a Product, b Product, field string) int {
+
+	switch field {
+
+	case "name":
+
+		return strings.Compare(a.Name, b.Name)
+
+	case "price":
+
+		return cmp.Compare(a.Price, b.Price)
+
+	case "created_at":
+
+		return a.CreatedAt.Compare(b.CreatedAt)
+
+	case "updated_at":
+
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	}
+
+	return cmp.Compare(a.ID, b.ID)
+}
@@ -0,0 +1,210 @@
+package data_layer
+
+import (
+	"fmt"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Default location of the SQLite products database
+const DefaultProductsDBPath = "simpler_home_test.db"
+
+// Supported database drivers
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+)
+
+// StoreConfig holds the settings of the application-scoped products database handle.
+// Path is only used by SQLite when no DSN is given; PostgreSQL and MySQL always need a DSN.
+type StoreConfig struct {
+	Driver          string
+	DSN             string
+	Path            string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	BusyTimeout     time.Duration
+}
+
+func DefaultStoreConfig() StoreConfig {
+
+	return StoreConfig{
+		Driver:          DriverSQLite,
+		Path:            DefaultProductsDBPath,
+		MaxOpenConns:    10,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+		BusyTimeout:     5 * time.Second,
+	}
+}
+
+// StoreConfigFromEnv starts from the defaults and overrides every setting found in the environment
+func StoreConfigFromEnv() StoreConfig {
+
+	config := DefaultStoreConfig()
+
+	if driver := os.Getenv("PRODUCTS_DB_DRIVER"); driver != "" {
+
+		config.Driver = driver
+	}
+
+	config.DSN = os.Getenv("PRODUCTS_DB_DSN")
+
+	if path := os.Getenv("PRODUCTS_DB_PATH"); path != "" {
+
+		config.Path = path
+	}
+
+	config.MaxOpenConns = intFromEnv("PRODUCTS_DB_MAX_OPEN_CONNS", config.MaxOpenConns)
+
+	config.MaxIdleConns = intFromEnv("PRODUCTS_DB_MAX_IDLE_CONNS", config.MaxIdleConns)
+
+	config.ConnMaxLifetime = durationFromEnv("PRODUCTS_DB_CONN_MAX_LIFETIME", config.ConnMaxLifetime)
+
+	config.ConnMaxIdleTime = durationFromEnv("PRODUCTS_DB_CONN_MAX_IDLE_TIME", config.ConnMaxIdleTime)
+
+	config.BusyTimeout = durationFromEnv("PRODUCTS_DB_BUSY_TIMEOUT", config.BusyTimeout)
+
+	return config
+}
+
+// OpenProductsDB opens the products database once and sizes its connection pool.
+// The schema is managed by the versioned migrations (see MigrateUp), not at open time.
+// The returned handle is meant to live for the whole application and be closed with CloseProductsDB.
+func OpenProductsDB(config StoreConfig) (*gorm.DB, error) {
+
+	dialector, err := dialectorFor(config)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	// Unique index violations come back as gorm.ErrDuplicatedKey, whatever the driver
+	products_db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	sqlDB, err := products_db.DB()
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	sqlDB.SetMaxOpenConns(config.MaxOpenConns)
+
+	sqlDB.SetMaxIdleConns(config.MaxIdleConns)
+
+	sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
+
+	sqlDB.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+
+	return products_db, nil
+}
+
+// dialectorFor picks the GORM dialector matching the configured driver
+func dialectorFor(config StoreConfig) (gorm.Dialector, error) {
+
+	switch config.Driver {
+
+	case DriverSQLite, "":
+
+		if config.DSN != "" {
+
+			return sqlite.Open(config.DSN), nil
+		}
+
+		// A busy timeout and immediate write transactions keep concurrent requests from failing with SQLITE_BUSY
+		dsn := config.Path + "?_busy_timeout=" + strconv.FormatInt(config.BusyTimeout.Milliseconds(), 10) + "&_txlock=immediate"
+
+		return sqlite.Open(dsn), nil
+
+	case DriverPostgres:
+
+		if config.DSN == "" {
+
+			return nil, fmt.Errorf("the %s driver requires a DSN", config.Driver)
+		}
+
+		return postgres.Open(config.DSN), nil
+
+	case DriverMySQL:
+
+		if config.DSN == "" {
+
+			return nil, fmt.Errorf("the %s driver requires a DSN", config.Driver)
+		}
+
+		return mysql.Open(config.DSN), nil
+	}
+
+	return nil, fmt.Errorf("unsupported database driver %q", config.Driver)
+}
+
+func CloseProductsDB(products_db *gorm.DB) error {
+
+	sqlDB, err := products_db.DB()
+
+	if err != nil {
+
+		return err
+	}
+
+	return sqlDB.Close()
+}
+
+func intFromEnv(key string, fallback int) int {
+
+	value := os.Getenv(key)
+
+	if value == "" {
+
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+
+	if err != nil {
+
+		log.Printf("Ignoring invalid %s=%q: %v", key, value, err)
+
+		return fallback
+	}
+
+	return parsed
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+
+	value := os.Getenv(key)
+
+	if value == "" {
+
+		return fallback
+	}
+
+	parsed, err := time.ParseDuration(value)
+
+	if err != nil {
+
+		log.Printf("Ignoring invalid %s=%q: %v", key, value, err)
+
+		return fallback
+	}
+
+	return parsed
+}
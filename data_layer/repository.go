@@ -0,0 +1,573 @@
+package data_layer
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// ProductRepository is the storage contract the API handlers depend on.
+// Implementations report missing products with gorm.ErrRecordNotFound.
+type ProductRepository interface {
+	InsertProduct(name string, price Amount, currency string) (uint, error)
+
+	// InsertProducts inserts all the products or none of them, and returns their IDs in order
+	InsertProducts(products []Product) ([]uint, error)
+
+	// DeleteProduct soft-deletes; PurgeProduct and PurgeDeletedProducts remove rows for good.
+	// Deletes and updates fail with a *VersionConflictError unless expectedVersion is AnyVersion or current.
+	DeleteProduct(id int, expectedVersion uint) error
+
+	RestoreProduct(id int) error
+
+	PurgeProduct(id int, expectedVersion uint) error
+
+	PurgeDeletedProducts(deletedBefore time.Time) (int64, error)
+
+	UpdateProductName(id int, name string, expectedVersion uint) error
+
+	UpdateProductPrice(id int, price Amount, expectedVersion uint) error
+
+	UpdateProduct(id int, changes ProductChanges, expectedVersion uint) error
+
+	// ApplyProductSchedules publishes and unpublishes the products due at now, and returns how many status changes it made
+	ApplyProductSchedules(now time.Time) (int, error)
+
+	// ApplyPriceRule changes many base prices at once, all or none, and returns the diff
+	ApplyPriceRule(rule PriceRule, dryRun bool) ([]PriceChange, error)
+
+	RetrieveProduct(id int, includeDeleted bool) (Product, error)
+
+	// RetrieveProductBySKU and RetrieveProductByGTIN find a live product by its normalized identifier.
+	// Malformed identifiers fail with ErrInvalidSKU or ErrInvalidGTIN.
+	RetrieveProductBySKU(sku string) (Product, error)
+
+	RetrieveProductByGTIN(gtin string) (Product, error)
+
+	RetrieveProductsWithPagination(filter ProductFilter, productSort ProductSort, offset int, limit int) ([]Product, error)
+
+	RetrieveProductsWithCursor(filter ProductFilter, cursor ProductCursor, limit int) ([]Product, error)
+
+	GetTotalNumberOfProducts(filter ProductFilter) (int64, error)
+
+	// StreamProducts visits every matching product in order without loading them all at once
+	StreamProducts(filter ProductFilter, productSort ProductSort, visit func(Product) error) error
+
+	SetProductPrice(id int, currency string, price Amount) error
+
+	DeleteProductPrice(id int, currency string) error
+
+	RetrieveProductPrices(ids []uint) ([]ProductPrice, error)
+}
+
+// ExchangeRateRepository maintains the local exchange-rate table used to convert prices
+type ExchangeRateRepository interface {
+	SetExchangeRate(base string, quote string, rate Rate) error
+
+	DeleteExchangeRate(base string, quote string) error
+
+	RetrieveExchangeRates() ([]ExchangeRate, error)
+}
+
+// CategoryRepository maintains the category hierarchy and the categories of every product.
+// Missing categories are reported with gorm.ErrRecordNotFound, like missing products.
+type CategoryRepository interface {
+	// CreateCategory adds a category under parentID, or at the root when it is nil
+	CreateCategory(name string, parentID *uint) (Category, error)
+
+	RetrieveCategory(id uint) (Category, error)
+
+	// RetrieveCategories lists every category, parents before their children
+	RetrieveCategories() ([]Category, error)
+
+	// UpdateCategory renames a category and moves it with its subtree under parentID
+	UpdateCategory(id uint, name string, parentID *uint) error
+
+	// DeleteCategory fails with ErrCategoryNotEmpty while the category has subcategories
+	DeleteCategory(id uint) error
+
+	AssignProductCategory(productID int, categoryID uint) error
+
+	UnassignProductCategory(productID int, categoryID uint) error
+
+	RetrieveProductCategories(productID int) ([]Category, error)
+
+	// RetrieveCategoryTree counts the live products in one of the statuses, or in any when statuses is empty
+	RetrieveCategoryTree(statuses []string) ([]*CategoryNode, error)
+}
+
+// TagRepository maintains the tags of every product. Tags are normalized with NormalizeTag,
+// and invalid ones are rejected with ErrInvalidTag.
+type TagRepository interface {
+	// AddProductTags tags a live product and returns all its tags
+	AddProductTags(productID int, tags []string) ([]string, error)
+
+	// RemoveProductTag fails with gorm.ErrRecordNotFound when the product does not carry the tag
+	RemoveProductTag(productID int, tag string) error
+
+	RetrieveProductTags(productID int) ([]string, error)
+
+	// RetrieveTagCloud counts the live products of every tag in one of the statuses, or in any when statuses is empty,
+	// most used first; a limit of 0 returns them all
+	RetrieveTagCloud(statuses []string, limit int) ([]TagCount, error)
+}
+
+// InventoryRepository keeps the stock of every product, and of every variant, in every warehouse. Every change is atomic:
+// the available quantity never goes below zero, whatever the concurrent requests. A variant ID of 0 stands for the
+// product itself and a warehouse ID of 0 for the default warehouse. Variants of another product are reported with
+// gorm.ErrRecordNotFound.
+type InventoryRepository interface {
+	// RetrieveStock returns the availability of a product or variant summed over its warehouses
+	RetrieveStock(productID int, variantID uint) (ProductAvailability, error)
+
+	// AdjustStock changes the on-hand quantity in a warehouse by delta, with one of the StockReasons
+	AdjustStock(productID int, variantID uint, warehouseID uint, delta int64, reason string) (ProductAvailability, error)
+
+	// TransferStock moves available units between two warehouses
+	TransferStock(productID int, variantID uint, fromWarehouseID uint, toWarehouseID uint, quantity int64) (ProductAvailability, error)
+
+	// ReserveStock holds units until expiresAt, after which they are given back automatically
+	ReserveStock(holdID string, productID int, variantID uint, warehouseID uint, quantity int64, expiresAt time.Time) (StockHold, error)
+
+	RetrieveStockHold(holdID string) (StockHold, error)
+
+	CommitStockHold(holdID string) (ProductAvailability, error)
+
+	ReleaseStockHold(holdID string) (ProductAvailability, error)
+
+	// ReleaseExpiredStockHolds releases the holds expired at now and returns how many
+	ReleaseExpiredStockHolds(now time.Time) (int, error)
+
+	RetrieveStockMovements(productID int, variantID uint, limit int) ([]StockMovement, error)
+}
+
+// WarehouseRepository maintains the warehouses. Missing ones are reported with gorm.ErrRecordNotFound.
+type WarehouseRepository interface {
+	CreateWarehouse(code string, name string) (Warehouse, error)
+
+	RetrieveWarehouse(id uint) (Warehouse, error)
+
+	// RetrieveWarehouses lists every warehouse, the default one first
+	RetrieveWarehouses() ([]Warehouse, error)
+
+	UpdateWarehouse(id uint, code string, name string) error
+
+	// DeleteWarehouse fails with ErrWarehouseNotEmpty while the warehouse holds stock
+	DeleteWarehouse(id uint) error
+}
+
+// VariantRepository maintains the variants of every product. Variants of missing or deleted products, and variants
+// of another product, are reported with gorm.ErrRecordNotFound.
+type VariantRepository interface {
+	// CreateProductVariant fails with ErrInvalidVariant or ErrDuplicateVariant when the spec is not acceptable
+	CreateProductVariant(productID int, spec VariantSpec) (ProductVariant, error)
+
+	RetrieveProductVariant(productID int, variantID uint) (ProductVariant, error)
+
+	// RetrieveProductVariantBySKU finds a variant of a live product by its normalized SKU. Malformed SKUs fail with ErrInvalidSKU.
+	RetrieveProductVariantBySKU(sku string) (ProductVariant, error)
+
+	// RetrieveProductVariants lists the variants of a product in ID order
+	RetrieveProductVariants(productID int) ([]ProductVariant, error)
+
+	UpdateProductVariant(productID int, variantID uint, spec VariantSpec) error
+
+	// DeleteProductVariant fails with ErrVariantNotEmpty while the variant has units on hand or reserved
+	DeleteProductVariant(productID int, variantID uint) error
+}
+
+// Repository is everything the API needs from a storage backend
+type Repository interface {
+	ProductRepository
+
+	ExchangeRateRepository
+
+	CategoryRepository
+
+	TagRepository
+
+	InventoryRepository
+
+	WarehouseRepository
+
+	VariantRepository
+
+	ProductSearcher
+
+	ProductSuggester
+}
+
+// GormProductRepository stores products through GORM on the application-scoped database handle
+type GormProductRepository struct {
+	products_db *gorm.DB
+	searcher    ProductSearcher
+	names       *NameIndex
+}
+
+// NewGormProductRepository searches with the engine NewProductSearcher detects on the database.
+// Its name index is read from the products table on the first suggestion, then follows the writes of the repository.
+func NewGormProductRepository(products_db *gorm.DB) *GormProductRepository {
+
+	names := newLazyNameIndex(func() ([]Product, error) {
+
+		var products []Product
+
+		return products, products_db.Select("id", "name", "status").Find(&products).Error
+	})
+
+	return &GormProductRepository{products_db: products_db, searcher: NewProductSearcher(products_db), names: names}
+}
+
+// WithSearcher replaces the search engine of the repository
+func (repository *GormProductRepository) WithSearcher(searcher ProductSearcher) *GormProductRepository {
+
+	repository.searcher = searcher
+
+	return repository
+}
+
+func (repository *GormProductRepository) SearchProducts(query string, statuses []string, offset int, limit int) ([]SearchResult, error) {
+
+	return repository.searcher.SearchProducts(query, statuses, offset, limit)
+}
+
+func (repository *GormProductRepository) SuggestProducts(prefix string, statuses []string, maxDistance int, limit int) ([]Suggestion, error) {
+
+	return repository.names.Suggest(prefix, statuses, maxDistance, limit)
+}
+
+// reindex refreshes the name index once a write to a product succeeded
+func (repository *GormProductRepository) reindex(id int, err error) error {
+
+	if err != nil {
+
+		return err
+	}
+
+	product, retrieveErr := RetrieveProduct(repository.products_db, id, false)
+
+	if retrieveErr != nil {
+
+		repository.names.Remove(uint(id))
+
+		return nil
+	}
+
+	repository.names.Put(product.ID, product.Name, product.Status)
+
+	return nil
+}
+
+func (repository *GormProductRepository) InsertProduct(name string, price Amount, currency string) (uint, error) {
+
+	productID, err := InsertProduct(repository.products_db, name, price, currency)
+
+	if err == nil {
+
+		repository.names.Put(productID, name, StatusActive)
+	}
+
+	return productID, err
+}
+
+func (repository *GormProductRepository) InsertProducts(products []Product) ([]uint, error) {
+
+	ids, err := InsertProducts(repository.products_db, products)
+
+	for i, productID := range ids {
+
+		product := products[i]
+
+		// Inserted, so its lifecycle is valid
+		_ = NormalizeProductLifecycle(&product)
+
+		repository.names.Put(productID, product.Name, product.Status)
+	}
+
+	return ids, err
+}
+
+func (repository *GormProductRepository) DeleteProduct(id int, expectedVersion uint) error {
+
+	return repository.reindex(id, DeleteProduct(repository.products_db, id, expectedVersion))
+}
+
+func (repository *GormProductRepository) UpdateProductName(id int, name string, expectedVersion uint) error {
+
+	return repository.reindex(id, UpdateProductName(repository.products_db, id, name, expectedVersion))
+}
+
+func (repository *GormProductRepository) UpdateProductPrice(id int, price Amount, expectedVersion uint) error {
+
+	return UpdateProductPrice(repository.products_db, id, price, expectedVersion)
+}
+
+func (repository *GormProductRepository) UpdateProduct(id int, changes ProductChanges, expectedVersion uint) error {
+
+	return repository.reindex(id, UpdateProduct(repository.products_db, id, changes, expectedVersion))
+}
+
+func (repository *GormProductRepository) ApplyPriceRule(rule PriceRule, dryRun bool) ([]PriceChange, error) {
+
+	return ApplyPriceRule(repository.products_db, rule, dryRun)
+}
+
+func (repository *GormProductRepository) RestoreProduct(id int) error {
+
+	return repository.reindex(id, RestoreProduct(repository.products_db, id))
+}
+
+func (repository *GormProductRepository) PurgeProduct(id int, expectedVersion uint) error {
+
+	return repository.reindex(id, PurgeProduct(repository.products_db, id, expectedVersion))
+}
+
+func (repository *GormProductRepository) PurgeDeletedProducts(deletedBefore time.Time) (int64, error) {
+
+	return PurgeDeletedProducts(repository.products_db, deletedBefore)
+}
+
+func (repository *GormProductRepository) RetrieveProduct(id int, includeDeleted bool) (Product, error) {
+
+	return RetrieveProduct(repository.products_db, id, includeDeleted)
+}
+
+func (repository *GormProductRepository) RetrieveProductBySKU(sku string) (Product, error) {
+
+	return RetrieveProductBySKU(repository.products_db, sku)
+}
+
+func (repository *GormProductRepository) RetrieveProductByGTIN(gtin string) (Product, error) {
+
+	return RetrieveProductByGTIN(repository.products_db, gtin)
+}
+
+func (repository *GormProductRepository) ApplyProductSchedules(now time.Time) (int, error) {
+
+	changedIDs, err := applyProductSchedules(repository.products_db, now)
+
+	for _, productID := range changedIDs {
+
+		repository.reindex(int(productID), nil)
+	}
+
+	return len(changedIDs), err
+}
+
+func (repository *GormProductRepository) RetrieveProductsWithPagination(filter ProductFilter, productSort ProductSort, offset int, limit int) ([]Product, error) {
+
+	return RetrieveProductsWithPagination(repository.products_db, filter, productSort, offset, limit)
+}
+
+func (repository *GormProductRepository) RetrieveProductsWithCursor(filter ProductFilter, cursor ProductCursor, limit int) ([]Product, error) {
+
+	return RetrieveProductsWithCursor(repository.products_db, filter, cursor, limit)
+}
+
+func (repository *GormProductRepository) GetTotalNumberOfProducts(filter ProductFilter) (int64, error) {
+
+	return GetTotalNumberOfProducts(repository.products_db, filter)
+}
+
+func (repository *GormProductRepository) StreamProducts(filter ProductFilter, productSort ProductSort, visit func(Product) error) error {
+
+	return StreamProducts(repository.products_db, filter, productSort, visit)
+}
+
+func (repository *GormProductRepository) SetProductPrice(id int, currency string, price Amount) error {
+
+	return SetProductPrice(repository.products_db, id, currency, price)
+}
+
+func (repository *GormProductRepository) DeleteProductPrice(id int, currency string) error {
+
+	return DeleteProductPrice(repository.products_db, id, currency)
+}
+
+func (repository *GormProductRepository) RetrieveProductPrices(ids []uint) ([]ProductPrice, error) {
+
+	return RetrieveProductPrices(repository.products_db, ids)
+}
+
+func (repository *GormProductRepository) SetExchangeRate(base string, quote string, rate Rate) error {
+
+	return SetExchangeRate(repository.products_db, base, quote, rate)
+}
+
+func (repository *GormProductRepository) DeleteExchangeRate(base string, quote string) error {
+
+	return DeleteExchangeRate(repository.products_db, base, quote)
+}
+
+func (repository *GormProductRepository) RetrieveExchangeRates() ([]ExchangeRate, error) {
+
+	return RetrieveExchangeRates(repository.products_db)
+}
+
+func (repository *GormProductRepository) CreateCategory(name string, parentID *uint) (Category, error) {
+
+	return CreateCategory(repository.products_db, name, parentID)
+}
+
+func (repository *GormProductRepository) RetrieveCategory(id uint) (Category, error) {
+
+	return RetrieveCategory(repository.products_db, id)
+}
+
+func (repository *GormProductRepository) RetrieveCategories() ([]Category, error) {
+
+	return RetrieveCategories(repository.products_db)
+}
+
+func (repository *GormProductRepository) UpdateCategory(id uint, name string, parentID *uint) error {
+
+	return UpdateCategory(repository.products_db, id, name, parentID)
+}
+
+func (repository *GormProductRepository) DeleteCategory(id uint) error {
+
+	return DeleteCategory(repository.products_db, id)
+}
+
+func (repository *GormProductRepository) AssignProductCategory(productID int, categoryID uint) error {
+
+	return AssignProductCategory(repository.products_db, productID, categoryID)
+}
+
+func (repository *GormProductRepository) UnassignProductCategory(productID int, categoryID uint) error {
+
+	return UnassignProductCategory(repository.products_db, productID, categoryID)
+}
+
+func (repository *GormProductRepository) RetrieveProductCategories(productID int) ([]Category, error) {
+
+	return RetrieveProductCategories(repository.products_db, productID)
+}
+
+func (repository *GormProductRepository) RetrieveCategoryTree(statuses []string) ([]*CategoryNode, error) {
+
+	return RetrieveCategoryTree(repository.products_db, statuses)
+}
+
+func (repository *GormProductRepository) AddProductTags(productID int, tags []string) ([]string, error) {
+
+	return AddProductTags(repository.products_db, productID, tags)
+}
+
+func (repository *GormProductRepository) RemoveProductTag(productID int, tag string) error {
+
+	return RemoveProductTag(repository.products_db, productID, tag)
+}
+
+func (repository *GormProductRepository) RetrieveProductTags(productID int) ([]string, error) {
+
+	return RetrieveProductTags(repository.products_db, productID)
+}
+
+func (repository *GormProductRepository) RetrieveTagCloud(statuses []string, limit int) ([]TagCount, error) {
+
+	return RetrieveTagCloud(repository.products_db, statuses, limit)
+}
+
+func (repository *GormProductRepository) RetrieveStock(productID int, variantID uint) (ProductAvailability, error) {
+
+	return RetrieveStock(repository.products_db, productID, variantID)
+}
+
+func (repository *GormProductRepository) AdjustStock(productID int, variantID uint, warehouseID uint, delta int64, reason string) (ProductAvailability, error) {
+
+	return AdjustStock(repository.products_db, productID, variantID, warehouseID, delta, reason)
+}
+
+func (repository *GormProductRepository) TransferStock(productID int, variantID uint, fromWarehouseID uint, toWarehouseID uint, quantity int64) (ProductAvailability, error) {
+
+	return TransferStock(repository.products_db, productID, variantID, fromWarehouseID, toWarehouseID, quantity)
+}
+
+func (repository *GormProductRepository) ReserveStock(holdID string, productID int, variantID uint, warehouseID uint, quantity int64, expiresAt time.Time) (StockHold, error) {
+
+	return ReserveStock(repository.products_db, holdID, productID, variantID, warehouseID, quantity, expiresAt)
+}
+
+func (repository *GormProductRepository) RetrieveStockHold(holdID string) (StockHold, error) {
+
+	return RetrieveStockHold(repository.products_db, holdID)
+}
+
+func (repository *GormProductRepository) CommitStockHold(holdID string) (ProductAvailability, error) {
+
+	return CommitStockHold(repository.products_db, holdID)
+}
+
+func (repository *GormProductRepository) ReleaseStockHold(holdID string) (ProductAvailability, error) {
+
+	return ReleaseStockHold(repository.products_db, holdID)
+}
+
+func (repository *GormProductRepository) ReleaseExpiredStockHolds(now time.Time) (int, error) {
+
+	return ReleaseExpiredStockHolds(repository.products_db, now)
+}
+
+func (repository *GormProductRepository) RetrieveStockMovements(productID int, variantID uint, limit int) ([]StockMovement, error) {
+
+	return RetrieveStockMovements(repository.products_db, productID, variantID, limit)
+}
+
+func (repository *GormProductRepository) CreateWarehouse(code string, name string) (Warehouse, error) {
+
+	return CreateWarehouse(repository.products_db, code, name)
+}
+
+func (repository *GormProductRepository) RetrieveWarehouse(id uint) (Warehouse, error) {
+
+	return RetrieveWarehouse(repository.products_db, id)
+}
+
+func (repository *GormProductRepository) RetrieveWarehouses() ([]Warehouse, error) {
+
+	return RetrieveWarehouses(repository.products_db)
+}
+
+func (repository *GormProductRepository) UpdateWarehouse(id uint, code string, name string) error {
+
+	return UpdateWarehouse(repository.products_db, id, code, name)
+}
+
+func (repository *GormProductRepository) DeleteWarehouse(id uint) error {
+
+	return DeleteWarehouse(repository.products_db, id)
+}
+
+func (repository *GormProductRepository) CreateProductVariant(productID int, spec VariantSpec) (ProductVariant, error) {
+
+	return CreateProductVariant(repository.products_db, productID, spec)
+}
+
+func (repository *GormProductRepository) RetrieveProductVariant(productID int, variantID uint) (ProductVariant, error) {
+
+	return RetrieveProductVariant(repository.products_db, productID, variantID)
+}
+
+func (repository *GormProductRepository) RetrieveProductVariantBySKU(sku string) (ProductVariant, error) {
+
+	return RetrieveProductVariantBySKU(repository.products_db, sku)
+}
+
+func (repository *GormProductRepository) RetrieveProductVariants(productID int) ([]ProductVariant, error) {
+
+	return RetrieveProductVariants(repository.products_db, productID)
+}
+
+func (repository *GormProductRepository) UpdateProductVariant(productID int, variantID uint, spec VariantSpec) error {
+
+	return UpdateProductVariant(repository.products_db, productID, variantID, spec)
+}
+
+func (repository *GormProductRepository) DeleteProductVariant(productID int, variantID uint) error {
+
+	return DeleteProductVariant(repository.products_db, productID, variantID)
+}
+
+var _ Repository = (*GormProductRepository)(nil)
+
+var _ Repository = (*MemoryProductRepository)(nil)
@@ -0,0 +1,270 @@
+package data_layer
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tag is a free-form label shared by every product carrying it, stored once in its normalized form
+type Tag struct {
+	ID        uint   `gorm:"primarykey"`
+	Name      string `gorm:"size:50;not null;uniqueIndex"`
+	CreatedAt time.Time
+}
+
+// ProductTag puts a tag on a product
+type ProductTag struct {
+	ProductID uint `gorm:"primaryKey;autoIncrement:false"`
+	TagID     uint `gorm:"primaryKey;autoIncrement:false;index"`
+}
+
+// TagCount is an entry of the tag cloud: how many live products carry the tag
+type TagCount struct {
+	Name  string
+	Count int
+}
+
+// MaxTagLength is the size of the tags.name column, in characters
+const MaxTagLength = 50
+
+// ErrInvalidTag is returned for tags that are empty, too long, or contain anything but letters, digits, spaces, - and _
+var ErrInvalidTag = errors.New("a tag must have 1 to 50 letters, digits, spaces, - or _")
+
+// NormalizeTag lowercases a tag and collapses its spaces, so that "Eco  Friendly" and "eco friendly" are the same tag
+func NormalizeTag(name string) (string, error) {
+
+	tag := strings.ToLower(strings.Join(strings.Fields(name), " "))
+
+	if tag == "" || utf8.RuneCountInString(tag) > MaxTagLength {
+
+		return "", ErrInvalidTag
+	}
+
+	for _, r := range tag {
+
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != ' ' && r != '-' && r != '_' {
+
+			return "", ErrInvalidTag
+		}
+	}
+
+	return tag, nil
+}
+
+// NormalizeTags normalizes and deduplicates tags, keeping their order
+func NormalizeTags(names []string) ([]string, error) {
+
+	tags := make([]string, 0, len(names))
+
+	seen := make(map[string]bool)
+
+	for _, name := range names {
+
+		tag, err := NormalizeTag(name)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		if !seen[tag] {
+
+			seen[tag] = true
+
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags, nil
+}
+
+// AddProductTags puts the tags on a live product and returns all its tags. UpdatedAt and the version
+// of the product only change when it gets a tag it did not have.
+func AddProductTags(products_db *gorm.DB, productID int, names []string) ([]string, error) {
+
+	tags, err := NormalizeTags(names)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	err = products_db.Transaction(func(tx *gorm.DB) error {
+
+		_, err := RetrieveProduct(tx, productID, false)
+
+		if err != nil {
+
+			return err
+		}
+
+		added := false
+
+		for _, name := range tags {
+
+			err = tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "name"}}, DoNothing: true}).Create(&Tag{Name: name}).Error
+
+			if err != nil {
+
+				return err
+			}
+
+			var tag Tag
+
+			err = tx.Where("name = ?", name).First(&tag).Error
+
+			if err != nil {
+
+				return err
+			}
+
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ProductTag{ProductID: uint(productID), TagID: tag.ID})
+
+			if result.Error != nil {
+
+				return result.Error
+			}
+
+			added = added || result.RowsAffected > 0
+		}
+
+		if !added {
+
+			return nil
+		}
+
+		return touchProduct(tx, uint(productID))
+	})
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	return RetrieveProductTags(products_db, productID)
+}
+
+// RemoveProductTag takes a tag off a live product, and drops the tag once no product carries it anymore
+func RemoveProductTag(products_db *gorm.DB, productID int, name string) error {
+
+	tag, err := NormalizeTag(name)
+
+	if err != nil {
+
+		return gorm.ErrRecordNotFound
+	}
+
+	return products_db.Transaction(func(tx *gorm.DB) error {
+
+		_, err := RetrieveProduct(tx, productID, false)
+
+		if err != nil {
+
+			return err
+		}
+
+		tagIDs := tx.Model(&Tag{}).Select("id").Where("name = ?", tag)
+
+		result := tx.Where("product_id = ? AND tag_id IN (?)", productID, tagIDs).Delete(&ProductTag{})
+
+		if result.Error != nil {
+
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+
+			return gorm.ErrRecordNotFound
+		}
+
+		err = tx.Where("name = ? AND NOT EXISTS (SELECT 1 FROM product_tags WHERE product_tags.tag_id = tags.id)", tag).Delete(&Tag{}).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		return touchProduct(tx, uint(productID))
+	})
+}
+
+// RetrieveProductTags returns the tags of a live product in alphabetical order
+func RetrieveProductTags(products_db *gorm.DB, productID int) ([]string, error) {
+
+	_, err := RetrieveProduct(products_db, productID, false)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	tags := []string{}
+
+	result := products_db.Model(&Tag{}).Joins("JOIN product_tags ON product_tags.tag_id = tags.id").
+		Where("product_tags.product_id = ?", productID).Order("tags.name").Pluck("tags.name", &tags)
+
+	if result.Error != nil {
+
+		return nil, result.Error
+	}
+
+	return tags, nil
+}
+
+// RetrieveTagCloud returns the tags of the live products in one of the statuses, or in any when statuses is empty,
+// with how many carry them, most used first. A limit of 0 returns them all.
+func RetrieveTagCloud(products_db *gorm.DB, statuses []string, limit int) ([]TagCount, error) {
+
+	var counts []TagCount
+
+	query := products_db.Model(&Tag{}).Select("tags.name AS name, COUNT(*) AS count").
+		Joins("JOIN product_tags ON product_tags.tag_id = tags.id").
+		Joins("JOIN products ON products.id = product_tags.product_id AND products.deleted_at IS NULL").
+		Group("tags.name").Order("count DESC, tags.name")
+
+	if len(statuses) > 0 {
+
+		query = query.Where("products.status IN ?", statuses)
+	}
+
+	if limit > 0 {
+
+		query = query.Limit(limit)
+	}
+
+	result := query.Scan(&counts)
+
+	if result.Error != nil {
+
+		return nil, result.Error
+	}
+
+	return counts, nil
+}
+
+// sortTagCloud is the in-memory equivalent of the RetrieveTagCloud order
+func sortTagCloud(counts []TagCount, limit int) []TagCount {
+
+	sort.Slice(counts, func(i, j int) bool {
+
+		if counts[i].Count != counts[j].Count {
+
+			return counts[i].Count > counts[j].Count
+		}
+
+		return counts[i].Name < counts[j].Name
+	})
+
+	if limit > 0 && len(counts) > limit {
+
+		counts = counts[:limit]
+	}
+
+	return counts
+}
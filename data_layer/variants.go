@@ -0,0 +1,454 @@
+package data_layer
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ProductVariant is a sellable version of a product, such as its size M in red. Options keeps the option values
+// as given, sorted by name (size=M;color=Red becomes color=Red;size=M); OptionsKey is its lowercased form,
+// unique per product, so that no two variants of a product share the same combination.
+// Its stock is kept by the InventoryRepository, like the stock of products; Available is read from there.
+type ProductVariant struct {
+	ID            uint    `gorm:"primarykey"`
+	ProductID     uint    `gorm:"not null;uniqueIndex:idx_product_variants_options"`
+	SKU           string  `gorm:"column:sku;size:64;not null;uniqueIndex"`
+	Options       string  `gorm:"size:255;not null"`
+	OptionsKey    string  `gorm:"size:255;not null;uniqueIndex:idx_product_variants_options"`
+	PriceOverride *Amount `gorm:"column:price_override_minor"`
+	Available     int64   `gorm:"-"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// OptionValues returns the option values of the variant by option name
+func (variant ProductVariant) OptionValues() map[string]string {
+
+	values := make(map[string]string)
+
+	for _, option := range strings.Split(variant.Options, ";") {
+
+		name, value, found := strings.Cut(option, "=")
+
+		if found {
+
+			values[name] = value
+		}
+	}
+
+	return values
+}
+
+// Price is the price of the variant in the currency of its product: its override, or the price of the product
+func (variant ProductVariant) Price(product Product) Amount {
+
+	if variant.PriceOverride != nil {
+
+		return *variant.PriceOverride
+	}
+
+	return product.Price
+}
+
+// VariantSpec is what the caller sets on a variant, when creating it and when replacing it
+type VariantSpec struct {
+	SKU           string
+	Options       map[string]string
+	PriceOverride *Amount
+}
+
+// Size limits of the variant columns
+const (
+	MaxOptionNameLength   = 30
+	MaxOptionValueLength  = 50
+	MaxVariantOptionsSize = 255
+)
+
+var (
+	// ErrInvalidVariant is returned for variants without options, with a malformed SKU or option, or a price override
+	// that is not positive
+	ErrInvalidVariant = errors.New("invalid variant")
+
+	// ErrDuplicateVariant is returned when another variant or a product, deleted or not, has the same SKU, or the
+	// product already has a variant with the same option values
+	ErrDuplicateVariant = errors.New("a variant with the same SKU or option values, or a product with the same SKU, already exists")
+
+	// ErrVariantNotEmpty is returned when deleting a variant that still has units on hand or reserved
+	ErrVariantNotEmpty = errors.New("the variant still holds stock")
+)
+
+// NormalizeVariantOptions returns the Options and OptionsKey of a variant. Option names are lowercased and made of
+// letters, digits, spaces, - and _; values keep their case but cannot contain = or ;. Spaces are collapsed in both.
+func NormalizeVariantOptions(options map[string]string) (string, string, error) {
+
+	if len(options) == 0 {
+
+		return "", "", ErrInvalidVariant
+	}
+
+	pairs := make([]string, 0, len(options))
+
+	seen := make(map[string]bool)
+
+	for name, value := range options {
+
+		name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+
+		value = strings.Join(strings.Fields(value), " ")
+
+		if name == "" || utf8.RuneCountInString(name) > MaxOptionNameLength || seen[name] {
+
+			return "", "", ErrInvalidVariant
+		}
+
+		for _, r := range name {
+
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != ' ' && r != '-' && r != '_' {
+
+				return "", "", ErrInvalidVariant
+			}
+		}
+
+		if value == "" || utf8.RuneCountInString(value) > MaxOptionValueLength || strings.ContainsAny(value, "=;") {
+
+			return "", "", ErrInvalidVariant
+		}
+
+		seen[name] = true
+
+		pairs = append(pairs, name+"="+value)
+	}
+
+	sort.Strings(pairs)
+
+	normalized := strings.Join(pairs, ";")
+
+	if len(normalized) > MaxVariantOptionsSize {
+
+		return "", "", ErrInvalidVariant
+	}
+
+	return normalized, strings.ToLower(normalized), nil
+}
+
+// newVariant validates a variant spec and returns the columns it sets
+func newVariant(productID uint, spec VariantSpec) (ProductVariant, error) {
+
+	sku, err := NormalizeSKU(spec.SKU)
+
+	if err != nil {
+
+		return ProductVariant{}, ErrInvalidVariant
+	}
+
+	options, optionsKey, err := NormalizeVariantOptions(spec.Options)
+
+	if err != nil {
+
+		return ProductVariant{}, err
+	}
+
+	if spec.PriceOverride != nil && *spec.PriceOverride <= 0 {
+
+		return ProductVariant{}, ErrInvalidVariant
+	}
+
+	variant := ProductVariant{ProductID: productID, SKU: sku, Options: options, OptionsKey: optionsKey}
+
+	if spec.PriceOverride != nil {
+
+		priceOverride := *spec.PriceOverride
+
+		variant.PriceOverride = &priceOverride
+	}
+
+	return variant, nil
+}
+
+// checkVariantUnique fails with ErrDuplicateVariant when another variant than id has the SKU or the option values,
+// or a product, deleted or not, has the SKU
+func checkVariantUnique(tx *gorm.DB, variant ProductVariant, id uint) error {
+
+	var count int64
+
+	err := tx.Model(&ProductVariant{}).Where("id <> ? AND (sku = ? OR (product_id = ? AND options_key = ?))", id, variant.SKU, variant.ProductID, variant.OptionsKey).Count(&count).Error
+
+	if err != nil {
+
+		return err
+	}
+
+	if count == 0 {
+
+		err = tx.Unscoped().Model(&Product{}).Where("sku = ?", variant.SKU).Count(&count).Error
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	if count > 0 {
+
+		return ErrDuplicateVariant
+	}
+
+	return nil
+}
+
+// variantAvailability sums the available units of the variants of a product over the warehouses
+func variantAvailability(tx *gorm.DB, productID uint) (map[uint]int64, error) {
+
+	var rows []struct {
+		VariantID uint
+		Available int64
+	}
+
+	err := tx.Model(&StockLevel{}).Select("variant_id, SUM(on_hand - reserved) AS available").Where("product_id = ? AND variant_id <> 0", productID).Group("variant_id").Scan(&rows).Error
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	available := make(map[uint]int64, len(rows))
+
+	for _, row := range rows {
+
+		available[row.VariantID] = row.Available
+	}
+
+	return available, nil
+}
+
+// CreateProductVariant adds a variant to a live product
+func CreateProductVariant(products_db *gorm.DB, productID int, spec VariantSpec) (ProductVariant, error) {
+
+	variant, err := newVariant(uint(productID), spec)
+
+	if err != nil {
+
+		return ProductVariant{}, err
+	}
+
+	err = products_db.Transaction(func(tx *gorm.DB) error {
+
+		_, err := RetrieveProduct(tx, productID, false)
+
+		if err != nil {
+
+			return err
+		}
+
+		err = checkVariantUnique(tx, variant, 0)
+
+		if err != nil {
+
+			return err
+		}
+
+		err = tx.Create(&variant).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		return touchProduct(tx, uint(productID))
+	})
+
+	if err != nil {
+
+		return ProductVariant{}, err
+	}
+
+	return variant, nil
+}
+
+// RetrieveProductVariant returns a variant of a live product
+func RetrieveProductVariant(products_db *gorm.DB, productID int, variantID uint) (ProductVariant, error) {
+
+	_, err := RetrieveProduct(products_db, productID, false)
+
+	if err != nil {
+
+		return ProductVariant{}, err
+	}
+
+	var variant ProductVariant
+
+	result := products_db.Where("product_id = ?", productID).First(&variant, variantID)
+
+	if result.Error != nil {
+
+		return ProductVariant{}, result.Error
+	}
+
+	available, err := variantAvailability(products_db, variant.ProductID)
+
+	if err != nil {
+
+		return ProductVariant{}, err
+	}
+
+	variant.Available = available[variant.ID]
+
+	return variant, nil
+}
+
+// RetrieveProductVariantBySKU returns the variant of a live product with the SKU, compared once normalized
+func RetrieveProductVariantBySKU(products_db *gorm.DB, sku string) (ProductVariant, error) {
+
+	normalized, err := NormalizeSKU(sku)
+
+	if err != nil {
+
+		return ProductVariant{}, err
+	}
+
+	var variant ProductVariant
+
+	result := products_db.Where("sku = ?", normalized).First(&variant)
+
+	if result.Error != nil {
+
+		return ProductVariant{}, result.Error
+	}
+
+	return RetrieveProductVariant(products_db, int(variant.ProductID), variant.ID)
+}
+
+// RetrieveProductVariants returns the variants of a live product in ID order
+func RetrieveProductVariants(products_db *gorm.DB, productID int) ([]ProductVariant, error) {
+
+	_, err := RetrieveProduct(products_db, productID, false)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	variants := []ProductVariant{}
+
+	result := products_db.Where("product_id = ?", productID).Order("id").Find(&variants)
+
+	if result.Error != nil {
+
+		return nil, result.Error
+	}
+
+	available, err := variantAvailability(products_db, uint(productID))
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	for i := range variants {
+
+		variants[i].Available = available[variants[i].ID]
+	}
+
+	return variants, nil
+}
+
+// UpdateProductVariant replaces the SKU, options and price override of a variant of a live product
+func UpdateProductVariant(products_db *gorm.DB, productID int, variantID uint, spec VariantSpec) error {
+
+	replacement, err := newVariant(uint(productID), spec)
+
+	if err != nil {
+
+		return err
+	}
+
+	return products_db.Transaction(func(tx *gorm.DB) error {
+
+		_, err := RetrieveProductVariant(tx, productID, variantID)
+
+		if err != nil {
+
+			return err
+		}
+
+		err = checkVariantUnique(tx, replacement, variantID)
+
+		if err != nil {
+
+			return err
+		}
+
+		// A map, so that a removed price override is written as NULL
+		err = tx.Model(&ProductVariant{}).Where("id = ?", variantID).Updates(map[string]interface{}{
+			"sku":                  replacement.SKU,
+			"options":              replacement.Options,
+			"options_key":          replacement.OptionsKey,
+			"price_override_minor": replacement.PriceOverride,
+			"updated_at":           time.Now(),
+		}).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		return touchProduct(tx, uint(productID))
+	})
+}
+
+// DeleteProductVariant removes a variant without units on hand or reserved, with its empty stock rows.
+// Its stock movements stay in the ledger.
+func DeleteProductVariant(products_db *gorm.DB, productID int, variantID uint) error {
+
+	return products_db.Transaction(func(tx *gorm.DB) error {
+
+		_, err := RetrieveProductVariant(tx, productID, variantID)
+
+		if err != nil {
+
+			return err
+		}
+
+		_, err = releaseExpiredHolds(tx, uint(productID), time.Now())
+
+		if err != nil {
+
+			return err
+		}
+
+		var stocked int64
+
+		err = tx.Model(&StockLevel{}).Where("product_id = ? AND variant_id = ? AND (on_hand > 0 OR reserved > 0)", productID, variantID).Count(&stocked).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		if stocked > 0 {
+
+			return ErrVariantNotEmpty
+		}
+
+		err = tx.Where("product_id = ? AND variant_id = ?", productID, variantID).Delete(&StockLevel{}).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		err = tx.Where("product_id = ?", productID).Delete(&ProductVariant{}, variantID).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		return touchProduct(tx, uint(productID))
+	})
+}
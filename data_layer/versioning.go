@@ -0,0 +1,102 @@
+package data_layer
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+)
+
+// Every write to a product increments its Version. Updates and deletes may pass the version they
+// last read as expectedVersion and fail with a *VersionConflictError when somebody else wrote in between.
+
+// AnyVersion as expectedVersion writes whatever the stored version is
+const AnyVersion uint = 0
+
+// ErrVersionConflict is matched by errors.Is on every *VersionConflictError
+var ErrVersionConflict = errors.New("product version conflict")
+
+// VersionConflictError reports a write that expected another version of the product than the stored one
+type VersionConflictError struct {
+	ProductID       uint
+	ExpectedVersion uint
+	CurrentVersion  uint
+}
+
+func (err *VersionConflictError) Error() string {
+
+	return fmt.Sprintf("product %d is at version %d, not %d", err.ProductID, err.CurrentVersion, err.ExpectedVersion)
+}
+
+func (err *VersionConflictError) Unwrap() error {
+
+	return ErrVersionConflict
+}
+
+// checkVersion returns a *VersionConflictError unless the product is at expectedVersion
+func checkVersion(product Product, expectedVersion uint) error {
+
+	if expectedVersion == AnyVersion || product.Version == expectedVersion {
+
+		return nil
+	}
+
+	return &VersionConflictError{ProductID: product.ID, ExpectedVersion: expectedVersion, CurrentVersion: product.Version}
+}
+
+// nextVersion is the column expression that bumps the version of the updated rows
+func nextVersion() interface{} {
+
+	return gorm.Expr("version + 1")
+}
+
+// whereVersion narrows a write down to the expected version of the product
+func whereVersion(query *gorm.DB, expectedVersion uint) *gorm.DB {
+
+	if expectedVersion == AnyVersion {
+
+		return query
+	}
+
+	return query.Where("version = ?", expectedVersion)
+}
+
+// updateVersioned applies changes to a live product at expectedVersion and bumps its version
+func updateVersioned(products_db *gorm.DB, id int, expectedVersion uint, changes map[string]interface{}) error {
+
+	changes["version"] = nextVersion()
+
+	result := whereVersion(products_db.Model(&Product{}).Where("id = ?", id), expectedVersion).Updates(changes)
+
+	if result.Error != nil {
+
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+
+		return missedWrite(products_db, id, expectedVersion, false)
+	}
+
+	return nil
+}
+
+// missedWrite explains why a versioned write matched no row: the product is missing or at another version
+func missedWrite(products_db *gorm.DB, id int, expectedVersion uint, includeDeleted bool) error {
+
+	product, err := RetrieveProduct(products_db, id, includeDeleted)
+
+	if err != nil {
+
+		return err
+	}
+
+	err = checkVersion(product, expectedVersion)
+
+	if err != nil {
+
+		return err
+	}
+
+	// The product changed between the write and this read; whatever happened, the write did not apply
+	return &VersionConflictError{ProductID: product.ID, ExpectedVersion: expectedVersion, CurrentVersion: product.Version}
+}
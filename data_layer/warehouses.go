@@ -0,0 +1,274 @@
+package data_layer
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Warehouse is a location holding stock. The first warehouse, by ID, is the default one of the stock
+// operations that do not name a warehouse; the schema and the memory repository start with MainWarehouseCode.
+type Warehouse struct {
+	ID        uint   `gorm:"primarykey"`
+	Code      string `gorm:"size:20;not null;uniqueIndex"`
+	Name      string `gorm:"size:100;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// MainWarehouseCode is the code of the warehouse holding the stock recorded before warehouses existed
+const MainWarehouseCode = "main"
+
+// ProductAvailability is the stock of a product, or of one of its variants when VariantID is not 0, summed over
+// its warehouses, with the stock of every warehouse
+type ProductAvailability struct {
+	ProductID  uint
+	VariantID  uint
+	OnHand     int64
+	Reserved   int64
+	UpdatedAt  time.Time
+	Warehouses []StockLevel
+}
+
+func (availability ProductAvailability) Available() int64 {
+
+	return availability.OnHand - availability.Reserved
+}
+
+// ReasonTransfer is recorded on both sides of a transfer between warehouses
+const ReasonTransfer = "transfer"
+
+var (
+	// ErrDuplicateWarehouse is returned when another warehouse has the same code
+	ErrDuplicateWarehouse = errors.New("a warehouse with the same code already exists")
+
+	// ErrWarehouseNotEmpty is returned when deleting a warehouse that still has units on hand or reserved
+	ErrWarehouseNotEmpty = errors.New("the warehouse still holds stock")
+)
+
+// newAvailability sums the stock levels of a product or variant, given in warehouse order
+func newAvailability(productID uint, variantID uint, levels []StockLevel) ProductAvailability {
+
+	availability := ProductAvailability{ProductID: productID, VariantID: variantID, Warehouses: levels}
+
+	for _, level := range levels {
+
+		availability.OnHand += level.OnHand
+
+		availability.Reserved += level.Reserved
+
+		if level.UpdatedAt.After(availability.UpdatedAt) {
+
+			availability.UpdatedAt = level.UpdatedAt
+		}
+	}
+
+	return availability
+}
+
+// resolveWarehouse checks that the warehouse exists, and picks the default warehouse for 0
+func resolveWarehouse(tx *gorm.DB, warehouseID uint) (uint, error) {
+
+	var warehouse Warehouse
+
+	query := tx.Order("id")
+
+	if warehouseID != 0 {
+
+		query = query.Where("id = ?", warehouseID)
+	}
+
+	result := query.First(&warehouse)
+
+	if result.Error != nil {
+
+		return 0, result.Error
+	}
+
+	return warehouse.ID, nil
+}
+
+// checkWarehouseCode fails with ErrDuplicateWarehouse when another warehouse has the code
+func checkWarehouseCode(tx *gorm.DB, code string, id uint) error {
+
+	var count int64
+
+	err := tx.Model(&Warehouse{}).Where("code = ? AND id <> ?", code, id).Count(&count).Error
+
+	if err != nil {
+
+		return err
+	}
+
+	if count > 0 {
+
+		return ErrDuplicateWarehouse
+	}
+
+	return nil
+}
+
+func CreateWarehouse(products_db *gorm.DB, code string, name string) (Warehouse, error) {
+
+	warehouse := Warehouse{Code: code, Name: name}
+
+	err := products_db.Transaction(func(tx *gorm.DB) error {
+
+		err := checkWarehouseCode(tx, code, 0)
+
+		if err != nil {
+
+			return err
+		}
+
+		return tx.Create(&warehouse).Error
+	})
+
+	if err != nil {
+
+		return Warehouse{}, err
+	}
+
+	return warehouse, nil
+}
+
+func RetrieveWarehouse(products_db *gorm.DB, id uint) (Warehouse, error) {
+
+	var warehouse Warehouse
+
+	result := products_db.First(&warehouse, id)
+
+	if result.Error != nil {
+
+		return Warehouse{}, result.Error
+	}
+
+	return warehouse, nil
+}
+
+// RetrieveWarehouses returns every warehouse in ID order, the default one first
+func RetrieveWarehouses(products_db *gorm.DB) ([]Warehouse, error) {
+
+	warehouses := []Warehouse{}
+
+	result := products_db.Order("id").Find(&warehouses)
+
+	if result.Error != nil {
+
+		return nil, result.Error
+	}
+
+	return warehouses, nil
+}
+
+func UpdateWarehouse(products_db *gorm.DB, id uint, code string, name string) error {
+
+	return products_db.Transaction(func(tx *gorm.DB) error {
+
+		warehouse, err := RetrieveWarehouse(tx, id)
+
+		if err != nil {
+
+			return err
+		}
+
+		err = checkWarehouseCode(tx, code, id)
+
+		if err != nil {
+
+			return err
+		}
+
+		return tx.Model(&warehouse).Updates(Warehouse{Code: code, Name: name}).Error
+	})
+}
+
+// DeleteWarehouse removes a warehouse without units on hand or reserved, with its empty stock rows
+func DeleteWarehouse(products_db *gorm.DB, id uint) error {
+
+	return products_db.Transaction(func(tx *gorm.DB) error {
+
+		_, err := RetrieveWarehouse(tx, id)
+
+		if err != nil {
+
+			return err
+		}
+
+		var stocked int64
+
+		err = tx.Model(&StockLevel{}).Where("warehouse_id = ? AND (on_hand > 0 OR reserved > 0)", id).Count(&stocked).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		if stocked > 0 {
+
+			return ErrWarehouseNotEmpty
+		}
+
+		err = tx.Where("warehouse_id = ?", id).Delete(&StockLevel{}).Error
+
+		if err != nil {
+
+			return err
+		}
+
+		return tx.Delete(&Warehouse{}, id).Error
+	})
+}
+
+// TransferStock moves available units of a live product or variant from one warehouse to another, in one transaction.
+// Held units stay where they are: the transfer fails with ErrInsufficientStock rather than touch them.
+func TransferStock(products_db *gorm.DB, productID int, variantID uint, fromWarehouseID uint, toWarehouseID uint, quantity int64) (ProductAvailability, error) {
+
+	if quantity <= 0 || fromWarehouseID == toWarehouseID {
+
+		return ProductAvailability{}, ErrInvalidStockChange
+	}
+
+	err := products_db.Transaction(func(tx *gorm.DB) error {
+
+		err := retrieveStockItem(tx, productID, variantID)
+
+		if err != nil {
+
+			return err
+		}
+
+		for _, warehouseID := range []uint{fromWarehouseID, toWarehouseID} {
+
+			_, err = RetrieveWarehouse(tx, warehouseID)
+
+			if err != nil {
+
+				return err
+			}
+		}
+
+		_, err = releaseExpiredHolds(tx, uint(productID), time.Now())
+
+		if err != nil {
+
+			return err
+		}
+
+		err = addStock(tx, uint(productID), variantID, fromWarehouseID, -quantity, ReasonTransfer)
+
+		if err != nil {
+
+			return err
+		}
+
+		return addStock(tx, uint(productID), variantID, toWarehouseID, quantity, ReasonTransfer)
+	})
+
+	if err != nil {
+
+		return ProductAvailability{}, err
+	}
+
+	return RetrieveStock(products_db, productID, variantID)
+}
@@ -1,19 +1,23 @@
 #!/bin/bash
 
-# Base URL for the insert product endpoint
-BASE_URL="http://localhost:8000/insert-product"
+# Base URL for the bulk insert endpoint
+BASE_URL="http://localhost:8000/v1/products/bulk"
+
+# Build one NDJSON line per product: 30 products in a single request
+PRODUCTS=""
 
-# Loop to insert 30 products
 for i in {1..30}
 do
   # Define the product name and price
   PRODUCT_NAME="Laptop_$i"
   PRODUCT_PRICE=$((1500 + i * 10))
 
-  # Make the HTTP POST request to insert the product
-  curl -X POST "$BASE_URL" \
-    -H "Content-Type: application/json" \
-    -d "{\"name\": \"$PRODUCT_NAME\", \"price\": $PRODUCT_PRICE}"
-  
-  echo "Inserted: $PRODUCT_NAME with price $PRODUCT_PRICE"
+  PRODUCTS+="{\"name\": \"$PRODUCT_NAME\", \"price\": $PRODUCT_PRICE}"$'\n'
 done
+
+# Insert them all in one transaction, and print the per-product results
+curl -X POST "$BASE_URL" \
+  -H "Content-Type: application/x-ndjson" \
+  --data-binary "$PRODUCTS"
+
+echo
@@ -1,28 +1,376 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 	"simpler-go-home-test/api"
+	"simpler-go-home-test/data_layer"
 )
 
 func main() {
 
+	// Environment variables provide the defaults, command line flags take precedence
+	store_config := data_layer.StoreConfigFromEnv()
+
+	flag.StringVar(&store_config.Driver, "db-driver", store_config.Driver, "database driver: sqlite, postgres or mysql")
+
+	flag.StringVar(&store_config.DSN, "db-dsn", store_config.DSN, "data source name of the products database (required for postgres and mysql)")
+
+	flag.StringVar(&store_config.Path, "db-path", store_config.Path, "path of the SQLite products database")
+
+	flag.IntVar(&store_config.MaxOpenConns, "db-max-open-conns", store_config.MaxOpenConns, "maximum number of open database connections")
+
+	flag.IntVar(&store_config.MaxIdleConns, "db-max-idle-conns", store_config.MaxIdleConns, "maximum number of idle database connections")
+
+	flag.DurationVar(&store_config.ConnMaxLifetime, "db-conn-max-lifetime", store_config.ConnMaxLifetime, "maximum time a database connection may be reused")
+
+	flag.DurationVar(&store_config.ConnMaxIdleTime, "db-conn-max-idle-time", store_config.ConnMaxIdleTime, "maximum time a database connection may stay idle")
+
+	flag.DurationVar(&store_config.BusyTimeout, "db-busy-timeout", store_config.BusyTimeout, "how long SQLite waits on a locked database before failing")
+
+	rounding_spec := os.Getenv("PRODUCTS_CURRENCY_ROUNDING")
+
+	flag.StringVar(&rounding_spec, "currency-rounding", rounding_spec, "rounding of converted prices per currency, e.g. \"JPY=1:half_up,CHF=0.05\"")
+
+	legacy_sunset_spec := os.Getenv("PRODUCTS_LEGACY_ROUTES_SUNSET")
+
+	if legacy_sunset_spec == "" {
+
+		legacy_sunset_spec = api.DefaultLegacyRoutesSunset.Format(time.DateOnly)
+	}
+
+	flag.StringVar(&legacy_sunset_spec, "legacy-routes-sunset", legacy_sunset_spec, "date (YYYY-MM-DD) announced in the Sunset header of the deprecated verb-style routes")
+
+	hold_sweep_interval := api.DefaultHoldSweepInterval
+
+	flag.DurationVar(&hold_sweep_interval, "hold-sweep-interval", hold_sweep_interval, "how often expired stock reservations are released")
+
+	schedule_interval := api.DefaultScheduleInterval
+
+	flag.DurationVar(&schedule_interval, "schedule-interval", schedule_interval, "how often products due for publishing or unpublishing change status")
+
+	flag.Usage = func() {
+
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [migrate up|down [steps]|status | import [-key name|id|sku] [-map FIELD=COLUMN,...] [-delimiter ,] FILE]\n", os.Args[0])
+
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	rounding_rules, err := data_layer.ParseRoundingRules(rounding_spec)
+
+	if err != nil {
+
+		log.Fatalf("Invalid currency rounding rules: %v", err)
+	}
+
+	legacy_sunset, err := time.Parse(time.DateOnly, legacy_sunset_spec)
+
+	if err != nil {
+
+		log.Fatalf("Invalid legacy routes sunset date: %v", err)
+	}
+
+	products_db, err := data_layer.OpenProductsDB(store_config)
+
+	if err != nil {
+
+		log.Fatalf("Failed to open the products database: %v", err)
+	}
+
+	if flag.Arg(0) == "migrate" {
+
+		err = migrate(products_db, flag.Args()[1:])
+
+		data_layer.CloseProductsDB(products_db)
+
+		if err != nil {
+
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	// Refuse to serve requests on an outdated schema
+	err = data_layer.CheckSchemaUpToDate(products_db)
+
+	if errors.Is(err, data_layer.ErrSchemaBehind) {
+
+		log.Fatalf("%v: run \"%s\"", err, migrateUpCommand(products_db))
+	}
+
+	if err != nil {
+
+		log.Fatalf("Refusing to serve the products database: %v", err)
+	}
+
+	if flag.Arg(0) == "import" {
+
+		err = importProducts(products_db, flag.Args()[1:])
+
+		data_layer.CloseProductsDB(products_db)
+
+		if err != nil {
+
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	handlers := api.NewProductsAPI(data_layer.NewGormProductRepository(products_db), rounding_rules)
+
 	products_api := fiber.New()
 
-	products_api.Post("/insert-product", api.InsertProduct)
+	handlers.RegisterRoutes(products_api, legacy_sunset)
+
+	if hold_sweep_interval <= 0 {
+
+		log.Fatalf("Invalid hold sweep interval %v: must be positive", hold_sweep_interval)
+	}
+
+	if schedule_interval <= 0 {
+
+		log.Fatalf("Invalid schedule interval %v: must be positive", schedule_interval)
+	}
+
+	stop_background_jobs := make(chan struct{})
+
+	go handlers.ReleaseExpiredStockHoldsEvery(hold_sweep_interval, stop_background_jobs)
 
-	products_api.Delete("/delete-product/:id", api.DeleteProduct)
+	go handlers.ApplyProductSchedulesEvery(schedule_interval, stop_background_jobs)
 
-	products_api.Put("/update-product-name", api.UpdateProductName)
+	// Stop accepting requests on SIGINT/SIGTERM so the database can be closed cleanly
+	go func() {
 
-	products_api.Put("/update-product-price", api.UpdateProductPrice)
-	
-	products_api.Get("/retrieve-product/:id", api.RetrieveProduct)
+		signals := make(chan os.Signal, 1)
+
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+		<-signals
+
+		log.Println("Shutting down the Products API")
+
+		products_api.Shutdown()
+	}()
 
-	products_api.Get("/retrieve-products", api.RetrieveProductsWithPagination)
-	
 	log.Println("Products API is running on port 8000")
-	
-	log.Fatal(products_api.Listen(":8000"))
-}
\ No newline at end of file
+
+	err = products_api.Listen(":8000")
+
+	if err != nil {
+
+		log.Printf("Products API stopped: %v", err)
+	}
+
+	close(stop_background_jobs)
+
+	err = data_layer.CloseProductsDB(products_db)
+
+	if err != nil {
+
+		log.Fatalf("Failed to close the products database: %v", err)
+	}
+}
+
+// migrateUpCommand is the command applying the pending migrations: on SQLite, only a build with FTS5 applies them all
+func migrateUpCommand(products_db *gorm.DB) string {
+
+	if products_db.Dialector.Name() == data_layer.DriverSQLite {
+
+		return "go run -tags sqlite_fts5 run.go migrate up"
+	}
+
+	return "go run run.go migrate up"
+}
+
+// migrate implements the "migrate up", "migrate down [steps]" and "migrate status" commands
+func migrate(products_db *gorm.DB, args []string) error {
+
+	if len(args) == 0 {
+
+		return fmt.Errorf("missing migrate command: expected up, down or status")
+	}
+
+	switch args[0] {
+
+	case "up":
+
+		applied, err := data_layer.MigrateUp(products_db)
+
+		for _, migration := range applied {
+
+			log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+		}
+
+		if err != nil {
+
+			return err
+		}
+
+		states, err := data_layer.MigrationStatus(products_db)
+
+		if err != nil {
+
+			return err
+		}
+
+		for _, state := range states {
+
+			if state.Deferred {
+
+				log.Printf("Migration %04d_%s stays pending: this build cannot apply it, see \"migrate status\"", state.Version, state.Name)
+			}
+		}
+
+		if len(applied) == 0 {
+
+			log.Println("The products database schema is already up to date")
+		}
+
+		return nil
+
+	case "down":
+
+		steps := 1
+
+		if len(args) > 1 {
+
+			parsed, err := strconv.Atoi(args[1])
+
+			if err != nil || parsed <= 0 {
+
+				return fmt.Errorf("invalid number of steps %q: must be a positive integer", args[1])
+			}
+
+			steps = parsed
+		}
+
+		reverted, err := data_layer.MigrateDown(products_db, steps)
+
+		for _, migration := range reverted {
+
+			log.Printf("Reverted migration %04d_%s", migration.Version, migration.Name)
+		}
+
+		return err
+
+	case "status":
+
+		states, err := data_layer.MigrationStatus(products_db)
+
+		if err != nil {
+
+			return err
+		}
+
+		for _, state := range states {
+
+			if state.Applied {
+
+				fmt.Printf("%04d_%-40s applied at %s\n", state.Version, state.Name, state.AppliedAt.Format(time.RFC3339))
+
+			} else if state.Deferred {
+
+				fmt.Printf("%04d_%-40s pending, this build cannot apply it\n", state.Version, state.Name)
+
+			} else {
+
+				fmt.Printf("%04d_%-40s pending\n", state.Version, state.Name)
+			}
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown migrate command %q: expected up, down or status", args[0])
+}
+
+// importProducts implements the "import [flags] FILE" command: it imports a CSV file like POST /v1/products/import
+// and prints the report as JSON. It fails when the file cannot be imported or some of its rows were rejected.
+func importProducts(products_db *gorm.DB, args []string) error {
+
+	import_flags := flag.NewFlagSet("import", flag.ContinueOnError)
+
+	key := import_flags.String("key", api.ImportKeyName, "field the rows are upserted by: name, id or sku")
+
+	mapping_spec := import_flags.String("map", "", "columns of the product fields, e.g. \"name=Product Title,price=Cost\"")
+
+	delimiter_spec := import_flags.String("delimiter", ",", "column separator, a single character or \"tab\"")
+
+	err := import_flags.Parse(args)
+
+	if err != nil {
+
+		return err
+	}
+
+	if import_flags.NArg() != 1 {
+
+		return fmt.Errorf("expected the path of one CSV file to import")
+	}
+
+	options := api.CSVImportOptions{Key: *key}
+
+	options.Mapping, err = api.ParseColumnMapping(*mapping_spec)
+
+	if err != nil {
+
+		return err
+	}
+
+	options.Delimiter, err = api.ParseDelimiter(*delimiter_spec)
+
+	if err != nil {
+
+		return err
+	}
+
+	file, err := os.Open(import_flags.Arg(0))
+
+	if err != nil {
+
+		return err
+	}
+
+	defer file.Close()
+
+	report, err := api.ImportProductsCSV(data_layer.NewGormProductRepository(products_db), file, options)
+
+	if err != nil {
+
+		return fmt.Errorf("cannot import %s: %v", import_flags.Arg(0), err)
+	}
+
+	output := json.NewEncoder(os.Stdout)
+
+	output.SetIndent("", "  ")
+
+	err = output.Encode(report)
+
+	if err != nil {
+
+		return err
+	}
+
+	log.Printf("Imported %s: %d accepted, %d updated, %d unchanged, %d rejected", import_flags.Arg(0), report.Accepted, report.Updated, report.Unchanged, report.Rejected)
+
+	if report.Rejected > 0 {
+
+		return fmt.Errorf("%d rows were rejected", report.Rejected)
+	}
+
+	return nil
+}
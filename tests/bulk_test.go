@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"simpler-go-home-test/data_layer"
+	"strings"
+	"testing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sendBody sends a raw body with the given content type
+func sendBody(t *testing.T, app *fiber.App, method string, path string, contentType string, body string) (*http.Response, map[string]interface{}) {
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	resp, err := app.Test(req, -1)
+
+	require.NoError(t, err)
+
+	responseBody, _ := io.ReadAll(resp.Body)
+
+	var responseData map[string]interface{}
+	_ = json.Unmarshal(responseBody, &responseData)
+
+	return resp, responseData
+}
+
+func bulkStatuses(responseData map[string]interface{}) []string {
+
+	var statuses []string
+
+	for _, result := range responseData["results"].([]interface{}) {
+		statuses = append(statuses, result.(map[string]interface{})["status"].(string))
+	}
+
+	return statuses
+}
+
+func TestBulkInsert_AllOrNothing(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	// Act - One invalid product keeps the whole batch out
+	resp, responseData := sendBody(t, app, http.MethodPost, "/v1/products/bulk", "application/json",
+		`[{"name": "Bulk_Laptop", "price": "1500.50"}, {"name": "", "price": 10}, {"name": "Bulk_Phone", "price": 800, "currency": "usd"}]`)
+
+	// Assert
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, []string{"skipped", "rejected", "skipped"}, bulkStatuses(responseData))
+	assert.Contains(t, responseData["results"].([]interface{})[1].(map[string]interface{})["error"], "Invalid product data for insertion")
+
+	total, _ := products.GetTotalNumberOfProducts(data_layer.ProductFilter{})
+	assert.Equal(t, int64(0), total)
+
+	// Act - All valid
+	resp, responseData = sendBody(t, app, http.MethodPost, "/v1/products/bulk", "application/json",
+		`[{"name": "Bulk_Laptop", "price": "1500.50"}, {"name": "Bulk_Phone", "price": 800, "currency": "usd"}]`)
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(2), responseData["inserted"])
+
+	phoneID := responseData["results"].([]interface{})[1].(map[string]interface{})["product_id"].(float64)
+
+	phone, err := products.RetrieveProduct(int(phoneID), false)
+
+	require.NoError(t, err)
+	assert.Equal(t, "Bulk_Phone", phone.Name)
+	assert.Equal(t, "USD", phone.Currency)
+}
+
+func TestBulkInsert_BestEffortNDJSON(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	body := `{"name": "Bulk_Mouse", "price": 25}
+{"name": "Bulk_Broken", "price":
+
+{"name": "Bulk_Free", "price": 0}
+{"name": "Bulk_Screen", "price": "199.99", "currency": "GBP"}
+`
+
+	// Act
+	resp, responseData := sendBody(t, app, http.MethodPost, "/v1/products/bulk?mode=best_effort", "application/x-ndjson", body)
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"inserted", "rejected", "rejected", "inserted"}, bulkStatuses(responseData))
+	assert.Equal(t, float64(2), responseData["inserted"])
+	assert.Equal(t, float64(2), responseData["rejected"])
+	assert.Contains(t, responseData["results"].([]interface{})[1].(map[string]interface{})["error"], "Cannot parse JSON")
+
+	total, _ := products.GetTotalNumberOfProducts(data_layer.ProductFilter{})
+	assert.Equal(t, int64(2), total)
+}
+
+func TestBulkInsert_InvalidRequests(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	app := SetupAppWithRepository(data_layer.NewMemoryProductRepository())
+
+	// Act & Assert
+	resp, _ := sendBody(t, app, http.MethodPost, "/v1/products/bulk", "text/csv", "name,price")
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	resp, _ = sendBody(t, app, http.MethodPost, "/v1/products/bulk", "application/json", `{"name": "Not_An_Array"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = sendBody(t, app, http.MethodPost, "/v1/products/bulk", "application/json", `[]`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = sendBody(t, app, http.MethodPost, "/v1/products/bulk?mode=sometimes", "application/json", `[{"name": "Bulk_X", "price": 1}]`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCategories_CRUDAndTree(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	laptopID, _ := products.InsertProduct("Category_Laptop", data_layer.MustParseAmount("1500"), "EUR")
+	phoneID, _ := products.InsertProduct("Category_Phone", data_layer.MustParseAmount("800"), "EUR")
+
+	// Act - Create a root and a child
+	resp, electronics := sendJSON(t, app, http.MethodPost, "/v1/categories", map[string]interface{}{"name": "Electronics"})
+
+	// Assert
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, fmt.Sprintf("/v1/categories/%v", electronics["id"]), resp.Header.Get("Location"))
+	assert.Nil(t, electronics["parent_id"])
+
+	resp, computers := sendJSON(t, app, http.MethodPost, "/v1/categories", map[string]interface{}{"name": "Computers", "parent_id": electronics["id"]})
+
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, electronics["id"], computers["parent_id"])
+
+	computersPath := fmt.Sprintf("/v1/categories/%v", computers["id"])
+
+	// Act - Assign products
+	resp, _ = sendJSON(t, app, http.MethodPut, fmt.Sprintf("/v1/products/%d/categories/%v", laptopID, computers["id"]), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = sendJSON(t, app, http.MethodPut, fmt.Sprintf("/v1/products/%d/categories/%v", phoneID, electronics["id"]), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Assert - Product categories and list filter
+	resp, responseData := sendRequest(t, app, http.MethodGet, fmt.Sprintf("/v1/products/%d/categories", laptopID))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, responseData["categories"], 1)
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, fmt.Sprintf("/v1/products?category=%v", electronics["id"]))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(1), responseData["metadata"].(map[string]interface{})["total_number_of_products"])
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, fmt.Sprintf("/v1/products?category=%v&include_subcategories=true", electronics["id"]))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(2), responseData["metadata"].(map[string]interface{})["total_number_of_products"])
+
+	// Act - Tree
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/categories/tree")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	roots := responseData["categories"].([]interface{})
+	require.Len(t, roots, 1)
+
+	root := roots[0].(map[string]interface{})
+	assert.Equal(t, "Electronics", root["name"])
+	assert.Equal(t, float64(1), root["product_count"])
+	assert.Equal(t, float64(2), root["total_product_count"])
+
+	children := root["children"].([]interface{})
+	require.Len(t, children, 1)
+	assert.Equal(t, float64(1), children[0].(map[string]interface{})["total_product_count"])
+
+	// Act - Move to the root and rename
+	resp, responseData = sendJSON(t, app, http.MethodPut, computersPath, map[string]interface{}{"name": "Computing", "parent_id": nil})
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Computing", responseData["name"])
+	assert.Nil(t, responseData["parent_id"])
+
+	// Act - Unassign and delete
+	resp, _ = sendRequest(t, app, http.MethodDelete, fmt.Sprintf("/v1/products/%d/categories/%v", laptopID, computers["id"]))
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = sendRequest(t, app, http.MethodDelete, computersPath)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = sendRequest(t, app, http.MethodGet, computersPath)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestCategories_Errors(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	parent, _ := products.CreateCategory("Parent", nil)
+	child, _ := products.CreateCategory("Child", &parent.ID)
+	productID, _ := products.InsertProduct("Category_Laptop", data_layer.MustParseAmount("1500"), "EUR")
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		payload interface{}
+		status  int
+	}{
+		{"empty name", http.MethodPost, "/v1/categories", map[string]interface{}{"name": " "}, http.StatusBadRequest},
+		{"missing parent", http.MethodPost, "/v1/categories", map[string]interface{}{"name": "Orphan", "parent_id": 999}, http.StatusNotFound},
+		{"duplicate sibling", http.MethodPost, "/v1/categories", map[string]interface{}{"name": "Child", "parent_id": parent.ID}, http.StatusConflict},
+		{"cycle", http.MethodPut, fmt.Sprintf("/v1/categories/%d", parent.ID), map[string]interface{}{"name": "Parent", "parent_id": child.ID}, http.StatusConflict},
+		{"not empty", http.MethodDelete, fmt.Sprintf("/v1/categories/%d", parent.ID), nil, http.StatusConflict},
+		{"invalid ID", http.MethodGet, "/v1/categories/abc", nil, http.StatusBadRequest},
+		{"missing category", http.MethodPut, fmt.Sprintf("/v1/products/%d/categories/999", productID), nil, http.StatusNotFound},
+		{"missing product", http.MethodGet, "/v1/products/999/categories", nil, http.StatusNotFound},
+		{"not assigned", http.MethodDelete, fmt.Sprintf("/v1/products/%d/categories/%d", productID, child.ID), nil, http.StatusNotFound},
+		{"invalid category filter", http.MethodGet, "/v1/products?category=abc", nil, http.StatusBadRequest},
+	}
+
+	for _, testCase := range cases {
+
+		// Act
+		resp, _ := sendJSON(t, app, testCase.method, testCase.path, testCase.payload)
+
+		// Assert
+		assert.Equal(t, testCase.status, resp.StatusCode, testCase.name)
+	}
+}
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetrieveProduct_ETag(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Tagged_Laptop", data_layer.MustParseAmount("999"), "EUR")
+
+	// Act
+	resp, responseData := sendRequest(t, app, http.MethodGet, fmt.Sprintf("/retrieve-product/%d", productID))
+
+	// Assert
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"1"`, resp.Header.Get("ETag"))
+	assert.Equal(t, float64(1), responseData["version"])
+
+	products.UpdateProductName(int(productID), "Tagged_Laptop_Renamed", data_layer.AnyVersion)
+
+	resp, _ = sendRequest(t, app, http.MethodGet, fmt.Sprintf("/retrieve-product/%d", productID))
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+}
+
+func TestUpdateProductName_IfMatch(t *testing.T) {
+	t.Parallel()
+
+	// Arrange - Two tools read version 1, the first one writes
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Contended_Phone", data_layer.MustParseAmount("300"), "EUR")
+
+	update := func(name string, ifMatch string) *http.Response {
+		body, _ := json.Marshal(map[string]interface{}{"id": productID, "name": name})
+		req := httptest.NewRequest(http.MethodPut, "/update-product-name", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		resp, err := app.Test(req, -1)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := update("Contended_Phone_First", `"1"`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Act - The second tool still holds version 1
+	resp = update("Contended_Phone_Second", `"1"`)
+
+	// Assert - Its write is refused instead of clobbering the first one
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+
+	product, _ := products.RetrieveProduct(int(productID), false)
+	assert.Equal(t, "Contended_Phone_First", product.Name)
+
+	// A wildcard or a missing header writes unconditionally, a malformed one is rejected
+	assert.Equal(t, http.StatusOK, update("Contended_Phone_Any", "*").StatusCode)
+	assert.Equal(t, http.StatusOK, update("Contended_Phone_Blind", "").StatusCode)
+	assert.Equal(t, http.StatusBadRequest, update("Contended_Phone_Weak", `W/"4"`).StatusCode)
+}
+
+func TestUpdateProductPrice_IfMatch(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Contended_Tablet", data_layer.MustParseAmount("400"), "EUR")
+
+	body, _ := json.Marshal(map[string]interface{}{"id": productID, "price": "420"})
+
+	// Act
+	req := httptest.NewRequest(http.MethodPut, "/update-product-price", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"7"`)
+	resp, _ := app.Test(req, -1)
+
+	// Assert
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	product, _ := products.RetrieveProduct(int(productID), false)
+	assert.Equal(t, data_layer.MustParseAmount("400"), product.Price)
+}
+
+func TestDeleteProduct_IfMatch(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Contended_Monitor", data_layer.MustParseAmount("250"), "EUR")
+	products.UpdateProductPrice(int(productID), data_layer.MustParseAmount("260"), data_layer.AnyVersion)
+
+	deleteWith := func(ifMatch string) *http.Response {
+		req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/delete-product/%d", productID), nil)
+		req.Header.Set("If-Match", ifMatch)
+		resp, err := app.Test(req, -1)
+		require.NoError(t, err)
+		return resp
+	}
+
+	// Act & Assert
+	assert.Equal(t, http.StatusPreconditionFailed, deleteWith(`"1"`).StatusCode)
+	assert.Equal(t, http.StatusOK, deleteWith(`"2"`).StatusCode)
+}
@@ -0,0 +1,2309 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"simpler-go-home-test/data_layer"
+	"sync"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// The conformance suite runs every data_layer operation against the in-memory repository and against
+// the GORM repository on the configured backend. The backend is chosen with PRODUCTS_TEST_DB_DRIVER and
+// PRODUCTS_TEST_DB_DSN (a fresh SQLite file is used when they are not set), for example:
+//
+//	PRODUCTS_TEST_DB_DRIVER=postgres PRODUCTS_TEST_DB_DSN="host=localhost user=postgres password=postgres dbname=products sslmode=disable" go test ./tests -run Conformance
+
+type conformanceBackend struct {
+	name string
+	open func(t *testing.T) data_layer.Repository
+}
+
+type conformanceCase struct {
+	name string
+	run  func(t *testing.T, products data_layer.Repository)
+}
+
+func conformanceBackends() []conformanceBackend {
+
+	return []conformanceBackend{
+		{name: "memory", open: func(t *testing.T) data_layer.Repository { return data_layer.NewMemoryProductRepository() }},
+		{name: "gorm", open: openConformanceRepository},
+	}
+}
+
+// openConformanceRepository opens the configured test database and leaves it empty for the next case
+func openConformanceRepository(t *testing.T) data_layer.Repository {
+
+	config := data_layer.DefaultStoreConfig()
+
+	config.Driver = os.Getenv("PRODUCTS_TEST_DB_DRIVER")
+
+	config.DSN = os.Getenv("PRODUCTS_TEST_DB_DSN")
+
+	if config.Driver == "" {
+		config.Driver = data_layer.DriverSQLite
+		config.Path = filepath.Join(t.TempDir(), "conformance.db")
+	}
+
+	products_db, err := data_layer.OpenProductsDB(config)
+
+	require.NoError(t, err)
+
+	_, err = data_layer.MigrateUp(products_db)
+
+	require.NoError(t, err)
+
+	truncate := func() {
+		for _, model := range []interface{}{&data_layer.ProductPrice{}, &data_layer.ExchangeRate{}, &data_layer.ProductCategory{}, &data_layer.Category{}, &data_layer.ProductTag{}, &data_layer.Tag{}, &data_layer.StockHold{}, &data_layer.StockMovement{}, &data_layer.StockLevel{}, &data_layer.ProductVariant{}, &data_layer.Product{}} {
+			products_db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(model)
+		}
+		products_db.Where("code <> ?", data_layer.MainWarehouseCode).Delete(&data_layer.Warehouse{})
+	}
+
+	truncate()
+
+	t.Cleanup(func() {
+		truncate()
+		data_layer.CloseProductsDB(products_db)
+	})
+
+	return data_layer.NewGormProductRepository(products_db)
+}
+
+func conformanceCases() []conformanceCase {
+
+	return []conformanceCase{
+		{name: "InsertAndRetrieveProduct", run: conformanceInsertAndRetrieveProduct},
+		{name: "InsertProducts", run: conformanceInsertProducts},
+		{name: "RetrieveMissingProduct", run: conformanceRetrieveMissingProduct},
+		{name: "UpdateProductName", run: conformanceUpdateProductName},
+		{name: "UpdateProductPrice", run: conformanceUpdateProductPrice},
+		{name: "UpdateMissingProduct", run: conformanceUpdateMissingProduct},
+		{name: "DeleteProduct", run: conformanceDeleteProduct},
+		{name: "PaginationAndTotal", run: conformancePaginationAndTotal},
+		{name: "FilterProducts", run: conformanceFilterProducts},
+		{name: "SortProducts", run: conformanceSortProducts},
+		{name: "ApplyPriceRule", run: conformanceApplyPriceRule},
+		{name: "CursorPagination", run: conformanceCursorPagination},
+		{name: "StreamProducts", run: conformanceStreamProducts},
+		{name: "SearchProducts", run: conformanceSearchProducts},
+		{name: "SuggestProducts", run: conformanceSuggestProducts},
+		{name: "RestoreProduct", run: conformanceRestoreProduct},
+		{name: "PurgeProduct", run: conformancePurgeProduct},
+		{name: "DeletedProductFilters", run: conformanceDeletedProductFilters},
+		{name: "PurgeDeletedProducts", run: conformancePurgeDeletedProducts},
+		{name: "ProductPrices", run: conformanceProductPrices},
+		{name: "OptimisticConcurrency", run: conformanceOptimisticConcurrency},
+		{name: "UpdateProductFields", run: conformanceUpdateProductFields},
+		{name: "ExchangeRates", run: conformanceExchangeRates},
+		{name: "Categories", run: conformanceCategories},
+		{name: "ProductCategories", run: conformanceProductCategories},
+		{name: "ProductTags", run: conformanceProductTags},
+		{name: "StockAdjustments", run: conformanceStockAdjustments},
+		{name: "StockHolds", run: conformanceStockHolds},
+		{name: "ConcurrentReservations", run: conformanceConcurrentReservations},
+		{name: "Warehouses", run: conformanceWarehouses},
+		{name: "StockTransfers", run: conformanceStockTransfers},
+		{name: "StockFilters", run: conformanceStockFilters},
+		{name: "ProductVariants", run: conformanceProductVariants},
+		{name: "VariantStock", run: conformanceVariantStock},
+		{name: "ProductIdentifiers", run: conformanceProductIdentifiers},
+		{name: "SKUNamespace", run: conformanceSKUNamespace},
+		{name: "ProductLifecycle", run: conformanceProductLifecycle},
+		{name: "LifecycleSearch", run: conformanceLifecycleSearch},
+		{name: "LifecycleCounts", run: conformanceLifecycleCounts},
+	}
+}
+
+func TestRepositoryConformance(t *testing.T) {
+
+	for _, backend := range conformanceBackends() {
+
+		t.Run(backend.name, func(t *testing.T) {
+
+			for _, testCase := range conformanceCases() {
+
+				t.Run(testCase.name, func(t *testing.T) {
+					testCase.run(t, backend.open(t))
+				})
+			}
+		})
+	}
+}
+
+func conformanceInsertAndRetrieveProduct(t *testing.T, products data_layer.Repository) {
+
+	productID, err := products.InsertProduct("Conformance_Laptop", data_layer.MustParseAmount("1999.99"), "EUR")
+
+	require.NoError(t, err)
+	assert.NotZero(t, productID)
+
+	product, err := products.RetrieveProduct(int(productID), false)
+
+	require.NoError(t, err)
+	assert.Equal(t, productID, product.ID)
+	assert.Equal(t, "Conformance_Laptop", product.Name)
+	assert.Equal(t, data_layer.MustParseAmount("1999.99"), product.Price)
+	assert.Equal(t, "EUR", product.Currency)
+	assert.False(t, product.CreatedAt.IsZero())
+	assert.False(t, product.UpdatedAt.IsZero())
+}
+
+func conformanceInsertProducts(t *testing.T, products data_layer.Repository) {
+
+	var batch []data_layer.Product
+
+	for i := 0; i < data_layer.InsertBatchSize+5; i++ {
+		batch = append(batch, data_layer.Product{Name: fmt.Sprintf("Bulk_%03d", i), Price: data_layer.Amount(100 + i), Currency: "EUR"})
+	}
+
+	ids, err := products.InsertProducts(batch)
+
+	require.NoError(t, err)
+	require.Len(t, ids, len(batch))
+
+	for i, productID := range ids {
+
+		product, err := products.RetrieveProduct(int(productID), false)
+
+		require.NoError(t, err)
+		assert.Equal(t, batch[i].Name, product.Name)
+		assert.Equal(t, batch[i].Price, product.Price)
+		assert.Equal(t, uint(1), product.Version)
+	}
+
+	total, err := products.GetTotalNumberOfProducts(data_layer.ProductFilter{})
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(batch)), total)
+
+	suggestions, err := products.SuggestProducts("bulk_104", nil, 0, 10)
+
+	require.NoError(t, err)
+	require.Len(t, suggestions, 1)
+	assert.Equal(t, ids[104], suggestions[0].ProductID)
+}
+
+func conformanceRetrieveMissingProduct(t *testing.T, products data_layer.Repository) {
+
+	_, err := products.RetrieveProduct(999999, false)
+
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func conformanceUpdateProductName(t *testing.T, products data_layer.Repository) {
+
+	productID, _ := products.InsertProduct("Conformance_Phone", data_layer.MustParseAmount("300"), "EUR")
+
+	require.NoError(t, products.UpdateProductName(int(productID), "Conformance_Phone_Renamed", data_layer.AnyVersion))
+
+	product, err := products.RetrieveProduct(int(productID), false)
+
+	require.NoError(t, err)
+	assert.Equal(t, "Conformance_Phone_Renamed", product.Name)
+	assert.Equal(t, data_layer.MustParseAmount("300"), product.Price)
+}
+
+func conformanceUpdateProductPrice(t *testing.T, products data_layer.Repository) {
+
+	productID, _ := products.InsertProduct("Conformance_Tablet", data_layer.MustParseAmount("450"), "USD")
+
+	require.NoError(t, products.UpdateProductPrice(int(productID), data_layer.MustParseAmount("475.50"), data_layer.AnyVersion))
+
+	product, err := products.RetrieveProduct(int(productID), false)
+
+	require.NoError(t, err)
+	assert.Equal(t, "Conformance_Tablet", product.Name)
+	assert.Equal(t, data_layer.MustParseAmount("475.50"), product.Price)
+	assert.Equal(t, "USD", product.Currency)
+}
+
+func conformanceUpdateMissingProduct(t *testing.T, products data_layer.Repository) {
+
+	assert.True(t, errors.Is(products.UpdateProductName(999999, "Missing", data_layer.AnyVersion), gorm.ErrRecordNotFound))
+
+	assert.True(t, errors.Is(products.UpdateProductPrice(999999, data_layer.MustParseAmount("10"), data_layer.AnyVersion), gorm.ErrRecordNotFound))
+}
+
+func conformanceDeleteProduct(t *testing.T, products data_layer.Repository) {
+
+	productID, _ := products.InsertProduct("Conformance_Monitor", data_layer.MustParseAmount("250"), "EUR")
+
+	require.NoError(t, products.DeleteProduct(int(productID), data_layer.AnyVersion))
+
+	_, err := products.RetrieveProduct(int(productID), false)
+
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	assert.True(t, errors.Is(products.DeleteProduct(int(productID), data_layer.AnyVersion), gorm.ErrRecordNotFound))
+
+	// The soft-deleted product is still there for whoever asks for it
+	product, err := products.RetrieveProduct(int(productID), true)
+
+	require.NoError(t, err)
+	assert.True(t, product.DeletedAt.Valid)
+	assert.Equal(t, "Conformance_Monitor", product.Name)
+
+	// Deleted products cannot be modified
+	assert.True(t, errors.Is(products.UpdateProductName(int(productID), "Ghost", data_layer.AnyVersion), gorm.ErrRecordNotFound))
+	assert.True(t, errors.Is(products.SetProductPrice(int(productID), "USD", 100), gorm.ErrRecordNotFound))
+}
+
+func conformanceCursorPagination(t *testing.T, products data_layer.Repository) {
+
+	for _, name := range []string{"Cursor_D", "Cursor_B", "Cursor_A", "Cursor_C", "Cursor_B"} {
+		products.InsertProduct(name, data_layer.MustParseAmount("100"), "EUR")
+	}
+
+	filter := data_layer.ProductFilter{NamePrefix: "Cursor_"}
+
+	for _, spec := range []string{"-price,name", "created_at", "-updated_at,-id"} {
+
+		productSort, err := data_layer.ParseProductSort(spec)
+
+		require.NoError(t, err)
+
+		expected, err := products.RetrieveProductsWithPagination(filter, productSort, 0, 10)
+
+		require.NoError(t, err)
+
+		// Walk forward two products at a time, passing the cursor through its opaque form
+		var forward []uint
+
+		boundary := expected[0]
+
+		forward = append(forward, boundary.ID)
+
+		for {
+
+			cursor, err := data_layer.DecodeProductCursor(data_layer.NewProductCursor(productSort, boundary, false).Encode())
+
+			require.NoError(t, err)
+
+			page, err := products.RetrieveProductsWithCursor(filter, cursor, 2)
+
+			require.NoError(t, err)
+
+			if len(page) == 0 {
+				break
+			}
+
+			for _, product := range page {
+				forward = append(forward, product.ID)
+			}
+
+			boundary = page[len(page)-1]
+		}
+
+		var expectedIDs []uint
+
+		for _, product := range expected {
+			expectedIDs = append(expectedIDs, product.ID)
+		}
+
+		assert.Equal(t, expectedIDs, forward, spec)
+
+		// Reading backwards from the last product returns the preceding products in listing order
+		cursor := data_layer.NewProductCursor(productSort, expected[len(expected)-1], true)
+
+		page, err := products.RetrieveProductsWithCursor(filter, cursor, 2)
+
+		require.NoError(t, err)
+
+		require.Len(t, page, 2, spec)
+		assert.Equal(t, expectedIDs[len(expectedIDs)-3:len(expectedIDs)-1], []uint{page[0].ID, page[1].ID}, spec)
+	}
+
+	// A product inserted before the cursor position does not shift the next page
+	productSort, _ := data_layer.ParseProductSort("name")
+
+	firstPage, err := products.RetrieveProductsWithPagination(filter, productSort, 0, 2)
+
+	require.NoError(t, err)
+
+	products.InsertProduct("Cursor_0", data_layer.MustParseAmount("100"), "EUR")
+
+	page, err := products.RetrieveProductsWithCursor(filter, data_layer.NewProductCursor(productSort, firstPage[1], false), 2)
+
+	require.NoError(t, err)
+
+	require.Len(t, page, 2)
+	assert.Equal(t, "Cursor_B", page[0].Name)
+	assert.Equal(t, "Cursor_C", page[1].Name)
+}
+
+func conformanceSearchProducts(t *testing.T, products data_layer.Repository) {
+
+	longID, _ := products.InsertProduct("Laptop Sleeve for Small Notebooks", data_layer.MustParseAmount("25"), "EUR")
+	shortID, _ := products.InsertProduct("Laptop", data_layer.MustParseAmount("900"), "EUR")
+	renamedID, _ := products.InsertProduct("Desk Lamp", data_layer.MustParseAmount("40"), "EUR")
+	deletedID, _ := products.InsertProduct("Laptop Stand", data_layer.MustParseAmount("30"), "EUR")
+
+	require.NoError(t, products.DeleteProduct(int(deletedID), data_layer.AnyVersion))
+
+	ids := func(query string) []uint {
+
+		results, err := products.SearchProducts(query, nil, 0, 10)
+
+		require.NoError(t, err)
+
+		var found []uint
+
+		for _, result := range results {
+			found = append(found, result.Product.ID)
+		}
+
+		return found
+	}
+
+	// Prefixes match, shorter names rank first and deleted products are left out
+	assert.Equal(t, []uint{shortID, longID}, ids("LAPT"))
+	assert.Equal(t, []uint{longID}, ids("laptop small"))
+	assert.Empty(t, ids("lamp laptop"))
+
+	// The index follows renames
+	require.NoError(t, products.UpdateProductName(int(renamedID), "Laptop Lamp", data_layer.AnyVersion))
+
+	assert.Empty(t, ids("desk"))
+	assert.Equal(t, []uint{renamedID}, ids("lamp"))
+
+	results, err := products.SearchProducts("lamp lap", nil, 0, 10)
+
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "<mark>Laptop</mark> <mark>Lamp</mark>", results[0].Snippet)
+
+	// Snippets are HTML: the name is escaped around the marks
+	_, err = products.InsertProduct(`Tom & Jerry <img src=x onerror=alert(1)>`, data_layer.MustParseAmount("15"), "EUR")
+
+	require.NoError(t, err)
+
+	results, err = products.SearchProducts("jerry", nil, 0, 10)
+
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "Tom &amp; <mark>Jerry</mark> &lt;img src=x onerror=alert(1)&gt;", results[0].Snippet)
+
+	// Restored products come back, purged ones are gone for good
+	require.NoError(t, products.RestoreProduct(int(deletedID)))
+
+	assert.Contains(t, ids("stand"), deletedID)
+
+	require.NoError(t, products.PurgeProduct(int(deletedID), data_layer.AnyVersion))
+
+	assert.Empty(t, ids("stand"))
+
+	// Paging
+	results, err = products.SearchProducts("laptop", nil, 1, 1)
+
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	_, err = products.SearchProducts(" -- ", nil, 0, 10)
+
+	assert.ErrorIs(t, err, data_layer.ErrEmptySearch)
+}
+
+func conformanceSuggestProducts(t *testing.T, products data_layer.Repository) {
+
+	laptopID, _ := products.InsertProduct("Laptop", data_layer.MustParseAmount("900"), "EUR")
+	sleeveID, _ := products.InsertProduct("Laptop Sleeve", data_layer.MustParseAmount("25"), "EUR")
+	lampID, _ := products.InsertProduct("Desk Lamp", data_layer.MustParseAmount("40"), "EUR")
+
+	suggest := func(prefix string, maxDistance int) []uint {
+
+		suggestions, err := products.SuggestProducts(prefix, nil, maxDistance, 10)
+
+		require.NoError(t, err)
+
+		var ids []uint
+
+		for _, suggestion := range suggestions {
+			ids = append(ids, suggestion.ProductID)
+		}
+
+		return ids
+	}
+
+	// Any word can be completed, and names starting with the prefix come first
+	assert.Equal(t, []uint{laptopID, sleeveID}, suggest("lap", 0))
+	assert.Equal(t, []uint{lampID}, suggest("la", 0)[2:])
+	assert.Equal(t, []uint{sleeveID}, suggest("laptop sl", 0))
+	assert.Empty(t, suggest("lpa", 0))
+
+	// Typos: a swap, a substitution and a missing letter, closest matches first
+	assert.Equal(t, []uint{laptopID, sleeveID}, suggest("lpatop", 1))
+	assert.Equal(t, []uint{laptopID, sleeveID}, suggest("labtop", 1))
+	assert.Equal(t, []uint{sleeveID}, suggest("laptop slev", 1))
+
+	suggestions, err := products.SuggestProducts("dsk", nil, 1, 10)
+
+	require.NoError(t, err)
+	require.Len(t, suggestions, 1)
+	assert.Equal(t, "Desk Lamp", suggestions[0].Name)
+	assert.Equal(t, 1, suggestions[0].Distance)
+
+	// The index follows the writes
+	require.NoError(t, products.UpdateProductName(int(lampID), "Floor Lamp", data_layer.AnyVersion))
+	assert.Empty(t, suggest("desk", 0))
+	assert.Equal(t, []uint{lampID}, suggest("flo", 0))
+
+	require.NoError(t, products.DeleteProduct(int(laptopID), data_layer.AnyVersion))
+	assert.Equal(t, []uint{sleeveID}, suggest("laptop", 0))
+
+	require.NoError(t, products.RestoreProduct(int(laptopID)))
+	assert.Equal(t, []uint{laptopID, sleeveID}, suggest("laptop", 0))
+
+	require.NoError(t, products.PurgeProduct(int(sleeveID), data_layer.AnyVersion))
+	assert.Equal(t, []uint{laptopID}, suggest("laptop", 0))
+
+	newID, _ := products.InsertProduct("Laptop Stand", data_layer.MustParseAmount("30"), "EUR")
+	assert.Equal(t, []uint{laptopID, newID}, suggest("laptop", 0))
+
+	_, err = products.SuggestProducts("  ", nil, 0, 10)
+
+	assert.ErrorIs(t, err, data_layer.ErrEmptySearch)
+}
+
+func conformanceRestoreProduct(t *testing.T, products data_layer.Repository) {
+
+	productID, _ := products.InsertProduct("Conformance_Keyboard", data_layer.MustParseAmount("80"), "EUR")
+
+	// Only deleted products can be restored
+	assert.True(t, errors.Is(products.RestoreProduct(int(productID)), gorm.ErrRecordNotFound))
+	assert.True(t, errors.Is(products.RestoreProduct(999999), gorm.ErrRecordNotFound))
+
+	require.NoError(t, products.DeleteProduct(int(productID), data_layer.AnyVersion))
+	require.NoError(t, products.RestoreProduct(int(productID)))
+
+	product, err := products.RetrieveProduct(int(productID), false)
+
+	require.NoError(t, err)
+	assert.False(t, product.DeletedAt.Valid)
+	assert.Equal(t, "Conformance_Keyboard", product.Name)
+}
+
+func conformancePurgeProduct(t *testing.T, products data_layer.Repository) {
+
+	liveID, _ := products.InsertProduct("Conformance_Mouse", data_layer.MustParseAmount("25"), "EUR")
+	deletedID, _ := products.InsertProduct("Conformance_Pad", data_layer.MustParseAmount("10"), "EUR")
+
+	require.NoError(t, products.DeleteProduct(int(deletedID), data_layer.AnyVersion))
+
+	// Purging works on live and soft-deleted products alike
+	require.NoError(t, products.PurgeProduct(int(liveID), data_layer.AnyVersion))
+	require.NoError(t, products.PurgeProduct(int(deletedID), data_layer.AnyVersion))
+
+	for _, id := range []uint{liveID, deletedID} {
+		_, err := products.RetrieveProduct(int(id), true)
+		assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+		assert.True(t, errors.Is(products.RestoreProduct(int(id)), gorm.ErrRecordNotFound))
+	}
+
+	assert.True(t, errors.Is(products.PurgeProduct(int(liveID), data_layer.AnyVersion), gorm.ErrRecordNotFound))
+}
+
+func conformanceDeletedProductFilters(t *testing.T, products data_layer.Repository) {
+
+	var ids []uint
+
+	for i := 1; i <= 5; i++ {
+		productID, err := products.InsertProduct("Conformance_Filtered", data_layer.Amount(i*100), "EUR")
+		require.NoError(t, err)
+		ids = append(ids, productID)
+	}
+
+	require.NoError(t, products.DeleteProduct(int(ids[1]), data_layer.AnyVersion))
+	require.NoError(t, products.DeleteProduct(int(ids[3]), data_layer.AnyVersion))
+
+	counts := map[string]data_layer.ProductFilter{
+		"live":    {},
+		"all":     {IncludeDeleted: true},
+		"deleted": {OnlyDeleted: true},
+	}
+
+	expected := map[string]int{"live": 3, "all": 5, "deleted": 2}
+
+	for name, filter := range counts {
+
+		total, err := products.GetTotalNumberOfProducts(filter)
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(expected[name]), total, name)
+
+		page, err := products.RetrieveProductsWithPagination(filter, nil, 0, 10)
+
+		require.NoError(t, err)
+		assert.Len(t, page, expected[name], name)
+	}
+
+	deleted, _ := products.RetrieveProductsWithPagination(data_layer.ProductFilter{OnlyDeleted: true}, nil, 0, 10)
+
+	require.Len(t, deleted, 2)
+	assert.Equal(t, ids[1], deleted[0].ID)
+	assert.Equal(t, ids[3], deleted[1].ID)
+}
+
+func conformancePurgeDeletedProducts(t *testing.T, products data_layer.Repository) {
+
+	liveID, _ := products.InsertProduct("Conformance_Live", data_layer.MustParseAmount("10"), "EUR")
+	deletedID, _ := products.InsertProduct("Conformance_Trash", data_layer.MustParseAmount("20"), "EUR")
+
+	require.NoError(t, products.SetProductPrice(int(deletedID), "USD", data_layer.MustParseAmount("22")))
+	require.NoError(t, products.DeleteProduct(int(deletedID), data_layer.AnyVersion))
+
+	// Nothing was deleted before an hour ago
+	purged, err := products.PurgeDeletedProducts(time.Now().Add(-time.Hour))
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), purged)
+
+	purged, err = products.PurgeDeletedProducts(time.Now().Add(time.Second))
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	_, err = products.RetrieveProduct(int(deletedID), true)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	prices, err := products.RetrieveProductPrices([]uint{deletedID})
+
+	require.NoError(t, err)
+	assert.Empty(t, prices)
+
+	_, err = products.RetrieveProduct(int(liveID), false)
+	assert.NoError(t, err)
+}
+
+func conformancePaginationAndTotal(t *testing.T, products data_layer.Repository) {
+
+	for i := 1; i <= 7; i++ {
+		_, err := products.InsertProduct("Conformance_Item", data_layer.Amount(i*100), "EUR")
+		require.NoError(t, err)
+	}
+
+	total, err := products.GetTotalNumberOfProducts(data_layer.ProductFilter{})
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), total)
+
+	firstPage, err := products.RetrieveProductsWithPagination(data_layer.ProductFilter{}, nil, 0, 5)
+
+	require.NoError(t, err)
+	assert.Len(t, firstPage, 5)
+
+	secondPage, err := products.RetrieveProductsWithPagination(data_layer.ProductFilter{}, nil, 5, 5)
+
+	require.NoError(t, err)
+	assert.Len(t, secondPage, 2)
+
+	emptyPage, err := products.RetrieveProductsWithPagination(data_layer.ProductFilter{}, nil, 10, 5)
+
+	require.NoError(t, err)
+	assert.Len(t, emptyPage, 0)
+}
+
+func conformanceFilterProducts(t *testing.T, products data_layer.Repository) {
+
+	products.InsertProduct("Filter_Laptop_Basic", data_layer.MustParseAmount("500"), "EUR")
+	products.InsertProduct("Filter_Laptop_Pro", data_layer.MustParseAmount("1500"), "EUR")
+	products.InsertProduct("Filter_Phone_100%", data_layer.MustParseAmount("800"), "EUR")
+
+	time.Sleep(20 * time.Millisecond)
+
+	cutoff := time.Now()
+
+	time.Sleep(20 * time.Millisecond)
+
+	tabletID, _ := products.InsertProduct("Filter_Tablet", data_layer.MustParseAmount("650"), "EUR")
+
+	minPrice := data_layer.MustParseAmount("600")
+	maxPrice := data_layer.MustParseAmount("1500")
+
+	cases := []struct {
+		name     string
+		filter   data_layer.ProductFilter
+		expected int
+	}{
+		{"contains is case-insensitive", data_layer.ProductFilter{NameContains: "laptop"}, 2},
+		{"prefix", data_layer.ProductFilter{NamePrefix: "FILTER_P"}, 1},
+		{"prefix is anchored", data_layer.ProductFilter{NamePrefix: "Laptop"}, 0},
+		{"wildcards are literal", data_layer.ProductFilter{NameContains: "100%"}, 1},
+		{"underscore is literal", data_layer.ProductFilter{NameContains: "Laptop_B_sic"}, 0},
+		{"price range is inclusive", data_layer.ProductFilter{MinPrice: &minPrice, MaxPrice: &maxPrice}, 3},
+		{"created after", data_layer.ProductFilter{CreatedAfter: cutoff}, 1},
+		{"created before", data_layer.ProductFilter{CreatedBefore: cutoff}, 3},
+		{"combined", data_layer.ProductFilter{NameContains: "laptop", MinPrice: &minPrice}, 1},
+		{"ids", data_layer.ProductFilter{IDs: []uint{tabletID, 999999}}, 1},
+		{"exact names", data_layer.ProductFilter{Names: []string{"Filter_Tablet", "Filter_Laptop_Pro", "Filter_Laptop"}}, 2},
+		{"pattern star", data_layer.ProductFilter{NamePattern: "filter_*_pro"}, 1},
+		{"pattern question mark", data_layer.ProductFilter{NamePattern: "Filter_Laptop_Bas?c"}, 1},
+		{"pattern is anchored", data_layer.ProductFilter{NamePattern: "Laptop*"}, 0},
+		{"pattern percent is literal", data_layer.ProductFilter{NamePattern: "*100%"}, 1},
+	}
+
+	for _, testCase := range cases {
+
+		total, err := products.GetTotalNumberOfProducts(testCase.filter)
+
+		require.NoError(t, err, testCase.name)
+		assert.Equal(t, int64(testCase.expected), total, testCase.name)
+
+		page, err := products.RetrieveProductsWithPagination(testCase.filter, nil, 0, 10)
+
+		require.NoError(t, err, testCase.name)
+		assert.Len(t, page, testCase.expected, testCase.name)
+	}
+
+	// Updating a product makes it match updated_after
+	time.Sleep(20 * time.Millisecond)
+
+	updateCutoff := time.Now()
+
+	time.Sleep(20 * time.Millisecond)
+
+	require.NoError(t, products.UpdateProductPrice(int(tabletID), data_layer.MustParseAmount("640"), data_layer.AnyVersion))
+
+	updated, err := products.RetrieveProductsWithPagination(data_layer.ProductFilter{UpdatedAfter: updateCutoff}, nil, 0, 10)
+
+	require.NoError(t, err)
+	require.Len(t, updated, 1)
+	assert.Equal(t, tabletID, updated[0].ID)
+}
+
+func conformanceSortProducts(t *testing.T, products data_layer.Repository) {
+
+	products.InsertProduct("Sort_B", data_layer.MustParseAmount("300"), "EUR")
+	products.InsertProduct("Sort_A", data_layer.MustParseAmount("300"), "EUR")
+	products.InsertProduct("Sort_C", data_layer.MustParseAmount("100"), "EUR")
+	products.InsertProduct("Sort_A", data_layer.MustParseAmount("200"), "EUR")
+
+	names := func(spec string) []string {
+
+		productSort, err := data_layer.ParseProductSort(spec)
+
+		require.NoError(t, err)
+
+		page, err := products.RetrieveProductsWithPagination(data_layer.ProductFilter{}, productSort, 0, 10)
+
+		require.NoError(t, err)
+
+		var result []string
+
+		for _, product := range page {
+			result = append(result, fmt.Sprintf("%s@%s", product.Name, product.Price))
+		}
+
+		return result
+	}
+
+	assert.Equal(t, []string{"Sort_B@300.00", "Sort_A@300.00", "Sort_C@100.00", "Sort_A@200.00"}, names(""))
+	assert.Equal(t, []string{"Sort_A@200.00", "Sort_C@100.00", "Sort_A@300.00", "Sort_B@300.00"}, names("-id"), "descending ID")
+	assert.Equal(t, []string{"Sort_A@300.00", "Sort_B@300.00", "Sort_A@200.00", "Sort_C@100.00"}, names("-price,name"))
+	assert.Equal(t, []string{"Sort_A@300.00", "Sort_A@200.00", "Sort_B@300.00", "Sort_C@100.00"}, names("name"), "ties broken by ID")
+	assert.Equal(t, []string{"Sort_A@200.00", "Sort_A@300.00", "Sort_B@300.00", "Sort_C@100.00"}, names("name,price"))
+
+	// Pages follow the sort
+	productSort, _ := data_layer.ParseProductSort("price")
+
+	secondPage, err := products.RetrieveProductsWithPagination(data_layer.ProductFilter{}, productSort, 2, 2)
+
+	require.NoError(t, err)
+	require.Len(t, secondPage, 2)
+	assert.Equal(t, "Sort_B", secondPage[0].Name)
+	assert.Equal(t, "Sort_A", secondPage[1].Name)
+}
+
+func conformanceProductPrices(t *testing.T, products data_layer.Repository) {
+
+	productID, _ := products.InsertProduct("Conformance_Camera", data_layer.MustParseAmount("500"), "EUR")
+
+	require.NoError(t, products.SetProductPrice(int(productID), "USD", data_layer.MustParseAmount("549.99")))
+	require.NoError(t, products.SetProductPrice(int(productID), "GBP", data_layer.MustParseAmount("425")))
+
+	// Setting a price twice overwrites it
+	require.NoError(t, products.SetProductPrice(int(productID), "USD", data_layer.MustParseAmount("539.99")))
+
+	// Setting the price in the base currency updates the base price
+	require.NoError(t, products.SetProductPrice(int(productID), "EUR", data_layer.MustParseAmount("499")))
+
+	prices, err := products.RetrieveProductPrices([]uint{productID})
+
+	require.NoError(t, err)
+	require.Len(t, prices, 2)
+	assert.Equal(t, "GBP", prices[0].Currency)
+	assert.Equal(t, data_layer.MustParseAmount("425"), prices[0].Price)
+	assert.Equal(t, "USD", prices[1].Currency)
+	assert.Equal(t, data_layer.MustParseAmount("539.99"), prices[1].Price)
+
+	product, _ := products.RetrieveProduct(int(productID), false)
+	assert.Equal(t, data_layer.MustParseAmount("499"), product.Price)
+
+	require.NoError(t, products.DeleteProductPrice(int(productID), "GBP"))
+	assert.True(t, errors.Is(products.DeleteProductPrice(int(productID), "GBP"), gorm.ErrRecordNotFound))
+	assert.True(t, errors.Is(products.SetProductPrice(999999, "USD", 100), gorm.ErrRecordNotFound))
+
+	// Soft-deleting the product keeps its explicit prices, purging it removes them
+	require.NoError(t, products.DeleteProduct(int(productID), data_layer.AnyVersion))
+
+	prices, err = products.RetrieveProductPrices([]uint{productID})
+
+	require.NoError(t, err)
+	assert.Len(t, prices, 1)
+
+	require.NoError(t, products.PurgeProduct(int(productID), data_layer.AnyVersion))
+
+	prices, err = products.RetrieveProductPrices([]uint{productID})
+
+	require.NoError(t, err)
+	assert.Empty(t, prices)
+}
+
+func conformanceOptimisticConcurrency(t *testing.T, products data_layer.Repository) {
+
+	productID, _ := products.InsertProduct("Conformance_Speaker", data_layer.MustParseAmount("120"), "EUR")
+
+	product, err := products.RetrieveProduct(int(productID), false)
+
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), product.Version)
+
+	// Every write bumps the version
+	require.NoError(t, products.UpdateProductName(int(productID), "Conformance_Speaker_Pro", 1))
+	require.NoError(t, products.UpdateProductPrice(int(productID), data_layer.MustParseAmount("150"), 2))
+	require.NoError(t, products.SetProductPrice(int(productID), "USD", data_layer.MustParseAmount("165")))
+
+	product, _ = products.RetrieveProduct(int(productID), false)
+	assert.Equal(t, uint(4), product.Version)
+
+	// A stale version is refused with a typed conflict and changes nothing
+	err = products.UpdateProductName(int(productID), "Conformance_Speaker_Stale", 2)
+
+	var conflict *data_layer.VersionConflictError
+
+	require.True(t, errors.As(err, &conflict))
+	assert.True(t, errors.Is(err, data_layer.ErrVersionConflict))
+	assert.Equal(t, productID, conflict.ProductID)
+	assert.Equal(t, uint(2), conflict.ExpectedVersion)
+	assert.Equal(t, uint(4), conflict.CurrentVersion)
+
+	assert.True(t, errors.Is(products.UpdateProductPrice(int(productID), 1, 3), data_layer.ErrVersionConflict))
+	assert.True(t, errors.Is(products.DeleteProduct(int(productID), 3), data_layer.ErrVersionConflict))
+
+	product, _ = products.RetrieveProduct(int(productID), false)
+	assert.Equal(t, "Conformance_Speaker_Pro", product.Name)
+	assert.Equal(t, data_layer.MustParseAmount("150"), product.Price)
+
+	// Missing products are still reported as missing, whatever the version
+	assert.True(t, errors.Is(products.UpdateProductName(999999, "Missing", 1), gorm.ErrRecordNotFound))
+
+	require.NoError(t, products.DeleteProduct(int(productID), 4))
+	require.NoError(t, products.RestoreProduct(int(productID)))
+
+	assert.True(t, errors.Is(products.PurgeProduct(int(productID), 5), data_layer.ErrVersionConflict))
+	require.NoError(t, products.PurgeProduct(int(productID), 6))
+}
+
+func conformanceUpdateProductFields(t *testing.T, products data_layer.Repository) {
+
+	productID, _ := products.InsertProduct("Conformance_Drone", data_layer.MustParseAmount("800"), "EUR")
+
+	require.NoError(t, products.SetProductPrice(int(productID), "USD", data_layer.MustParseAmount("870")))
+	require.NoError(t, products.SetProductPrice(int(productID), "GBP", data_layer.MustParseAmount("690")))
+
+	name := "Conformance_Drone_Pro"
+	price := data_layer.MustParseAmount("880")
+	currency := "USD"
+
+	// All fields change together, at the expected version
+	err := products.UpdateProduct(int(productID), data_layer.ProductChanges{Name: &name, Price: &price, Currency: &currency}, 2)
+
+	assert.True(t, errors.Is(err, data_layer.ErrVersionConflict))
+
+	require.NoError(t, products.UpdateProduct(int(productID), data_layer.ProductChanges{Name: &name, Price: &price, Currency: &currency}, 3))
+
+	product, err := products.RetrieveProduct(int(productID), false)
+
+	require.NoError(t, err)
+	assert.Equal(t, name, product.Name)
+	assert.Equal(t, price, product.Price)
+	assert.Equal(t, "USD", product.Currency)
+	assert.Equal(t, uint(4), product.Version)
+
+	// The explicit price in the new base currency is gone, the others stay
+	prices, err := products.RetrieveProductPrices([]uint{productID})
+
+	require.NoError(t, err)
+	require.Len(t, prices, 1)
+	assert.Equal(t, "GBP", prices[0].Currency)
+
+	// An empty change set writes nothing but still checks the product
+	require.NoError(t, products.UpdateProduct(int(productID), data_layer.ProductChanges{}, 4))
+	assert.True(t, errors.Is(products.UpdateProduct(int(productID), data_layer.ProductChanges{}, 1), data_layer.ErrVersionConflict))
+	assert.True(t, errors.Is(products.UpdateProduct(999999, data_layer.ProductChanges{Name: &name}, data_layer.AnyVersion), gorm.ErrRecordNotFound))
+}
+
+func conformanceExchangeRates(t *testing.T, products data_layer.Repository) {
+
+	require.NoError(t, products.SetExchangeRate("EUR", "USD", data_layer.MustParseRate("1.08")))
+	require.NoError(t, products.SetExchangeRate("EUR", "GBP", data_layer.MustParseRate("0.85")))
+	require.NoError(t, products.SetExchangeRate("EUR", "USD", data_layer.MustParseRate("1.0875")))
+
+	rates, err := products.RetrieveExchangeRates()
+
+	require.NoError(t, err)
+	require.Len(t, rates, 2)
+	assert.Equal(t, "GBP", rates[0].QuoteCurrency)
+	assert.Equal(t, "USD", rates[1].QuoteCurrency)
+	assert.Equal(t, data_layer.MustParseRate("1.0875"), rates[1].Rate)
+
+	require.NoError(t, products.DeleteExchangeRate("EUR", "GBP"))
+	assert.True(t, errors.Is(products.DeleteExchangeRate("EUR", "GBP"), gorm.ErrRecordNotFound))
+}
+
+func conformanceApplyPriceRule(t *testing.T, products data_layer.Repository) {
+
+	laptopID, _ := products.InsertProduct("Rule_Laptop", data_layer.MustParseAmount("1000"), "EUR")
+	mouseID, _ := products.InsertProduct("Rule_Mouse", data_layer.MustParseAmount("19.99"), "EUR")
+	cableID, _ := products.InsertProduct("Rule_Cable", data_layer.MustParseAmount("4.20"), "USD")
+
+	raise := data_layer.PriceRule{
+		Filter: data_layer.ProductFilter{NamePattern: "rule_*"},
+		Operations: []data_layer.PriceOperation{
+			{Kind: data_layer.PriceMultiply, Factor: data_layer.MustParseRate("1.05")},
+			{Kind: data_layer.PriceRound99},
+		},
+	}
+
+	// A dry run reports the diff without writing anything
+	changes, err := products.ApplyPriceRule(raise, true)
+
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	assert.Equal(t, data_layer.PriceChange{ProductID: laptopID, Name: "Rule_Laptop", Currency: "EUR", OldPrice: data_layer.MustParseAmount("1000"), NewPrice: data_layer.MustParseAmount("1049.99")}, changes[0])
+	assert.Equal(t, data_layer.MustParseAmount("20.99"), changes[1].NewPrice)
+	assert.Equal(t, data_layer.MustParseAmount("3.99"), changes[2].NewPrice)
+
+	laptop, err := products.RetrieveProduct(int(laptopID), false)
+
+	require.NoError(t, err)
+	assert.Equal(t, data_layer.MustParseAmount("1000"), laptop.Price)
+	assert.Equal(t, uint(1), laptop.Version)
+
+	changes, err = products.ApplyPriceRule(raise, false)
+
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+
+	laptop, err = products.RetrieveProduct(int(laptopID), false)
+
+	require.NoError(t, err)
+	assert.Equal(t, data_layer.MustParseAmount("1049.99"), laptop.Price)
+	assert.Equal(t, uint(2), laptop.Version)
+
+	// Unchanged prices are left out of the diff and keep their version
+	changes, err = products.ApplyPriceRule(data_layer.PriceRule{
+		Filter:     data_layer.ProductFilter{IDs: []uint{laptopID, mouseID}},
+		Operations: []data_layer.PriceOperation{{Kind: data_layer.PriceSet, Amount: data_layer.MustParseAmount("20.99")}},
+	}, false)
+
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, laptopID, changes[0].ProductID)
+
+	mouse, err := products.RetrieveProduct(int(mouseID), false)
+
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), mouse.Version)
+
+	// One invalid price rolls the whole rule back
+	minPrice := data_layer.MustParseAmount("10")
+
+	_, err = products.ApplyPriceRule(data_layer.PriceRule{
+		Filter:     data_layer.ProductFilter{MinPrice: &minPrice},
+		Operations: []data_layer.PriceOperation{{Kind: data_layer.PriceAdd, Amount: data_layer.MustParseAmount("-20.99")}},
+	}, false)
+
+	var invalid *data_layer.PriceRuleError
+
+	require.ErrorAs(t, err, &invalid)
+	assert.True(t, errors.Is(err, data_layer.ErrInvalidPrice))
+
+	for _, productID := range []uint{laptopID, mouseID, cableID} {
+
+		product, err := products.RetrieveProduct(int(productID), false)
+
+		require.NoError(t, err)
+		assert.NotEqual(t, data_layer.Amount(0), product.Price)
+	}
+
+	laptop, _ = products.RetrieveProduct(int(laptopID), false)
+
+	assert.Equal(t, data_layer.MustParseAmount("20.99"), laptop.Price)
+}
+
+func conformanceStreamProducts(t *testing.T, products data_layer.Repository) {
+
+	products.InsertProduct("Stream_B", data_layer.MustParseAmount("20"), "EUR")
+	products.InsertProduct("Stream_A", data_layer.MustParseAmount("30"), "EUR")
+	deletedID, _ := products.InsertProduct("Stream_C", data_layer.MustParseAmount("10"), "EUR")
+	products.InsertProduct("Other", data_layer.MustParseAmount("5"), "EUR")
+
+	require.NoError(t, products.DeleteProduct(int(deletedID), data_layer.AnyVersion))
+
+	productSort, err := data_layer.ParseProductSort("-price")
+
+	require.NoError(t, err)
+
+	var names []string
+
+	visit := func(product data_layer.Product) error {
+
+		names = append(names, product.Name)
+
+		return nil
+	}
+
+	err = products.StreamProducts(data_layer.ProductFilter{NamePrefix: "stream_"}, productSort, visit)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Stream_A", "Stream_B"}, names)
+
+	names = nil
+
+	err = products.StreamProducts(data_layer.ProductFilter{NamePrefix: "stream_", IncludeDeleted: true}, nil, visit)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Stream_B", "Stream_A", "Stream_C"}, names)
+
+	// The first error of visit stops the stream
+	stop := errors.New("stop")
+
+	visited := 0
+
+	err = products.StreamProducts(data_layer.ProductFilter{}, nil, func(product data_layer.Product) error {
+
+		visited++
+
+		return stop
+	})
+
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, visited)
+}
+
+func conformanceCategories(t *testing.T, products data_layer.Repository) {
+
+	electronics, err := products.CreateCategory("Electronics", nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("/%d/", electronics.ID), electronics.Path)
+	assert.Nil(t, electronics.ParentID)
+
+	computers, err := products.CreateCategory("Computers", &electronics.ID)
+
+	require.NoError(t, err)
+	assert.Equal(t, electronics.Path+fmt.Sprintf("%d/", computers.ID), computers.Path)
+
+	laptops, err := products.CreateCategory("Laptops", &computers.ID)
+
+	require.NoError(t, err)
+
+	garden, err := products.CreateCategory("Garden", nil)
+
+	require.NoError(t, err)
+
+	// Sibling names are unique whatever their case, cousins may share them
+	_, err = products.CreateCategory("Computers", &electronics.ID)
+
+	assert.True(t, errors.Is(err, data_layer.ErrDuplicateCategory))
+
+	_, err = products.CreateCategory("COMPUTERS", &electronics.ID)
+
+	assert.True(t, errors.Is(err, data_layer.ErrDuplicateCategory))
+
+	_, err = products.CreateCategory("garden", nil)
+
+	assert.True(t, errors.Is(err, data_layer.ErrDuplicateCategory))
+
+	_, err = products.CreateCategory("Laptops", &garden.ID)
+
+	assert.NoError(t, err)
+
+	missing := uint(999999)
+
+	_, err = products.CreateCategory("Orphan", &missing)
+
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	// A category cannot move under itself or its subtree
+	assert.True(t, errors.Is(products.UpdateCategory(computers.ID, "Computers", &laptops.ID), data_layer.ErrCategoryCycle))
+	assert.True(t, errors.Is(products.UpdateCategory(computers.ID, "Computers", &computers.ID), data_layer.ErrCategoryCycle))
+
+	// Moving a category moves its subtree
+	require.NoError(t, products.UpdateCategory(computers.ID, "Computing", nil))
+
+	computers, err = products.RetrieveCategory(computers.ID)
+
+	require.NoError(t, err)
+	assert.Equal(t, "Computing", computers.Name)
+	assert.Nil(t, computers.ParentID)
+	assert.Equal(t, fmt.Sprintf("/%d/", computers.ID), computers.Path)
+
+	laptops, err = products.RetrieveCategory(laptops.ID)
+
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("/%d/%d/", computers.ID, laptops.ID), laptops.Path)
+
+	categories, err := products.RetrieveCategories()
+
+	require.NoError(t, err)
+	assert.Len(t, categories, 5)
+
+	// Only leaves can be deleted
+	assert.True(t, errors.Is(products.DeleteCategory(computers.ID), data_layer.ErrCategoryNotEmpty))
+	assert.NoError(t, products.DeleteCategory(laptops.ID))
+	assert.NoError(t, products.DeleteCategory(computers.ID))
+	assert.True(t, errors.Is(products.DeleteCategory(computers.ID), gorm.ErrRecordNotFound))
+
+	_, err = products.RetrieveCategory(laptops.ID)
+
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func conformanceProductCategories(t *testing.T, products data_layer.Repository) {
+
+	electronics, _ := products.CreateCategory("Electronics", nil)
+	computers, _ := products.CreateCategory("Computers", &electronics.ID)
+	phones, _ := products.CreateCategory("Phones", &electronics.ID)
+	garden, _ := products.CreateCategory("Garden", nil)
+
+	laptopID, _ := products.InsertProduct("Category_Laptop", data_layer.MustParseAmount("1500"), "EUR")
+	phoneID, _ := products.InsertProduct("Category_Phone", data_layer.MustParseAmount("800"), "EUR")
+	chargerID, _ := products.InsertProduct("Category_Charger", data_layer.MustParseAmount("20"), "EUR")
+	deletedID, _ := products.InsertProduct("Category_Deleted", data_layer.MustParseAmount("5"), "EUR")
+
+	require.NoError(t, products.AssignProductCategory(int(laptopID), computers.ID))
+	require.NoError(t, products.AssignProductCategory(int(phoneID), phones.ID))
+	require.NoError(t, products.AssignProductCategory(int(chargerID), computers.ID))
+	require.NoError(t, products.AssignProductCategory(int(chargerID), phones.ID))
+	require.NoError(t, products.AssignProductCategory(int(chargerID), electronics.ID))
+	require.NoError(t, products.AssignProductCategory(int(deletedID), phones.ID))
+
+	// Assigning twice changes nothing
+	require.NoError(t, products.AssignProductCategory(int(laptopID), computers.ID))
+
+	assert.True(t, errors.Is(products.AssignProductCategory(999999, computers.ID), gorm.ErrRecordNotFound))
+	assert.True(t, errors.Is(products.AssignProductCategory(int(laptopID), 999999), gorm.ErrRecordNotFound))
+
+	require.NoError(t, products.DeleteProduct(int(deletedID), data_layer.AnyVersion))
+
+	categories, err := products.RetrieveProductCategories(int(chargerID))
+
+	require.NoError(t, err)
+	assert.Len(t, categories, 3)
+
+	cases := []struct {
+		name     string
+		filter   data_layer.ProductFilter
+		expected int
+	}{
+		{"category only", data_layer.ProductFilter{CategoryID: electronics.ID}, 1},
+		{"category with subcategories", data_layer.ProductFilter{CategoryID: electronics.ID, IncludeSubcategories: true}, 3},
+		{"leaf", data_layer.ProductFilter{CategoryID: phones.ID}, 2},
+		{"leaf with deleted", data_layer.ProductFilter{CategoryID: phones.ID, IncludeDeleted: true}, 3},
+		{"empty", data_layer.ProductFilter{CategoryID: garden.ID, IncludeSubcategories: true}, 0},
+		{"combined", data_layer.ProductFilter{CategoryID: electronics.ID, IncludeSubcategories: true, NamePrefix: "category_p"}, 1},
+	}
+
+	for _, testCase := range cases {
+
+		total, err := products.GetTotalNumberOfProducts(testCase.filter)
+
+		require.NoError(t, err, testCase.name)
+		assert.Equal(t, int64(testCase.expected), total, testCase.name)
+	}
+
+	tree, err := products.RetrieveCategoryTree(nil)
+
+	require.NoError(t, err)
+	require.Len(t, tree, 2)
+	assert.Equal(t, "Electronics", tree[0].Name)
+	assert.Equal(t, 1, tree[0].ProductCount)
+	assert.Equal(t, 3, tree[0].TotalProductCount)
+	require.Len(t, tree[0].Children, 2)
+	assert.Equal(t, "Computers", tree[0].Children[0].Name)
+	assert.Equal(t, 2, tree[0].Children[0].ProductCount)
+	assert.Equal(t, "Phones", tree[0].Children[1].Name)
+	assert.Equal(t, 2, tree[0].Children[1].TotalProductCount)
+	assert.Equal(t, "Garden", tree[1].Name)
+	assert.Empty(t, tree[1].Children)
+
+	// Unassigning and purging remove the assignments
+	require.NoError(t, products.UnassignProductCategory(int(chargerID), electronics.ID))
+	assert.True(t, errors.Is(products.UnassignProductCategory(int(chargerID), electronics.ID), gorm.ErrRecordNotFound))
+
+	require.NoError(t, products.PurgeProduct(int(laptopID), data_layer.AnyVersion))
+
+	total, err := products.GetTotalNumberOfProducts(data_layer.ProductFilter{CategoryID: computers.ID})
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+
+	// Deleting a category unassigns its products
+	require.NoError(t, products.DeleteCategory(phones.ID))
+
+	categories, err = products.RetrieveProductCategories(int(chargerID))
+
+	require.NoError(t, err)
+	require.Len(t, categories, 1)
+	assert.Equal(t, computers.ID, categories[0].ID)
+}
+
+func conformanceProductTags(t *testing.T, products data_layer.Repository) {
+
+	shirtID, _ := products.InsertProduct("Tag_Shirt", data_layer.MustParseAmount("20"), "EUR")
+	bagID, _ := products.InsertProduct("Tag_Bag", data_layer.MustParseAmount("30"), "EUR")
+	mugID, _ := products.InsertProduct("Tag_Mug", data_layer.MustParseAmount("10"), "EUR")
+	deletedID, _ := products.InsertProduct("Tag_Deleted", data_layer.MustParseAmount("5"), "EUR")
+
+	before, _ := products.RetrieveProduct(int(shirtID), false)
+
+	// Tags are normalized and deduplicated
+	tags, err := products.AddProductTags(int(shirtID), []string{" Eco  Friendly", "sale", "SALE"})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"eco friendly", "sale"}, tags)
+
+	after, _ := products.RetrieveProduct(int(shirtID), false)
+
+	assert.Equal(t, before.Version+1, after.Version)
+	assert.False(t, after.UpdatedAt.Before(before.UpdatedAt))
+
+	// Adding tags the product already has changes nothing
+	_, err = products.AddProductTags(int(shirtID), []string{"sale"})
+
+	require.NoError(t, err)
+
+	unchanged, _ := products.RetrieveProduct(int(shirtID), false)
+
+	assert.Equal(t, after.Version, unchanged.Version)
+
+	_, err = products.AddProductTags(int(bagID), []string{"sale", "leather"})
+	require.NoError(t, err)
+	_, err = products.AddProductTags(int(mugID), []string{"eco friendly"})
+	require.NoError(t, err)
+	_, err = products.AddProductTags(int(deletedID), []string{"sale"})
+	require.NoError(t, err)
+
+	require.NoError(t, products.DeleteProduct(int(deletedID), data_layer.AnyVersion))
+
+	_, err = products.AddProductTags(int(shirtID), []string{"no/slash"})
+	assert.True(t, errors.Is(err, data_layer.ErrInvalidTag))
+
+	_, err = products.AddProductTags(999999, []string{"sale"})
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	cases := []struct {
+		name     string
+		filter   data_layer.ProductFilter
+		expected int
+	}{
+		{"any", data_layer.ProductFilter{Tags: []string{"sale"}}, 2},
+		{"any of two", data_layer.ProductFilter{Tags: []string{"leather", "eco friendly"}}, 3},
+		{"all", data_layer.ProductFilter{Tags: []string{"sale", "eco friendly"}, AllTags: true}, 1},
+		{"all without match", data_layer.ProductFilter{Tags: []string{"leather", "eco friendly"}, AllTags: true}, 0},
+		{"unknown", data_layer.ProductFilter{Tags: []string{"unknown"}}, 0},
+		{"with deleted", data_layer.ProductFilter{Tags: []string{"sale"}, IncludeDeleted: true}, 3},
+		{"combined", data_layer.ProductFilter{Tags: []string{"sale"}, NamePrefix: "tag_b"}, 1},
+	}
+
+	for _, testCase := range cases {
+
+		total, err := products.GetTotalNumberOfProducts(testCase.filter)
+
+		require.NoError(t, err, testCase.name)
+		assert.Equal(t, int64(testCase.expected), total, testCase.name)
+	}
+
+	// The cloud counts live products only, most used first
+	cloud, err := products.RetrieveTagCloud(nil, 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, []data_layer.TagCount{{Name: "eco friendly", Count: 2}, {Name: "sale", Count: 2}, {Name: "leather", Count: 1}}, cloud)
+
+	cloud, err = products.RetrieveTagCloud(nil, 1)
+
+	require.NoError(t, err)
+	assert.Equal(t, []data_layer.TagCount{{Name: "eco friendly", Count: 2}}, cloud)
+
+	// Removing a tag bumps the version
+	require.NoError(t, products.RemoveProductTag(int(shirtID), "Sale"))
+	assert.True(t, errors.Is(products.RemoveProductTag(int(shirtID), "sale"), gorm.ErrRecordNotFound))
+
+	removed, _ := products.RetrieveProduct(int(shirtID), false)
+
+	assert.Equal(t, after.Version+1, removed.Version)
+
+	tags, err = products.RetrieveProductTags(int(shirtID))
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"eco friendly"}, tags)
+
+	// Purging removes the tags of the product
+	require.NoError(t, products.PurgeProduct(int(bagID), data_layer.AnyVersion))
+
+	total, err := products.GetTotalNumberOfProducts(data_layer.ProductFilter{Tags: []string{"leather"}})
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+}
+
+func conformanceStockAdjustments(t *testing.T, products data_layer.Repository) {
+
+	productID, _ := products.InsertProduct("Stock_Shirt", data_layer.MustParseAmount("20"), "EUR")
+
+	// A product without stock has none
+	level, err := products.RetrieveStock(int(productID), 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), level.OnHand)
+
+	level, err = products.AdjustStock(int(productID), 0, 0, 10, data_layer.ReasonReceived)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), level.OnHand)
+	assert.Equal(t, int64(10), level.Available())
+
+	level, err = products.AdjustStock(int(productID), 0, 0, -3, data_layer.ReasonDamaged)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), level.OnHand)
+
+	// Stock never goes negative
+	_, err = products.AdjustStock(int(productID), 0, 0, -8, data_layer.ReasonLost)
+	assert.True(t, errors.Is(err, data_layer.ErrInsufficientStock))
+
+	_, err = products.AdjustStock(int(productID), 0, 0, 0, data_layer.ReasonCorrection)
+	assert.True(t, errors.Is(err, data_layer.ErrInvalidStockChange))
+
+	_, err = products.AdjustStock(int(productID), 0, 0, 1, "gift")
+	assert.True(t, errors.Is(err, data_layer.ErrInvalidStockChange))
+
+	_, err = products.AdjustStock(999999, 0, 0, 1, data_layer.ReasonReceived)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	level, err = products.RetrieveStock(int(productID), 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), level.OnHand)
+
+	movements, err := products.RetrieveStockMovements(int(productID), 0, 10)
+
+	require.NoError(t, err)
+	require.Len(t, movements, 2)
+	assert.Equal(t, int64(-3), movements[0].Delta)
+	assert.Equal(t, data_layer.ReasonDamaged, movements[0].Reason)
+	assert.Equal(t, data_layer.ReasonReceived, movements[1].Reason)
+
+	movements, err = products.RetrieveStockMovements(int(productID), 0, 1)
+
+	require.NoError(t, err)
+	assert.Len(t, movements, 1)
+
+	// Purging removes the stock of the product
+	require.NoError(t, products.PurgeProduct(int(productID), data_layer.AnyVersion))
+
+	_, err = products.RetrieveStock(int(productID), 0)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func conformanceStockHolds(t *testing.T, products data_layer.Repository) {
+
+	productID, _ := products.InsertProduct("Stock_Bag", data_layer.MustParseAmount("30"), "EUR")
+	otherID, _ := products.InsertProduct("Stock_Mug", data_layer.MustParseAmount("10"), "EUR")
+
+	_, err := products.AdjustStock(int(productID), 0, 0, 5, data_layer.ReasonReceived)
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour)
+
+	hold, err := products.ReserveStock("order-1", int(productID), 0, 0, 3, expiresAt)
+
+	require.NoError(t, err)
+	assert.Equal(t, "order-1", hold.ID)
+	assert.Equal(t, int64(3), hold.Quantity)
+
+	// Retrying the same reservation holds nothing more
+	_, err = products.ReserveStock("order-1", int(productID), 0, 0, 3, expiresAt)
+	require.NoError(t, err)
+
+	_, err = products.ReserveStock("order-1", int(productID), 0, 0, 2, expiresAt)
+	assert.True(t, errors.Is(err, data_layer.ErrHoldExists))
+
+	_, err = products.ReserveStock("order-1", int(otherID), 0, 0, 3, expiresAt)
+	assert.True(t, errors.Is(err, data_layer.ErrHoldExists))
+
+	level, err := products.RetrieveStock(int(productID), 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), level.Reserved)
+	assert.Equal(t, int64(2), level.Available())
+
+	_, err = products.ReserveStock("order-2", int(productID), 0, 0, 3, expiresAt)
+	assert.True(t, errors.Is(err, data_layer.ErrInsufficientStock))
+
+	_, err = products.ReserveStock("", int(productID), 0, 0, 1, expiresAt)
+	assert.True(t, errors.Is(err, data_layer.ErrInvalidStockChange))
+
+	_, err = products.ReserveStock("order-2", int(productID), 0, 0, 0, expiresAt)
+	assert.True(t, errors.Is(err, data_layer.ErrInvalidStockChange))
+
+	// Held units cannot be adjusted away
+	_, err = products.AdjustStock(int(productID), 0, 0, -3, data_layer.ReasonLost)
+	assert.True(t, errors.Is(err, data_layer.ErrInsufficientStock))
+
+	// Committing sells the held units
+	level, err = products.CommitStockHold("order-1")
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), level.OnHand)
+	assert.Equal(t, int64(0), level.Reserved)
+
+	_, err = products.CommitStockHold("order-1")
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	movements, err := products.RetrieveStockMovements(int(productID), 0, 10)
+
+	require.NoError(t, err)
+	assert.Equal(t, data_layer.ReasonSold, movements[0].Reason)
+	assert.Equal(t, "order-1", movements[0].HoldID)
+
+	// Retrying the reservation after its commit holds nothing again
+	_, err = products.ReserveStock("order-1", int(productID), 0, 0, 1, expiresAt)
+	assert.True(t, errors.Is(err, data_layer.ErrHoldCommitted))
+
+	level, err = products.RetrieveStock(int(productID), 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), level.Reserved)
+
+	// Releasing gives the units back
+	_, err = products.ReserveStock("order-3", int(productID), 0, 0, 2, expiresAt)
+	require.NoError(t, err)
+
+	level, err = products.ReleaseStockHold("order-3")
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), level.Available())
+
+	_, err = products.RetrieveStockHold("order-3")
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	// Expired holds give their units back by themselves, and cannot be committed
+	_, err = products.ReserveStock("order-4", int(productID), 0, 0, 2, time.Now().Add(-time.Second))
+	require.NoError(t, err)
+
+	_, err = products.CommitStockHold("order-4")
+	assert.True(t, errors.Is(err, data_layer.ErrHoldExpired))
+
+	level, err = products.RetrieveStock(int(productID), 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), level.Available())
+
+	_, err = products.RetrieveStockHold("order-4")
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	// The sweeper releases the holds expired at the given time
+	_, err = products.ReserveStock("order-5", int(productID), 0, 0, 1, expiresAt)
+	require.NoError(t, err)
+
+	released, err := products.ReleaseExpiredStockHolds(time.Now())
+
+	require.NoError(t, err)
+	assert.Equal(t, 0, released)
+
+	released, err = products.ReleaseExpiredStockHolds(expiresAt.Add(time.Second))
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, released)
+
+	level, err = products.RetrieveStock(int(productID), 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), level.Reserved)
+}
+
+func conformanceConcurrentReservations(t *testing.T, products data_layer.Repository) {
+
+	productID, _ := products.InsertProduct("Stock_Contended", data_layer.MustParseAmount("10"), "EUR")
+
+	_, err := products.AdjustStock(int(productID), 0, 0, 10, data_layer.ReasonReceived)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+
+	results := make(chan error, 25)
+
+	// 25 orders of one unit compete for 10 units
+	for i := 1; i <= 25; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			_, err := products.ReserveStock(fmt.Sprintf("contended-%d", i), int(productID), 0, 0, 1, time.Now().Add(time.Hour))
+
+			results <- err
+		}(i)
+	}
+
+	wg.Wait()
+	close(results)
+
+	reserved := 0
+
+	for err := range results {
+
+		if err == nil {
+			reserved++
+		} else {
+			assert.True(t, errors.Is(err, data_layer.ErrInsufficientStock), "unexpected error: %v", err)
+		}
+	}
+
+	assert.Equal(t, 10, reserved)
+
+	level, err := products.RetrieveStock(int(productID), 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), level.Reserved)
+	assert.Equal(t, int64(0), level.Available())
+}
+
+func conformanceWarehouses(t *testing.T, products data_layer.Repository) {
+
+	warehouses, err := products.RetrieveWarehouses()
+
+	require.NoError(t, err)
+	require.Len(t, warehouses, 1)
+	assert.Equal(t, data_layer.MainWarehouseCode, warehouses[0].Code)
+
+	mainID := warehouses[0].ID
+
+	warehouse, err := products.CreateWarehouse("athens", "Athens depot")
+
+	require.NoError(t, err)
+	assert.NotZero(t, warehouse.ID)
+
+	_, err = products.CreateWarehouse("athens", "Another depot")
+	assert.True(t, errors.Is(err, data_layer.ErrDuplicateWarehouse))
+
+	assert.True(t, errors.Is(products.UpdateWarehouse(warehouse.ID, data_layer.MainWarehouseCode, "Athens depot"), data_layer.ErrDuplicateWarehouse))
+	assert.True(t, errors.Is(products.UpdateWarehouse(999999, "lost", "Lost depot"), gorm.ErrRecordNotFound))
+
+	require.NoError(t, products.UpdateWarehouse(warehouse.ID, "ath", "Athens central depot"))
+
+	warehouse, err = products.RetrieveWarehouse(warehouse.ID)
+
+	require.NoError(t, err)
+	assert.Equal(t, "ath", warehouse.Code)
+	assert.Equal(t, "Athens central depot", warehouse.Name)
+
+	warehouses, err = products.RetrieveWarehouses()
+
+	require.NoError(t, err)
+	require.Len(t, warehouses, 2)
+	assert.Equal(t, mainID, warehouses[0].ID)
+
+	// A warehouse holding stock cannot be deleted, an emptied one can
+	productID, _ := products.InsertProduct("Stock_Lamp", data_layer.MustParseAmount("40"), "EUR")
+
+	_, err = products.AdjustStock(int(productID), 0, warehouse.ID, 2, data_layer.ReasonReceived)
+	require.NoError(t, err)
+
+	assert.True(t, errors.Is(products.DeleteWarehouse(warehouse.ID), data_layer.ErrWarehouseNotEmpty))
+
+	_, err = products.AdjustStock(int(productID), 0, warehouse.ID, -2, data_layer.ReasonSold)
+	require.NoError(t, err)
+
+	require.NoError(t, products.DeleteWarehouse(warehouse.ID))
+
+	_, err = products.RetrieveWarehouse(warehouse.ID)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	assert.True(t, errors.Is(products.DeleteWarehouse(warehouse.ID), gorm.ErrRecordNotFound))
+
+	level, err := products.RetrieveStock(int(productID), 0)
+
+	require.NoError(t, err)
+	assert.Empty(t, level.Warehouses)
+
+	_, err = products.AdjustStock(int(productID), 0, warehouse.ID, 1, data_layer.ReasonReceived)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func conformanceStockTransfers(t *testing.T, products data_layer.Repository) {
+
+	warehouses, _ := products.RetrieveWarehouses()
+	mainID := warehouses[0].ID
+
+	depot, err := products.CreateWarehouse("depot", "Depot")
+	require.NoError(t, err)
+
+	productID, _ := products.InsertProduct("Stock_Chair", data_layer.MustParseAmount("80"), "EUR")
+
+	// Stock operations without a warehouse use the default one
+	_, err = products.AdjustStock(int(productID), 0, 0, 10, data_layer.ReasonReceived)
+	require.NoError(t, err)
+
+	_, err = products.ReserveStock("order-1", int(productID), 0, 0, 4, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	level, err := products.TransferStock(int(productID), 0, mainID, depot.ID, 5)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), level.OnHand)
+	assert.Equal(t, int64(4), level.Reserved)
+	require.Len(t, level.Warehouses, 2)
+	assert.Equal(t, mainID, level.Warehouses[0].WarehouseID)
+	assert.Equal(t, int64(5), level.Warehouses[0].OnHand)
+	assert.Equal(t, int64(4), level.Warehouses[0].Reserved)
+	assert.Equal(t, depot.ID, level.Warehouses[1].WarehouseID)
+	assert.Equal(t, int64(5), level.Warehouses[1].OnHand)
+
+	// Held units stay where they are, and a failed transfer changes nothing
+	_, err = products.TransferStock(int(productID), 0, mainID, depot.ID, 2)
+	assert.True(t, errors.Is(err, data_layer.ErrInsufficientStock))
+
+	_, err = products.TransferStock(int(productID), 0, mainID, mainID, 1)
+	assert.True(t, errors.Is(err, data_layer.ErrInvalidStockChange))
+
+	_, err = products.TransferStock(int(productID), 0, mainID, depot.ID, 0)
+	assert.True(t, errors.Is(err, data_layer.ErrInvalidStockChange))
+
+	_, err = products.TransferStock(int(productID), 0, mainID, 999999, 1)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	_, err = products.TransferStock(999999, 0, mainID, depot.ID, 1)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	level, err = products.RetrieveStock(int(productID), 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), level.Warehouses[0].Available())
+	assert.Equal(t, int64(5), level.Warehouses[1].Available())
+
+	// Both sides of the transfer are in the ledger
+	movements, err := products.RetrieveStockMovements(int(productID), 0, 2)
+
+	require.NoError(t, err)
+	require.Len(t, movements, 2)
+
+	for _, movement := range movements {
+		assert.Equal(t, data_layer.ReasonTransfer, movement.Reason)
+	}
+
+	assert.ElementsMatch(t, []int64{-5, 5}, []int64{movements[0].Delta, movements[1].Delta})
+
+	// Holds are taken from the warehouse they name
+	_, err = products.ReserveStock("order-2", int(productID), 0, depot.ID, 5, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	hold, err := products.RetrieveStockHold("order-2")
+
+	require.NoError(t, err)
+	assert.Equal(t, depot.ID, hold.WarehouseID)
+
+	level, err = products.CommitStockHold("order-2")
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), level.OnHand)
+	assert.Equal(t, int64(0), level.Warehouses[1].OnHand)
+}
+
+func conformanceStockFilters(t *testing.T, products data_layer.Repository) {
+
+	warehouses, _ := products.RetrieveWarehouses()
+	mainID := warehouses[0].ID
+
+	depot, err := products.CreateWarehouse("depot", "Depot")
+	require.NoError(t, err)
+
+	stockedID, _ := products.InsertProduct("Filter_Stocked", data_layer.MustParseAmount("10"), "EUR")
+	heldID, _ := products.InsertProduct("Filter_Held", data_layer.MustParseAmount("10"), "EUR")
+	depotID, _ := products.InsertProduct("Filter_Depot", data_layer.MustParseAmount("10"), "EUR")
+	products.InsertProduct("Filter_None", data_layer.MustParseAmount("10"), "EUR")
+
+	_, err = products.AdjustStock(int(stockedID), 0, mainID, 3, data_layer.ReasonReceived)
+	require.NoError(t, err)
+
+	// Every unit of this one is held
+	_, err = products.AdjustStock(int(heldID), 0, mainID, 1, data_layer.ReasonReceived)
+	require.NoError(t, err)
+	_, err = products.ReserveStock("order-1", int(heldID), 0, mainID, 1, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	_, err = products.AdjustStock(int(depotID), 0, depot.ID, 2, data_layer.ReasonReceived)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name     string
+		filter   data_layer.ProductFilter
+		expected int
+	}{
+		{"in stock", data_layer.ProductFilter{InStock: true}, 2},
+		{"stocked in main", data_layer.ProductFilter{WarehouseID: mainID}, 2},
+		{"in stock in main", data_layer.ProductFilter{InStock: true, WarehouseID: mainID}, 1},
+		{"in stock in depot", data_layer.ProductFilter{InStock: true, WarehouseID: depot.ID}, 1},
+		{"unknown warehouse", data_layer.ProductFilter{WarehouseID: 999999}, 0},
+		{"combined", data_layer.ProductFilter{InStock: true, NamePrefix: "filter_d"}, 1},
+	}
+
+	for _, testCase := range cases {
+
+		total, err := products.GetTotalNumberOfProducts(testCase.filter)
+
+		require.NoError(t, err, testCase.name)
+		assert.Equal(t, int64(testCase.expected), total, testCase.name)
+	}
+}
+
+func conformanceProductVariants(t *testing.T, products data_layer.Repository) {
+
+	shirtID, _ := products.InsertProduct("Variant_Shirt", data_layer.MustParseAmount("20"), "EUR")
+	hoodieID, _ := products.InsertProduct("Variant_Hoodie", data_layer.MustParseAmount("45"), "EUR")
+
+	before, _ := products.RetrieveProduct(int(shirtID), false)
+
+	priceOverride := data_layer.MustParseAmount("22.50")
+
+	variant, err := products.CreateProductVariant(int(shirtID), data_layer.VariantSpec{SKU: " ts-m-red ", Options: map[string]string{"Size": "M", "color": " Red "}, PriceOverride: &priceOverride})
+
+	require.NoError(t, err)
+	assert.NotZero(t, variant.ID)
+	assert.Equal(t, "TS-M-RED", variant.SKU)
+	assert.Equal(t, "color=Red;size=M", variant.Options)
+	assert.Equal(t, map[string]string{"color": "Red", "size": "M"}, variant.OptionValues())
+
+	// Adding a variant bumps the version of the product
+	after, _ := products.RetrieveProduct(int(shirtID), false)
+
+	assert.Equal(t, before.Version+1, after.Version)
+
+	small, err := products.CreateProductVariant(int(shirtID), data_layer.VariantSpec{SKU: "TS-S-RED", Options: map[string]string{"size": "S", "color": "red"}})
+
+	require.NoError(t, err)
+	assert.Nil(t, small.PriceOverride)
+	assert.Equal(t, after.Price, small.Price(after))
+
+	// Option combinations are unique per product, whatever their case; SKUs are unique everywhere
+	_, err = products.CreateProductVariant(int(shirtID), data_layer.VariantSpec{SKU: "TS-M-RED-2", Options: map[string]string{"color": "RED", "size": "m"}})
+	assert.True(t, errors.Is(err, data_layer.ErrDuplicateVariant))
+
+	_, err = products.CreateProductVariant(int(hoodieID), data_layer.VariantSpec{SKU: "ts-m-red", Options: map[string]string{"size": "M"}})
+	assert.True(t, errors.Is(err, data_layer.ErrDuplicateVariant))
+
+	_, err = products.CreateProductVariant(int(hoodieID), data_layer.VariantSpec{SKU: "HD-M-RED", Options: map[string]string{"color": "red", "size": "M"}})
+	require.NoError(t, err)
+
+	negative := data_layer.Amount(-1)
+
+	for _, spec := range []data_layer.VariantSpec{
+		{SKU: "TS-L", Options: map[string]string{}},
+		{SKU: "TS L", Options: map[string]string{"size": "L"}},
+		{SKU: "TS-L", Options: map[string]string{"size": "L;XL"}},
+		{SKU: "TS-L", Options: map[string]string{"size": "L", "Size": "XL"}},
+		{SKU: "TS-L", Options: map[string]string{"size": "L"}, PriceOverride: &negative},
+	} {
+		_, err = products.CreateProductVariant(int(shirtID), spec)
+		assert.True(t, errors.Is(err, data_layer.ErrInvalidVariant), "%+v", spec)
+	}
+
+	_, err = products.CreateProductVariant(999999, data_layer.VariantSpec{SKU: "TS-L", Options: map[string]string{"size": "L"}})
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	variants, err := products.RetrieveProductVariants(int(shirtID))
+
+	require.NoError(t, err)
+	require.Len(t, variants, 2)
+	assert.Equal(t, variant.ID, variants[0].ID)
+	assert.Equal(t, int64(0), variants[0].Available)
+	require.NotNil(t, variants[0].PriceOverride)
+	assert.Equal(t, priceOverride, *variants[0].PriceOverride)
+
+	// Replacing keeps the ID and can drop the price override
+	require.NoError(t, products.UpdateProductVariant(int(shirtID), variant.ID, data_layer.VariantSpec{SKU: "TS-M-BLUE", Options: map[string]string{"size": "M", "color": "blue"}}))
+
+	variant, err = products.RetrieveProductVariant(int(shirtID), variant.ID)
+
+	require.NoError(t, err)
+	assert.Equal(t, "TS-M-BLUE", variant.SKU)
+	assert.Equal(t, "color=blue;size=M", variant.Options)
+	assert.Nil(t, variant.PriceOverride)
+
+	// Replacing a variant with its own values is not a duplicate, taking those of another one is
+	require.NoError(t, products.UpdateProductVariant(int(shirtID), variant.ID, data_layer.VariantSpec{SKU: "TS-M-BLUE", Options: map[string]string{"size": "M", "color": "blue"}}))
+	assert.True(t, errors.Is(products.UpdateProductVariant(int(shirtID), variant.ID, data_layer.VariantSpec{SKU: "TS-M-BLUE", Options: map[string]string{"size": "S", "color": "red"}}), data_layer.ErrDuplicateVariant))
+
+	// Variants are only reached through their own product
+	_, err = products.RetrieveProductVariant(int(hoodieID), variant.ID)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+	assert.True(t, errors.Is(products.DeleteProductVariant(int(hoodieID), variant.ID), gorm.ErrRecordNotFound))
+
+	require.NoError(t, products.DeleteProductVariant(int(shirtID), small.ID))
+	assert.True(t, errors.Is(products.DeleteProductVariant(int(shirtID), small.ID), gorm.ErrRecordNotFound))
+
+	// Deleted products hide their variants, purged ones lose them
+	require.NoError(t, products.DeleteProduct(int(shirtID), data_layer.AnyVersion))
+
+	_, err = products.RetrieveProductVariants(int(shirtID))
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	require.NoError(t, products.PurgeProduct(int(shirtID), data_layer.AnyVersion))
+
+	// The SKU of a purged variant is free again
+	_, err = products.CreateProductVariant(int(hoodieID), data_layer.VariantSpec{SKU: "TS-M-BLUE", Options: map[string]string{"size": "L"}})
+	require.NoError(t, err)
+}
+
+func conformanceVariantStock(t *testing.T, products data_layer.Repository) {
+
+	warehouses, _ := products.RetrieveWarehouses()
+	mainID := warehouses[0].ID
+
+	depot, err := products.CreateWarehouse("depot", "Depot")
+	require.NoError(t, err)
+
+	shirtID, _ := products.InsertProduct("VariantStock_Shirt", data_layer.MustParseAmount("20"), "EUR")
+	hoodieID, _ := products.InsertProduct("VariantStock_Hoodie", data_layer.MustParseAmount("45"), "EUR")
+
+	medium, err := products.CreateProductVariant(int(shirtID), data_layer.VariantSpec{SKU: "VS-M", Options: map[string]string{"size": "M"}})
+	require.NoError(t, err)
+
+	large, err := products.CreateProductVariant(int(shirtID), data_layer.VariantSpec{SKU: "VS-L", Options: map[string]string{"size": "L"}})
+	require.NoError(t, err)
+
+	// Every variant has its own rows, apart from those of the product
+	level, err := products.AdjustStock(int(shirtID), medium.ID, 0, 6, data_layer.ReasonReceived)
+
+	require.NoError(t, err)
+	assert.Equal(t, medium.ID, level.VariantID)
+	assert.Equal(t, int64(6), level.OnHand)
+
+	_, err = products.AdjustStock(int(shirtID), 0, 0, 2, data_layer.ReasonReceived)
+	require.NoError(t, err)
+
+	level, err = products.RetrieveStock(int(shirtID), large.ID)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), level.OnHand)
+
+	level, err = products.RetrieveStock(int(shirtID), 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), level.OnHand)
+
+	// Holds and transfers of a variant guard its own units
+	hold, err := products.ReserveStock("order-1", int(shirtID), medium.ID, 0, 4, time.Now().Add(time.Hour))
+
+	require.NoError(t, err)
+	assert.Equal(t, medium.ID, hold.VariantID)
+
+	_, err = products.ReserveStock("order-1", int(shirtID), large.ID, 0, 4, time.Now().Add(time.Hour))
+	assert.True(t, errors.Is(err, data_layer.ErrHoldExists))
+
+	_, err = products.ReserveStock("order-2", int(shirtID), large.ID, 0, 1, time.Now().Add(time.Hour))
+	assert.True(t, errors.Is(err, data_layer.ErrInsufficientStock))
+
+	_, err = products.AdjustStock(int(shirtID), medium.ID, 0, -3, data_layer.ReasonDamaged)
+	assert.True(t, errors.Is(err, data_layer.ErrInsufficientStock))
+
+	_, err = products.TransferStock(int(shirtID), medium.ID, mainID, depot.ID, 3)
+	assert.True(t, errors.Is(err, data_layer.ErrInsufficientStock))
+
+	level, err = products.TransferStock(int(shirtID), medium.ID, mainID, depot.ID, 2)
+
+	require.NoError(t, err)
+	require.Len(t, level.Warehouses, 2)
+	assert.Equal(t, int64(2), level.Warehouses[1].OnHand)
+
+	variant, err := products.RetrieveProductVariant(int(shirtID), medium.ID)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), variant.Available)
+
+	level, err = products.CommitStockHold("order-1")
+
+	require.NoError(t, err)
+	assert.Equal(t, medium.ID, level.VariantID)
+	assert.Equal(t, int64(2), level.OnHand)
+
+	movements, err := products.RetrieveStockMovements(int(shirtID), medium.ID, 10)
+
+	require.NoError(t, err)
+	require.Len(t, movements, 4)
+	assert.Equal(t, data_layer.ReasonSold, movements[0].Reason)
+
+	movements, err = products.RetrieveStockMovements(int(shirtID), 0, 10)
+
+	require.NoError(t, err)
+	assert.Len(t, movements, 1)
+
+	// Variants are only reached through their own product
+	_, err = products.RetrieveStock(int(hoodieID), medium.ID)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	_, err = products.AdjustStock(int(hoodieID), medium.ID, 0, 1, data_layer.ReasonReceived)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	_, err = products.ReserveStock("order-3", int(shirtID), 999999, 0, 1, time.Now().Add(time.Hour))
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	// A variant holding stock cannot be deleted, an emptied one can
+	assert.True(t, errors.Is(products.DeleteProductVariant(int(shirtID), medium.ID), data_layer.ErrVariantNotEmpty))
+
+	_, err = products.AdjustStock(int(shirtID), medium.ID, depot.ID, -2, data_layer.ReasonLost)
+	require.NoError(t, err)
+
+	require.NoError(t, products.DeleteProductVariant(int(shirtID), medium.ID))
+
+	_, err = products.RetrieveStock(int(shirtID), medium.ID)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func conformanceProductIdentifiers(t *testing.T, products data_layer.Repository) {
+
+	identifier := func(value string) *string { return &value }
+
+	ids, err := products.InsertProducts([]data_layer.Product{
+		{Name: "Identified_Drill", Price: data_layer.MustParseAmount("89"), Currency: "EUR", SKU: identifier(" drl-18v "), GTIN: identifier("4006381-333931")},
+		{Name: "Identified_Saw", Price: data_layer.MustParseAmount("59"), Currency: "EUR", SKU: identifier("SAW.1"), GTIN: identifier("96385074")},
+		{Name: "Identified_Glue", Price: data_layer.MustParseAmount("4"), Currency: "EUR", SKU: identifier("")},
+	})
+
+	require.NoError(t, err)
+	require.Len(t, ids, 3)
+
+	drill, err := products.RetrieveProduct(int(ids[0]), false)
+
+	require.NoError(t, err)
+	require.NotNil(t, drill.SKU)
+	require.NotNil(t, drill.GTIN)
+	assert.Equal(t, "DRL-18V", *drill.SKU)
+	assert.Equal(t, "4006381333931", *drill.GTIN)
+
+	// An empty SKU is no SKU, and products without identifiers do not clash
+	glue, err := products.RetrieveProduct(int(ids[2]), false)
+
+	require.NoError(t, err)
+	assert.Nil(t, glue.SKU)
+	assert.Nil(t, glue.GTIN)
+
+	_, err = products.InsertProducts([]data_layer.Product{{Name: "Identified_Tape", Price: data_layer.MustParseAmount("3"), Currency: "EUR"}})
+	require.NoError(t, err)
+
+	// GTIN-8, UPC-A, EAN-13 and GTIN-14 check digits are verified
+	for _, gtin := range []string{"036000291452", "10614141000415"} {
+		_, err = products.InsertProducts([]data_layer.Product{{Name: "Identified_" + gtin, Price: data_layer.MustParseAmount("1"), Currency: "EUR", GTIN: identifier(gtin)}})
+		assert.NoError(t, err, gtin)
+	}
+
+	for _, gtin := range []string{"4006381333932", "96385075", "12345", "400638133393X", "036000291453"} {
+		_, err = products.InsertProducts([]data_layer.Product{{Name: "Identified_Bad", Price: data_layer.MustParseAmount("1"), Currency: "EUR", GTIN: identifier(gtin)}})
+		assert.True(t, errors.Is(err, data_layer.ErrInvalidGTIN), gtin)
+	}
+
+	_, err = products.InsertProducts([]data_layer.Product{{Name: "Identified_Bad", Price: data_layer.MustParseAmount("1"), Currency: "EUR", SKU: identifier("drl 18v")}})
+	assert.True(t, errors.Is(err, data_layer.ErrInvalidSKU))
+
+	// Duplicates are refused against stored products, within a batch, and leave nothing behind
+	_, err = products.InsertProducts([]data_layer.Product{{Name: "Identified_Copy", Price: data_layer.MustParseAmount("1"), Currency: "EUR", SKU: identifier("Drl-18v")}})
+	assert.True(t, errors.Is(err, data_layer.ErrDuplicateProduct))
+
+	_, err = products.InsertProducts([]data_layer.Product{{Name: "Identified_Copy", Price: data_layer.MustParseAmount("1"), Currency: "EUR", GTIN: identifier("96385074")}})
+	assert.True(t, errors.Is(err, data_layer.ErrDuplicateProduct))
+
+	_, err = products.InsertProducts([]data_layer.Product{
+		{Name: "Identified_First", Price: data_layer.MustParseAmount("1"), Currency: "EUR", SKU: identifier("TWIN")},
+		{Name: "Identified_Second", Price: data_layer.MustParseAmount("1"), Currency: "EUR", SKU: identifier("twin")},
+	})
+	assert.True(t, errors.Is(err, data_layer.ErrDuplicateProduct))
+
+	var duplicate *data_layer.DuplicateProductError
+
+	require.True(t, errors.As(err, &duplicate))
+	assert.Equal(t, 1, duplicate.Index)
+
+	// The error names the product of the batch whose identifier is taken
+	_, err = products.InsertProducts([]data_layer.Product{
+		{Name: "Identified_Fresh", Price: data_layer.MustParseAmount("1"), Currency: "EUR", SKU: identifier("FRESH")},
+		{Name: "Identified_Clash", Price: data_layer.MustParseAmount("1"), Currency: "EUR", GTIN: identifier("96385074")},
+	})
+	require.True(t, errors.As(err, &duplicate))
+	assert.Equal(t, 1, duplicate.Index)
+
+	_, err = products.RetrieveProductBySKU("TWIN")
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	// Lookups normalize their input like insertions
+	found, err := products.RetrieveProductBySKU("drl-18v")
+
+	require.NoError(t, err)
+	assert.Equal(t, ids[0], found.ID)
+
+	found, err = products.RetrieveProductByGTIN("9638 5074")
+
+	require.NoError(t, err)
+	assert.Equal(t, ids[1], found.ID)
+
+	_, err = products.RetrieveProductByGTIN("96385075")
+	assert.True(t, errors.Is(err, data_layer.ErrInvalidGTIN))
+
+	_, err = products.RetrieveProductBySKU("NOPE")
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	// Updates validate, keep the identifiers of the product itself, refuse those of others and clear with ""
+	before, _ := products.RetrieveProduct(int(ids[1]), false)
+
+	require.NoError(t, products.UpdateProduct(int(ids[1]), data_layer.ProductChanges{SKU: identifier("saw.1"), GTIN: identifier("96385074")}, data_layer.AnyVersion))
+
+	assert.True(t, errors.Is(products.UpdateProduct(int(ids[1]), data_layer.ProductChanges{SKU: identifier("DRL-18V")}, data_layer.AnyVersion), data_layer.ErrDuplicateProduct))
+	assert.True(t, errors.Is(products.UpdateProduct(int(ids[1]), data_layer.ProductChanges{GTIN: identifier("96385075")}, data_layer.AnyVersion), data_layer.ErrInvalidGTIN))
+	assert.True(t, errors.Is(products.UpdateProduct(999999, data_layer.ProductChanges{SKU: identifier("GHOST")}, data_layer.AnyVersion), gorm.ErrRecordNotFound))
+
+	require.NoError(t, products.UpdateProduct(int(ids[1]), data_layer.ProductChanges{GTIN: identifier("")}, data_layer.AnyVersion))
+
+	saw, err := products.RetrieveProduct(int(ids[1]), false)
+
+	require.NoError(t, err)
+	require.NotNil(t, saw.SKU)
+	assert.Equal(t, "SAW.1", *saw.SKU)
+	assert.Nil(t, saw.GTIN)
+	assert.Greater(t, saw.Version, before.Version)
+
+	_, err = products.RetrieveProductByGTIN("96385074")
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	// Deleted products are not found, but keep their identifiers until purged
+	require.NoError(t, products.DeleteProduct(int(ids[0]), data_layer.AnyVersion))
+
+	_, err = products.RetrieveProductBySKU("DRL-18V")
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	_, err = products.InsertProducts([]data_layer.Product{{Name: "Identified_Copy", Price: data_layer.MustParseAmount("1"), Currency: "EUR", SKU: identifier("DRL-18V")}})
+	assert.True(t, errors.Is(err, data_layer.ErrDuplicateProduct))
+
+	require.NoError(t, products.PurgeProduct(int(ids[0]), data_layer.AnyVersion))
+
+	_, err = products.InsertProducts([]data_layer.Product{{Name: "Identified_Copy", Price: data_layer.MustParseAmount("1"), Currency: "EUR", SKU: identifier("DRL-18V"), GTIN: identifier("4006381333931")}})
+	require.NoError(t, err)
+}
+
+func conformanceSKUNamespace(t *testing.T, products data_layer.Repository) {
+
+	identifier := func(value string) *string { return &value }
+
+	ids, err := products.InsertProducts([]data_layer.Product{
+		{Name: "Namespace_Jacket", Price: data_layer.MustParseAmount("120"), Currency: "EUR", SKU: identifier("JKT-1")},
+		{Name: "Namespace_Coat", Price: data_layer.MustParseAmount("180"), Currency: "EUR"},
+	})
+
+	require.NoError(t, err)
+
+	variant, err := products.CreateProductVariant(int(ids[1]), data_layer.VariantSpec{SKU: "coat-m", Options: map[string]string{"size": "M"}})
+	require.NoError(t, err)
+
+	// A variant cannot take the SKU of a product, nor a product the SKU of a variant
+	_, err = products.CreateProductVariant(int(ids[1]), data_layer.VariantSpec{SKU: "jkt-1", Options: map[string]string{"size": "L"}})
+	assert.True(t, errors.Is(err, data_layer.ErrDuplicateVariant))
+
+	assert.True(t, errors.Is(products.UpdateProductVariant(int(ids[1]), variant.ID, data_layer.VariantSpec{SKU: "JKT-1", Options: map[string]string{"size": "M"}}), data_layer.ErrDuplicateVariant))
+
+	_, err = products.InsertProducts([]data_layer.Product{{Name: "Namespace_Copy", Price: data_layer.MustParseAmount("10"), Currency: "EUR", SKU: identifier("COAT-M")}})
+	assert.True(t, errors.Is(err, data_layer.ErrDuplicateProduct))
+
+	assert.True(t, errors.Is(products.UpdateProduct(int(ids[0]), data_layer.ProductChanges{SKU: identifier("coat-m")}, data_layer.AnyVersion), data_layer.ErrDuplicateProduct))
+
+	// The SKU of a deleted product stays taken until it is purged
+	require.NoError(t, products.DeleteProduct(int(ids[0]), data_layer.AnyVersion))
+
+	_, err = products.CreateProductVariant(int(ids[1]), data_layer.VariantSpec{SKU: "JKT-1", Options: map[string]string{"size": "L"}})
+	assert.True(t, errors.Is(err, data_layer.ErrDuplicateVariant))
+
+	require.NoError(t, products.PurgeProduct(int(ids[0]), data_layer.AnyVersion))
+
+	_, err = products.CreateProductVariant(int(ids[1]), data_layer.VariantSpec{SKU: "JKT-1", Options: map[string]string{"size": "L"}})
+	require.NoError(t, err)
+
+	// Variants are looked up by their normalized SKU, through live products only
+	found, err := products.RetrieveProductVariantBySKU(" coat-m ")
+
+	require.NoError(t, err)
+	assert.Equal(t, variant.ID, found.ID)
+	assert.Equal(t, ids[1], found.ProductID)
+
+	_, err = products.RetrieveProductVariantBySKU("COAT M")
+	assert.True(t, errors.Is(err, data_layer.ErrInvalidSKU))
+
+	_, err = products.RetrieveProductVariantBySKU("COAT-XL")
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	require.NoError(t, products.DeleteProduct(int(ids[1]), data_layer.AnyVersion))
+
+	_, err = products.RetrieveProductVariantBySKU("COAT-M")
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func conformanceProductLifecycle(t *testing.T, products data_layer.Repository) {
+
+	status := func(value string) *string { return &value }
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	publishAt, unpublishAt := now.Add(time.Hour), now.Add(2*time.Hour)
+
+	legacyID, _ := products.InsertProduct("Lifecycle_Legacy", data_layer.MustParseAmount("5"), "EUR")
+
+	ids, err := products.InsertProducts([]data_layer.Product{
+		{Name: "Lifecycle_Plain", Price: data_layer.MustParseAmount("10"), Currency: "EUR"},
+		{Name: "Lifecycle_Scheduled", Price: data_layer.MustParseAmount("20"), Currency: "EUR", PublishAt: &publishAt, UnpublishAt: &unpublishAt},
+		{Name: "Lifecycle_Archived", Price: data_layer.MustParseAmount("30"), Currency: "EUR", Status: data_layer.StatusArchived, UnpublishAt: &unpublishAt},
+	})
+
+	require.NoError(t, err)
+
+	// Products are active unless they say otherwise or have a publish_at, and schedules only apply where they can
+	for id, expected := range map[uint]string{legacyID: data_layer.StatusActive, ids[0]: data_layer.StatusActive, ids[1]: data_layer.StatusDraft, ids[2]: data_layer.StatusArchived} {
+		product, err := products.RetrieveProduct(int(id), false)
+		require.NoError(t, err)
+		assert.Equal(t, expected, product.Status, product.Name)
+	}
+
+	scheduled, _ := products.RetrieveProduct(int(ids[1]), false)
+
+	require.NotNil(t, scheduled.PublishAt)
+	require.NotNil(t, scheduled.UnpublishAt)
+	assert.True(t, publishAt.Equal(*scheduled.PublishAt))
+	assert.True(t, unpublishAt.Equal(*scheduled.UnpublishAt))
+
+	archived, _ := products.RetrieveProduct(int(ids[2]), false)
+
+	assert.Nil(t, archived.UnpublishAt)
+
+	_, err = products.InsertProducts([]data_layer.Product{{Name: "Lifecycle_Bad", Price: data_layer.MustParseAmount("1"), Currency: "EUR", Status: "retired"}})
+	assert.True(t, errors.Is(err, data_layer.ErrInvalidStatus))
+
+	_, err = products.InsertProducts([]data_layer.Product{{Name: "Lifecycle_Bad", Price: data_layer.MustParseAmount("1"), Currency: "EUR", PublishAt: &unpublishAt, UnpublishAt: &publishAt}})
+	assert.True(t, errors.Is(err, data_layer.ErrInvalidSchedule))
+
+	// Status filters
+	filter := data_layer.ProductFilter{NamePrefix: "Lifecycle_", Statuses: []string{data_layer.StatusActive}}
+
+	active, err := products.RetrieveProductsWithPagination(filter, nil, 0, 10)
+
+	require.NoError(t, err)
+	require.Len(t, active, 2)
+	assert.ElementsMatch(t, []uint{legacyID, ids[0]}, []uint{active[0].ID, active[1].ID})
+
+	total, err := products.GetTotalNumberOfProducts(data_layer.ProductFilter{NamePrefix: "Lifecycle_", Statuses: []string{data_layer.StatusDraft, data_layer.StatusArchived}})
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+
+	// Transitions
+	assert.True(t, errors.Is(products.UpdateProduct(int(ids[0]), data_layer.ProductChanges{Status: status(data_layer.StatusDraft)}, data_layer.AnyVersion), data_layer.ErrStatusTransition))
+	assert.True(t, errors.Is(products.UpdateProduct(int(ids[0]), data_layer.ProductChanges{Status: status("retired")}, data_layer.AnyVersion), data_layer.ErrInvalidStatus))
+	assert.True(t, errors.Is(products.UpdateProduct(int(ids[0]), data_layer.ProductChanges{Status: status(data_layer.StatusArchived)}, 99), data_layer.ErrVersionConflict))
+	assert.True(t, errors.Is(products.UpdateProduct(999999, data_layer.ProductChanges{Status: status(data_layer.StatusArchived)}, data_layer.AnyVersion), gorm.ErrRecordNotFound))
+
+	before, _ := products.RetrieveProduct(int(ids[0]), false)
+
+	require.NoError(t, products.UpdateProduct(int(ids[0]), data_layer.ProductChanges{Status: status(data_layer.StatusArchived)}, data_layer.AnyVersion))
+	require.NoError(t, products.UpdateProduct(int(ids[0]), data_layer.ProductChanges{Status: status(data_layer.StatusActive)}, data_layer.AnyVersion))
+
+	after, _ := products.RetrieveProduct(int(ids[0]), false)
+
+	assert.Equal(t, data_layer.StatusActive, after.Status)
+	assert.Equal(t, before.Version+2, after.Version)
+
+	// Schedules can be moved, and are checked against the stored one
+	assert.True(t, errors.Is(products.UpdateProduct(int(ids[1]), data_layer.ProductChanges{UnpublishAt: &publishAt}, data_layer.AnyVersion), data_layer.ErrInvalidSchedule))
+
+	later := unpublishAt.Add(time.Hour)
+
+	require.NoError(t, products.UpdateProduct(int(ids[1]), data_layer.ProductChanges{UnpublishAt: &later}, data_layer.AnyVersion))
+
+	// Publishing a draft by hand drops its publish_at, and a zero time removes a schedule
+	require.NoError(t, products.UpdateProduct(int(ids[1]), data_layer.ProductChanges{Status: status(data_layer.StatusActive), UnpublishAt: &time.Time{}}, data_layer.AnyVersion))
+
+	scheduled, _ = products.RetrieveProduct(int(ids[1]), false)
+
+	assert.Equal(t, data_layer.StatusActive, scheduled.Status)
+	assert.Nil(t, scheduled.PublishAt)
+	assert.Nil(t, scheduled.UnpublishAt)
+
+	// The scheduler publishes due drafts and archives due active products, deleted ones aside
+	pastPublish, pastUnpublish := now.Add(-2*time.Hour), now.Add(-time.Hour)
+
+	due, err := products.InsertProducts([]data_layer.Product{
+		{Name: "Lifecycle_DueDraft", Price: data_layer.MustParseAmount("1"), Currency: "EUR", PublishAt: &pastPublish},
+		{Name: "Lifecycle_DueActive", Price: data_layer.MustParseAmount("1"), Currency: "EUR", UnpublishAt: &pastUnpublish},
+		{Name: "Lifecycle_DueBoth", Price: data_layer.MustParseAmount("1"), Currency: "EUR", PublishAt: &pastPublish, UnpublishAt: &pastUnpublish},
+		{Name: "Lifecycle_DueDeleted", Price: data_layer.MustParseAmount("1"), Currency: "EUR", PublishAt: &pastPublish},
+		{Name: "Lifecycle_NotDue", Price: data_layer.MustParseAmount("1"), Currency: "EUR", PublishAt: &publishAt},
+	})
+
+	require.NoError(t, err)
+	require.NoError(t, products.DeleteProduct(int(due[3]), data_layer.AnyVersion))
+
+	draft, _ := products.RetrieveProduct(int(due[0]), false)
+
+	changed, err := products.ApplyProductSchedules(now)
+
+	require.NoError(t, err)
+	assert.Equal(t, 4, changed)
+
+	for i, expected := range []string{data_layer.StatusActive, data_layer.StatusArchived, data_layer.StatusArchived, data_layer.StatusDraft, data_layer.StatusDraft} {
+		product, err := products.RetrieveProduct(int(due[i]), true)
+		require.NoError(t, err)
+		assert.Equal(t, expected, product.Status, product.Name)
+	}
+
+	published, _ := products.RetrieveProduct(int(due[0]), false)
+
+	assert.Nil(t, published.PublishAt)
+	assert.Equal(t, draft.Version+1, published.Version)
+
+	unpublished, _ := products.RetrieveProduct(int(due[1]), false)
+
+	assert.Nil(t, unpublished.UnpublishAt)
+
+	changed, err = products.ApplyProductSchedules(now)
+
+	require.NoError(t, err)
+	assert.Zero(t, changed)
+}
+
+func conformanceLifecycleSearch(t *testing.T, products data_layer.Repository) {
+
+	status := func(value string) *string { return &value }
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	later := now.Add(time.Hour)
+
+	ids, err := products.InsertProducts([]data_layer.Product{
+		{Name: "Zephyrine Active", Price: data_layer.MustParseAmount("10"), Currency: "EUR"},
+		{Name: "Zephyrine Draft", Price: data_layer.MustParseAmount("20"), Currency: "EUR", PublishAt: &later},
+		{Name: "Zephyrine Archived", Price: data_layer.MustParseAmount("30"), Currency: "EUR", Status: data_layer.StatusArchived},
+	})
+
+	require.NoError(t, err)
+
+	active := []string{data_layer.StatusActive}
+
+	search := func(statuses []string) []uint {
+
+		results, err := products.SearchProducts("zephyrine", statuses, 0, 10)
+
+		require.NoError(t, err)
+
+		var found []uint
+
+		for _, result := range results {
+			found = append(found, result.Product.ID)
+		}
+
+		return found
+	}
+
+	suggest := func(statuses []string) []uint {
+
+		suggestions, err := products.SuggestProducts("zephyr", statuses, 0, 10)
+
+		require.NoError(t, err)
+
+		var found []uint
+
+		for _, suggestion := range suggestions {
+			found = append(found, suggestion.ProductID)
+		}
+
+		return found
+	}
+
+	assert.Equal(t, []uint{ids[0]}, search(active))
+	assert.ElementsMatch(t, ids, search(nil))
+	assert.Equal(t, []uint{ids[0]}, suggest(active))
+	assert.ElementsMatch(t, ids, suggest(nil))
+
+	// Status changes move products in and out of the suggestions, whether made by a write or by the scheduler
+	require.NoError(t, products.UpdateProduct(int(ids[0]), data_layer.ProductChanges{Status: status(data_layer.StatusArchived)}, data_layer.AnyVersion))
+	require.NoError(t, products.UpdateProduct(int(ids[2]), data_layer.ProductChanges{Status: status(data_layer.StatusActive)}, data_layer.AnyVersion))
+
+	assert.Equal(t, []uint{ids[2]}, search(active))
+	assert.Equal(t, []uint{ids[2]}, suggest(active))
+
+	_, err = products.ApplyProductSchedules(later)
+
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []uint{ids[1], ids[2]}, search(active))
+	assert.ElementsMatch(t, []uint{ids[1], ids[2]}, suggest(active))
+	assert.ElementsMatch(t, ids, suggest(nil))
+}
+
+func conformanceLifecycleCounts(t *testing.T, products data_layer.Repository) {
+
+	later := time.Now().Add(time.Hour)
+
+	ids, err := products.InsertProducts([]data_layer.Product{
+		{Name: "Counted_Active", Price: data_layer.MustParseAmount("10"), Currency: "EUR"},
+		{Name: "Counted_Draft", Price: data_layer.MustParseAmount("20"), Currency: "EUR", PublishAt: &later},
+		{Name: "Counted_Archived", Price: data_layer.MustParseAmount("30"), Currency: "EUR", Status: data_layer.StatusArchived},
+	})
+
+	require.NoError(t, err)
+
+	category, err := products.CreateCategory("Counted", nil)
+
+	require.NoError(t, err)
+
+	for _, productID := range ids {
+		require.NoError(t, products.AssignProductCategory(int(productID), category.ID))
+
+		_, err = products.AddProductTags(int(productID), []string{"counted"})
+		require.NoError(t, err)
+	}
+
+	// Counts follow the statuses, like the product list they lead to
+	for _, testCase := range []struct {
+		statuses []string
+		expected int
+	}{
+		{[]string{data_layer.StatusActive}, 1},
+		{[]string{data_layer.StatusDraft, data_layer.StatusArchived}, 2},
+		{nil, 3},
+	} {
+		tree, err := products.RetrieveCategoryTree(testCase.statuses)
+
+		require.NoError(t, err)
+		require.Len(t, tree, 1)
+		assert.Equal(t, testCase.expected, tree[0].ProductCount, testCase.statuses)
+		assert.Equal(t, testCase.expected, tree[0].TotalProductCount, testCase.statuses)
+
+		cloud, err := products.RetrieveTagCloud(testCase.statuses, 0)
+
+		require.NoError(t, err)
+		assert.Equal(t, []data_layer.TagCount{{Name: "counted", Count: testCase.expected}}, cloud, testCase.statuses)
+	}
+}
@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundingRules_Modes(t *testing.T) {
+
+	rules, err := data_layer.ParseRoundingRules("CHF=0.05,SEK=1:down,NOK=1:up,DKK=1:half_even")
+
+	require.NoError(t, err)
+
+	// 1234.5 minor units
+	exact := big.NewRat(24690, 20)
+
+	assert.Equal(t, data_layer.Amount(1235), rules.For("USD").Round(exact))
+	assert.Equal(t, data_layer.Amount(1235), rules.For("CHF").Round(exact))
+	assert.Equal(t, data_layer.Amount(1200), rules.For("SEK").Round(exact))
+	assert.Equal(t, data_layer.Amount(1300), rules.For("NOK").Round(exact))
+	assert.Equal(t, data_layer.Amount(1200), rules.For("DKK").Round(exact))
+	assert.Equal(t, data_layer.Amount(1200), rules.For("JPY").Round(exact))
+
+	_, err = data_layer.ParseRoundingRules("CHF=0.05:sideways")
+	assert.Error(t, err)
+
+	_, err = data_layer.ParseRoundingRules("CHF")
+	assert.Error(t, err)
+}
+
+func TestExchangeRateTable_ConvertsBothWays(t *testing.T) {
+
+	table := data_layer.NewExchangeRateTable([]data_layer.ExchangeRate{{BaseCurrency: "EUR", QuoteCurrency: "USD", Rate: data_layer.MustParseRate("1.25")}})
+
+	rule := data_layer.DefaultRoundingRules().For("USD")
+
+	converted, err := table.Convert(data_layer.MustParseAmount("10"), "EUR", "USD", rule)
+
+	require.NoError(t, err)
+	assert.Equal(t, data_layer.MustParseAmount("12.50"), converted)
+
+	converted, err = table.Convert(data_layer.MustParseAmount("12.50"), "USD", "EUR", rule)
+
+	require.NoError(t, err)
+	assert.Equal(t, data_layer.MustParseAmount("10"), converted)
+
+	_, err = table.Convert(data_layer.MustParseAmount("10"), "EUR", "GBP", rule)
+
+	assert.ErrorIs(t, err, data_layer.ErrNoExchangeRate)
+}
+
+// putJSON sends a JSON body with PUT and returns the response
+func putJSON(t *testing.T, app *fiber.App, path string, payload interface{}) *http.Response {
+
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPut, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+
+	require.NoError(t, err)
+
+	return resp
+}
+
+func TestRetrieveProduct_InRequestedCurrency(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Laptop_Multi_Currency", data_layer.MustParseAmount("1000"), "EUR")
+
+	resp := putJSON(t, app, "/set-exchange-rate", map[string]interface{}{"base": "EUR", "quote": "USD", "rate": "1.0875"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = putJSON(t, app, "/set-exchange-rate", map[string]interface{}{"base": "EUR", "quote": "JPY", "rate": 161.234})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = putJSON(t, app, "/set-product-price", map[string]interface{}{"id": productID, "currency": "gbp", "price": "849.99"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	testCases := []struct {
+		currency string
+		price    string
+		source   string
+	}{
+		{"USD", "1087.50", "exchange_rate"},
+		{"JPY", "161234.00", "exchange_rate"},
+		{"GBP", "849.99", "explicit"},
+		{"EUR", "1000.00", "base"},
+	}
+
+	for _, testCase := range testCases {
+		// Act
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/retrieve-product/%d?currency=%s", productID, testCase.currency), nil)
+		resp, _ := app.Test(req, -1)
+
+		// Assert
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var responseData map[string]json.RawMessage
+		json.NewDecoder(resp.Body).Decode(&responseData)
+
+		assert.Equal(t, testCase.price, string(responseData["price"]), testCase.currency)
+		assert.Equal(t, `"`+testCase.currency+`"`, string(responseData["currency"]))
+		assert.Equal(t, `"`+testCase.source+`"`, string(responseData["price_source"]))
+	}
+
+	// No rate to CHF
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/retrieve-product/%d?currency=CHF", productID), nil)
+	resp, _ = app.Test(req, -1)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+}
+
+func TestRetrieveProducts_InRequestedCurrency(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	products.InsertProduct("Product_EUR", data_layer.MustParseAmount("10"), "EUR")
+	products.InsertProduct("Product_USD", data_layer.MustParseAmount("20"), "USD")
+	products.SetExchangeRate("USD", "EUR", data_layer.MustParseRate("0.5"))
+
+	// Act
+	req := httptest.NewRequest(http.MethodGet, "/retrieve-products?currency=EUR", nil)
+	resp, _ := app.Test(req, -1)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var responseData map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&responseData)
+
+	productsPage := responseData["products"].([]interface{})
+	require.Len(t, productsPage, 2)
+	assert.Equal(t, float64(10), productsPage[0].(map[string]interface{})["price"])
+	assert.Equal(t, float64(10), productsPage[1].(map[string]interface{})["price"])
+	assert.Equal(t, "exchange_rate", productsPage[1].(map[string]interface{})["price_source"])
+}
+
+func TestSetExchangeRate_InvalidPair(t *testing.T) {
+	t.Parallel()
+
+	app := SetupAppWithRepository(data_layer.NewMemoryProductRepository())
+
+	resp := putJSON(t, app, "/set-exchange-rate", map[string]interface{}{"base": "EUR", "quote": "EUR", "rate": 1})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = putJSON(t, app, "/set-exchange-rate", map[string]interface{}{"base": "EUR", "quote": "USD", "rate": -1})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"simpler-go-home-test/data_layer"
+	"strings"
+	"testing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exportBody sends an export request and returns the answer with its whole body
+func exportBody(t *testing.T, app *fiber.App, path string) (*http.Response, []byte) {
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil), -1)
+
+	require.NoError(t, err)
+
+	body, err := io.ReadAll(resp.Body)
+
+	require.NoError(t, err)
+
+	return resp, body
+}
+
+func newExportApp(t *testing.T) (*fiber.App, data_layer.Repository) {
+
+	products := data_layer.NewMemoryProductRepository()
+
+	products.InsertProduct("Export_Laptop", data_layer.MustParseAmount("1500.50"), "EUR")
+	products.InsertProduct("Export_Phone, \"Pro\"", data_layer.MustParseAmount("800"), "USD")
+	deletedID, _ := products.InsertProduct("Export_Tablet", data_layer.MustParseAmount("650"), "EUR")
+
+	require.NoError(t, products.DeleteProduct(int(deletedID), data_layer.AnyVersion))
+
+	return SetupAppWithRepository(products), products
+}
+
+func TestExportProducts_Formats(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	app, _ := newExportApp(t)
+
+	// Act - JSON
+	resp, body := exportBody(t, app, "/v1/products/export")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Regexp(t, `^attachment; filename="products-\d{8}-\d{6}\.json"$`, resp.Header.Get("Content-Disposition"))
+	assert.Equal(t, "2", resp.Header.Get("X-Total-Count"))
+
+	var exported []map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &exported))
+	require.Len(t, exported, 2)
+	assert.Equal(t, "Export_Laptop", exported[0]["name"])
+	assert.Equal(t, 1500.5, exported[0]["price"])
+	assert.Equal(t, float64(1), exported[0]["version"])
+
+	// Act - NDJSON, filtered and sorted
+	resp, body = exportBody(t, app, "/v1/products/export?format=ndjson&include_deleted=true&sort=-price&max_price=1000")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"name":"Export_Phone, \"Pro\""`)
+	assert.Contains(t, lines[1], `"deleted_at":`)
+
+	// Act - CSV
+	resp, body = exportBody(t, app, "/v1/products/export?format=csv")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, []string{"id", "name", "price", "currency", "created_at", "updated_at", "deleted_at", "version", "sku", "gtin", "status", "publish_at", "unpublish_at"}, records[0])
+	assert.Equal(t, []string{"1", "Export_Laptop", "1500.50", "EUR"}, records[1][:4])
+	assert.Equal(t, "Export_Phone, \"Pro\"", records[2][1])
+}
+
+func TestExportProducts_Gzip(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	app, products := newExportApp(t)
+
+	// More than one flush worth of products
+	for i := 0; i < 250; i++ {
+		products.InsertProduct("Export_Bulk", data_layer.MustParseAmount("1"), "EUR")
+	}
+
+	// Act
+	resp, body := exportBody(t, app, "/v1/products/export?format=ndjson&gzip=true")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/gzip", resp.Header.Get("Content-Type"))
+	assert.Regexp(t, `filename="products-\d{8}-\d{6}\.ndjson\.gz"$`, resp.Header.Get("Content-Disposition"))
+
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+
+	uncompressed, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(uncompressed)), "\n"), 252)
+}
+
+func TestExportProducts_InvalidRequests(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	app, _ := newExportApp(t)
+
+	for _, path := range []string{
+		"/v1/products/export?format=xml",
+		"/v1/products/export?gzip=maybe",
+		"/v1/products/export?sort=colour",
+		"/v1/products/export?min_price=10&max_price=5",
+	} {
+
+		// Act
+		resp, _ := exportBody(t, app, path)
+
+		// Assert
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+	}
+}
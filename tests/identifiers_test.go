@@ -0,0 +1,207 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentifiers_CreateAndLookup(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	app := SetupAppWithRepository(data_layer.NewMemoryProductRepository())
+
+	// Act
+	resp, responseData := sendJSON(t, app, http.MethodPost, "/v1/products", map[string]interface{}{"name": "Identified_Kettle", "price": "39.90", "sku": "ktl-1", "gtin": "4006381 333931"})
+
+	// Assert
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "KTL-1", responseData["sku"])
+	assert.Equal(t, "4006381333931", responseData["gtin"])
+
+	productID := responseData["id"]
+
+	// Act - Duplicates are conflicts, not server errors
+	resp, responseData = sendJSON(t, app, http.MethodPost, "/v1/products", map[string]interface{}{"name": "Identified_Copy", "price": "10", "sku": "KTL-1"})
+
+	// Assert
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Contains(t, responseData["Error"], "same SKU or GTIN")
+
+	resp, _ = sendJSON(t, app, http.MethodPost, "/insert-product", map[string]interface{}{"name": "Identified_Copy", "price": "10", "gtin": "4006381333931"})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// Act - A wrong check digit is a bad request
+	resp, responseData = sendJSON(t, app, http.MethodPost, "/v1/products", map[string]interface{}{"name": "Identified_Bad", "price": "10", "gtin": "4006381333932"})
+
+	// Assert
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, responseData["Error"], "check digit")
+
+	// Act - Lookups
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/products/lookup?sku=ktl-1")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, productID, responseData["id"])
+	assert.NotEmpty(t, resp.Header.Get("ETag"))
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/products/lookup?gtin=4006381-333931")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, productID, responseData["id"])
+
+	for path, status := range map[string]int{
+		"/v1/products/lookup":                         http.StatusBadRequest,
+		"/v1/products/lookup?sku=KTL-1&gtin=96385074": http.StatusBadRequest,
+		"/v1/products/lookup?gtin=96385075":           http.StatusBadRequest,
+		"/v1/products/lookup?sku=KTL%202":             http.StatusBadRequest,
+		"/v1/products/lookup?gtin=96385074":           http.StatusNotFound,
+		"/v1/products/lookup?sku=KTL-2":               http.StatusNotFound,
+	} {
+		resp, _ = sendRequest(t, app, http.MethodGet, path)
+		assert.Equal(t, status, resp.StatusCode, path)
+	}
+}
+
+func TestIdentifiers_VariantSKUs(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	sku := "BAG-1"
+
+	ids, _ := products.InsertProducts([]data_layer.Product{
+		{Name: "Identified_Bag", Price: data_layer.MustParseAmount("30"), Currency: "EUR", SKU: &sku},
+		{Name: "Identified_Belt", Price: data_layer.MustParseAmount("15"), Currency: "EUR"},
+	})
+	variant, _ := products.CreateProductVariant(int(ids[1]), data_layer.VariantSpec{SKU: "BELT-90", Options: map[string]string{"length": "90"}})
+
+	// Act - A variant SKU is looked up as well
+	resp, responseData := sendRequest(t, app, http.MethodGet, "/v1/products/lookup?sku=belt-90")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(ids[1]), responseData["id"])
+	require.NotNil(t, responseData["variant"])
+	assert.Equal(t, float64(variant.ID), responseData["variant"].(map[string]interface{})["id"])
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/products/lookup?sku=bag-1")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotContains(t, responseData, "variant")
+
+	// Act - Products and variants cannot share a SKU
+	resp, _ = sendJSON(t, app, http.MethodPost, "/v1/products", map[string]interface{}{"name": "Identified_Copy", "price": "10", "sku": "BELT-90"})
+
+	// Assert
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp, _ = sendJSON(t, app, http.MethodPost, fmt.Sprintf("/v1/products/%d/variants", ids[1]), map[string]interface{}{"sku": "bag-1", "options": map[string]string{"length": "100"}})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestIdentifiers_ReplaceAndPatch(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	sku, gtin := "MUG-1", "96385074"
+
+	ids, _ := products.InsertProducts([]data_layer.Product{
+		{Name: "Identified_Mug", Price: data_layer.MustParseAmount("8"), Currency: "EUR", SKU: &sku, GTIN: &gtin},
+		{Name: "Identified_Cup", Price: data_layer.MustParseAmount("6"), Currency: "EUR"},
+	})
+	mugPath := fmt.Sprintf("/v1/products/%d", ids[0])
+	cupPath := fmt.Sprintf("/v1/products/%d", ids[1])
+
+	// Act - A replacement without a GTIN removes it
+	resp, responseData := sendJSON(t, app, http.MethodPut, mugPath, map[string]interface{}{"name": "Identified_Mug", "price": "8", "currency": "EUR", "sku": "mug-1"})
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "MUG-1", responseData["sku"])
+	assert.Nil(t, responseData["gtin"])
+
+	// Act - Taking the SKU of another product
+	resp, _ = sendJSON(t, app, http.MethodPut, cupPath, map[string]interface{}{"name": "Identified_Cup", "price": "6", "currency": "EUR", "sku": "MUG-1"})
+
+	// Assert
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// Act - Patching the identifiers
+	resp, responseData = patchProduct(t, app, ids[1], "application/merge-patch+json", `{"sku": "cup-1", "gtin": "036000291452"}`, "")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "CUP-1", responseData["sku"])
+	assert.Equal(t, "036000291452", responseData["gtin"])
+
+	resp, _ = patchProduct(t, app, ids[1], "application/merge-patch+json", `{"sku": "MUG-1"}`, "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp, _ = patchProduct(t, app, ids[1], "application/merge-patch+json", `{"gtin": "036000291453"}`, "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, responseData = patchProduct(t, app, ids[1], "application/merge-patch+json", `{"sku": null}`, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, responseData["sku"])
+	assert.Equal(t, "036000291452", responseData["gtin"])
+}
+
+func TestIdentifiers_BulkAndImport(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	body := `[{"name": "Identified_Pen", "price": "2", "sku": "PEN"}, {"name": "Identified_Pencil", "price": "1", "sku": "pen"}]`
+
+	// Act - All or nothing
+	resp, responseData := sendBody(t, app, http.MethodPost, "/v1/products/bulk", "application/json", body)
+
+	// Assert - The conflicting product is named, and the others are not inserted
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, []string{"skipped", "rejected"}, bulkStatuses(responseData))
+	assert.Contains(t, responseData["results"].([]interface{})[1].(map[string]interface{})["error"], "same SKU or GTIN")
+	assert.Equal(t, float64(0), responseData["inserted"])
+
+	_, err := products.RetrieveProductBySKU("PEN")
+	assert.Error(t, err)
+
+	// Act - Best effort
+	resp, responseData = sendBody(t, app, http.MethodPost, "/v1/products/bulk?mode=best_effort", "application/json", body)
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"inserted", "rejected"}, bulkStatuses(responseData))
+	assert.Contains(t, responseData["results"].([]interface{})[1].(map[string]interface{})["error"], "same SKU or GTIN")
+
+	// Act - Import
+	csv := "name,price,sku,gtin\n" +
+		"Identified_Pen,2,pen-1,\n" +
+		"Identified_Ink,5,INK,96385074\n" +
+		"Identified_Nib,3,PEN-1,\n" +
+		"Identified_Pad,4,,96385075\n"
+
+	resp, responseData = sendBody(t, app, http.MethodPost, "/v1/products/import", "text/csv", csv)
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"updated", "accepted", "rejected", "rejected"}, importStatuses(responseData))
+
+	pen, err := products.RetrieveProductBySKU("PEN-1")
+	require.NoError(t, err)
+	assert.Equal(t, "Identified_Pen", pen.Name)
+
+	ink, err := products.RetrieveProductByGTIN("96385074")
+	require.NoError(t, err)
+	assert.Equal(t, "Identified_Ink", ink.Name)
+}
@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func importStatuses(responseData map[string]interface{}) []string {
+
+	var statuses []string
+
+	for _, row := range responseData["rows"].([]interface{}) {
+		statuses = append(statuses, row.(map[string]interface{})["status"].(string))
+	}
+
+	return statuses
+}
+
+func TestImportProducts_UpsertByName(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	laptopID, _ := products.InsertProduct("Import_Laptop", data_layer.MustParseAmount("1500"), "EUR")
+	products.InsertProduct("Import_Phone", data_layer.MustParseAmount("800"), "USD")
+
+	csv := "Title;Cost;Currency\n" +
+		"Import_Laptop;1600.50;\n" +
+		"Import_Phone;800;usd\n" +
+		"Import_Tablet;650;\n" +
+		";10;EUR\n" +
+		"Import_Mouse;0;EUR\n" +
+		"Import_Cable;abc;EUR\n"
+
+	// Act
+	resp, responseData := sendBody(t, app, http.MethodPost, "/v1/products/import?map=name=Title,price=Cost&delimiter=;", "text/csv", csv)
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"updated", "unchanged", "accepted", "rejected", "rejected", "rejected"}, importStatuses(responseData))
+	assert.Equal(t, float64(1), responseData["accepted"])
+	assert.Equal(t, float64(1), responseData["updated"])
+	assert.Equal(t, float64(1), responseData["unchanged"])
+	assert.Equal(t, float64(3), responseData["rejected"])
+
+	rows := responseData["rows"].([]interface{})
+	assert.Equal(t, float64(2), rows[0].(map[string]interface{})["row"])
+	assert.Equal(t, float64(laptopID), rows[0].(map[string]interface{})["product_id"])
+	assert.Contains(t, rows[4].(map[string]interface{})["error"], "price must be greater than zero")
+	assert.Contains(t, rows[5].(map[string]interface{})["error"], "invalid amount")
+
+	laptop, _ := products.RetrieveProduct(int(laptopID), false)
+	assert.Equal(t, data_layer.MustParseAmount("1600.50"), laptop.Price)
+	assert.Equal(t, "EUR", laptop.Currency)
+	assert.Equal(t, uint(2), laptop.Version)
+
+	total, _ := products.GetTotalNumberOfProducts(data_layer.ProductFilter{})
+	assert.Equal(t, int64(3), total)
+}
+
+func TestImportProducts_UpsertByIDFromMultipart(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	laptopID, _ := products.InsertProduct("Import_Laptop", data_layer.MustParseAmount("1500"), "EUR")
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	file, _ := form.CreateFormFile("file", "catalog.csv")
+	file.Write([]byte("\ufeffID,Name,Price\n" +
+		"1,Import_Laptop Pro,\n" +
+		",Import_Phone,800\n" +
+		"999,Import_Ghost,10\n"))
+	form.Close()
+
+	// Act
+	req := httptest.NewRequest(http.MethodPost, "/v1/products/import?key=id", body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := app.Test(req, -1)
+
+	require.NoError(t, err)
+
+	responseBody, _ := io.ReadAll(resp.Body)
+
+	var responseData map[string]interface{}
+	_ = json.Unmarshal(responseBody, &responseData)
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "id", responseData["key"])
+	assert.Equal(t, []string{"updated", "accepted", "rejected"}, importStatuses(responseData))
+
+	laptop, _ := products.RetrieveProduct(int(laptopID), false)
+	assert.Equal(t, "Import_Laptop Pro", laptop.Name)
+	assert.Equal(t, data_layer.MustParseAmount("1500"), laptop.Price)
+}
+
+func TestImportProducts_UpsertBySKUWithSchedules(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	sku := "DRL-18V"
+
+	ids, err := products.InsertProducts([]data_layer.Product{{Name: "Import_Drill", Price: data_layer.MustParseAmount("90"), Currency: "EUR", SKU: &sku}})
+
+	require.NoError(t, err)
+
+	csv := "sku,name,price,status,publish_at,unpublish_at\n" +
+		"drl-18v,Import_Drill Pro,,,,2027-01-01T00:00:00Z\n" +
+		"SAW-1,Import_Saw,120,draft,2027-02-01T09:00:00+02:00,\n" +
+		"DRL-18V,Import_Drill Pro,,,,2027-01-01T00:00:00Z\n" +
+		"SAW 2,Import_Saw 2,10,,,\n" +
+		"SAW-3,Import_Saw 3,10,draft,tomorrow,\n" +
+		"SAW-4,Import_Saw 4,10,draft,2027-03-01T00:00:00Z,2027-02-01T00:00:00Z\n"
+
+	// Act
+	resp, responseData := sendBody(t, app, http.MethodPost, "/v1/products/import?key=sku", "text/csv", csv)
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "sku", responseData["key"])
+	assert.Equal(t, []string{"updated", "accepted", "unchanged", "rejected", "rejected", "rejected"}, importStatuses(responseData))
+
+	rows := responseData["rows"].([]interface{})
+	assert.Equal(t, float64(ids[0]), rows[0].(map[string]interface{})["product_id"])
+	assert.Contains(t, rows[3].(map[string]interface{})["error"], "invalid sku")
+	assert.Contains(t, rows[4].(map[string]interface{})["error"], "invalid publish_at")
+	assert.Contains(t, rows[5].(map[string]interface{})["error"], "unpublish_at must come after publish_at")
+
+	drill, _ := products.RetrieveProduct(int(ids[0]), false)
+	assert.Equal(t, "Import_Drill Pro", drill.Name)
+	require.NotNil(t, drill.UnpublishAt)
+	assert.True(t, drill.UnpublishAt.Equal(time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)))
+
+	saw, err := products.RetrieveProductBySKU("saw-1")
+
+	require.NoError(t, err)
+	assert.Equal(t, data_layer.StatusDraft, saw.Status)
+	require.NotNil(t, saw.PublishAt)
+	assert.True(t, saw.PublishAt.Equal(time.Date(2027, time.February, 1, 7, 0, 0, 0, time.UTC)))
+}
+
+func TestImportProducts_InvalidRequests(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	app := SetupAppWithRepository(data_layer.NewMemoryProductRepository())
+
+	cases := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"unknown key", "/v1/products/import?key=gtin", "text/csv", "name,price\nLaptop,10\n", http.StatusBadRequest},
+		{"unknown field", "/v1/products/import?map=colour=Color", "text/csv", "name,price\nLaptop,10\n", http.StatusBadRequest},
+		{"mapped column missing", "/v1/products/import?map=price=Cost", "text/csv", "name,price\nLaptop,10\n", http.StatusBadRequest},
+		{"no key column", "/v1/products/import?key=id", "text/csv", "name,price\nLaptop,10\n", http.StatusBadRequest},
+		{"empty file", "/v1/products/import", "text/csv", "", http.StatusBadRequest},
+		{"bad delimiter", "/v1/products/import?delimiter=ab", "text/csv", "name,price\nLaptop,10\n", http.StatusBadRequest},
+		{"not csv", "/v1/products/import", "application/json", `[{"name": "Laptop"}]`, http.StatusUnsupportedMediaType},
+	}
+
+	for _, testCase := range cases {
+
+		// Act
+		resp, _ := sendBody(t, app, http.MethodPost, testCase.path, testCase.contentType, testCase.body)
+
+		// Assert
+		assert.Equal(t, testCase.status, resp.StatusCode, testCase.name)
+	}
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInventory_AdjustReserveAndCommit(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Stock_Shirt", data_layer.MustParseAmount("20"), "EUR")
+	stockPath := fmt.Sprintf("/v1/products/%d/stock", productID)
+
+	// Act - Receive stock
+	resp, responseData := sendJSON(t, app, http.MethodPost, stockPath+"/adjustments", map[string]interface{}{"delta": 10, "reason": "received"})
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(10), responseData["on_hand"])
+	assert.Equal(t, float64(10), responseData["available"])
+
+	// Act - Hold 4 units
+	resp, responseData = sendJSON(t, app, http.MethodPost, stockPath+"/holds", map[string]interface{}{"hold_id": "order-1", "quantity": 4, "ttl_seconds": 60})
+
+	// Assert
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "/v1/stock-holds/order-1", resp.Header.Get("Location"))
+	assert.Equal(t, float64(4), responseData["quantity"])
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, stockPath)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(4), responseData["reserved"])
+	assert.Equal(t, float64(6), responseData["available"])
+
+	resp, _ = sendRequest(t, app, http.MethodGet, "/v1/stock-holds/order-1")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Act - Commit the hold
+	resp, responseData = sendJSON(t, app, http.MethodPost, "/v1/stock-holds/order-1/commit", nil)
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(6), responseData["on_hand"])
+	assert.Equal(t, float64(0), responseData["reserved"])
+
+	// Act - Hold and release
+	resp, _ = sendJSON(t, app, http.MethodPost, stockPath+"/holds", map[string]interface{}{"hold_id": "order-2", "quantity": 6})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, _ = sendRequest(t, app, http.MethodDelete, "/v1/stock-holds/order-2")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// Assert - The ledger lists the movements, newest first
+	resp, responseData = sendRequest(t, app, http.MethodGet, stockPath+"/movements")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	movements := responseData["movements"].([]interface{})
+	require.Len(t, movements, 2)
+	assert.Equal(t, "sold", movements[0].(map[string]interface{})["reason"])
+	assert.Equal(t, "order-1", movements[0].(map[string]interface{})["hold_id"])
+	assert.Equal(t, float64(-4), movements[0].(map[string]interface{})["delta"])
+}
+
+func TestInventory_Errors(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Stock_Shirt", data_layer.MustParseAmount("20"), "EUR")
+	products.AdjustStock(int(productID), 0, 0, 2, data_layer.ReasonReceived)
+	products.ReserveStock("order-1", int(productID), 0, 0, 1, time.Now().Add(time.Hour))
+	products.ReserveStock("order-expired", int(productID), 0, 0, 1, time.Now().Add(-time.Second))
+
+	stockPath := fmt.Sprintf("/v1/products/%d/stock", productID)
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		payload interface{}
+		status  int
+	}{
+		// First, as the other calls on the product release its expired holds
+		{"expired hold", http.MethodPost, "/v1/stock-holds/order-expired/commit", nil, http.StatusGone},
+		{"unknown reason", http.MethodPost, stockPath + "/adjustments", map[string]interface{}{"delta": 1, "reason": "gift"}, http.StatusBadRequest},
+		{"zero delta", http.MethodPost, stockPath + "/adjustments", map[string]interface{}{"delta": 0, "reason": "received"}, http.StatusBadRequest},
+		{"negative stock", http.MethodPost, stockPath + "/adjustments", map[string]interface{}{"delta": -3, "reason": "lost"}, http.StatusConflict},
+		{"held units", http.MethodPost, stockPath + "/adjustments", map[string]interface{}{"delta": -2, "reason": "lost"}, http.StatusConflict},
+		{"missing product", http.MethodGet, "/v1/products/999/stock", nil, http.StatusNotFound},
+		{"invalid ID", http.MethodGet, "/v1/products/abc/stock", nil, http.StatusBadRequest},
+		{"not enough stock", http.MethodPost, stockPath + "/holds", map[string]interface{}{"hold_id": "order-2", "quantity": 5}, http.StatusConflict},
+		{"reused hold ID", http.MethodPost, stockPath + "/holds", map[string]interface{}{"hold_id": "order-1", "quantity": 2}, http.StatusConflict},
+		{"missing hold ID", http.MethodPost, stockPath + "/holds", map[string]interface{}{"quantity": 1}, http.StatusBadRequest},
+		{"invalid TTL", http.MethodPost, stockPath + "/holds", map[string]interface{}{"hold_id": "order-3", "quantity": 1, "ttl_seconds": -5}, http.StatusBadRequest},
+		{"missing hold", http.MethodDelete, "/v1/stock-holds/order-9", nil, http.StatusNotFound},
+		{"invalid limit", http.MethodGet, stockPath + "/movements?limit=0", nil, http.StatusBadRequest},
+	}
+
+	for _, testCase := range cases {
+
+		// Act
+		resp, _ := sendJSON(t, app, testCase.method, testCase.path, testCase.payload)
+
+		// Assert
+		assert.Equal(t, testCase.status, resp.StatusCode, testCase.name)
+	}
+}
@@ -0,0 +1,305 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"simpler-go-home-test/api"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycle_PublicCallsOnlyShowActiveProducts(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	sku := "DRAFT-1"
+	publishAt := time.Now().Add(time.Hour)
+
+	ids, _ := products.InsertProducts([]data_layer.Product{
+		{Name: "Lifecycle_Active", Price: data_layer.MustParseAmount("10"), Currency: "EUR"},
+		{Name: "Lifecycle_Draft", Price: data_layer.MustParseAmount("20"), Currency: "EUR", SKU: &sku, PublishAt: &publishAt},
+		{Name: "Lifecycle_Archived", Price: data_layer.MustParseAmount("30"), Currency: "EUR", Status: data_layer.StatusArchived},
+	})
+
+	// Act - Lists
+	resp, responseData := sendRequest(t, app, http.MethodGet, "/v1/products")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(1), responseData["metadata"].(map[string]interface{})["total_number_of_products"])
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/products?admin=true")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(3), responseData["metadata"].(map[string]interface{})["total_number_of_products"])
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/products?admin=true&status=draft,archived")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(2), responseData["metadata"].(map[string]interface{})["total_number_of_products"])
+
+	for _, path := range []string{"/v1/products?status=draft", "/v1/products?admin=true&status=retired", "/v1/products?admin=maybe"} {
+		resp, _ = sendRequest(t, app, http.MethodGet, path)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+	}
+
+	resp, _ = sendRequest(t, app, http.MethodGet, "/v1/products?status=active")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Act - Retrieve and lookup
+	draftPath := fmt.Sprintf("/v1/products/%d", ids[1])
+
+	resp, _ = sendRequest(t, app, http.MethodGet, draftPath)
+
+	// Assert
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, draftPath+"?admin=true")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "draft", responseData["status"])
+	assert.NotNil(t, responseData["publish_at"])
+
+	resp, _ = sendRequest(t, app, http.MethodGet, fmt.Sprintf("/retrieve-product/%d", ids[2]))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = sendRequest(t, app, http.MethodGet, "/v1/products/lookup?sku=DRAFT-1")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = sendRequest(t, app, http.MethodGet, "/v1/products/lookup?sku=DRAFT-1&admin=true")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, fmt.Sprintf("/v1/products/%d", ids[0]))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "active", responseData["status"])
+}
+
+func TestLifecycle_SearchAutocompleteAndExportHideDrafts(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	app := SetupAppWithRepository(data_layer.NewMemoryProductRepository())
+
+	resp, _ := sendJSON(t, app, http.MethodPost, "/v1/products", map[string]interface{}{"name": "Secret Launch", "price": "10", "status": "draft"})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, _ = sendJSON(t, app, http.MethodPost, "/v1/products", map[string]interface{}{"name": "Secondhand Lamp", "price": "15"})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// Act - Search
+	resp, responseData := sendRequest(t, app, http.MethodGet, "/v1/products/search?q=secret")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, responseData["results"])
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/products/search?q=secret&admin=true")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, responseData["results"], 1)
+
+	// Act - Autocomplete
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/products/autocomplete?prefix=sec")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, responseData["suggestions"], 1)
+	assert.Equal(t, "Secondhand Lamp", responseData["suggestions"].([]interface{})[0].(map[string]interface{})["name"])
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/products/autocomplete?prefix=sec&admin=true")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, responseData["suggestions"], 2)
+
+	// Act - Export
+	resp, body := exportBody(t, app, "/v1/products/export?format=ndjson")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("X-Total-Count"))
+	assert.NotContains(t, string(body), "Secret Launch")
+
+	resp, body = exportBody(t, app, "/v1/products/export?format=ndjson&admin=true&status=draft")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("X-Total-Count"))
+	assert.Contains(t, string(body), "Secret Launch")
+
+	for _, path := range []string{"/v1/products/search?q=secret&admin=maybe", "/v1/products/autocomplete?prefix=sec&admin=maybe", "/v1/products/export?admin=maybe", "/v1/products/export?status=draft"} {
+		resp, _ = sendRequest(t, app, http.MethodGet, path)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+	}
+}
+
+func TestLifecycle_SubResourcesOfDraftsAreHidden(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	ids, _ := products.InsertProducts([]data_layer.Product{
+		{Name: "Lifecycle_Hidden", Price: data_layer.MustParseAmount("20"), Currency: "EUR", Status: data_layer.StatusDraft},
+		{Name: "Lifecycle_Retired", Price: data_layer.MustParseAmount("30"), Currency: "EUR", Status: data_layer.StatusArchived},
+	})
+
+	for _, productID := range ids {
+
+		variant, err := products.CreateProductVariant(int(productID), data_layer.VariantSpec{SKU: fmt.Sprintf("HIDDEN-%d", productID), Options: map[string]string{"size": "M"}})
+		require.NoError(t, err)
+
+		paths := []string{
+			fmt.Sprintf("/v1/products/%d/variants", productID),
+			fmt.Sprintf("/v1/products/%d/variants/%d", productID, variant.ID),
+			fmt.Sprintf("/v1/products/%d/prices", productID),
+			fmt.Sprintf("/v1/products/%d/tags", productID),
+			fmt.Sprintf("/v1/products/%d/categories", productID),
+			fmt.Sprintf("/v1/products/%d/stock", productID),
+			fmt.Sprintf("/v1/products/%d/variants/%d/stock", productID, variant.ID),
+		}
+
+		for _, path := range paths {
+			// Act
+			resp, _ := sendRequest(t, app, http.MethodGet, path)
+
+			// Assert - Not found like the product itself, but for admins
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+
+			resp, _ = sendRequest(t, app, http.MethodGet, path+"?admin=true")
+			assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+
+			resp, _ = sendRequest(t, app, http.MethodGet, path+"?admin=maybe")
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+		}
+	}
+}
+
+func TestLifecycle_TreeAndCloudCountActiveProducts(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	ids, _ := products.InsertProducts([]data_layer.Product{
+		{Name: "Lifecycle_Shown", Price: data_layer.MustParseAmount("10"), Currency: "EUR"},
+		{Name: "Lifecycle_Unpublished", Price: data_layer.MustParseAmount("20"), Currency: "EUR", Status: data_layer.StatusDraft},
+	})
+
+	category, _ := products.CreateCategory("Lifecycle", nil)
+
+	for _, productID := range ids {
+		require.NoError(t, products.AssignProductCategory(int(productID), category.ID))
+
+		_, err := products.AddProductTags(int(productID), []string{"launch"})
+		require.NoError(t, err)
+	}
+
+	for _, testCase := range []struct {
+		query    string
+		expected float64
+	}{
+		{"", 1},
+		{"?admin=true", 2},
+	} {
+		// Act
+		resp, responseData := sendRequest(t, app, http.MethodGet, "/v1/categories/tree"+testCase.query)
+
+		// Assert - The same products as /v1/products?category= and ?tags=
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, testCase.expected, responseData["categories"].([]interface{})[0].(map[string]interface{})["product_count"], testCase.query)
+
+		resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/tags"+testCase.query)
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, testCase.expected, responseData["tags"].([]interface{})[0].(map[string]interface{})["count"], testCase.query)
+	}
+
+	for _, path := range []string{"/v1/categories/tree?admin=maybe", "/v1/tags?admin=maybe"} {
+		resp, _ := sendRequest(t, app, http.MethodGet, path)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+	}
+}
+
+func TestLifecycle_CreateAndTransitions(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	app := SetupAppWithRepository(data_layer.NewMemoryProductRepository())
+
+	publishAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	// Act - A product created with a publish_at is a draft
+	resp, responseData := sendJSON(t, app, http.MethodPost, "/v1/products", map[string]interface{}{"name": "Lifecycle_Lamp", "price": "40", "publish_at": publishAt})
+
+	// Assert
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "draft", responseData["status"])
+
+	productPath := resp.Header.Get("Location")
+
+	for _, body := range []map[string]interface{}{
+		{"name": "Lifecycle_Bad", "price": "1", "status": "retired"},
+		{"name": "Lifecycle_Bad", "price": "1", "publish_at": publishAt, "unpublish_at": publishAt},
+	} {
+		resp, _ = sendJSON(t, app, http.MethodPost, "/v1/products", body)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+	}
+
+	// Act - Publishing by hand drops the publish_at
+	resp, responseData = patchProduct(t, app, 1, "application/merge-patch+json", `{"status": "active"}`, "")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "active", responseData["status"])
+	assert.Nil(t, responseData["publish_at"])
+
+	// Act - Active products cannot go back to draft
+	resp, responseData = patchProduct(t, app, 1, "application/merge-patch+json", `{"status": "draft"}`, "")
+
+	// Assert
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Contains(t, responseData["Error"], "cannot go from active to draft")
+
+	resp, _ = patchProduct(t, app, 1, "application/merge-patch+json", `{"status": null}`, "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Act - Replacing keeps a missing status, and archives an explicit one
+	resp, responseData = sendJSON(t, app, http.MethodPut, productPath, map[string]interface{}{"name": "Lifecycle_Lamp", "price": "45", "currency": "EUR"})
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "active", responseData["status"])
+
+	resp, responseData = sendJSON(t, app, http.MethodPut, productPath, map[string]interface{}{"name": "Lifecycle_Lamp", "price": "45", "currency": "EUR", "status": "archived"})
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "archived", responseData["status"])
+
+	resp, _ = sendJSON(t, app, http.MethodPut, productPath, map[string]interface{}{"name": "Lifecycle_Lamp", "price": "45", "currency": "EUR", "status": "draft"})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestLifecycle_SchedulerPublishesDueProducts(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	handlers := api.NewProductsAPI(products, data_layer.DefaultRoundingRules())
+
+	publishAt := time.Now().Add(50 * time.Millisecond)
+
+	ids, _ := products.InsertProducts([]data_layer.Product{{Name: "Lifecycle_Launch", Price: data_layer.MustParseAmount("99"), Currency: "EUR", PublishAt: &publishAt}})
+
+	stop := make(chan struct{})
+
+	defer close(stop)
+
+	// Act
+	go handlers.ApplyProductSchedulesEvery(10*time.Millisecond, stop)
+
+	// Assert
+	assert.Eventually(t, func() bool {
+		product, err := products.RetrieveProduct(int(ids[0]), false)
+		return err == nil && product.Status == data_layer.StatusActive
+	}, 2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"net/http"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetrieveProducts_FiltersAndSort(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	products.InsertProduct("Query_Laptop_Basic", data_layer.MustParseAmount("500"), "EUR")
+	products.InsertProduct("Query_Laptop_Pro", data_layer.MustParseAmount("1500"), "EUR")
+	products.InsertProduct("Query_Laptop_Air", data_layer.MustParseAmount("1100"), "EUR")
+	products.InsertProduct("Query_Phone", data_layer.MustParseAmount("800"), "EUR")
+
+	// Act
+	resp, responseData := sendRequest(t, app, http.MethodGet, "/v1/products?name_contains=LAPTOP&min_price=600&sort=-price,name&limit=1")
+
+	// Assert - The metadata counts the filtered products only
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	metadata := responseData["metadata"].(map[string]interface{})
+
+	assert.Equal(t, float64(2), metadata["total_number_of_products"])
+	assert.Equal(t, float64(2), metadata["total_pages"])
+
+	page := responseData["products"].([]interface{})
+
+	require.Len(t, page, 1)
+	assert.Equal(t, "Query_Laptop_Pro", page[0].(map[string]interface{})["name"])
+
+	_, responseData = sendRequest(t, app, http.MethodGet, "/v1/products?name_contains=LAPTOP&min_price=600&sort=-price,name&limit=1&page=2")
+
+	page = responseData["products"].([]interface{})
+
+	require.Len(t, page, 1)
+	assert.Equal(t, "Query_Laptop_Air", page[0].(map[string]interface{})["name"])
+
+	_, responseData = sendRequest(t, app, http.MethodGet, "/retrieve-products?name_prefix=query_p&max_price=800.00")
+
+	assert.Len(t, responseData["products"], 1)
+}
+
+func TestRetrieveProducts_TimeFilters(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	products.InsertProduct("Dated_Product", data_layer.MustParseAmount("10"), "EUR")
+
+	// Act & Assert
+	_, responseData := sendRequest(t, app, http.MethodGet, "/v1/products?created_after=2000-01-01&created_before=2999-01-01T00:00:00Z")
+	assert.Len(t, responseData["products"], 1)
+
+	_, responseData = sendRequest(t, app, http.MethodGet, "/v1/products?updated_after=2999-01-01")
+	assert.Empty(t, responseData["products"])
+}
+
+func TestRetrieveProducts_InvalidListQuery(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	app := SetupAppWithRepository(data_layer.NewMemoryProductRepository())
+
+	invalidQueries := []string{
+		"sort=color",
+		"sort=price,-price",
+		"sort=deleted_at",
+		"min_price=cheap",
+		"max_price=1.001",
+		"min_price=10&max_price=5",
+		"created_after=yesterday",
+		"updated_after=17/10/2026",
+	}
+
+	for _, query := range invalidQueries {
+
+		// Act
+		resp, responseData := sendRequest(t, app, http.MethodGet, "/v1/products?"+query)
+
+		// Assert
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+		assert.Contains(t, responseData["Error"], "Invalid list query", query)
+	}
+}
+
+func TestRetrieveProducts_CursorPagination(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	for _, name := range []string{"Cursor_E", "Cursor_D", "Cursor_C", "Cursor_B", "Cursor_A"} {
+		products.InsertProduct(name, data_layer.MustParseAmount("10"), "EUR")
+	}
+
+	names := func(responseData map[string]interface{}) []string {
+
+		var result []string
+
+		for _, product := range responseData["products"].([]interface{}) {
+			result = append(result, product.(map[string]interface{})["name"].(string))
+		}
+
+		return result
+	}
+
+	// Act - The first page comes from offset mode, then the cursors take over
+	_, responseData := sendRequest(t, app, http.MethodGet, "/v1/products?sort=name&limit=2")
+
+	metadata := responseData["metadata"].(map[string]interface{})
+
+	// Assert
+	assert.Equal(t, []string{"Cursor_A", "Cursor_B"}, names(responseData))
+	assert.Nil(t, metadata["prev_cursor"])
+	require.NotEmpty(t, metadata["next_cursor"])
+
+	_, responseData = sendRequest(t, app, http.MethodGet, "/v1/products?limit=2&cursor="+metadata["next_cursor"].(string))
+
+	metadata = responseData["metadata"].(map[string]interface{})
+
+	assert.Equal(t, []string{"Cursor_C", "Cursor_D"}, names(responseData))
+	require.NotEmpty(t, metadata["next_cursor"])
+	require.NotEmpty(t, metadata["prev_cursor"])
+
+	prevCursor := metadata["prev_cursor"].(string)
+
+	resp, responseData := sendRequest(t, app, http.MethodGet, "/v1/products?limit=2&cursor="+metadata["next_cursor"].(string))
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"Cursor_E"}, names(responseData))
+	assert.Nil(t, responseData["metadata"].(map[string]interface{})["next_cursor"])
+
+	_, responseData = sendRequest(t, app, http.MethodGet, "/v1/products?limit=2&cursor="+prevCursor)
+
+	assert.Equal(t, []string{"Cursor_A", "Cursor_B"}, names(responseData))
+	assert.Nil(t, responseData["metadata"].(map[string]interface{})["prev_cursor"])
+
+	// A cursor only pages the sort it was issued for
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/products?sort=-price&cursor="+prevCursor)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, responseData["Error"], "sort=name")
+
+	resp, _ = sendRequest(t, app, http.MethodGet, "/v1/products?cursor=not-a-cursor")
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
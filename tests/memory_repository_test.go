@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+// Every test gets its own in-memory catalog, so they can safely run in parallel
+
+func TestMemoryRepository_InsertAndRetrieveProduct(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	app := SetupAppWithRepository(data_layer.NewMemoryProductRepository())
+
+	body, _ := json.Marshal(map[string]interface{}{"name": "Laptop_Memory", "price": 999.5})
+	req := httptest.NewRequest(http.MethodPost, "/insert-product", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := app.Test(req, -1)
+
+	var insertResponse map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&insertResponse)
+	productID := int(insertResponse["product_id"].(float64))
+
+	// Act
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/retrieve-product/%d", productID), nil)
+	resp, _ = app.Test(req, -1)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var responseData map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&responseData)
+
+	assert.Equal(t, "Laptop_Memory", responseData["name"])
+	assert.Equal(t, 999.5, responseData["price"])
+}
+
+func TestMemoryRepository_UpdateAndDeleteProduct(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Phone_Memory", data_layer.MustParseAmount("300"), "EUR")
+
+	// Act - Rename the product, then delete it
+	updateBody, _ := json.Marshal(map[string]interface{}{"id": productID, "name": "Phone_Memory_Renamed"})
+	req := httptest.NewRequest(http.MethodPut, "/update-product-name", bytes.NewReader(updateBody))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := app.Test(req, -1)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	product, err := products.RetrieveProduct(int(productID), false)
+	assert.NoError(t, err)
+	assert.Equal(t, "Phone_Memory_Renamed", product.Name)
+
+	req = httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/delete-product/%d", productID), nil)
+	resp, _ = app.Test(req, -1)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/delete-product/%d", productID), nil)
+	resp, _ = app.Test(req, -1)
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestMemoryRepository_Pagination(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	for i := 1; i <= 25; i++ {
+		products.InsertProduct(fmt.Sprintf("Product_%d", i), data_layer.Amount(i*10000), "EUR")
+	}
+
+	// Act
+	req := httptest.NewRequest(http.MethodGet, "/retrieve-products?page=3&limit=10", nil)
+	resp, _ := app.Test(req, -1)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var responseData map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&responseData)
+
+	metadata := responseData["metadata"].(map[string]interface{})
+	assert.Equal(t, float64(3), metadata["total_pages"])
+	assert.Equal(t, float64(25), metadata["total_number_of_products"])
+	assert.Nil(t, metadata["next_page"])
+
+	productsPage := responseData["products"].([]interface{})
+	assert.Equal(t, 5, len(productsPage))
+	assert.Equal(t, "Product_21", productsPage[0].(map[string]interface{})["name"])
+}
@@ -0,0 +1,437 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func openEmptyProductsDB(t *testing.T) *gorm.DB {
+
+	config := data_layer.DefaultStoreConfig()
+
+	config.Path = filepath.Join(t.TempDir(), "migrations.db")
+
+	products_db, err := data_layer.OpenProductsDB(config)
+
+	require.NoError(t, err)
+
+	t.Cleanup(func() { data_layer.CloseProductsDB(products_db) })
+
+	return products_db
+}
+
+// appliedMigrations counts the applied migrations newer than version: a deferred one is never applied
+func appliedMigrations(t *testing.T, products_db *gorm.DB, version uint) int {
+
+	states, err := data_layer.MigrationStatus(products_db)
+
+	require.NoError(t, err)
+
+	applied := 0
+
+	for _, state := range states {
+
+		if state.Applied && state.Version > version {
+
+			applied++
+		}
+	}
+
+	return applied
+}
+
+// migrateDownTo reverts the applied migrations newer than version
+func migrateDownTo(t *testing.T, products_db *gorm.DB, version uint) {
+
+	_, err := data_layer.MigrateDown(products_db, appliedMigrations(t, products_db, version))
+
+	require.NoError(t, err)
+}
+
+func TestMigrations_UpAndStatus(t *testing.T) {
+	// Arrange
+	products_db := openEmptyProductsDB(t)
+
+	// Act
+	applied, err := data_layer.MigrateUp(products_db)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, appliedMigrations(t, products_db, 0), len(applied))
+	assert.True(t, products_db.Migrator().HasTable("products"))
+	assert.NoError(t, data_layer.CheckSchemaUpToDate(products_db))
+
+	states, err := data_layer.MigrationStatus(products_db)
+
+	require.NoError(t, err)
+
+	// Every migration is applied, but those this build cannot apply
+	for _, state := range states {
+		assert.NotEqual(t, state.Applied, state.Deferred, "migration %d should be applied or deferred", state.Version)
+		assert.Equal(t, state.Applied, state.AppliedAt != nil)
+	}
+
+	// Running the migrations a second time is a no-op
+	applied, err = data_layer.MigrateUp(products_db)
+
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+}
+
+func TestMigrations_RefuseOutdatedSchema(t *testing.T) {
+	// Arrange
+	products_db := openEmptyProductsDB(t)
+
+	// Act
+	err := data_layer.CheckSchemaUpToDate(products_db)
+
+	// Assert
+	assert.True(t, errors.Is(err, data_layer.ErrSchemaBehind))
+
+	pending, err := data_layer.PendingMigrations(products_db)
+
+	require.NoError(t, err)
+	assert.Equal(t, data_layer.Migrations()[0].Version, pending[0].Version)
+}
+
+func TestMigrations_DownRevertsNewestFirst(t *testing.T) {
+	// Arrange
+	products_db := openEmptyProductsDB(t)
+
+	_, err := data_layer.MigrateUp(products_db)
+
+	require.NoError(t, err)
+
+	migrations := data_layer.Migrations()
+
+	applied := appliedMigrations(t, products_db, 0)
+
+	// Act - Revert everything
+	reverted, err := data_layer.MigrateDown(products_db, len(migrations))
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, applied, len(reverted))
+	assert.Equal(t, migrations[len(migrations)-1].Version, reverted[0].Version)
+	assert.False(t, products_db.Migrator().HasTable("products"))
+	assert.True(t, errors.Is(data_layer.CheckSchemaUpToDate(products_db), data_layer.ErrSchemaBehind))
+}
+
+func TestMigrations_AdoptExistingProductsTable(t *testing.T) {
+	// Arrange - A database created by the former AutoMigrate, with data in it
+	products_db := openEmptyProductsDB(t)
+
+	require.NoError(t, products_db.Exec("CREATE TABLE products (id integer PRIMARY KEY AUTOINCREMENT, created_at datetime, updated_at datetime, deleted_at datetime, name text, price real)").Error)
+	require.NoError(t, products_db.Exec("INSERT INTO products (name, price, created_at, updated_at) VALUES ('Legacy_Laptop', 1999.99, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+
+	// Act
+	_, err := data_layer.MigrateUp(products_db)
+
+	// Assert - The existing rows survive the migrations
+	require.NoError(t, err)
+
+	product, err := data_layer.NewGormProductRepository(products_db).RetrieveProduct(1, false)
+
+	require.NoError(t, err)
+	assert.Equal(t, "Legacy_Laptop", product.Name)
+	assert.Equal(t, data_layer.Amount(199999), product.Price)
+	assert.Equal(t, data_layer.DefaultCurrency, product.Currency)
+	assert.Equal(t, uint(1), product.Version)
+}
+
+func TestMigrations_MinorUnitPricesRoundTrip(t *testing.T) {
+	// Arrange
+	products_db := openEmptyProductsDB(t)
+
+	_, err := data_layer.MigrateUp(products_db)
+
+	require.NoError(t, err)
+
+	_, err = data_layer.NewGormProductRepository(products_db).InsertProduct("Priced_Laptop", data_layer.MustParseAmount("1600.10"), "EUR")
+
+	require.NoError(t, err)
+
+	// Act - Step back to the float64 schema
+	migrateDownTo(t, products_db, 1)
+
+	// Assert
+	var price float64
+
+	require.NoError(t, products_db.Raw("SELECT price FROM products WHERE name = 'Priced_Laptop'").Scan(&price).Error)
+	assert.Equal(t, 1600.10, price)
+	assert.False(t, products_db.Migrator().HasColumn("products", "price_minor"))
+}
+
+func TestMigrations_StockMovesIntoMainWarehouse(t *testing.T) {
+	// Arrange
+	products_db := openEmptyProductsDB(t)
+
+	_, err := data_layer.MigrateUp(products_db)
+
+	require.NoError(t, err)
+
+	products := data_layer.NewGormProductRepository(products_db)
+
+	productID, _ := products.InsertProduct("Stocked_Lamp", data_layer.MustParseAmount("40"), "EUR")
+
+	_, err = products.AdjustStock(int(productID), 0, 0, 7, data_layer.ReasonReceived)
+
+	require.NoError(t, err)
+
+	// Act - Step back to the single stock level per product of version 9, and forward again
+	migrateDownTo(t, products_db, 9)
+
+	var onHand int64
+
+	require.NoError(t, products_db.Raw("SELECT on_hand FROM stock_levels WHERE product_id = ?", productID).Scan(&onHand).Error)
+	assert.Equal(t, int64(7), onHand)
+	assert.False(t, products_db.Migrator().HasTable("warehouses"))
+
+	_, err = data_layer.MigrateUp(products_db)
+
+	require.NoError(t, err)
+
+	// Assert
+	level, err := products.RetrieveStock(int(productID), 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), level.OnHand)
+	require.Len(t, level.Warehouses, 1)
+
+	warehouse, err := products.RetrieveWarehouse(level.Warehouses[0].WarehouseID)
+
+	require.NoError(t, err)
+	assert.Equal(t, data_layer.MainWarehouseCode, warehouse.Code)
+}
+
+func TestMigrations_ExistingProductsBecomeActive(t *testing.T) {
+	// Arrange
+	products_db := openEmptyProductsDB(t)
+
+	_, err := data_layer.MigrateUp(products_db)
+
+	require.NoError(t, err)
+
+	// Step back to version 12, before product statuses
+	migrateDownTo(t, products_db, 12)
+	assert.False(t, products_db.Migrator().HasColumn("products", "status"))
+
+	require.NoError(t, products_db.Exec("INSERT INTO products (name, price_minor, currency, version, created_at, updated_at) VALUES ('Lifecycle_Old', 100, 'EUR', 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+
+	// Act
+	_, err = data_layer.MigrateUp(products_db)
+
+	require.NoError(t, err)
+
+	// Assert
+	products, err := data_layer.NewGormProductRepository(products_db).RetrieveProductsWithPagination(data_layer.ProductFilter{Statuses: []string{data_layer.StatusActive}}, nil, 0, 10)
+
+	require.NoError(t, err)
+	require.Len(t, products, 1)
+	assert.Equal(t, "Lifecycle_Old", products[0].Name)
+	assert.Nil(t, products[0].PublishAt)
+}
+
+func TestMigrations_VariantStockMovesIntoTheLedger(t *testing.T) {
+	// Arrange
+	products_db := openEmptyProductsDB(t)
+
+	_, err := data_layer.MigrateUp(products_db)
+
+	require.NoError(t, err)
+
+	products := data_layer.NewGormProductRepository(products_db)
+
+	productID, _ := products.InsertProduct("Variant_Jacket", data_layer.MustParseAmount("120"), "EUR")
+
+	_, err = products.AdjustStock(int(productID), 0, 0, 2, data_layer.ReasonReceived)
+
+	require.NoError(t, err)
+
+	// Step back to version 13, where the stock of a variant was a column of its own
+	migrateDownTo(t, products_db, 13)
+	assert.True(t, products_db.Migrator().HasColumn("product_variants", "stock"))
+
+	require.NoError(t, products_db.Exec("INSERT INTO product_variants (product_id, sku, options, options_key, stock, created_at, updated_at) VALUES (?, 'JACKET-M', 'size=M', 'size=m', 4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)", productID).Error)
+
+	// Act
+	_, err = data_layer.MigrateUp(products_db)
+
+	require.NoError(t, err)
+
+	// Assert
+	assert.False(t, products_db.Migrator().HasColumn("product_variants", "stock"))
+
+	variants, err := products.RetrieveProductVariants(int(productID))
+
+	require.NoError(t, err)
+	require.Len(t, variants, 1)
+	assert.Equal(t, int64(4), variants[0].Available)
+
+	movements, err := products.RetrieveStockMovements(int(productID), variants[0].ID, 10)
+
+	require.NoError(t, err)
+	require.Len(t, movements, 1)
+	assert.Equal(t, data_layer.ReasonCorrection, movements[0].Reason)
+
+	level, err := products.RetrieveStock(int(productID), 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), level.OnHand)
+
+	// Dropping the column kept the unique indexes of the variants
+	assert.True(t, products_db.Migrator().HasIndex("product_variants", "idx_product_variants_sku"))
+	assert.True(t, products_db.Migrator().HasIndex("product_variants", "idx_product_variants_options"))
+}
+
+func TestMigrations_SearchIndexWaitsForAnFTS5Build(t *testing.T) {
+	// Arrange
+	products_db := openEmptyProductsDB(t)
+
+	_, err := data_layer.MigrateUp(products_db)
+
+	require.NoError(t, err)
+
+	states, err := data_layer.MigrationStatus(products_db)
+
+	require.NoError(t, err)
+
+	index := states[5]
+
+	require.Equal(t, "create_product_search_index", index.Name)
+
+	// Assert - Only a build with FTS5 applies it; any other leaves it pending without refusing to start
+	assert.Equal(t, index.Deferred, !products_db.Migrator().HasTable("products_fts"))
+	assert.NoError(t, data_layer.CheckSchemaUpToDate(products_db))
+
+	pending, err := data_layer.PendingMigrations(products_db)
+
+	require.NoError(t, err)
+
+	if index.Deferred {
+		require.Len(t, pending, 1)
+		assert.Equal(t, index.Version, pending[0].Version)
+		return
+	}
+
+	// Act - An FTS5 build applies it after the later migrations, when an earlier build left it pending
+	for _, statement := range []string{"DROP TRIGGER products_fts_insert", "DROP TRIGGER products_fts_delete", "DROP TRIGGER products_fts_update", "DROP TABLE products_fts"} {
+		require.NoError(t, products_db.Exec(statement).Error)
+	}
+
+	require.NoError(t, products_db.Exec("DELETE FROM schema_migrations WHERE version = ?", index.Version).Error)
+
+	_, err = data_layer.NewGormProductRepository(products_db).InsertProduct("Indexed_Lantern", data_layer.MustParseAmount("25"), "EUR")
+
+	require.NoError(t, err)
+
+	applied, err := data_layer.MigrateUp(products_db)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.Equal(t, index.Version, applied[0].Version)
+
+	results, err := data_layer.NewGormProductRepository(products_db).SearchProducts("lant", nil, 0, 10)
+
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "Indexed_Lantern", results[0].Product.Name)
+}
+
+func TestMigrations_RefuseSearchIndexThisBuildCannotMaintain(t *testing.T) {
+	// Arrange
+	products_db := openEmptyProductsDB(t)
+
+	_, err := data_layer.MigrateUp(products_db)
+
+	require.NoError(t, err)
+
+	states, err := data_layer.MigrationStatus(products_db)
+
+	require.NoError(t, err)
+
+	if !states[5].Deferred {
+		// A build with FTS5 maintains the index it created
+		assert.NoError(t, data_layer.CheckSearchIndexSupported(products_db))
+		return
+	}
+
+	// A plain table stands in for the index of an FTS5 build, which this build cannot create
+	require.NoError(t, products_db.Exec("CREATE TABLE products_fts (name text)").Error)
+
+	// Act
+	err = data_layer.CheckSchemaUpToDate(products_db)
+
+	// Assert - Neither the server nor the migrations run on it
+	assert.True(t, errors.Is(err, data_layer.ErrSearchIndexUnsupported))
+
+	_, err = data_layer.MigrateUp(products_db)
+
+	assert.True(t, errors.Is(err, data_layer.ErrSearchIndexUnsupported))
+}
+
+func TestMigrations_DownRevertsTheLastAppliedFirst(t *testing.T) {
+	// Arrange
+	products_db := openEmptyProductsDB(t)
+
+	_, err := data_layer.MigrateUp(products_db)
+
+	require.NoError(t, err)
+
+	// The search index applied after the later migrations, as by an FTS5 build on a database migrated without it
+	index := data_layer.Migrations()[5]
+
+	require.NoError(t, products_db.Save(&data_layer.SchemaMigration{Version: index.Version, Name: index.Name, AppliedAt: time.Now().Add(time.Minute)}).Error)
+
+	// Act
+	reverted, err := data_layer.MigrateDown(products_db, 1)
+
+	// Assert - It is reverted first, and the newest version stays applied
+	require.NoError(t, err)
+	require.Len(t, reverted, 1)
+	assert.Equal(t, index.Version, reverted[0].Version)
+
+	states, err := data_layer.MigrationStatus(products_db)
+
+	require.NoError(t, err)
+	assert.False(t, states[5].Applied)
+	assert.True(t, states[len(states)-1].Applied)
+
+	// Then the others, newest version first
+	reverted, err = data_layer.MigrateDown(products_db, 1)
+
+	require.NoError(t, err)
+	require.Len(t, reverted, 1)
+	assert.Equal(t, states[len(states)-1].Version, reverted[0].Version)
+}
+
+func TestMigrations_SiblingCategoryNamesAreUniquelyIndexed(t *testing.T) {
+	// Arrange
+	products_db := openEmptyProductsDB(t)
+
+	_, err := data_layer.MigrateUp(products_db)
+
+	require.NoError(t, err)
+
+	books, err := data_layer.NewGormProductRepository(products_db).CreateCategory("Books", nil)
+
+	require.NoError(t, err)
+
+	// Act - A write that got past the sibling check, as a concurrent one would
+	err = products_db.Create(&data_layer.Category{Name: "BOOKS", Path: "/", SiblingKey: "0/books"}).Error
+
+	// Assert
+	assert.True(t, errors.Is(err, gorm.ErrDuplicatedKey))
+
+	err = products_db.Create(&data_layer.Category{Name: "books", ParentID: &books.ID, Path: "/", SiblingKey: fmt.Sprintf("%d/books", books.ID)}).Error
+
+	assert.NoError(t, err)
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAmount_ParseAndFormat(t *testing.T) {
+
+	testCases := map[string]string{
+		"1999.99": "1999.99",
+		"0.1":     "0.10",
+		"-5":      "-5.00",
+		"1.5e2":   "150.00",
+		"0.30":    "0.30",
+	}
+
+	for text, expected := range testCases {
+		amount, err := data_layer.ParseAmount(text)
+
+		require.NoError(t, err, text)
+		assert.Equal(t, expected, amount.String())
+	}
+
+	for _, invalid := range []string{"19.999", "abc", "1/3", "", "1e400"} {
+		_, err := data_layer.ParseAmount(invalid)
+
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestAmount_JSONRoundTrip(t *testing.T) {
+
+	var product data_layer.Product
+
+	require.NoError(t, json.Unmarshal([]byte(`{"name": "Exact", "price": "1600.10", "currency": "usd"}`), &product))
+	assert.Equal(t, data_layer.Amount(160010), product.Price)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"name": "Exact", "price": 0.3}`), &product))
+	assert.Equal(t, data_layer.Amount(30), product.Price)
+
+	encoded, err := json.Marshal(struct{ Price data_layer.Amount }{data_layer.Amount(160010)})
+
+	require.NoError(t, err)
+	assert.Equal(t, `{"Price":1600.10}`, string(encoded))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"price": 0.001}`), &product))
+}
+
+func TestInsertProduct_DecimalStringPriceAndCurrency(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	app := SetupAppWithRepository(data_layer.NewMemoryProductRepository())
+
+	body := []byte(`{"name": "Laptop_Exact", "price": "1999.99", "currency": "usd"}`)
+	req := httptest.NewRequest(http.MethodPost, "/insert-product", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := app.Test(req, -1)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var insertResponse map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&insertResponse)
+	productID := int(insertResponse["product_id"].(float64))
+
+	// Act
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/retrieve-product/%d", productID), nil)
+	resp, _ = app.Test(req, -1)
+
+	// Assert - The price is emitted exactly as it was sent
+	var responseData map[string]json.RawMessage
+	json.NewDecoder(resp.Body).Decode(&responseData)
+
+	assert.Equal(t, "1999.99", string(responseData["price"]))
+	assert.Equal(t, `"USD"`, string(responseData["currency"]))
+}
+
+func TestInsertProduct_InvalidCurrencyAndPrecision(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	app := SetupAppWithRepository(data_layer.NewMemoryProductRepository())
+
+	for _, body := range []string{`{"name": "Laptop", "price": 10, "currency": "EURO"}`, `{"name": "Laptop", "price": 10.005}`} {
+		// Act
+		req := httptest.NewRequest(http.MethodPost, "/insert-product", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := app.Test(req, -1)
+
+		// Assert
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+	}
+}
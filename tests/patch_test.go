@@ -0,0 +1,238 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"simpler-go-home-test/data_layer"
+	"strings"
+	"testing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// patchProduct sends a PATCH /products/:id with the given content type and decodes the JSON answer
+func patchProduct(t *testing.T, app *fiber.App, productID uint, contentType string, patch string, ifMatch string) (*http.Response, map[string]interface{}) {
+
+	req := httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/products/%d", productID), strings.NewReader(patch))
+	req.Header.Set("Content-Type", contentType)
+
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+
+	resp, err := app.Test(req, -1)
+
+	require.NoError(t, err)
+
+	body, _ := io.ReadAll(resp.Body)
+
+	var responseData map[string]interface{}
+	_ = json.Unmarshal(body, &responseData)
+
+	return resp, responseData
+}
+
+func TestPatchProduct_MergePatch(t *testing.T) {
+	// Arrange
+	app := SetupApp(t)
+
+	defer data_layer.DestroyProductsDB()
+
+	body, _ := json.Marshal(map[string]interface{}{"name": "Merge_Laptop", "price": "1499.99"})
+	req := httptest.NewRequest(http.MethodPost, "/insert-product", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := app.Test(req, -1)
+
+	var inserted map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&inserted)
+
+	productID := uint(inserted["product_id"].(float64))
+
+	// Act
+	resp, responseData := patchProduct(t, app, productID, "application/merge-patch+json", `{"name": "Merged_Laptop", "price": "1299.99"}`, "")
+
+	// Assert
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Merged_Laptop", responseData["name"])
+	assert.Equal(t, 1299.99, responseData["price"])
+	assert.Equal(t, float64(2), responseData["version"])
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+}
+
+func TestPatchProduct_JSONPatch(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Patched_Phone", data_layer.MustParseAmount("300"), "EUR")
+
+	// Act
+	resp, responseData := patchProduct(t, app, productID, "application/json-patch+json", `[
+		{"op": "test", "path": "/name", "value": "Patched_Phone"},
+		{"op": "replace", "path": "/name", "value": "Patched_Phone_Pro"},
+		{"op": "replace", "path": "/price", "value": 349.5}
+	]`, "")
+
+	// Assert
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Patched_Phone_Pro", responseData["name"])
+
+	product, _ := products.RetrieveProduct(int(productID), false)
+	assert.Equal(t, data_layer.MustParseAmount("349.50"), product.Price)
+
+	// A failing test operation leaves the product untouched
+	resp, _ = patchProduct(t, app, productID, "application/json-patch+json", `[
+		{"op": "replace", "path": "/name", "value": "Never_Written"},
+		{"op": "test", "path": "/price", "value": 1}
+	]`, "")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	product, _ = products.RetrieveProduct(int(productID), false)
+	assert.Equal(t, "Patched_Phone_Pro", product.Name)
+}
+
+func TestPatchProduct_PlainJSONIsSniffed(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Sniffed_Tablet", data_layer.MustParseAmount("400"), "EUR")
+
+	// Act & Assert - An object is a merge patch, an array a JSON Patch
+	resp, responseData := patchProduct(t, app, productID, "application/json", `{"price": 410}`, "")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(410), responseData["price"])
+
+	resp, responseData = patchProduct(t, app, productID, "application/json", `[{"op": "replace", "path": "/price", "value": 420}]`, "")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(420), responseData["price"])
+
+	resp, _ = patchProduct(t, app, productID, "text/plain", `{"price": 430}`, "")
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+}
+
+func TestPatchProduct_ValidatesLikeInsert(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Validated_Monitor", data_layer.MustParseAmount("250"), "EUR")
+
+	invalidPatches := []string{
+		`{"name": ""}`,
+		`{"name": null}`,
+		`{"price": 0}`,
+		`{"price": "-5"}`,
+		`{"price": "1.001"}`,
+		`{"currency": "EURO"}`,
+		`{"id": 42}`,
+		`{"version": 9}`,
+		`{"color": "red"}`,
+		`["not", "a", "patch"]`,
+		`42`,
+	}
+
+	for _, patch := range invalidPatches {
+
+		// Act
+		resp, _ := patchProduct(t, app, productID, "application/json", patch, "")
+
+		// Assert
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, patch)
+	}
+
+	product, _ := products.RetrieveProduct(int(productID), false)
+	assert.Equal(t, "Validated_Monitor", product.Name)
+	assert.Equal(t, data_layer.MustParseAmount("250"), product.Price)
+	assert.Equal(t, uint(1), product.Version)
+}
+
+func TestPatchProduct_ChangesCurrency(t *testing.T) {
+	t.Parallel()
+
+	// Arrange - The product has an explicit USD price
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Rebased_Camera", data_layer.MustParseAmount("500"), "EUR")
+	products.SetProductPrice(int(productID), "USD", data_layer.MustParseAmount("540"))
+
+	// Act - Move the base price to USD
+	resp, responseData := patchProduct(t, app, productID, "application/merge-patch+json", `{"price": "545", "currency": "usd"}`, "")
+
+	// Assert - The base price replaces the explicit one
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "USD", responseData["currency"])
+	assert.Equal(t, float64(545), responseData["price"])
+
+	prices, _ := products.RetrieveProductPrices([]uint{productID})
+	assert.Empty(t, prices)
+}
+
+func TestPatchProduct_IfMatchAndMissing(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Guarded_Speaker", data_layer.MustParseAmount("120"), "EUR")
+	products.UpdateProductName(int(productID), "Guarded_Speaker_Renamed", data_layer.AnyVersion)
+
+	// Act & Assert
+	resp, _ := patchProduct(t, app, productID, "application/merge-patch+json", `{"name": "Stale"}`, `"1"`)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, _ = patchProduct(t, app, productID, "application/merge-patch+json", `{"name": "Fresh"}`, `"2"`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = patchProduct(t, app, 999999, "application/merge-patch+json", `{"name": "Missing"}`, "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// racingRepository lets another writer change the product right before every update
+type racingRepository struct {
+	data_layer.Repository
+}
+
+func (repository racingRepository) UpdateProduct(id int, changes data_layer.ProductChanges, expectedVersion uint) error {
+
+	repository.Repository.UpdateProductName(id, "Racing_Writer", data_layer.AnyVersion)
+
+	return repository.Repository.UpdateProduct(id, changes, expectedVersion)
+}
+
+func TestPatchProduct_ConcurrentWritesWithoutIfMatch(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := racingRepository{data_layer.NewMemoryProductRepository()}
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Racing_Lamp", data_layer.MustParseAmount("30"), "EUR")
+
+	// Act - Every attempt loses the race
+	resp, responseData := patchProduct(t, app, productID, "application/merge-patch+json", `{"price": "35"}`, "")
+
+	// Assert - A conflict, not a precondition the client never sent
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Contains(t, responseData["Error"], "kept changing")
+
+	resp, _ = patchProduct(t, app, productID, "application/merge-patch+json", `{"price": "35"}`, `"1"`)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"net/http"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyPriceRule_DryRunThenApply(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	laptopID, _ := products.InsertProduct("Rule_Laptop", data_layer.MustParseAmount("1000"), "EUR")
+	products.InsertProduct("Rule_Phone", data_layer.MustParseAmount("800"), "EUR")
+	products.InsertProduct("Other_Tablet", data_layer.MustParseAmount("650"), "EUR")
+
+	rule := map[string]interface{}{
+		"filter":     map[string]interface{}{"name_pattern": "Rule_*", "min_price": "900"},
+		"operations": []interface{}{map[string]interface{}{"op": "multiply", "value": "1.05"}, map[string]interface{}{"op": "round_99"}},
+		"dry_run":    true,
+	}
+
+	// Act - Dry run
+	resp, responseData := sendJSON(t, app, http.MethodPost, "/v1/products/bulk-price-update", rule)
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, true, responseData["dry_run"])
+	assert.Equal(t, float64(1), responseData["changed"])
+
+	change := responseData["changes"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, float64(laptopID), change["id"])
+	assert.Equal(t, float64(1000), change["old_price"])
+	assert.Equal(t, 1049.99, change["new_price"])
+
+	laptop, _ := products.RetrieveProduct(int(laptopID), false)
+	assert.Equal(t, data_layer.MustParseAmount("1000"), laptop.Price)
+
+	// Act - Apply
+	rule["dry_run"] = false
+	resp, responseData = sendJSON(t, app, http.MethodPost, "/v1/products/bulk-price-update", rule)
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(1), responseData["changed"])
+
+	laptop, _ = products.RetrieveProduct(int(laptopID), false)
+	assert.Equal(t, data_layer.MustParseAmount("1049.99"), laptop.Price)
+	assert.Equal(t, uint(2), laptop.Version)
+}
+
+func TestApplyPriceRule_InvalidResultRollsBack(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	laptopID, _ := products.InsertProduct("Rule_Laptop", data_layer.MustParseAmount("1000"), "EUR")
+	cableID, _ := products.InsertProduct("Rule_Cable", data_layer.MustParseAmount("5"), "EUR")
+
+	// Act
+	resp, responseData := sendJSON(t, app, http.MethodPost, "/v1/products/bulk-price-update", map[string]interface{}{
+		"filter":     map[string]interface{}{"ids": []uint{laptopID, cableID}},
+		"operations": []interface{}{map[string]interface{}{"op": "add", "value": "-10"}},
+	})
+
+	// Assert
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, float64(cableID), responseData["product_id"])
+
+	laptop, _ := products.RetrieveProduct(int(laptopID), false)
+	assert.Equal(t, data_layer.MustParseAmount("1000"), laptop.Price)
+}
+
+func TestApplyPriceRule_InvalidRequests(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	app := SetupAppWithRepository(data_layer.NewMemoryProductRepository())
+
+	byIDs := map[string]interface{}{"ids": []int{1}}
+
+	cases := []struct {
+		name    string
+		payload interface{}
+	}{
+		{"no filter", map[string]interface{}{"operations": []interface{}{map[string]interface{}{"op": "round_99"}}}},
+		{"no operations", map[string]interface{}{"filter": byIDs}},
+		{"unknown operation", map[string]interface{}{"filter": byIDs, "operations": []interface{}{map[string]interface{}{"op": "divide", "value": 2}}}},
+		{"set without value", map[string]interface{}{"filter": byIDs, "operations": []interface{}{map[string]interface{}{"op": "set"}}}},
+		{"set to zero", map[string]interface{}{"filter": byIDs, "operations": []interface{}{map[string]interface{}{"op": "set", "value": 0}}}},
+		{"negative factor", map[string]interface{}{"filter": byIDs, "operations": []interface{}{map[string]interface{}{"op": "multiply", "value": "-1"}}}},
+		{"round with value", map[string]interface{}{"filter": byIDs, "operations": []interface{}{map[string]interface{}{"op": "round_99", "value": 1}}}},
+		{"inverted price range", map[string]interface{}{"filter": map[string]interface{}{"min_price": 10, "max_price": 5}, "operations": []interface{}{map[string]interface{}{"op": "round_99"}}}},
+	}
+
+	for _, testCase := range cases {
+
+		// Act
+		resp, responseData := sendJSON(t, app, http.MethodPost, "/v1/products/bulk-price-update", testCase.payload)
+
+		// Assert
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, testCase.name)
+		assert.Contains(t, responseData["Error"], "Invalid price rule", testCase.name)
+	}
+}
@@ -11,24 +11,37 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 	"fmt"
+	"sync"
 )
 
 // Setup function for initializing Fiber app
-func SetupApp() (*fiber.App) {
-	
-	app := fiber.New()
+func SetupApp(t *testing.T) (*fiber.App) {
+
+	products_db, err := data_layer.OpenProductsDB(data_layer.DefaultStoreConfig())
+
+	if err != nil {
+		t.Fatalf("Failed to open the products database: %v", err)
+	}
 
-	app.Post("/insert-product", api.InsertProduct)
+	t.Cleanup(func() { data_layer.CloseProductsDB(products_db) })
 
-	app.Delete("/delete-product/:id", api.DeleteProduct)
+	_, err = data_layer.MigrateUp(products_db)
+
+	if err != nil {
+		t.Fatalf("Failed to migrate the products database: %v", err)
+	}
+
+	return SetupAppWithRepository(data_layer.NewGormProductRepository(products_db))
+}
 
-	app.Put("/update-product-name", api.UpdateProductName)
+// Setup function for initializing Fiber app on top of any product repository
+func SetupAppWithRepository(products data_layer.Repository) (*fiber.App) {
 
-	app.Put("/update-product-price", api.UpdateProductPrice)
+	handlers := api.NewProductsAPI(products, data_layer.DefaultRoundingRules())
 	
-	app.Get("/retrieve-product/:id", api.RetrieveProduct)
+	app := fiber.New()
 
-	app.Get("/retrieve-products", api.RetrieveProductsWithPagination)
+	handlers.RegisterRoutes(app, api.DefaultLegacyRoutesSunset)
 
 	return app
 }
@@ -37,7 +50,7 @@ func SetupApp() (*fiber.App) {
 
 func TestInsertProduct_HappyPath(t *testing.T) {
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 
 	defer data_layer.DestroyProductsDB()
 
@@ -70,7 +83,7 @@ func TestInsertProduct_HappyPath(t *testing.T) {
 
 func TestInsertProduct_InvalidBody(t *testing.T) {
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 	
 	defer data_layer.DestroyProductsDB()
 
@@ -103,7 +116,7 @@ func TestInsertProduct_InvalidBody(t *testing.T) {
 func TestInsertProduct_InvalidPrice(t *testing.T) {
 	
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 
 	defer data_layer.DestroyProductsDB()
 
@@ -131,10 +144,60 @@ func TestInsertProduct_InvalidPrice(t *testing.T) {
 	assert.Equal(t,"Invalid product data for insertion: name must be non-empty, and price must be greater than zero", responseData["Error"])
 }
 
+// Test concurrent insertions sharing the application-scoped database handle
+func TestInsertProduct_ConcurrentRequests(t *testing.T) {
+	// Arrange
+	app := SetupApp(t)
+
+	defer data_layer.DestroyProductsDB()
+
+	var wg sync.WaitGroup
+
+	statusCodes := make(chan int, 20)
+
+	// Act - Fire 20 insertions at the same time
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			body, _ := json.Marshal(map[string]interface{}{"name": fmt.Sprintf("Concurrent_%d", i), "price": float64(i * 10)})
+			req := httptest.NewRequest(http.MethodPost, "/insert-product", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req, -1)
+
+			if err != nil {
+				statusCodes <- 0
+				return
+			}
+
+			statusCodes <- resp.StatusCode
+		}(i)
+	}
+
+	wg.Wait()
+	close(statusCodes)
+
+	// Assert - Every insertion succeeded and all products are stored
+	for statusCode := range statusCodes {
+		assert.Equal(t, http.StatusOK, statusCode)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/retrieve-products?page=1&limit=50", nil)
+	resp, _ := app.Test(req, -1)
+
+	var responseData map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&responseData)
+
+	metadata := responseData["metadata"].(map[string]interface{})
+	assert.Equal(t, float64(20), metadata["total_number_of_products"])
+}
+
 // Test the happy path (valid product retrieval)
 func TestRetrieveProduct_HappyPath(t *testing.T) {
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 
 	defer data_layer.DestroyProductsDB()
 
@@ -174,7 +237,7 @@ func TestRetrieveProduct_HappyPath(t *testing.T) {
 // Test invalid ID format (non-integer ID)
 func TestRetrieveProduct_InvalidIDFormat(t *testing.T) {
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 
 	defer data_layer.DestroyProductsDB()
 
@@ -195,7 +258,7 @@ func TestRetrieveProduct_InvalidIDFormat(t *testing.T) {
 // Test product not found (valid but non-existent ID)
 func TestRetrieveProduct_IDNotFound(t *testing.T) {
 	// Arrange
-	app:= SetupApp()
+	app:= SetupApp(t)
 
 	// Act - Try to retrieve a product with a valid but non-existent ID (e.g., ID 999)
 	req := httptest.NewRequest(http.MethodGet, "/retrieve-product/999", nil)
@@ -215,7 +278,7 @@ func TestRetrieveProduct_IDNotFound(t *testing.T) {
 // Test the happy path (valid product deletion)
 func TestDeleteProduct_HappyPath(t *testing.T) {
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 
 	defer data_layer.DestroyProductsDB()
 
@@ -253,7 +316,7 @@ func TestDeleteProduct_HappyPath(t *testing.T) {
 // Test invalid ID format (non-integer ID)
 func TestDeleteProduct_InvalidIDFormat(t *testing.T) {
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 
 	defer data_layer.DestroyProductsDB()
 
@@ -274,7 +337,7 @@ func TestDeleteProduct_InvalidIDFormat(t *testing.T) {
 // Test product not found (valid but non-existent ID)
 func TestDeleteProduct_IDNotFound(t *testing.T) {
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 
 	defer data_layer.DestroyProductsDB()
 
@@ -296,7 +359,7 @@ func TestDeleteProduct_IDNotFound(t *testing.T) {
 // Test the happy path (valid price update)
 func TestUpdateProductPrice_HappyPath(t *testing.T) {
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 
 	defer data_layer.DestroyProductsDB()
 
@@ -354,7 +417,7 @@ func TestUpdateProductPrice_HappyPath(t *testing.T) {
 // Test invalid price update (negative price)
 func TestUpdateProductPrice_InvalidPrice(t *testing.T) {
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 
 	defer data_layer.DestroyProductsDB()
 
@@ -407,7 +470,7 @@ func TestUpdateProductPrice_InvalidPrice(t *testing.T) {
 // Test product not found (valid ID but non-existent product)
 func TestUpdateProductPrice_IDNotFound(t *testing.T) {
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 
 	defer data_layer.DestroyProductsDB()
 
@@ -433,7 +496,7 @@ func TestUpdateProductPrice_IDNotFound(t *testing.T) {
 
 func TestUpdateProductName_HappyPath(t *testing.T) {
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 
 	defer data_layer.DestroyProductsDB()
 
@@ -488,7 +551,7 @@ func TestUpdateProductName_HappyPath(t *testing.T) {
 // Test invalid name update (empty name)
 func TestUpdateProductName_InvalidName(t *testing.T) {
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 
 	defer data_layer.DestroyProductsDB()
 
@@ -530,7 +593,7 @@ func TestUpdateProductName_InvalidName(t *testing.T) {
 // Test product not found (valid ID but non-existent product)
 func TestUpdateProductName_IDNotFound(t *testing.T) {
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 
 	defer data_layer.DestroyProductsDB()
 
@@ -556,7 +619,7 @@ func TestUpdateProductName_IDNotFound(t *testing.T) {
 
 func TestRetrieveProductsWithPagination_HappyPath(t *testing.T) {
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 
 	defer data_layer.DestroyProductsDB()
 
@@ -601,7 +664,7 @@ func TestRetrieveProductsWithPagination_HappyPath(t *testing.T) {
 // Test invalid pagination (negative page or limit)
 func TestRetrieveProductsWithPagination_InvalidPagination(t *testing.T) {
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 
 	defer data_layer.DestroyProductsDB()
 
@@ -621,7 +684,7 @@ func TestRetrieveProductsWithPagination_InvalidPagination(t *testing.T) {
 
 func TestRetrieveProductsWithPagination_PageExceedsData(t *testing.T) {
 	// Arrange
-	app := SetupApp()
+	app := SetupApp(t)
 
 	defer data_layer.DestroyProductsDB()
 
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"net/http"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchProducts_HappyPath(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	products.InsertProduct("Search_Laptop Pro", data_layer.MustParseAmount("1500"), "EUR")
+	products.InsertProduct("Search_Laptop Air", data_layer.MustParseAmount("1100"), "EUR")
+	products.InsertProduct("Search_Phone", data_layer.MustParseAmount("800"), "EUR")
+
+	// Act
+	resp, responseData := sendRequest(t, app, http.MethodGet, "/v1/products/search?q=laptop+pr&limit=1")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	results := responseData["results"].([]interface{})
+
+	require.Len(t, results, 1)
+
+	result := results[0].(map[string]interface{})
+
+	assert.Equal(t, "Search_Laptop Pro", result["name"])
+	assert.Equal(t, float64(1500), result["price"])
+	assert.Equal(t, "Search_<mark>Laptop</mark> <mark>Pro</mark>", result["snippet"])
+	assert.Greater(t, result["score"], float64(0))
+
+	metadata := responseData["metadata"].(map[string]interface{})
+
+	assert.Nil(t, metadata["next_page"])
+
+	_, responseData = sendRequest(t, app, http.MethodGet, "/v1/products/search?q=laptop&limit=1")
+
+	assert.Equal(t, float64(2), responseData["metadata"].(map[string]interface{})["next_page"])
+}
+
+func TestSearchProducts_InvalidQuery(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	app := SetupAppWithRepository(data_layer.NewMemoryProductRepository())
+
+	for _, query := range []string{"", "q=", "q=%20-%20", "q=laptop&page=0", "q=laptop&limit=-1"} {
+
+		// Act
+		resp, _ := sendRequest(t, app, http.MethodGet, "/v1/products/search?"+query)
+
+		// Assert
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+}
+
+func TestAutocompleteProducts_FuzzyMode(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	products.InsertProduct("Keyboard", data_layer.MustParseAmount("50"), "EUR")
+	products.InsertProduct("Mechanical Keyboard", data_layer.MustParseAmount("120"), "EUR")
+
+	// Act
+	resp, responseData := sendRequest(t, app, http.MethodGet, "/v1/products/autocomplete?prefix=keyb")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	suggestions := responseData["suggestions"].([]interface{})
+
+	require.Len(t, suggestions, 2)
+	assert.Equal(t, "Keyboard", suggestions[0].(map[string]interface{})["name"])
+
+	_, responseData = sendRequest(t, app, http.MethodGet, "/v1/products/autocomplete?prefix=kebyoard")
+	assert.Empty(t, responseData["suggestions"])
+
+	_, responseData = sendRequest(t, app, http.MethodGet, "/v1/products/autocomplete?prefix=kebyoard&fuzzy=true&limit=1")
+
+	suggestions = responseData["suggestions"].([]interface{})
+
+	require.Len(t, suggestions, 1)
+	assert.Equal(t, "Keyboard", suggestions[0].(map[string]interface{})["name"])
+	assert.Equal(t, float64(1), suggestions[0].(map[string]interface{})["distance"])
+	assert.Equal(t, float64(2), responseData["max_distance"])
+
+	// Invalid requests
+	for _, query := range []string{"", "prefix=%20", "prefix=key&max_distance=1", "prefix=key&fuzzy=true&max_distance=4", "prefix=key&fuzzy=maybe", "prefix=key&limit=0"} {
+
+		resp, _ = sendRequest(t, app, http.MethodGet, "/v1/products/autocomplete?"+query)
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+}
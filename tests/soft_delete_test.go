@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sendRequest sends a request without a body and decodes the JSON answer
+func sendRequest(t *testing.T, app *fiber.App, method string, path string) (*http.Response, map[string]interface{}) {
+
+	req := httptest.NewRequest(method, path, nil)
+	resp, err := app.Test(req, -1)
+
+	require.NoError(t, err)
+
+	body, _ := io.ReadAll(resp.Body)
+
+	var responseData map[string]interface{}
+	_ = json.Unmarshal(body, &responseData)
+
+	return resp, responseData
+}
+
+func TestDeleteProduct_MovesToTrashAndRestores(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Trash_Laptop", data_layer.MustParseAmount("999"), "EUR")
+
+	// Act - Delete the product
+	resp, _ := sendRequest(t, app, http.MethodDelete, fmt.Sprintf("/delete-product/%d", productID))
+
+	// Assert - It is gone from the catalog but still in the trash
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = sendRequest(t, app, http.MethodGet, fmt.Sprintf("/retrieve-product/%d", productID))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, responseData := sendRequest(t, app, http.MethodGet, fmt.Sprintf("/retrieve-product/%d?include_deleted=true", productID))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotNil(t, responseData["deleted_at"])
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/retrieve-deleted-products")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(1), responseData["metadata"].(map[string]interface{})["total_number_of_products"])
+
+	// Act - Restore it
+	resp, _ = sendRequest(t, app, http.MethodPost, fmt.Sprintf("/restore-product/%d", productID))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Assert - Back in the catalog, out of the trash
+	resp, responseData = sendRequest(t, app, http.MethodGet, fmt.Sprintf("/retrieve-product/%d", productID))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, responseData["deleted_at"])
+
+	resp, _ = sendRequest(t, app, http.MethodPost, fmt.Sprintf("/restore-product/%d", productID))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestRetrieveProducts_IncludeDeleted(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	products.InsertProduct("Listed_Phone", data_layer.MustParseAmount("300"), "EUR")
+	deletedID, _ := products.InsertProduct("Listed_Tablet", data_layer.MustParseAmount("400"), "EUR")
+	products.DeleteProduct(int(deletedID), data_layer.AnyVersion)
+
+	// Act
+	_, live := sendRequest(t, app, http.MethodGet, "/retrieve-products")
+	_, all := sendRequest(t, app, http.MethodGet, "/retrieve-products?include_deleted=true")
+	resp, _ := sendRequest(t, app, http.MethodGet, "/retrieve-products?include_deleted=maybe")
+
+	// Assert
+	assert.Len(t, live["products"], 1)
+	assert.Len(t, all["products"], 2)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestDeleteProduct_ForcePurges(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Purged_Monitor", data_layer.MustParseAmount("250"), "EUR")
+
+	// Act
+	resp, responseData := sendRequest(t, app, http.MethodDelete, fmt.Sprintf("/delete-product/%d?force=true", productID))
+
+	// Assert - Nothing left to restore
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Product purged permanently from the products database", responseData["message"])
+
+	resp, _ = sendRequest(t, app, http.MethodGet, fmt.Sprintf("/retrieve-product/%d?include_deleted=true", productID))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = sendRequest(t, app, http.MethodPost, fmt.Sprintf("/restore-product/%d", productID))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestPurgeDeletedProducts_OlderThan(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Old_Trash", data_layer.MustParseAmount("5"), "EUR")
+	products.DeleteProduct(int(productID), data_layer.AnyVersion)
+
+	// Act - The product was deleted just now, so it is not older than a day
+	resp, responseData := sendRequest(t, app, http.MethodDelete, "/purge-deleted-products?older_than=24h")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(0), responseData["purged"])
+
+	resp, responseData = sendRequest(t, app, http.MethodDelete, "/purge-deleted-products")
+
+	// Assert
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(1), responseData["purged"])
+
+	_, err := products.RetrieveProduct(int(productID), true)
+	assert.Error(t, err)
+
+	resp, _ = sendRequest(t, app, http.MethodDelete, "/purge-deleted-products?older_than=yesterday")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
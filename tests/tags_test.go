@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTags_AddFilterAndCloud(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	shirtID, _ := products.InsertProduct("Tag_Shirt", data_layer.MustParseAmount("20"), "EUR")
+	bagID, _ := products.InsertProduct("Tag_Bag", data_layer.MustParseAmount("30"), "EUR")
+
+	// Act - Add tags
+	resp, responseData := sendJSON(t, app, http.MethodPost, fmt.Sprintf("/v1/products/%d/tags", shirtID), map[string]interface{}{"tags": []string{"Sale", "Eco Friendly"}})
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []interface{}{"eco friendly", "sale"}, responseData["tags"])
+
+	resp, _ = sendJSON(t, app, http.MethodPost, fmt.Sprintf("/v1/products/%d/tags", bagID), map[string]interface{}{"tags": []string{"sale"}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, fmt.Sprintf("/v1/products/%d/tags", bagID))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []interface{}{"sale"}, responseData["tags"])
+
+	// Act - Filter the list
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/products?tags=sale,eco%20friendly")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(2), responseData["metadata"].(map[string]interface{})["total_number_of_products"])
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/products?tags=SALE,eco%20friendly&tags_match=all")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(1), responseData["metadata"].(map[string]interface{})["total_number_of_products"])
+
+	// Act - Tag cloud
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/tags")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"tag": "sale", "count": float64(2)},
+		map[string]interface{}{"tag": "eco friendly", "count": float64(1)},
+	}, responseData["tags"])
+
+	// Act - Remove a tag with a space
+	resp, _ = sendRequest(t, app, http.MethodDelete, fmt.Sprintf("/v1/products/%d/tags/eco%%20friendly", shirtID))
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/tags?limit=5")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, responseData["tags"], 1)
+}
+
+func TestTags_Errors(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Tag_Shirt", data_layer.MustParseAmount("20"), "EUR")
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		payload interface{}
+		status  int
+	}{
+		{"no tags", http.MethodPost, fmt.Sprintf("/v1/products/%d/tags", productID), map[string]interface{}{"tags": []string{}}, http.StatusBadRequest},
+		{"invalid tag", http.MethodPost, fmt.Sprintf("/v1/products/%d/tags", productID), map[string]interface{}{"tags": []string{"a;b"}}, http.StatusBadRequest},
+		{"empty tag", http.MethodPost, fmt.Sprintf("/v1/products/%d/tags", productID), map[string]interface{}{"tags": []string{" "}}, http.StatusBadRequest},
+		{"missing product", http.MethodPost, "/v1/products/999/tags", map[string]interface{}{"tags": []string{"sale"}}, http.StatusNotFound},
+		{"invalid ID", http.MethodGet, "/v1/products/abc/tags", nil, http.StatusBadRequest},
+		{"missing tag", http.MethodDelete, fmt.Sprintf("/v1/products/%d/tags/sale", productID), nil, http.StatusNotFound},
+		{"invalid tags filter", http.MethodGet, "/v1/products?tags=a,,b", nil, http.StatusBadRequest},
+		{"invalid tags_match", http.MethodGet, "/v1/products?tags=a&tags_match=some", nil, http.StatusBadRequest},
+		{"invalid limit", http.MethodGet, "/v1/tags?limit=-1", nil, http.StatusBadRequest},
+	}
+
+	for _, testCase := range cases {
+
+		// Act
+		resp, _ := sendJSON(t, app, testCase.method, testCase.path, testCase.payload)
+
+		// Assert
+		assert.Equal(t, testCase.status, resp.StatusCode, testCase.name)
+	}
+}
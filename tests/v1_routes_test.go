@@ -0,0 +1,241 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"simpler-go-home-test/api"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sendJSON sends a JSON body and decodes the JSON answer
+func sendJSON(t *testing.T, app *fiber.App, method string, path string, payload interface{}) (*http.Response, map[string]interface{}) {
+
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+
+	require.NoError(t, err)
+
+	responseBody, _ := io.ReadAll(resp.Body)
+
+	var responseData map[string]interface{}
+	_ = json.Unmarshal(responseBody, &responseData)
+
+	return resp, responseData
+}
+
+func TestV1_CreateProduct(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	app := SetupAppWithRepository(data_layer.NewMemoryProductRepository())
+
+	// Act
+	resp, responseData := sendJSON(t, app, http.MethodPost, "/v1/products", map[string]interface{}{"name": "Resource_Laptop", "price": "1500.50"})
+
+	// Assert
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, fmt.Sprintf("/v1/products/%v", responseData["id"]), resp.Header.Get("Location"))
+	assert.Equal(t, `"1"`, resp.Header.Get("ETag"))
+	assert.Equal(t, "Resource_Laptop", responseData["name"])
+	assert.Equal(t, "EUR", responseData["currency"])
+	assert.Empty(t, resp.Header.Get("Deprecation"))
+
+	// The Location can be followed
+	location := resp.Header.Get("Location")
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, location)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Resource_Laptop", responseData["name"])
+
+	resp, _ = sendJSON(t, app, http.MethodPost, "/v1/products", map[string]interface{}{"name": "", "price": 10})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestV1_ListReplaceAndDeleteProduct(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Resource_Phone", data_layer.MustParseAmount("300"), "EUR")
+	products.InsertProduct("Resource_Tablet", data_layer.MustParseAmount("400"), "EUR")
+
+	// Act & Assert - List
+	resp, responseData := sendRequest(t, app, http.MethodGet, "/v1/products?page=1&limit=10")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, responseData["products"], 2)
+
+	// Replace every field
+	path := fmt.Sprintf("/v1/products/%d", productID)
+
+	resp, responseData = sendJSON(t, app, http.MethodPut, path, map[string]interface{}{"name": "Resource_Phone_Pro", "price": "329.90", "currency": "usd"})
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Resource_Phone_Pro", responseData["name"])
+	assert.Equal(t, 329.9, responseData["price"])
+	assert.Equal(t, "USD", responseData["currency"])
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+
+	resp, _ = sendJSON(t, app, http.MethodPut, path, map[string]interface{}{"name": "Resource_Phone_Free"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = sendJSON(t, app, http.MethodPut, "/v1/products/999999", map[string]interface{}{"name": "Missing", "price": 1, "currency": "EUR"})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Patch
+	req := httptest.NewRequest(http.MethodPatch, path, bytes.NewReader([]byte(`{"price": "319.90"}`)))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	resp, _ = app.Test(req, -1)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Delete answers 204 without a body
+	resp, _ = sendRequest(t, app, http.MethodDelete, path)
+
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Empty(t, body)
+
+	resp, _ = sendRequest(t, app, http.MethodDelete, path)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Restore it from the trash
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/deleted-products")
+	assert.Len(t, responseData["products"], 1)
+
+	resp, _ = sendRequest(t, app, http.MethodPost, path+"/restore")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestV1_ReplaceProductRequiresCurrency(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Resource_Headset", data_layer.MustParseAmount("120"), "USD")
+	path := fmt.Sprintf("/v1/products/%d", productID)
+
+	// Act
+	resp, responseData := sendJSON(t, app, http.MethodPut, path, map[string]interface{}{"name": "Resource_Headset_Pro", "price": "150"})
+
+	// Assert - Refused, rather than relabelling the dollars as euros
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, responseData["Error"], "currency is required")
+
+	product, err := products.RetrieveProduct(int(productID), false)
+
+	require.NoError(t, err)
+	assert.Equal(t, "USD", product.Currency)
+	assert.Equal(t, data_layer.MustParseAmount("120"), product.Price)
+
+	resp, responseData = sendJSON(t, app, http.MethodPut, path, map[string]interface{}{"name": "Resource_Headset_Pro", "price": "150", "currency": "USD"})
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "USD", responseData["currency"])
+}
+
+func TestV1_PricesAndExchangeRates(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Resource_Camera", data_layer.MustParseAmount("500"), "EUR")
+
+	// Act & Assert
+	resp, _ := sendJSON(t, app, http.MethodPut, fmt.Sprintf("/v1/products/%d/prices/usd", productID), map[string]interface{}{"price": "549.99"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, responseData := sendRequest(t, app, http.MethodGet, fmt.Sprintf("/v1/products/%d/prices", productID))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, responseData["prices"], 2)
+
+	resp, _ = sendRequest(t, app, http.MethodDelete, fmt.Sprintf("/v1/products/%d/prices/USD", productID))
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = sendJSON(t, app, http.MethodPut, "/v1/exchange-rates/EUR/GBP", map[string]interface{}{"rate": "0.85"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/exchange-rates")
+	assert.Len(t, responseData["exchange_rates"], 1)
+
+	resp, _ = sendRequest(t, app, http.MethodDelete, "/v1/exchange-rates/EUR/GBP")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = sendRequest(t, app, http.MethodDelete, "/v1/exchange-rates/EUR/GBP")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestLegacyRoutes_AreDeprecated(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Legacy_Monitor", data_layer.MustParseAmount("250"), "EUR")
+
+	// Act
+	resp, responseData := sendRequest(t, app, http.MethodGet, fmt.Sprintf("/retrieve-product/%d", productID))
+
+	// Assert - Still served as before, with the deprecation announced
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Legacy_Monitor", responseData["name"])
+	assert.Equal(t, fmt.Sprintf("@%d", api.LegacyRoutesDeprecatedAt.Unix()), resp.Header.Get("Deprecation"))
+	assert.Equal(t, "Fri, 30 Apr 2027 00:00:00 GMT", resp.Header.Get("Sunset"))
+	assert.Equal(t, fmt.Sprintf(`</v1/products/%d>; rel="successor-version"`, productID), resp.Header.Get("Link"))
+
+	resp, _ = sendJSON(t, app, http.MethodPost, "/insert-product", map[string]interface{}{"name": "Legacy_Keyboard", "price": 80})
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Deprecation"))
+	assert.Equal(t, `</v1/products>; rel="successor-version"`, resp.Header.Get("Link"))
+
+	// Routes taking the IDs in the body link the resource they change
+	resp, _ = sendJSON(t, app, http.MethodPut, "/update-product-name", map[string]interface{}{"id": productID, "name": "Legacy_Display"})
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, fmt.Sprintf(`</v1/products/%d>; rel="successor-version"`, productID), resp.Header.Get("Link"))
+
+	resp, _ = sendJSON(t, app, http.MethodPut, "/update-product-price", map[string]interface{}{"id": productID, "price": 260})
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, fmt.Sprintf(`</v1/products/%d>; rel="successor-version"`, productID), resp.Header.Get("Link"))
+
+	resp, _ = sendJSON(t, app, http.MethodPut, "/set-product-price", map[string]interface{}{"id": productID, "currency": "USD", "price": 280})
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, fmt.Sprintf(`</v1/products/%d/prices/USD>; rel="successor-version"`, productID), resp.Header.Get("Link"))
+
+	resp, _ = sendJSON(t, app, http.MethodPut, "/set-exchange-rate", map[string]interface{}{"base": "EUR", "quote": "GBP", "rate": 0.85})
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `</v1/exchange-rates/EUR/GBP>; rel="successor-version"`, resp.Header.Get("Link"))
+
+	// Without the IDs, the link stops at the collection
+	resp, _ = sendJSON(t, app, http.MethodPut, "/set-product-price", map[string]interface{}{"id": productID, "price": 280})
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, fmt.Sprintf(`</v1/products/%d/prices>; rel="successor-version"`, productID), resp.Header.Get("Link"))
+
+	// Errors carry the headers too
+	resp, _ = sendRequest(t, app, http.MethodDelete, "/delete-product/999999")
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Sunset"))
+}
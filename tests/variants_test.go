@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVariants_CRUDAndEmbedding(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Variant_Tee", data_layer.MustParseAmount("20"), "EUR")
+	productPath := fmt.Sprintf("/v1/products/%d", productID)
+
+	// Act - Create
+	resp, responseData := sendJSON(t, app, http.MethodPost, productPath+"/variants", map[string]interface{}{"sku": "tee-m-red", "options": map[string]string{"size": "M", "color": "red"}, "price_override": "24.90"})
+
+	// Assert
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "TEE-M-RED", responseData["sku"])
+	assert.Equal(t, map[string]interface{}{"size": "M", "color": "red"}, responseData["options"])
+	assert.Equal(t, 24.9, responseData["price"])
+	assert.Equal(t, "EUR", responseData["currency"])
+	assert.Equal(t, float64(0), responseData["available"])
+
+	variantPath := resp.Header.Get("Location")
+	require.Equal(t, fmt.Sprintf("%s/variants/%v", productPath, responseData["id"]), variantPath)
+
+	// Act - Replace without a price override
+	resp, responseData = sendJSON(t, app, http.MethodPut, variantPath, map[string]interface{}{"sku": "TEE-L-RED", "options": map[string]string{"size": "L", "color": "red"}})
+
+	// Assert - The variant is sold at the price of the product
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, responseData["price_override"])
+	assert.Equal(t, float64(20), responseData["price"])
+
+	// Act - Retrieve the product with and without its variants
+	resp, responseData = sendRequest(t, app, http.MethodGet, productPath)
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotContains(t, responseData, "variants")
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, productPath+"?include=variants")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	variants := responseData["variants"].([]interface{})
+	require.Len(t, variants, 1)
+	assert.Equal(t, "TEE-L-RED", variants[0].(map[string]interface{})["sku"])
+
+	// Act - Delete
+	resp, _ = sendRequest(t, app, http.MethodDelete, variantPath)
+
+	// Assert
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, productPath+"?include=variants")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []interface{}{}, responseData["variants"])
+}
+
+func TestVariants_Errors(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Variant_Cap", data_layer.MustParseAmount("15"), "EUR")
+	otherID, _ := products.InsertProduct("Variant_Scarf", data_layer.MustParseAmount("25"), "EUR")
+	variant, _ := products.CreateProductVariant(int(productID), data_layer.VariantSpec{SKU: "CAP-RED", Options: map[string]string{"color": "red"}})
+
+	variantsPath := fmt.Sprintf("/v1/products/%d/variants", productID)
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		payload interface{}
+		status  int
+	}{
+		{"duplicate options", http.MethodPost, variantsPath, map[string]interface{}{"sku": "CAP-RED-2", "options": map[string]string{"color": "Red"}}, http.StatusConflict},
+		{"duplicate SKU", http.MethodPost, fmt.Sprintf("/v1/products/%d/variants", otherID), map[string]interface{}{"sku": "cap-red", "options": map[string]string{"color": "red"}}, http.StatusConflict},
+		{"missing options", http.MethodPost, variantsPath, map[string]interface{}{"sku": "CAP-BLUE"}, http.StatusBadRequest},
+		{"missing SKU", http.MethodPost, variantsPath, map[string]interface{}{"options": map[string]string{"color": "blue"}}, http.StatusBadRequest},
+		{"stock on create", http.MethodPost, variantsPath, map[string]interface{}{"sku": "CAP-BLUE", "options": map[string]string{"color": "blue"}, "stock": 3}, http.StatusBadRequest},
+		{"stock on replace", http.MethodPut, fmt.Sprintf("%s/%d", variantsPath, variant.ID), map[string]interface{}{"sku": "CAP-RED", "options": map[string]string{"color": "red"}, "stock": 3}, http.StatusBadRequest},
+		{"zero price override", http.MethodPost, variantsPath, map[string]interface{}{"sku": "CAP-BLUE", "options": map[string]string{"color": "blue"}, "price_override": 0}, http.StatusBadRequest},
+		{"missing product", http.MethodPost, "/v1/products/999/variants", map[string]interface{}{"sku": "CAP-BLUE", "options": map[string]string{"color": "blue"}}, http.StatusNotFound},
+		{"variant of another product", http.MethodGet, fmt.Sprintf("/v1/products/%d/variants/%d", otherID, variant.ID), nil, http.StatusNotFound},
+		{"missing variant", http.MethodDelete, variantsPath + "/999", nil, http.StatusNotFound},
+		{"invalid variant ID", http.MethodGet, variantsPath + "/abc", nil, http.StatusBadRequest},
+		{"unknown include", http.MethodGet, fmt.Sprintf("/v1/products/%d?include=prices", productID), nil, http.StatusBadRequest},
+	}
+
+	for _, testCase := range cases {
+
+		// Act
+		resp, _ := sendJSON(t, app, testCase.method, testCase.path, testCase.payload)
+
+		// Assert
+		assert.Equal(t, testCase.status, resp.StatusCode, testCase.name)
+	}
+}
+
+func TestVariants_StockRoutes(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	productID, _ := products.InsertProduct("Variant_Boot", data_layer.MustParseAmount("80"), "EUR")
+	otherID, _ := products.InsertProduct("Variant_Sock", data_layer.MustParseAmount("5"), "EUR")
+	variant, _ := products.CreateProductVariant(int(productID), data_layer.VariantSpec{SKU: "BOOT-42", Options: map[string]string{"size": "42"}})
+
+	variantPath := fmt.Sprintf("/v1/products/%d/variants/%d", productID, variant.ID)
+
+	// Act - Receive units of the variant
+	resp, responseData := sendJSON(t, app, http.MethodPost, variantPath+"/stock/adjustments", map[string]interface{}{"delta": 5, "reason": "received"})
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(variant.ID), responseData["variant_id"])
+	assert.Equal(t, float64(5), responseData["available"])
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, fmt.Sprintf("/v1/products/%d/stock", productID))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotContains(t, responseData, "variant_id")
+	assert.Equal(t, float64(0), responseData["available"])
+
+	// Act - Hold some of them
+	resp, responseData = sendJSON(t, app, http.MethodPost, variantPath+"/stock/holds", map[string]interface{}{"hold_id": "order-1", "quantity": 2})
+
+	// Assert
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, float64(variant.ID), responseData["variant_id"])
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, variantPath)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(3), responseData["available"])
+
+	resp, responseData = sendRequest(t, app, http.MethodGet, variantPath+"/stock/movements")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, responseData["movements"], 1)
+
+	// Act - A variant holding stock cannot be deleted
+	resp, _ = sendRequest(t, app, http.MethodDelete, variantPath)
+
+	// Assert
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	for _, testCase := range []struct {
+		path   string
+		status int
+	}{
+		{fmt.Sprintf("/v1/products/%d/variants/%d/stock", otherID, variant.ID), http.StatusNotFound},
+		{fmt.Sprintf("/v1/products/%d/variants/999/stock", productID), http.StatusNotFound},
+		{fmt.Sprintf("/v1/products/%d/variants/abc/stock", productID), http.StatusBadRequest},
+	} {
+		resp, _ = sendRequest(t, app, http.MethodGet, testCase.path)
+		assert.Equal(t, testCase.status, resp.StatusCode, testCase.path)
+	}
+}
@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"simpler-go-home-test/data_layer"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarehouses_CRUD(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	// Act - Create
+	resp, responseData := sendJSON(t, app, http.MethodPost, "/v1/warehouses", map[string]interface{}{"code": " Athens ", "name": "Athens depot"})
+
+	// Assert
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "athens", responseData["code"])
+
+	warehousePath := resp.Header.Get("Location")
+	require.NotEmpty(t, warehousePath)
+
+	// Act - List, the default warehouse first
+	resp, responseData = sendRequest(t, app, http.MethodGet, "/v1/warehouses")
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	warehouses := responseData["warehouses"].([]interface{})
+	require.Len(t, warehouses, 2)
+	assert.Equal(t, data_layer.MainWarehouseCode, warehouses[0].(map[string]interface{})["code"])
+
+	// Act - Replace
+	resp, responseData = sendJSON(t, app, http.MethodPut, warehousePath, map[string]interface{}{"code": "ath", "name": "Athens central"})
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ath", responseData["code"])
+	assert.Equal(t, "Athens central", responseData["name"])
+
+	// Act - Delete
+	resp, _ = sendRequest(t, app, http.MethodDelete, warehousePath)
+
+	// Assert
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = sendRequest(t, app, http.MethodGet, warehousePath)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestWarehouses_TransferAndFilter(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	depot, _ := products.CreateWarehouse("depot", "Depot")
+	productID, _ := products.InsertProduct("Stock_Desk", data_layer.MustParseAmount("120"), "EUR")
+	products.InsertProduct("Stock_Empty", data_layer.MustParseAmount("10"), "EUR")
+	products.AdjustStock(int(productID), 0, 0, 6, data_layer.ReasonReceived)
+
+	stockPath := fmt.Sprintf("/v1/products/%d/stock", productID)
+
+	// Act
+	resp, responseData := sendJSON(t, app, http.MethodPost, stockPath+"/transfers", map[string]interface{}{"from_warehouse_id": 1, "to_warehouse_id": depot.ID, "quantity": 4})
+
+	// Assert - The totals stay, the warehouses share them
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(6), responseData["on_hand"])
+
+	warehouses := responseData["warehouses"].([]interface{})
+	require.Len(t, warehouses, 2)
+	assert.Equal(t, float64(2), warehouses[0].(map[string]interface{})["available"])
+	assert.Equal(t, float64(depot.ID), warehouses[1].(map[string]interface{})["warehouse_id"])
+	assert.Equal(t, float64(4), warehouses[1].(map[string]interface{})["available"])
+
+	// Act - Take one more unit out of the depot than it has
+	resp, _ = sendJSON(t, app, http.MethodPost, stockPath+"/adjustments", map[string]interface{}{"warehouse_id": depot.ID, "delta": -5, "reason": "lost"})
+
+	// Assert
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// Act - Filter the list
+	resp, responseData = sendRequest(t, app, http.MethodGet, fmt.Sprintf("/v1/products?in_stock=true&warehouse=%d", depot.ID))
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(1), responseData["metadata"].(map[string]interface{})["total_number_of_products"])
+
+	// The depot cannot go while it holds units
+	resp, _ = sendRequest(t, app, http.MethodDelete, fmt.Sprintf("/v1/warehouses/%d", depot.ID))
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestWarehouses_Errors(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	products := data_layer.NewMemoryProductRepository()
+	app := SetupAppWithRepository(products)
+
+	depot, _ := products.CreateWarehouse("depot", "Depot")
+	productID, _ := products.InsertProduct("Stock_Shelf", data_layer.MustParseAmount("60"), "EUR")
+	products.AdjustStock(int(productID), 0, 0, 1, data_layer.ReasonReceived)
+
+	transfersPath := fmt.Sprintf("/v1/products/%d/stock/transfers", productID)
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		payload interface{}
+		status  int
+	}{
+		{"duplicate code", http.MethodPost, "/v1/warehouses", map[string]interface{}{"code": "MAIN", "name": "Main again"}, http.StatusConflict},
+		{"missing code", http.MethodPost, "/v1/warehouses", map[string]interface{}{"name": "Nameless"}, http.StatusBadRequest},
+		{"code with spaces", http.MethodPost, "/v1/warehouses", map[string]interface{}{"code": "north depot", "name": "North"}, http.StatusBadRequest},
+		{"missing name", http.MethodPost, "/v1/warehouses", map[string]interface{}{"code": "north"}, http.StatusBadRequest},
+		{"missing warehouse", http.MethodGet, "/v1/warehouses/999", nil, http.StatusNotFound},
+		{"invalid ID", http.MethodGet, "/v1/warehouses/abc", nil, http.StatusBadRequest},
+		{"stocked warehouse", http.MethodDelete, "/v1/warehouses/1", nil, http.StatusConflict},
+		{"same warehouse", http.MethodPost, transfersPath, map[string]interface{}{"from_warehouse_id": 1, "to_warehouse_id": 1, "quantity": 1}, http.StatusBadRequest},
+		{"unknown warehouse", http.MethodPost, transfersPath, map[string]interface{}{"from_warehouse_id": 1, "to_warehouse_id": 999, "quantity": 1}, http.StatusNotFound},
+		{"not enough stock", http.MethodPost, transfersPath, map[string]interface{}{"from_warehouse_id": 1, "to_warehouse_id": depot.ID, "quantity": 2}, http.StatusConflict},
+		{"missing product", http.MethodPost, "/v1/products/999/stock/transfers", map[string]interface{}{"from_warehouse_id": 1, "to_warehouse_id": depot.ID, "quantity": 1}, http.StatusNotFound},
+		{"invalid in_stock", http.MethodGet, "/v1/products?in_stock=maybe", nil, http.StatusBadRequest},
+		{"invalid warehouse filter", http.MethodGet, "/v1/products?warehouse=0", nil, http.StatusBadRequest},
+	}
+
+	for _, testCase := range cases {
+
+		// Act
+		resp, _ := sendJSON(t, app, testCase.method, testCase.path, testCase.payload)
+
+		// Assert
+		assert.Equal(t, testCase.status, resp.StatusCode, testCase.name)
+	}
+}